@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	defaultInvitationDays     = 7
+	generatedPasswordNumBytes = 12
+)
+
+/*
+activate-user <email>
+*/
+func activateUser(args []string) error {
+	var (
+		err error
+	)
+
+	email := strings.TrimSpace(args[0])
+
+	if err = userService.ActivateUserByEmail(email); err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			return fmt.Errorf("no user with the email %s", email)
+		}
+
+		return err
+	}
+
+	fmt.Printf("%s is now active.\n", email)
+	return nil
+}
+
+/*
+reset-password <email>
+*/
+func resetPassword(args []string) error {
+	var (
+		err      error
+		user     *models.User
+		password string
+	)
+
+	email := strings.TrimSpace(args[0])
+
+	if user, err = userService.GetUserByEmail(email); err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			return fmt.Errorf("no user with the email %s", email)
+		}
+
+		return err
+	}
+
+	if password, err = generatePassword(); err != nil {
+		return err
+	}
+
+	if _, err = userService.UpdatePassword(user.ID.ID, password); err != nil {
+		return err
+	}
+
+	fmt.Printf("The password for %s was reset and they have been signed out.\n", email)
+	fmt.Printf("New password: %s\n", password)
+	return nil
+}
+
+/*
+invite <email> [days]
+*/
+func invite(args []string) error {
+	var (
+		err  error
+		code string
+	)
+
+	address := strings.TrimSpace(args[0])
+	days := defaultInvitationDays
+
+	if !email.IsValidEmailAddress(address) {
+		return fmt.Errorf("%q is not a valid email address", address)
+	}
+
+	if len(args) > 1 {
+		if days, err = parseID(args[1]); err != nil {
+			return fmt.Errorf("%q is not a valid number of days", args[1])
+		}
+	}
+
+	request := models.CreateRegistrationInvitationRequest{
+		Email:    address,
+		Lifetime: time.Hour * 24 * time.Duration(days),
+	}
+
+	if code, err = registrationInvitationService.CreateRegistrationInvitation(request); err != nil {
+		return err
+	}
+
+	signUpLink := fmt.Sprintf("%s/account/sign-up?invitation=%s", config.TLD, url.QueryEscape(code))
+
+	mailBody := fmt.Sprintf(`
+		<p>You're invited to keep track of your shows with Streaming Tracker!</p>
+		<p>To create your account, please click the following link:
+		<a href="%s">Sign Up</a>. If you're asked for an invitation code,
+		enter: %s</p>
+		<p>This invitation works once, and expires in %d days.</p>
+	`,
+		signUpLink,
+		code,
+		days,
+	)
+
+	err = emailService.Send(email.Mail{
+		Body:       mailBody,
+		BodyIsHtml: true,
+		From:       email.EmailAddress{Email: config.EmailFrom},
+		Subject:    "You're invited to Streaming Tracker",
+		To: []email.EmailAddress{
+			{
+				Email: fmt.Sprintf("%s <%s>", address, address),
+			},
+		},
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "The invitation was created, but couldn't be emailed: %s\n", err.Error())
+	} else {
+		fmt.Printf("Sent an invitation to %s.\n", address)
+	}
+
+	if config.RegistrationMode != configuration.RegistrationModeInviteOnly {
+		fmt.Fprintf(os.Stderr, "Note: the registration mode is %q, so sign ups don't ask for invitations.\n", config.RegistrationMode)
+	}
+
+	fmt.Printf("Sign up link: %s\n", signUpLink)
+	return nil
+}
+
+/*
+list-accounts
+*/
+func listAccounts(args []string) error {
+	var (
+		err      error
+		accounts []models.AccountSummary
+	)
+
+	if accounts, err = accountService.GetAccounts(); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tOWNER\tJOIN TOKEN\tMEMBERS\tWATCHERS\tSHOWS")
+
+	for _, account := range accounts {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\n",
+			account.ID,
+			account.OwnerEmail,
+			account.JoinToken,
+			account.NumMembers,
+			account.NumWatchers,
+			account.NumShows,
+		)
+	}
+
+	return w.Flush()
+}
+
+/*
+list-watchers <account ID>
+*/
+func listWatchers(args []string) error {
+	var (
+		err       error
+		accountID int
+		results   []*models.WatcherWithUserInfo
+	)
+
+	if accountID, err = parseID(args[0]); err != nil {
+		return err
+	}
+
+	if results, err = watcherService.GetWatchersWithUserInfo(accountID, 0); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tUSER\tOWNER")
+
+	for _, watcher := range results {
+		user := watcher.UserEmail
+
+		if user == "" {
+			user = "-"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\n", watcher.ID, watcher.Name, user, watcher.IsOwner)
+	}
+
+	return w.Flush()
+}
+
+/*
+regenerate-join-token <account ID>
+*/
+func regenerateJoinToken(args []string) error {
+	var (
+		err       error
+		accountID int
+		joinToken string
+	)
+
+	if accountID, err = parseID(args[0]); err != nil {
+		return err
+	}
+
+	if joinToken, err = accountService.RegenerateJoinToken(accountID); err != nil {
+		if errors.Is(err, identity.ErrAccountNotFound) {
+			return fmt.Errorf("no account with the ID %d", accountID)
+		}
+
+		return err
+	}
+
+	fmt.Printf("New join token for account %d: %s\n", accountID, joinToken)
+	return nil
+}
+
+func parseID(value string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(value))
+
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%q is not a valid ID", value)
+	}
+
+	return id, nil
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, generatedPasswordNumBytes)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating password: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
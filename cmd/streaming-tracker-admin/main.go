@@ -0,0 +1,232 @@
+/*
+streaming-tracker-admin runs administrative tasks against the Streaming
+Tracker database, such as activating a user whose activation email never
+arrived. It reads the same configuration as the web application, so the DSN
+can come from the DSN environment variable, a .env file, or the -dsn flag.
+The migrate command reads migration files from -migrationdir, or from
+sql-migrations in the current directory when it isn't set, as it is in the
+Docker image.
+
+	streaming-tracker-admin [flags] <command> [arguments]
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/migrations"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	Version string = "development"
+	config  configuration.Config
+
+	/* Services */
+	db                            *pgxpool.Pool
+	emailService                  email.MailServicer
+	accountService                identity.AccountServicer
+	migrationService              migrations.MigrationServicer
+	registrationInvitationService identity.RegistrationInvitationServicer
+	userService                   identity.UserServicer
+	watcherService                watchers.WatcherServicer
+)
+
+type command struct {
+	name        string
+	arguments   string
+	description string
+	minArgs     int
+	maxArgs     int
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:        "activate-user",
+		arguments:   "<email>",
+		description: "Activate a user without their activation code",
+		minArgs:     1,
+		maxArgs:     1,
+		run:         activateUser,
+	},
+	{
+		name:        "reset-password",
+		arguments:   "<email>",
+		description: "Set a new, random password for a user and sign them out everywhere",
+		minArgs:     1,
+		maxArgs:     1,
+		run:         resetPassword,
+	},
+	{
+		name:        "invite",
+		arguments:   "<email> [days]",
+		description: "Email someone a single use sign up invitation that expires in 7 days, or the given number of days",
+		minArgs:     1,
+		maxArgs:     2,
+		run:         invite,
+	},
+	{
+		name:        "list-accounts",
+		description: "List every account with its owner and join token",
+		run:         listAccounts,
+	},
+	{
+		name:        "list-watchers",
+		arguments:   "<account ID>",
+		description: "List the watchers in an account",
+		minArgs:     1,
+		maxArgs:     1,
+		run:         listWatchers,
+	},
+	{
+		name:        "migrate",
+		arguments:   "status|up|down [steps]",
+		description: "Show, apply, or roll back database migrations",
+		minArgs:     1,
+		maxArgs:     2,
+		run:         migrate,
+	},
+	{
+		name:        "regenerate-join-token",
+		arguments:   "<account ID>",
+		description: "Give an account a new join token. The old token stops working",
+		minArgs:     1,
+		maxArgs:     1,
+		run:         regenerateJoinToken,
+	},
+}
+
+func main() {
+	var (
+		err error
+		cmd *command
+	)
+
+	flag.Usage = usage
+	config = configuration.LoadConfig()
+	args := flag.Args()
+
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if cmd = findCommand(args[0]); cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+
+	if len(args)-1 < cmd.minArgs || len(args)-1 > cmd.maxArgs {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n", os.Args[0], cmd.name, cmd.arguments)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if db, err = pgxpool.New(ctx, config.DSN); err != nil {
+		fail(fmt.Errorf("error connecting to the database: %w", err))
+	}
+
+	defer db.Close()
+
+	if err = db.Ping(ctx); err != nil {
+		fail(fmt.Errorf("error connecting to the database: %w", err))
+	}
+
+	emailService = configuration.NewMailService(&config)
+
+	userService = identity.NewUserService(identity.UserServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	accountService = identity.NewAccountService(identity.AccountServiceConfig{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+		},
+	})
+
+	registrationInvitationService = identity.NewRegistrationInvitationService(identity.RegistrationInvitationServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	watcherService = watchers.NewWatcherService(watchers.WatcherServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	migrationDir := config.DataMigrationDir
+
+	if migrationDir == "" {
+		migrationDir = "sql-migrations"
+	}
+
+	migrationService = migrations.NewMigrationService(migrations.MigrationServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: time.Minute * 5,
+			DB:           db,
+		},
+		Source:                os.DirFS(migrationDir),
+		LegacyBaselineVersion: migrations.LegacyBaselineVersion,
+	})
+
+	if err = cmd.run(args[1:]); err != nil {
+		fail(err)
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "streaming-tracker-admin %s\n\n", Version)
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [arguments]\n\nCommands:\n", os.Args[0])
+
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-40s %s\n", cmd.name+" "+cmd.arguments, cmd.description)
+	}
+
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func fail(err error) {
+	if db != nil {
+		db.Close()
+	}
+
+	fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/adampresley/streaming-tracker/pkg/migrations"
+)
+
+/*
+migrate status|up|down [steps]
+*/
+func migrate(args []string) error {
+	switch args[0] {
+	case "status":
+		if len(args) > 1 {
+			return fmt.Errorf("migrate status doesn't take any arguments")
+		}
+
+		return migrateStatus()
+
+	case "up":
+		if len(args) > 1 {
+			return fmt.Errorf("migrate up doesn't take any arguments")
+		}
+
+		return migrateUp()
+
+	case "down":
+		steps := 1
+
+		if len(args) > 1 {
+			var err error
+
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("%q is not a valid number of migrations to roll back", args[1])
+			}
+		}
+
+		return migrateDown(steps)
+
+	default:
+		return fmt.Errorf("unknown migrate command %q. Use status, up, or down", args[0])
+	}
+}
+
+func migrateStatus() error {
+	var (
+		err      error
+		statuses []migrations.MigrationStatus
+	)
+
+	if statuses, err = migrationService.Status(); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tDOWN")
+
+	for _, status := range statuses {
+		state := "pending"
+		appliedAt := "-"
+		hasDown := "no"
+
+		switch {
+		case status.Missing:
+			state = "applied, file missing"
+		case status.ChecksumMismatch:
+			state = "applied, file changed"
+		case status.Baseline:
+			state = "baseline"
+		case status.Applied:
+			state = "applied"
+		}
+
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		if status.Down != "" {
+			hasDown = "yes"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt, hasDown)
+	}
+
+	return w.Flush()
+}
+
+func migrateUp() error {
+	var (
+		err     error
+		applied []migrations.Migration
+	)
+
+	applied, err = migrationService.Up()
+
+	for _, migration := range applied {
+		fmt.Printf("Applied %s\n", migration.Name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("The database is up to date.")
+	}
+
+	return nil
+}
+
+func migrateDown(steps int) error {
+	var (
+		err        error
+		rolledBack []migrations.Migration
+	)
+
+	rolledBack, err = migrationService.Down(steps)
+
+	for _, migration := range rolledBack {
+		fmt.Printf("Rolled back %s\n", migration.Name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(rolledBack) == 0 {
+		fmt.Println("There are no applied migrations to roll back.")
+	}
+
+	return nil
+}
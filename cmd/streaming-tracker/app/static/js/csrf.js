@@ -0,0 +1,75 @@
+/*
+ * Sends the CSRF token with every request that changes something. The
+ * token cookie is HttpOnly, so the token is fetched from the server once
+ * per page. HTMX and fetch requests send it in the X-CSRF-Token header.
+ * Regular forms get it in a hidden field. It goes first, since the server
+ * checks it before reading a file upload.
+ */
+const CSRF_FIELD_NAME = "csrf_token";
+const CSRF_HEADER_NAME = "X-CSRF-Token";
+const CSRF_TOKEN_URL = "/csrf-token";
+
+let csrfTokenValue = "";
+let csrfTokenLoaded = false;
+
+const csrfTokenReady = fetch(CSRF_TOKEN_URL, { credentials: "same-origin" })
+   .then((response) => response.json())
+   .then((result) => result.token || "")
+   .catch(() => "")
+   .then((token) => {
+      csrfTokenValue = token;
+      csrfTokenLoaded = true;
+      return token;
+   });
+
+function csrfToken() {
+   return csrfTokenValue;
+}
+
+/*
+ * Requests made before the token arrives wait for it. If it can't be
+ * fetched they go without, and the server says the page has expired.
+ */
+document.addEventListener("htmx:confirm", (e) => {
+   if (csrfTokenLoaded) {
+      return;
+   }
+
+   /*
+    * false still shows any hx-confirm question, without asking this
+    * handler again.
+    */
+   e.preventDefault();
+   csrfTokenReady.then(() => e.detail.issueRequest(false));
+});
+
+document.addEventListener("htmx:configRequest", (e) => {
+   e.detail.headers[CSRF_HEADER_NAME] = csrfToken();
+});
+
+document.addEventListener("submit", (e) => {
+   const form = e.target;
+   const submitter = e.submitter;
+   const method = (submitter?.getAttribute("formmethod") || form.getAttribute("method") || "get").toLowerCase();
+
+   if (method !== "post") {
+      return;
+   }
+
+   if (!csrfTokenLoaded) {
+      e.preventDefault();
+      csrfTokenReady.then(() => form.requestSubmit(submitter));
+      return;
+   }
+
+   let input = form.querySelector(`input[name="${CSRF_FIELD_NAME}"]`);
+
+   if (!input) {
+      input = document.createElement("input");
+      input.type = "hidden";
+      input.name = CSRF_FIELD_NAME;
+   }
+
+   input.value = csrfToken();
+   form.prepend(input);
+}, true);
@@ -0,0 +1,166 @@
+/*
+ * Passkey log in and registration. The server sends binary values as
+ * base64url strings, which are decoded before calling the WebAuthn API, and
+ * the browser's response is encoded the same way before it is sent back.
+ */
+document.addEventListener("DOMContentLoaded", () => {
+   const supported = !!window.PublicKeyCredential;
+
+   setupLogin(supported);
+   setupRegistration(supported);
+});
+
+function setupLogin(supported) {
+   const container = document.querySelector("#passkeyLogin");
+   const button = document.querySelector("#passkeyLoginBtn");
+   const messageEl = document.querySelector("#passkeyLoginMessage");
+
+   if (!container || !supported) {
+      return;
+   }
+
+   container.hidden = false;
+
+   button.addEventListener("click", async () => {
+      button.setAttribute("aria-busy", "true");
+      showMessage(messageEl, "");
+
+      try {
+         const options = await postJSON("/login/passkey/begin", {});
+         const credential = await navigator.credentials.get({
+            publicKey: {
+               ...options,
+               challenge: decode(options.challenge),
+               allowCredentials: options.allowCredentials.map(toDescriptor),
+            },
+         });
+
+         const result = await postJSON("/login/passkey/finish", {
+            id: credential.id,
+            rawId: encode(credential.rawId),
+            type: credential.type,
+            response: {
+               clientDataJSON: encode(credential.response.clientDataJSON),
+               authenticatorData: encode(credential.response.authenticatorData),
+               signature: encode(credential.response.signature),
+               userHandle: credential.response.userHandle ? encode(credential.response.userHandle) : "",
+            },
+         });
+
+         window.location = result.redirect;
+      } catch (e) {
+         showMessage(messageEl, errorMessage(e));
+      } finally {
+         button.removeAttribute("aria-busy");
+      }
+   });
+}
+
+function setupRegistration(supported) {
+   const form = document.querySelector("#addPasskeyForm");
+   const unsupportedEl = document.querySelector("#passkeyUnsupported");
+   const nameEl = document.querySelector("#passkeyName");
+   const submitEl = document.querySelector("#addPasskeySubmit");
+   const messageEl = document.querySelector("#passkeyMessage");
+
+   if (!form || !supported) {
+      return;
+   }
+
+   form.hidden = false;
+   unsupportedEl.hidden = true;
+
+   form.addEventListener("submit", async (e) => {
+      e.preventDefault();
+      submitEl.setAttribute("aria-busy", "true");
+      showMessage(messageEl, "");
+
+      try {
+         const options = await postJSON("/account/settings/passkeys/begin", {});
+         const credential = await navigator.credentials.create({
+            publicKey: {
+               ...options,
+               challenge: decode(options.challenge),
+               user: { ...options.user, id: decode(options.user.id) },
+               excludeCredentials: options.excludeCredentials.map(toDescriptor),
+            },
+         });
+
+         const result = await postJSON("/account/settings/passkeys/finish", {
+            name: nameEl.value,
+            credential: {
+               id: credential.id,
+               rawId: encode(credential.rawId),
+               type: credential.type,
+               response: {
+                  clientDataJSON: encode(credential.response.clientDataJSON),
+                  attestationObject: encode(credential.response.attestationObject),
+               },
+            },
+         });
+
+         window.location = result.redirect;
+      } catch (e) {
+         showMessage(messageEl, errorMessage(e));
+      } finally {
+         submitEl.removeAttribute("aria-busy");
+      }
+   });
+}
+
+async function postJSON(url, body) {
+   const token = await csrfTokenReady;
+
+   const response = await fetch(url, {
+      method: "POST",
+      headers: {
+         "Content-Type": "application/json",
+         [CSRF_HEADER_NAME]: token,
+      },
+      body: JSON.stringify(body),
+   });
+
+   const result = await response.json();
+
+   if (!response.ok) {
+      throw new Error(result.message || "Something went wrong. Please try again.");
+   }
+
+   return result;
+}
+
+/*
+ * The browser rejects with NotAllowedError when the user cancels or the
+ * request times out.
+ */
+function errorMessage(e) {
+   if (e.name === "NotAllowedError") {
+      return "The passkey request was cancelled or timed out.";
+   }
+
+   if (e.name === "InvalidStateError") {
+      return "That passkey is already registered.";
+   }
+
+   return e.message;
+}
+
+function showMessage(el, message) {
+   el.textContent = message;
+   el.hidden = message === "";
+}
+
+function toDescriptor(descriptor) {
+   return { ...descriptor, id: decode(descriptor.id) };
+}
+
+function decode(value) {
+   const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+   const padded = base64 + "=".repeat((4 - (base64.length % 4)) % 4);
+   return Uint8Array.from(atob(padded), (c) => c.charCodeAt(0)).buffer;
+}
+
+function encode(buffer) {
+   const binary = String.fromCharCode(...new Uint8Array(buffer));
+   return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/platforms"
+	"github.com/adampresley/streaming-tracker/pkg/shows"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
+)
+
+var (
+	//go:embed openapi.json
+	openAPIDocument []byte
+)
+
+type ApiHandlers interface {
+	OpenAPIDocument(w http.ResponseWriter, r *http.Request)
+	GetPlatforms(w http.ResponseWriter, r *http.Request)
+
+	AddShow(w http.ResponseWriter, r *http.Request)
+	AddSeason(w http.ResponseWriter, r *http.Request)
+	BackToWantToWatch(w http.ResponseWriter, r *http.Request)
+	CancelShow(w http.ResponseWriter, r *http.Request)
+	DeleteShow(w http.ResponseWriter, r *http.Request)
+	FindShowImage(w http.ResponseWriter, r *http.Request)
+	FinishSeason(w http.ResponseWriter, r *http.Request)
+	GetActiveShows(w http.ResponseWriter, r *http.Request)
+	GetFinishedShows(w http.ResponseWriter, r *http.Request)
+	GetShow(w http.ResponseWriter, r *http.Request)
+	MatchOnlineShow(w http.ResponseWriter, r *http.Request)
+	OnlineSearch(w http.ResponseWriter, r *http.Request)
+	SearchShows(w http.ResponseWriter, r *http.Request)
+	StartWatching(w http.ResponseWriter, r *http.Request)
+	UpdateShow(w http.ResponseWriter, r *http.Request)
+	UpdateShowProgress(w http.ResponseWriter, r *http.Request)
+
+	AddWatcher(w http.ResponseWriter, r *http.Request)
+	GetWatchers(w http.ResponseWriter, r *http.Request)
+	UpdateWatcherName(w http.ResponseWriter, r *http.Request)
+}
+
+type ApiControllerConfig struct {
+	Auth            auth2.Authenticator[*identity.UserSession]
+	Config          *configuration.Config
+	PlatformService platforms.PlatformServicer
+	ShowService     shows.ShowServicer
+	WatcherService  watchers.WatcherServicer
+}
+
+type ApiController struct {
+	base.BaseHandler
+
+	auth            auth2.Authenticator[*identity.UserSession]
+	config          *configuration.Config
+	platformService platforms.PlatformServicer
+	showService     shows.ShowServicer
+	watcherService  watchers.WatcherServicer
+}
+
+func NewApiController(config ApiControllerConfig) ApiController {
+	return ApiController{
+		auth:            config.Auth,
+		config:          config.Config,
+		platformService: config.PlatformService,
+		showService:     config.ShowService,
+		watcherService:  config.WatcherService,
+	}
+}
+
+/*
+GET /api/v1/openapi.json
+*/
+func (c ApiController) OpenAPIDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPIDocument)
+}
+
+/*
+GET /api/v1/platforms
+*/
+func (c ApiController) GetPlatforms(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		results []*models.Platform
+	)
+
+	if results, err = c.platformService.GetPlatforms(); err != nil {
+		slog.Error("error fetching platforms", "error", err)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+)
+
+/*
+BearerTokenMiddleware authenticates API requests that carry a personal
+access token in an "Authorization: Bearer" header. The token's user and
+account are put in the request context the same way a browser session is,
+so handlers don't need to know how the request was authenticated, and the
+user's role in the account is looked up like CurrentSessionMiddleware does
+for browsers. A token stops working when its user leaves the account.
+Requests without an Authorization header are passed to sessionMiddleware.
+
+Read scoped tokens may only be used for GET and HEAD requests.
+*/
+func BearerTokenMiddleware(apiTokenService identity.ApiTokenServicer, accountService identity.AccountServicer, sessionMiddleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withSession := sessionMiddleware(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				err      error
+				apiToken *models.ApiToken
+				role     models.AccountRole
+			)
+
+			authorization := strings.TrimSpace(r.Header.Get("Authorization"))
+
+			if authorization == "" {
+				withSession.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, token, _ := strings.Cut(authorization, " ")
+
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+				writeError(w, http.StatusUnauthorized, responsetypes.ErrorCodeInvalidToken, "The Authorization header must be in the form 'Bearer <token>'.")
+				return
+			}
+
+			if apiToken, err = apiTokenService.AuthenticateApiToken(strings.TrimSpace(token)); err != nil {
+				if errors.Is(err, identity.ErrInvalidApiToken) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					writeError(w, http.StatusUnauthorized, responsetypes.ErrorCodeInvalidToken, "The access token is invalid or has been revoked.")
+					return
+				}
+
+				slog.Error("error authenticating api token", "error", err)
+				writeError(w, http.StatusInternalServerError, responsetypes.ErrorCodeInternalError, "There was an unexpected error. Please try again later.")
+				return
+			}
+
+			if apiToken.Scope != models.ApiTokenScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="write"`)
+				writeError(w, http.StatusForbidden, responsetypes.ErrorCodeInsufficientScope, "This access token is read only.")
+				return
+			}
+
+			if role, err = accountService.GetMemberRole(apiToken.AccountID, apiToken.UserID); err != nil {
+				if errors.Is(err, identity.ErrAccountMemberNotFound) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					writeError(w, http.StatusUnauthorized, responsetypes.ErrorCodeInvalidToken, "The access token's user is no longer a member of its household.")
+					return
+				}
+
+				slog.Error("error fetching api token role", "error", err, "userID", apiToken.UserID, "accountID", apiToken.AccountID)
+				writeError(w, http.StatusInternalServerError, responsetypes.ErrorCodeInternalError, "There was an unexpected error. Please try again later.")
+				return
+			}
+
+			session := &identity.UserSession{
+				UserID:    apiToken.UserID,
+				Email:     apiToken.UserEmail,
+				AccountID: apiToken.AccountID,
+				Role:      role,
+			}
+
+			ctx := context.WithValue(r.Context(), "session", session)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
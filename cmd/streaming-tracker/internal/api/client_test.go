@@ -0,0 +1,649 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/api"
+	"github.com/adampresley/streaming-tracker/pkg/client"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/shows"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
+)
+
+const (
+	ownerToken   = "st_owner"
+	viewerToken  = "st_viewer"
+	readToken    = "st_read"
+	leftToken    = "st_left"
+	failureToken = "st_failure"
+
+	ownerID   = 1
+	viewerID  = 2
+	leftID    = 3
+	accountID = 10
+
+	erroringShowID = 999
+)
+
+var (
+	errDatabase = errors.New("database is down")
+)
+
+/*
+newTestServer runs the real API handlers and bearer token middleware
+against in-memory services, the same way main.go routes them.
+*/
+func newTestServer(t *testing.T) (*httptest.Server, *fakeShowService, *fakeWatcherService) {
+	t.Helper()
+
+	showService := &fakeShowService{shows: map[int]*fakeShow{}}
+	watcherService := &fakeWatcherService{
+		watchers: []*models.WatcherWithUserInfo{
+			{ID: 1, Name: "Adam", UserID: ownerID, IsOwner: true},
+			{ID: 2, Name: "Maryanne", UserID: viewerID},
+		},
+	}
+
+	controller := api.NewApiController(api.ApiControllerConfig{
+		Config:          &configuration.Config{PageSize: 20},
+		PlatformService: fakePlatformService{},
+		ShowService:     showService,
+		WatcherService:  watcherService,
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/", api.NotFound)
+	mux.HandleFunc("GET /api/v1/platforms", controller.GetPlatforms)
+	mux.HandleFunc("POST /api/v1/shows", controller.AddShow)
+	mux.HandleFunc("GET /api/v1/shows/{id}", controller.GetShow)
+	mux.HandleFunc("PUT /api/v1/shows/{id}", controller.UpdateShow)
+	mux.HandleFunc("DELETE /api/v1/shows/{id}", controller.DeleteShow)
+	mux.HandleFunc("POST /api/v1/shows/{id}/start-watching", controller.StartWatching)
+	mux.HandleFunc("GET /api/v1/watchers", controller.GetWatchers)
+	mux.HandleFunc("POST /api/v1/watchers", controller.AddWatcher)
+	mux.HandleFunc("PUT /api/v1/watchers/{id}", controller.UpdateWatcherName)
+
+	noSession := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			api.Unauthorized(w, r, nil)
+		})
+	}
+
+	server := httptest.NewServer(api.BearerTokenMiddleware(fakeApiTokenService{}, fakeAccountService{}, noSession)(mux))
+	t.Cleanup(server.Close)
+
+	return server, showService, watcherService
+}
+
+func newTestClient(server *httptest.Server, token string) client.Client {
+	return client.New(server.URL, token, client.WithHttpClient(server.Client()))
+}
+
+func TestClientTokenAuth(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	ctx := context.Background()
+
+	newShow := requesttypes.AddShowRequest{Name: "Severance", TotalSeasons: 2, PlatformID: 1, WatcherIDs: []int{1}}
+
+	tests := []struct {
+		name       string
+		token      string
+		call       func(c client.Client) error
+		wantErr    error
+		wantStatus int
+	}{
+		{
+			name:  "valid token can read",
+			token: ownerToken,
+			call: func(c client.Client) error {
+				_, err := c.GetPlatforms(ctx)
+				return err
+			},
+		},
+		{
+			name:  "member role from the account is used for writes",
+			token: ownerToken,
+			call: func(c client.Client) error {
+				_, err := c.AddShow(ctx, newShow)
+				return err
+			},
+		},
+		{
+			name:  "unknown token",
+			token: "st_nope",
+			call: func(c client.Client) error {
+				_, err := c.GetPlatforms(ctx)
+				return err
+			},
+			wantErr:    client.ErrUnauthorized,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:  "read scoped token can't write",
+			token: readToken,
+			call: func(c client.Client) error {
+				_, err := c.AddShow(ctx, newShow)
+				return err
+			},
+			wantErr:    client.ErrForbidden,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:  "read scoped token can read",
+			token: readToken,
+			call: func(c client.Client) error {
+				_, err := c.GetWatchersWithUserInfo(ctx)
+				return err
+			},
+		},
+		{
+			name:  "viewer can't write",
+			token: viewerToken,
+			call: func(c client.Client) error {
+				_, err := c.AddShow(ctx, newShow)
+				return err
+			},
+			wantErr:    client.ErrForbidden,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:  "token of someone who left the household",
+			token: leftToken,
+			call: func(c client.Client) error {
+				_, err := c.GetPlatforms(ctx)
+				return err
+			},
+			wantErr:    client.ErrUnauthorized,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:  "token lookup fails",
+			token: failureToken,
+			call: func(c client.Client) error {
+				_, err := c.GetPlatforms(ctx)
+				return err
+			},
+			wantErr:    client.ErrInternalError,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newTestClient(server, tt.token))
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			var apiErr *client.APIError
+
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an *client.APIError, got %T", err)
+			}
+
+			if apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, apiErr.StatusCode)
+			}
+		})
+	}
+}
+
+func TestClientErrorMapping(t *testing.T) {
+	server, showService, _ := newTestServer(t)
+	ctx := context.Background()
+	c := newTestClient(server, ownerToken)
+
+	watchedShowID, err := c.AddShow(ctx, requesttypes.AddShowRequest{Name: "Andor", TotalSeasons: 2, PlatformID: 1, WatcherIDs: []int{1}})
+
+	if err != nil {
+		t.Fatalf("error adding show: %v", err)
+	}
+
+	showService.shows[watchedShowID].watchedSeasons = 1
+
+	tests := []struct {
+		name        string
+		call        func() error
+		wantErr     error
+		wantCode    string
+		wantDetails int
+	}{
+		{
+			name: "show not found",
+			call: func() error {
+				_, err := c.GetShowByID(ctx, 404)
+				return err
+			},
+			wantErr:  client.ErrShowNotFound,
+			wantCode: responsetypes.ErrorCodeShowNotFound,
+		},
+		{
+			name: "show with watched seasons",
+			call: func() error {
+				return c.DeleteShow(ctx, watchedShowID)
+			},
+			wantErr:  client.ErrShowHasWatchedSeasons,
+			wantCode: responsetypes.ErrorCodeShowHasWatchedSeasons,
+		},
+		{
+			name: "watcher not found",
+			call: func() error {
+				return c.UpdateWatcherName(ctx, 404, "Nobody")
+			},
+			wantErr:  client.ErrWatcherNotFound,
+			wantCode: responsetypes.ErrorCodeWatcherNotFound,
+		},
+		{
+			name: "someone else's watcher",
+			call: func() error {
+				return c.UpdateWatcherName(ctx, 2, "Mary")
+			},
+			wantErr:  client.ErrForbidden,
+			wantCode: responsetypes.ErrorCodeForbidden,
+		},
+		{
+			name: "validation failure lists each problem",
+			call: func() error {
+				_, err := c.AddShow(ctx, requesttypes.AddShowRequest{PlatformID: 7, WatcherIDs: []int{1}})
+				return err
+			},
+			wantErr:     client.ErrValidationFailed,
+			wantCode:    responsetypes.ErrorCodeValidationFailed,
+			wantDetails: 3,
+		},
+		{
+			name: "unexpected server error",
+			call: func() error {
+				_, err := c.GetShowByID(ctx, erroringShowID)
+				return err
+			},
+			wantErr:  client.ErrInternalError,
+			wantCode: responsetypes.ErrorCodeInternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr *client.APIError
+
+			err := tt.call()
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an *client.APIError, got %T", err)
+			}
+
+			if apiErr.Code != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, apiErr.Code)
+			}
+
+			if len(apiErr.Details) != tt.wantDetails {
+				t.Errorf("expected %d details, got %v", tt.wantDetails, apiErr.Details)
+			}
+
+			for _, other := range []error{client.ErrNotFound, client.ErrBadRequest, client.ErrUnauthorized} {
+				if other != tt.wantErr && errors.Is(err, other) {
+					t.Errorf("error should not match %v", other)
+				}
+			}
+		})
+	}
+}
+
+func TestClientErrorFromProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	var apiErr *client.APIError
+
+	_, err := newTestClient(server, ownerToken).GetPlatforms(context.Background())
+
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *client.APIError, got %v", err)
+	}
+
+	if apiErr.StatusCode != http.StatusBadGateway || apiErr.Code != "" || apiErr.Message != "upstream unavailable" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+
+	if errors.Is(err, client.ErrInternalError) {
+		t.Errorf("an error without a code should not match a sentinel error")
+	}
+}
+
+func TestClientShowRoundTrip(t *testing.T) {
+	server, showService, _ := newTestServer(t)
+	ctx := context.Background()
+	c := newTestClient(server, ownerToken)
+
+	showID, err := c.AddShow(ctx, requesttypes.AddShowRequest{
+		Name:         "The Expanse",
+		TotalSeasons: 6,
+		PlatformID:   1,
+		WatcherIDs:   []int{1, 2},
+		PosterImage:  "https://example.com/expanse.jpg",
+	})
+
+	if err != nil {
+		t.Fatalf("error adding show: %v", err)
+	}
+
+	show, err := c.GetShowByID(ctx, showID)
+
+	if err != nil {
+		t.Fatalf("error getting show: %v", err)
+	}
+
+	if show.ID != showID || show.Name != "The Expanse" || show.NumSeasons != 6 || show.PlatformID != 1 || !slices.Equal(show.WatcherIds, []int{1, 2}) {
+		t.Errorf("unexpected show after adding: %+v", show)
+	}
+
+	err = c.UpdateShow(ctx, requesttypes.EditShowRequest{
+		ID:           showID,
+		Name:         "The Expanse (2015)",
+		TotalSeasons: 6,
+		PlatformID:   1,
+		WatcherIDs:   []int{1},
+	})
+
+	if err != nil {
+		t.Fatalf("error updating show: %v", err)
+	}
+
+	if show, err = c.GetShowByID(ctx, showID); err != nil {
+		t.Fatalf("error getting show: %v", err)
+	}
+
+	if show.Name != "The Expanse (2015)" || !slices.Equal(show.WatcherIds, []int{1}) {
+		t.Errorf("unexpected show after updating: %+v", show)
+	}
+
+	if err = c.StartWatching(ctx, showID); err != nil {
+		t.Fatalf("error starting show: %v", err)
+	}
+
+	if showService.shows[showID].status != "Watching" {
+		t.Errorf("expected the show to be Watching, got %q", showService.shows[showID].status)
+	}
+
+	if err = c.DeleteShow(ctx, showID); err != nil {
+		t.Fatalf("error deleting show: %v", err)
+	}
+
+	if _, err = c.GetShowByID(ctx, showID); !errors.Is(err, client.ErrShowNotFound) {
+		t.Errorf("expected ErrShowNotFound after deleting, got %v", err)
+	}
+}
+
+func TestClientWatcherRoundTrip(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	ctx := context.Background()
+	c := newTestClient(server, ownerToken)
+
+	watcher, err := c.CreateWatcherManual(ctx, "  Grandma  ")
+
+	if err != nil {
+		t.Fatalf("error creating watcher: %v", err)
+	}
+
+	if watcher.ID == 0 || watcher.Name != "Grandma" {
+		t.Errorf("unexpected watcher: %+v", watcher)
+	}
+
+	if err = c.UpdateWatcherName(ctx, watcher.ID, "Nana"); err != nil {
+		t.Fatalf("error renaming watcher: %v", err)
+	}
+
+	results, err := c.GetWatchersWithUserInfo(ctx)
+
+	if err != nil {
+		t.Fatalf("error getting watchers: %v", err)
+	}
+
+	names := []string{}
+
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+
+	if !slices.Equal(names, []string{"Adam", "Maryanne", "Nana"}) {
+		t.Errorf("unexpected watchers: %v", names)
+	}
+
+	if !results[0].IsOwner || results[0].UserID != ownerID {
+		t.Errorf("expected the first watcher to be the owner's: %+v", results[0])
+	}
+}
+
+/*
+Fakes. Each embeds the service interface so only the methods the tests
+call need to be written. Calling any other method panics.
+*/
+
+type fakeApiTokenService struct {
+	identity.ApiTokenServicer
+}
+
+func (s fakeApiTokenService) AuthenticateApiToken(token string) (*models.ApiToken, error) {
+	switch token {
+	case ownerToken:
+		return &models.ApiToken{UserID: ownerID, AccountID: accountID, Scope: models.ApiTokenScopeWrite}, nil
+	case viewerToken:
+		return &models.ApiToken{UserID: viewerID, AccountID: accountID, Scope: models.ApiTokenScopeWrite}, nil
+	case readToken:
+		return &models.ApiToken{UserID: ownerID, AccountID: accountID, Scope: models.ApiTokenScopeRead}, nil
+	case leftToken:
+		return &models.ApiToken{UserID: leftID, AccountID: accountID, Scope: models.ApiTokenScopeWrite}, nil
+	case failureToken:
+		return nil, errDatabase
+	}
+
+	return nil, identity.ErrInvalidApiToken
+}
+
+type fakeAccountService struct {
+	identity.AccountServicer
+}
+
+func (s fakeAccountService) GetMemberRole(accountID, userID int) (models.AccountRole, error) {
+	switch userID {
+	case ownerID:
+		return models.AccountRoleOwner, nil
+	case viewerID:
+		return models.AccountRoleViewer, nil
+	}
+
+	return "", identity.ErrAccountMemberNotFound
+}
+
+type fakePlatformService struct{}
+
+func (s fakePlatformService) GetPlatforms() ([]*models.Platform, error) {
+	return []*models.Platform{
+		{ID: models.ID{ID: 1}, Name: "Netflix", Icon: "netflix"},
+		{ID: models.ID{ID: 2}, Name: "Hulu", Icon: "hulu"},
+	}, nil
+}
+
+type fakeShow struct {
+	show           models.ShowForEdit
+	status         string
+	watchedSeasons int
+}
+
+type fakeShowService struct {
+	shows.ShowServicer
+
+	mu     sync.Mutex
+	nextID int
+	shows  map[int]*fakeShow
+}
+
+func (s *fakeShowService) AddShow(accountID int, req requesttypes.AddShowRequest, options ...services.TxOption) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+
+	s.shows[s.nextID] = &fakeShow{
+		show: models.ShowForEdit{
+			ID:          s.nextID,
+			Name:        req.Name,
+			NumSeasons:  req.TotalSeasons,
+			PlatformID:  req.PlatformID,
+			WatcherIds:  req.WatcherIDs,
+			PosterImage: req.PosterImage,
+		},
+		status: "Want To Watch",
+	}
+
+	return s.nextID, nil
+}
+
+func (s *fakeShowService) DeleteShow(accountID, showID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	show, ok := s.shows[showID]
+
+	if !ok {
+		return shows.ErrShowNotFound
+	}
+
+	if show.watchedSeasons > 0 {
+		return shows.ErrShowHasWatchedSeasons
+	}
+
+	delete(s.shows, showID)
+	return nil
+}
+
+func (s *fakeShowService) GetShowByID(accountID, showID int) (*models.ShowForEdit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if showID == erroringShowID {
+		return nil, errDatabase
+	}
+
+	show, ok := s.shows[showID]
+
+	if !ok {
+		return nil, shows.ErrShowNotFound
+	}
+
+	result := show.show
+	return &result, nil
+}
+
+func (s *fakeShowService) StartWatching(accountID, showID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	show, ok := s.shows[showID]
+
+	if !ok {
+		return shows.ErrShowNotFound
+	}
+
+	show.status = "Watching"
+	return nil
+}
+
+func (s *fakeShowService) UpdateShow(accountID int, req requesttypes.EditShowRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	show, ok := s.shows[req.ID]
+
+	if !ok {
+		return shows.ErrShowNotFound
+	}
+
+	show.show.Name = req.Name
+	show.show.NumSeasons = req.TotalSeasons
+	show.show.PlatformID = req.PlatformID
+	show.show.WatcherIds = req.WatcherIDs
+	show.show.PosterImage = req.PosterImage
+	return nil
+}
+
+type fakeWatcherService struct {
+	watchers.WatcherServicer
+
+	mu       sync.Mutex
+	watchers []*models.WatcherWithUserInfo
+}
+
+func (s *fakeWatcherService) CreateWatcherManual(accountID int, name string, options ...services.TxOption) (*models.Watcher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watcher := &models.WatcherWithUserInfo{ID: len(s.watchers) + 1, Name: name}
+	s.watchers = append(s.watchers, watcher)
+
+	return &models.Watcher{ID: models.ID{ID: watcher.ID}, Name: name}, nil
+}
+
+func (s *fakeWatcherService) GetWatchers(accountID int) ([]*models.Watcher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []*models.Watcher{}
+
+	for _, watcher := range s.watchers {
+		results = append(results, &models.Watcher{ID: models.ID{ID: watcher.ID}, Name: watcher.Name})
+	}
+
+	return results, nil
+}
+
+func (s *fakeWatcherService) GetWatchersWithUserInfo(accountID, currentUserID int) ([]*models.WatcherWithUserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.watchers), nil
+}
+
+func (s *fakeWatcherService) UpdateWatcherName(watcherID, accountID, currentUserID int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := slices.IndexFunc(s.watchers, func(w *models.WatcherWithUserInfo) bool { return w.ID == watcherID })
+
+	if index < 0 {
+		return watchers.ErrWatcherNotFound
+	}
+
+	if s.watchers[index].UserID != 0 && s.watchers[index].UserID != currentUserID {
+		return watchers.ErrPermissionDenied
+	}
+
+	s.watchers[index].Name = name
+	return nil
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+	"github.com/adampresley/streaming-tracker/pkg/shows"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
+)
+
+const (
+	maxRequestBodySize int64 = 1 << 20
+)
+
+/*
+writeJSON writes value with the given status code. httphelpers.WriteJson
+only sets the status for errors, which isn't enough for 201 responses.
+*/
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	var (
+		err error
+		b   []byte
+	)
+
+	if b, err = json.Marshal(value); err != nil {
+		slog.Error("error marshaling API response", "error", err)
+		writeError(w, http.StatusInternalServerError, responsetypes.ErrorCodeInternalError, "There was an unexpected error. Please try again later.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string, details ...string) {
+	b, _ := json.Marshal(responsetypes.ErrorResponse{
+		Error: responsetypes.ErrorDetail{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+/*
+writeServiceError maps errors returned by the services to an API error
+response. Anything that isn't a known sentinel error is a 500. Callers
+are expected to have logged unexpected errors already.
+*/
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, shows.ErrShowNotFound):
+		writeError(w, http.StatusNotFound, responsetypes.ErrorCodeShowNotFound, "Show not found.")
+
+	case errors.Is(err, shows.ErrShowHasWatchedSeasons):
+		writeError(w, http.StatusConflict, responsetypes.ErrorCodeShowHasWatchedSeasons, "Shows that have watched seasons cannot be deleted.")
+
+	case errors.Is(err, shows.ErrOnlineShowNotFound):
+		writeError(w, http.StatusNotFound, responsetypes.ErrorCodeOnlineShowNotFound, "No matching show was found on TVMaze.")
+
+	case errors.Is(err, watchers.ErrWatcherNotFound):
+		writeError(w, http.StatusNotFound, responsetypes.ErrorCodeWatcherNotFound, "Watcher not found.")
+
+	case errors.Is(err, watchers.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, responsetypes.ErrorCodeForbidden, "You don't have permission to edit this watcher.")
+
+	default:
+		writeError(w, http.StatusInternalServerError, responsetypes.ErrorCodeInternalError, "There was an unexpected error. Please try again later.")
+	}
+}
+
+/*
+writeForbidden answers requests that the caller's role in the household
+doesn't allow.
+*/
+func writeForbidden(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusForbidden, responsetypes.ErrorCodeForbidden, message)
+}
+
+func writeValidationError(w http.ResponseWriter, problems []string) {
+	writeError(w, http.StatusBadRequest, responsetypes.ErrorCodeValidationFailed, strings.Join(problems, " "), problems...)
+}
+
+/*
+readJSONBody decodes the request body into dest. When it returns false an
+error response has already been written.
+*/
+func readJSONBody(w http.ResponseWriter, r *http.Request, dest any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dest); err != nil {
+		writeError(w, http.StatusBadRequest, responsetypes.ErrorCodeBadRequest, "The request body is not valid JSON: "+err.Error())
+		return false
+	}
+
+	return true
+}
+
+/*
+Unauthorized is used by the authentication middleware for API routes so
+clients get a JSON error instead of a redirect to the login page.
+*/
+func Unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, http.StatusUnauthorized, responsetypes.ErrorCodeUnauthorized, "Authentication is required.")
+}
+
+/*
+InvalidCSRFToken answers API requests made with the web app's session that
+don't send the CSRF token. Requests with an access token don't need one.
+*/
+func InvalidCSRFToken(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, http.StatusForbidden, responsetypes.ErrorCodeForbidden, "Requests using a browser session must send the X-CSRF-Token header.")
+}
+
+/*
+NotFound answers requests for API routes that don't exist.
+*/
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, responsetypes.ErrorCodeNotFound, "The requested resource does not exist.")
+}
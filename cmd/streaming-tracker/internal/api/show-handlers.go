@@ -0,0 +1,539 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/paging"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/querymodels"
+	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+	"github.com/adampresley/streaming-tracker/pkg/shows"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+/*
+GET /api/v1/shows?page={page}&showName={name}&platform={id}&watcher={id}&sortBy={column}&sortDirection={asc|desc}
+*/
+func (c ApiController) SearchShows(w http.ResponseWriter, r *http.Request) {
+	var (
+		err          error
+		totalRecords int
+		showResults  []querymodels.Shows
+	)
+
+	session := c.GetSession(r)
+	page := max(httphelpers.GetFromRequest[int](r, "page"), 1)
+
+	showResults, totalRecords, err = c.showService.SearchShows(
+		session.AccountID,
+		shows.WithPage(page),
+		shows.WithShowName(httphelpers.GetFromRequest[string](r, "showName")),
+		shows.WithPlatform(httphelpers.GetFromRequest[int](r, "platform")),
+		shows.WithWatcher(httphelpers.GetFromRequest[int](r, "watcher")),
+		shows.WithSortBy(httphelpers.GetFromRequest[string](r, "sortBy")),
+		shows.WithSortDirection(httphelpers.GetFromRequest[string](r, "sortDirection")),
+	)
+
+	if err != nil {
+		slog.Error("error searching shows", "error", err, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	pageInfo := paging.Calculate(page, int64(totalRecords), c.config.PageSize)
+
+	writeJSON(w, http.StatusOK, responsetypes.PagedShows{
+		Shows:      toShowResponses(showResults),
+		Page:       pageInfo.Page,
+		NumPages:   pageInfo.TotalPages,
+		TotalCount: totalRecords,
+	})
+}
+
+/*
+GET /api/v1/shows/active?groupBy={status|watchers}
+*/
+func (c ApiController) GetActiveShows(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		showsData *orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, []models.ShowGroupedByStatusAndWatchers]]
+	)
+
+	session := c.GetSession(r)
+
+	switch httphelpers.GetFromRequest[string](r, "groupBy") {
+	case "", "status":
+		showsData, err = c.showService.GetActiveShowsGroupedByStatusAndWatchers(session.AccountID)
+
+	case "watchers":
+		showsData, err = c.showService.GetActiveShowsGroupedByWatchersAndStatus(session.AccountID)
+
+	default:
+		writeValidationError(w, []string{"groupBy must be either 'status' or 'watchers'."})
+		return
+	}
+
+	if err != nil {
+		slog.Error("error fetching active shows", "error", err, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, showsData)
+}
+
+/*
+GET /api/v1/shows/finished
+*/
+func (c ApiController) GetFinishedShows(w http.ResponseWriter, r *http.Request) {
+	var (
+		err         error
+		showResults []querymodels.Shows
+	)
+
+	session := c.GetSession(r)
+
+	if showResults, err = c.showService.GetFinishedShows(session.AccountID); err != nil {
+		slog.Error("error fetching finished shows", "error", err, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toShowResponses(showResults))
+}
+
+/*
+GET /api/v1/shows/{id}
+*/
+func (c ApiController) GetShow(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		show *models.ShowForEdit
+	)
+
+	session := c.GetSession(r)
+	showID := httphelpers.GetFromRequest[int](r, "id")
+
+	if show, err = c.showService.GetShowByID(session.AccountID, showID); err != nil {
+		slog.Error("error fetching show", "error", err, "showID", showID, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, show)
+}
+
+/*
+POST /api/v1/shows
+*/
+func (c ApiController) AddShow(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		req    requesttypes.AddShowRequest
+		showID int
+	)
+
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		writeForbidden(w, "Your role in this household can't change shows.")
+		return
+	}
+
+	if !readJSONBody(w, r, &req) {
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	problems := c.validateShow(session.AccountID, req.Name, req.TotalSeasons, req.PlatformID, req.WatcherIDs)
+
+	if req.WatchStatusID != 0 && !isValidWatchStatus(req.WatchStatusID) {
+		problems = append(problems, "watchStatusID must be 1 (Want To Watch), 2 (Watching), or 3 (Finished Watching).")
+	}
+
+	if req.CurrentSeason < 0 || req.CurrentSeason > req.TotalSeasons {
+		problems = append(problems, "currentSeason must be between 0 and totalSeasons.")
+	}
+
+	if len(problems) > 0 {
+		writeValidationError(w, problems)
+		return
+	}
+
+	if showID, err = c.showService.AddShow(session.AccountID, req); err != nil {
+		slog.Error("error creating new show", "error", err, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	slog.Info("new show added through the API", "showID", showID, "accountID", session.AccountID)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/shows/%d", showID))
+	writeJSON(w, http.StatusCreated, responsetypes.CreatedShow{ID: showID})
+}
+
+/*
+PUT /api/v1/shows/{id}
+*/
+func (c ApiController) UpdateShow(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		req requesttypes.EditShowRequest
+	)
+
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		writeForbidden(w, "Your role in this household can't change shows.")
+		return
+	}
+
+	if !readJSONBody(w, r, &req) {
+		return
+	}
+
+	req.ID = httphelpers.GetFromRequest[int](r, "id")
+	req.Name = strings.TrimSpace(req.Name)
+
+	if problems := c.validateShow(session.AccountID, req.Name, req.TotalSeasons, req.PlatformID, req.WatcherIDs); len(problems) > 0 {
+		writeValidationError(w, problems)
+		return
+	}
+
+	if err = c.showService.UpdateShow(session.AccountID, req); err != nil {
+		slog.Error("error updating show", "error", err, "showID", req.ID, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	c.writeShow(w, session.AccountID, req.ID)
+}
+
+/*
+PUT /api/v1/shows/{id}/progress
+*/
+func (c ApiController) UpdateShowProgress(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		req requesttypes.UpdateShowProgressRequest
+	)
+
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		writeForbidden(w, "Your role in this household can't change shows.")
+		return
+	}
+
+	if !readJSONBody(w, r, &req) {
+		return
+	}
+
+	req.ShowID = httphelpers.GetFromRequest[int](r, "id")
+	problems := []string{}
+
+	if !isValidWatchStatus(req.WatchStatusID) {
+		problems = append(problems, "watchStatusID must be 1 (Want To Watch), 2 (Watching), or 3 (Finished Watching).")
+	}
+
+	if req.CurrentSeason < 0 {
+		problems = append(problems, "currentSeason cannot be negative.")
+	}
+
+	if req.NumSeasons < 0 {
+		problems = append(problems, "numSeasons cannot be negative.")
+	}
+
+	if len(req.WatcherIDs) > 0 {
+		problems = append(problems, c.validateWatcherIDs(session.AccountID, req.WatcherIDs)...)
+	}
+
+	if len(problems) > 0 {
+		writeValidationError(w, problems)
+		return
+	}
+
+	if err = c.showService.UpdateShowProgress(session.AccountID, req); err != nil {
+		slog.Error("error updating show progress", "error", err, "showID", req.ShowID, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	c.writeShow(w, session.AccountID, req.ShowID)
+}
+
+/*
+DELETE /api/v1/shows/{id}
+*/
+func (c ApiController) DeleteShow(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	showID := httphelpers.GetFromRequest[int](r, "id")
+
+	if !session.Role.CanDeleteShows() {
+		writeForbidden(w, "Only the household owner can delete shows.")
+		return
+	}
+
+	if err = c.showService.DeleteShow(session.AccountID, showID); err != nil {
+		slog.Error("error deleting show", "error", err, "showID", showID, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+POST /api/v1/shows/{id}/start-watching
+*/
+func (c ApiController) StartWatching(w http.ResponseWriter, r *http.Request) {
+	c.changeShowStatus(w, r, "start watching", c.showService.StartWatching)
+}
+
+/*
+POST /api/v1/shows/{id}/finish-season
+*/
+func (c ApiController) FinishSeason(w http.ResponseWriter, r *http.Request) {
+	c.changeShowStatus(w, r, "finish season", c.showService.FinishSeason)
+}
+
+/*
+POST /api/v1/shows/{id}/add-season
+*/
+func (c ApiController) AddSeason(w http.ResponseWriter, r *http.Request) {
+	c.changeShowStatus(w, r, "add season", c.showService.AddSeason)
+}
+
+/*
+POST /api/v1/shows/{id}/cancel
+*/
+func (c ApiController) CancelShow(w http.ResponseWriter, r *http.Request) {
+	c.changeShowStatus(w, r, "cancel show", c.showService.CancelShow)
+}
+
+/*
+POST /api/v1/shows/{id}/back-to-want-to-watch
+*/
+func (c ApiController) BackToWantToWatch(w http.ResponseWriter, r *http.Request) {
+	c.changeShowStatus(w, r, "move show back to want to watch", c.showService.BackToWantToWatch)
+}
+
+/*
+GET /api/v1/online/shows?name={name}
+*/
+func (c ApiController) OnlineSearch(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		results []models.OnlineShowSearchResult
+	)
+
+	name := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "name"))
+
+	if name == "" {
+		writeValidationError(w, []string{"name is required."})
+		return
+	}
+
+	if results, err = c.showService.OnlineSearch(name, "US"); err != nil {
+		slog.Error("error searching for shows online", "error", err, "name", name)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+/*
+GET /api/v1/online/shows/image?name={name}
+*/
+func (c ApiController) FindShowImage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		imageURL string
+	)
+
+	name := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "name"))
+
+	if name == "" {
+		writeValidationError(w, []string{"name is required."})
+		return
+	}
+
+	if imageURL, err = c.showService.FindShowImageByName(name); err != nil {
+		slog.Error("error finding show image", "error", err, "name", name)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responsetypes.ShowImage{ImageURL: imageURL})
+}
+
+/*
+GET /api/v1/online/shows/match?title={title}&year={year}&imdbID={id}&tvdbID={id}
+*/
+func (c ApiController) MatchOnlineShow(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		match *models.OnlineShowMatch
+	)
+
+	title := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "title"))
+	imdbID := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "imdbID"))
+	tvdbID := httphelpers.GetFromRequest[int](r, "tvdbID")
+
+	if title == "" && imdbID == "" && tvdbID == 0 {
+		writeValidationError(w, []string{"One of title, imdbID, or tvdbID is required."})
+		return
+	}
+
+	if match, err = c.showService.MatchOnlineShow(title, httphelpers.GetFromRequest[int](r, "year"), imdbID, tvdbID); err != nil {
+		slog.Error("error matching show online", "error", err, "title", title)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, match)
+}
+
+/*
+changeShowStatus runs one of the single step status changes, such as
+finishing a season, and responds with the show.
+*/
+func (c ApiController) changeShowStatus(w http.ResponseWriter, r *http.Request, action string, change func(accountID, showID int) error) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	showID := httphelpers.GetFromRequest[int](r, "id")
+
+	if !session.Role.CanEditShows() {
+		writeForbidden(w, "Your role in this household can't change shows.")
+		return
+	}
+
+	if err = change(session.AccountID, showID); err != nil {
+		slog.Error("error trying to "+action, "error", err, "showID", showID, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	c.writeShow(w, session.AccountID, showID)
+}
+
+func (c ApiController) writeShow(w http.ResponseWriter, accountID, showID int) {
+	var (
+		err  error
+		show *models.ShowForEdit
+	)
+
+	if show, err = c.showService.GetShowByID(accountID, showID); err != nil {
+		slog.Error("error fetching show", "error", err, "showID", showID, "accountID", accountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, show)
+}
+
+/*
+validateShow checks the fields shared by adding and editing a show. The
+platform and watchers must exist, and the watchers must belong to the
+account.
+*/
+func (c ApiController) validateShow(accountID int, name string, totalSeasons, platformID int, watcherIDs []int) []string {
+	var (
+		err       error
+		platforms []*models.Platform
+	)
+
+	problems := []string{}
+
+	if name == "" {
+		problems = append(problems, "name is required.")
+	}
+
+	if totalSeasons < 1 {
+		problems = append(problems, "totalSeasons must be at least 1.")
+	}
+
+	if platforms, err = c.platformService.GetPlatforms(); err != nil {
+		slog.Error("error fetching platforms", "error", err)
+		return append(problems, "Platforms could not be checked. Please try again later.")
+	}
+
+	if !slices.ContainsFunc(platforms, func(p *models.Platform) bool { return p.ID.ID == platformID }) {
+		problems = append(problems, "platformID must be the ID of an existing platform.")
+	}
+
+	if len(watcherIDs) == 0 {
+		return append(problems, "At least one watcher is required.")
+	}
+
+	return append(problems, c.validateWatcherIDs(accountID, watcherIDs)...)
+}
+
+func (c ApiController) validateWatcherIDs(accountID int, watcherIDs []int) []string {
+	var (
+		err      error
+		watchers []*models.Watcher
+	)
+
+	if watchers, err = c.watcherService.GetWatchers(accountID); err != nil {
+		slog.Error("error fetching watchers", "error", err, "accountID", accountID)
+		return []string{"Watchers could not be checked. Please try again later."}
+	}
+
+	for _, watcherID := range watcherIDs {
+		if !slices.ContainsFunc(watchers, func(watcher *models.Watcher) bool { return watcher.ID.ID == watcherID }) {
+			return []string{fmt.Sprintf("Watcher %d does not exist.", watcherID)}
+		}
+	}
+
+	return []string{}
+}
+
+func isValidWatchStatus(watchStatusID int) bool {
+	return watchStatusID == models.WantToWatch || watchStatusID == models.Watching || watchStatusID == models.FinishedWatching
+}
+
+func toShowResponses(showResults []querymodels.Shows) []responsetypes.Show {
+	result := make([]responsetypes.Show, 0, len(showResults))
+
+	for _, s := range showResults {
+		show := responsetypes.Show{
+			ShowID:        s.ShowID,
+			ShowName:      s.ShowName,
+			NumSeasons:    s.NumSeasons,
+			PlatformName:  s.PlatformName,
+			PlatformIcon:  s.PlatformIcon,
+			Cancelled:     s.Cancelled,
+			WatchStatus:   s.WatchStatus,
+			CurrentSeason: s.CurrentSeason,
+			WatcherName:   s.WatcherName,
+			PosterImage:   s.PosterImage,
+		}
+
+		if s.DateCancelled.Valid {
+			show.DateCancelled = s.DateCancelled.Time.Format(time.RFC3339)
+		}
+
+		if s.FinishedAt.Valid {
+			show.FinishedAt = s.FinishedAt.Time.Format(time.RFC3339)
+		}
+
+		result = append(result, show)
+	}
+
+	return result
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+)
+
+/*
+GET /api/v1/watchers
+*/
+func (c ApiController) GetWatchers(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		results []*models.WatcherWithUserInfo
+	)
+
+	session := c.GetSession(r)
+
+	if results, err = c.watcherService.GetWatchersWithUserInfo(session.AccountID, session.UserID); err != nil {
+		slog.Error("error fetching watchers", "error", err, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	watchers := make([]responsetypes.Watcher, 0, len(results))
+
+	for _, watcher := range results {
+		watchers = append(watchers, responsetypes.Watcher{
+			ID:        watcher.ID,
+			Name:      watcher.Name,
+			UserID:    watcher.UserID,
+			UserEmail: watcher.UserEmail,
+			IsOwner:   watcher.IsOwner,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, watchers)
+}
+
+/*
+POST /api/v1/watchers
+*/
+func (c ApiController) AddWatcher(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		req     requesttypes.WatcherNameRequest
+		watcher *models.Watcher
+	)
+
+	session := c.GetSession(r)
+
+	if !session.Role.CanAddWatchers() {
+		writeForbidden(w, "Your role in this household can't add watchers.")
+		return
+	}
+
+	if !readJSONBody(w, r, &req) {
+		return
+	}
+
+	if req.Name = strings.TrimSpace(req.Name); req.Name == "" {
+		writeValidationError(w, []string{"name is required."})
+		return
+	}
+
+	if watcher, err = c.watcherService.CreateWatcherManual(session.AccountID, req.Name); err != nil {
+		slog.Error("error creating watcher", "error", err, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, responsetypes.Watcher{
+		ID:   watcher.ID.ID,
+		Name: watcher.Name,
+	})
+}
+
+/*
+PUT /api/v1/watchers/{id}
+*/
+func (c ApiController) UpdateWatcherName(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		req requesttypes.WatcherNameRequest
+	)
+
+	session := c.GetSession(r)
+	watcherID := httphelpers.GetFromRequest[int](r, "id")
+
+	if !readJSONBody(w, r, &req) {
+		return
+	}
+
+	if req.Name = strings.TrimSpace(req.Name); req.Name == "" {
+		writeValidationError(w, []string{"name is required."})
+		return
+	}
+
+	if err = c.watcherService.UpdateWatcherName(watcherID, session.AccountID, session.UserID, req.Name); err != nil {
+		slog.Error("error updating watcher name", "error", err, "watcherID", watcherID, "accountID", session.AccountID)
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
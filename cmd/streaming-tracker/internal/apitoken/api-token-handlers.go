@@ -0,0 +1,201 @@
+package apitoken
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/datetime"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	maxTokenNameLength = 100
+)
+
+type ApiTokenHandlers interface {
+	CreateApiTokenAction(w http.ResponseWriter, r *http.Request)
+	ManageApiTokensPage(w http.ResponseWriter, r *http.Request)
+	RevokeApiTokenAction(w http.ResponseWriter, r *http.Request)
+}
+
+type ApiTokenControllerConfig struct {
+	ApiTokenService identity.ApiTokenServicer
+	Auth            auth2.Authenticator[*identity.UserSession]
+	Config          *configuration.Config
+	Renderer        rendering.TemplateRenderer
+}
+
+type ApiTokenController struct {
+	base.BaseHandler
+
+	apiTokenService identity.ApiTokenServicer
+	auth            auth2.Authenticator[*identity.UserSession]
+	config          *configuration.Config
+	renderer        rendering.TemplateRenderer
+}
+
+func NewApiTokenController(config ApiTokenControllerConfig) ApiTokenController {
+	return ApiTokenController{
+		apiTokenService: config.ApiTokenService,
+		auth:            config.Auth,
+		config:          config.Config,
+		renderer:        config.Renderer,
+	}
+}
+
+/*
+GET /account/api-tokens
+*/
+func (c ApiTokenController) ManageApiTokensPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/account/api-tokens"
+	session := c.GetSession(r)
+
+	viewData := viewmodels.ManageApiTokens{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+		Tokens: []viewmodels.ApiTokenDisplay{},
+		Scope:  models.ApiTokenScopeRead,
+	}
+
+	if viewData.Tokens, err = c.getTokens(session.UserID, session.AccountID); err != nil {
+		slog.Error("error fetching api tokens", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /account/api-tokens/create
+*/
+func (c ApiTokenController) CreateApiTokenAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/account/api-tokens"
+	session := c.GetSession(r)
+
+	viewData := viewmodels.ManageApiTokens{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Tokens: []viewmodels.ApiTokenDisplay{},
+		Name:   strings.TrimSpace(httphelpers.GetFromRequest[string](r, "name")),
+		Scope:  httphelpers.GetFromRequest[string](r, "scope"),
+	}
+
+	switch {
+	case viewData.Name == "":
+		viewData.Message = "Please give your token a name so you can recognize it later."
+		viewData.IsError = true
+
+	case len(viewData.Name) > maxTokenNameLength:
+		viewData.Message = "Token names can't be longer than 100 characters."
+		viewData.IsError = true
+
+	default:
+		if viewData.NewToken, _, err = c.apiTokenService.CreateApiToken(session.UserID, session.AccountID, viewData.Name, viewData.Scope); err != nil {
+			viewData.IsError = true
+
+			if errors.Is(err, identity.ErrInvalidScope) {
+				viewData.Message = "Please choose whether the token can make changes."
+			} else {
+				slog.Error("error creating api token", "error", err, "userID", session.UserID)
+				viewData.Message = "There was an unexpected error creating your token. Please try again later."
+			}
+		} else {
+			slog.Info("api token created", "userID", session.UserID, "accountID", session.AccountID, "scope", viewData.Scope)
+			viewData.Message = "Your token was created. Copy it now. You won't be able to see it again."
+			viewData.Name = ""
+		}
+	}
+
+	if viewData.Tokens, err = c.getTokens(session.UserID, session.AccountID); err != nil {
+		slog.Error("error fetching api tokens", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /account/api-tokens/revoke
+*/
+func (c ApiTokenController) RevokeApiTokenAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	tokenID := httphelpers.GetFromRequest[int](r, "id")
+	message := "The token was revoked. Anything using it can no longer call the API."
+
+	if err = c.apiTokenService.RevokeApiToken(session.UserID, tokenID); err != nil {
+		if errors.Is(err, identity.ErrApiTokenNotFound) {
+			message = "That token doesn't exist or was already revoked."
+		} else {
+			slog.Error("error revoking api token", "error", err, "tokenID", tokenID, "userID", session.UserID)
+			message = "There was an unexpected error revoking the token. Please try again later."
+		}
+	} else {
+		slog.Info("api token revoked", "tokenID", tokenID, "userID", session.UserID)
+	}
+
+	http.Redirect(w, r, "/account/api-tokens?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+func (c ApiTokenController) getTokens(userID, accountID int) ([]viewmodels.ApiTokenDisplay, error) {
+	var (
+		err    error
+		tokens []models.ApiToken
+	)
+
+	result := []viewmodels.ApiTokenDisplay{}
+
+	if tokens, err = c.apiTokenService.GetApiTokens(userID, accountID); err != nil {
+		return result, err
+	}
+
+	for _, token := range tokens {
+		display := viewmodels.ApiTokenDisplay{
+			ID:          token.ID,
+			Name:        token.Name,
+			TokenPrefix: token.TokenPrefix,
+			Scope:       token.Scope,
+			CreatedAt:   datetime.DisplayDate(token.CreatedAt),
+			LastUsedAt:  "Never",
+			IsRevoked:   token.RevokedAt != nil,
+		}
+
+		if token.LastUsedAt != nil {
+			display.LastUsedAt = datetime.DisplayDateTime(*token.LastUsedAt)
+		}
+
+		if token.RevokedAt != nil {
+			display.RevokedAt = datetime.DisplayDate(*token.RevokedAt)
+		}
+
+		result = append(result, display)
+	}
+
+	return result, nil
+}
@@ -1,8 +1,10 @@
 package base
 
 import (
+	"html/template"
 	"net/http"
 
+	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/streaming-tracker/pkg/identity"
 )
 
@@ -13,3 +15,13 @@ func (h BaseHandler) GetSession(r *http.Request) *identity.UserSession {
 	session, _ := r.Context().Value("session").(*identity.UserSession)
 	return session
 }
+
+/*
+GetMessage returns the message passed to a page in its query string, as
+plain text. Anyone can put anything in a link, so it is never trusted as
+HTML. Messages built by the handler itself are set on the view model
+directly.
+*/
+func (h BaseHandler) GetMessage(r *http.Request) template.HTML {
+	return template.HTML(template.HTMLEscapeString(httphelpers.GetFromRequest[string](r, "message")))
+}
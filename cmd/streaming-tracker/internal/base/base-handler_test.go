@@ -0,0 +1,50 @@
+package base_test
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+)
+
+func TestGetMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    template.HTML
+	}{
+		{
+			name:    "no message",
+			message: "",
+			want:    "",
+		},
+		{
+			name:    "plain text is unchanged",
+			message: "Your password was changed. Please log in with your new password.",
+			want:    "Your password was changed. Please log in with your new password.",
+		},
+		{
+			name:    "markup is escaped",
+			message: `<script>alert("hi")</script>`,
+			want:    "&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;",
+		},
+		{
+			name:    "user input in a message is escaped",
+			message: "We sent an invitation to <img src=x onerror=alert(1)>@example.com.",
+			want:    "We sent an invitation to &lt;img src=x onerror=alert(1)&gt;@example.com.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/login?message="+url.QueryEscape(tt.message), nil)
+
+			if got := (base.BaseHandler{}).GetMessage(r); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -9,8 +9,8 @@ import (
 	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/adamgokit/rendering"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
-	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/configuration"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
 	"github.com/adampresley/streaming-tracker/pkg/identity"
 	"github.com/adampresley/streaming-tracker/pkg/models"
 	"github.com/adampresley/streaming-tracker/pkg/shows"
@@ -83,7 +83,8 @@ func (c HomeController) HomePage(w http.ResponseWriter, r *http.Request) {
 			IsHtmx:  httphelpers.IsHtmx(r),
 			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
 		},
-		Shows: []viewmodels.DashboardShow{},
+		Shows:        []viewmodels.DashboardShow{},
+		CanEditShows: session.Role.CanEditShows(),
 	}
 
 	if shows, err = c.showService.GetActiveShowsGroupedByWatchersAndStatus(session.AccountID); err != nil {
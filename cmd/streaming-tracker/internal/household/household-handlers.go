@@ -0,0 +1,724 @@
+package household
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/clientip"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/datetime"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/useragent"
+)
+
+const (
+	accountInvitationLifetime = time.Hour * 24 * 7
+	maxSecurityLogEvents      = 200
+)
+
+type HouseholdHandlers interface {
+	AccountSwitcher(w http.ResponseWriter, r *http.Request)
+	HouseholdPage(w http.ResponseWriter, r *http.Request)
+	InviteAction(w http.ResponseWriter, r *http.Request)
+	JoinAction(w http.ResponseWriter, r *http.Request)
+	LeaveAction(w http.ResponseWriter, r *http.Request)
+	RemoveMemberAction(w http.ResponseWriter, r *http.Request)
+	RevokeInvitationAction(w http.ResponseWriter, r *http.Request)
+	RotateJoinTokenAction(w http.ResponseWriter, r *http.Request)
+	SecurityLogPage(w http.ResponseWriter, r *http.Request)
+	SetMemberRoleAction(w http.ResponseWriter, r *http.Request)
+	SwitchAccountAction(w http.ResponseWriter, r *http.Request)
+	TransferOwnershipAction(w http.ResponseWriter, r *http.Request)
+}
+
+type HouseholdControllerConfig struct {
+	AccountInvitationService identity.AccountInvitationServicer
+	AccountService           identity.AccountServicer
+	AuditService             audit.AuditServicer
+	Auth                     auth2.Authenticator[*identity.UserSession]
+	Config                   *configuration.Config
+	EmailService             email.MailServicer
+	LoginThrottleService     identity.LoginThrottleServicer
+	Renderer                 rendering.TemplateRenderer
+	UserService              identity.UserServicer
+}
+
+type HouseholdController struct {
+	base.BaseHandler
+
+	accountInvitationService identity.AccountInvitationServicer
+	accountService           identity.AccountServicer
+	auditService             audit.AuditServicer
+	auth                     auth2.Authenticator[*identity.UserSession]
+	config                   *configuration.Config
+	emailService             email.MailServicer
+	loginThrottleService     identity.LoginThrottleServicer
+	renderer                 rendering.TemplateRenderer
+	userService              identity.UserServicer
+}
+
+func NewHouseholdController(config HouseholdControllerConfig) HouseholdController {
+	return HouseholdController{
+		accountInvitationService: config.AccountInvitationService,
+		accountService:           config.AccountService,
+		auditService:             config.AuditService,
+		auth:                     config.Auth,
+		config:                   config.Config,
+		emailService:             config.EmailService,
+		loginThrottleService:     config.LoginThrottleService,
+		renderer:                 config.Renderer,
+		userService:              config.UserService,
+	}
+}
+
+/*
+GET /account/household
+*/
+func (c HouseholdController) HouseholdPage(w http.ResponseWriter, r *http.Request) {
+	viewData := viewmodels.Household{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+		AccountCode: httphelpers.GetFromRequest[string](r, "accountCode"),
+	}
+
+	c.render(w, r, viewData)
+}
+
+/*
+GET /account/switcher
+*/
+func (c HouseholdController) AccountSwitcher(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		accounts []models.AccountMembership
+	)
+
+	session := c.GetSession(r)
+
+	viewData := viewmodels.AccountSwitcher{
+		CurrentAccountID: session.AccountID,
+		Accounts:         []viewmodels.AccountSwitcherOption{},
+	}
+
+	if accounts, err = c.accountService.GetUserAccounts(session.UserID); err != nil {
+		slog.Error("error fetching accounts for switcher", "error", err, "userID", session.UserID)
+	}
+
+	for _, account := range accounts {
+		label := "My household"
+
+		if !account.IsOwner {
+			label = fmt.Sprintf("%s's household", account.OwnerEmail)
+		}
+
+		viewData.Accounts = append(viewData.Accounts, viewmodels.AccountSwitcherOption{
+			AccountID: account.AccountID,
+			Label:     label,
+		})
+	}
+
+	c.renderer.Render("components/account-switcher", viewData, w)
+}
+
+/*
+POST /account/switch
+*/
+func (c HouseholdController) SwitchAccountAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	accountID := httphelpers.GetFromRequest[int](r, "accountID")
+
+	if err = c.accountService.SwitchAccount(session.UserID, accountID); err != nil {
+		message := "There was an unexpected error switching households. Please try again later."
+
+		if errors.Is(err, identity.ErrAccountMemberNotFound) {
+			message = "You don't belong to that household."
+		} else {
+			slog.Error("error switching account", "error", err, "userID", session.UserID, "accountID", accountID)
+		}
+
+		c.redirect(w, r, message)
+		return
+	}
+
+	session.AccountID = accountID
+
+	if err = c.auth.SaveSession(w, r, session); err != nil {
+		slog.Error("error saving session after switching account", "error", err, "userID", session.UserID)
+		c.redirect(w, r, "There was an unexpected error switching households. Please try again later.")
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+/*
+POST /account/household/join
+*/
+func (c HouseholdController) JoinAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err         error
+		accountID   int
+		lockedUntil time.Time
+	)
+
+	session := c.GetSession(r)
+	accountCode := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "accountCode"))
+	throttleKeys := identity.JoinCodeThrottleKeys(clientip.FromRequest(r, c.config.TrustProxyHeaders), session.UserID)
+
+	viewData := viewmodels.Household{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		AccountCode: accountCode,
+	}
+
+	if lockedUntil, err = c.loginThrottleService.GetLoginLockout(throttleKeys...); err != nil {
+		slog.Error("error checking account code lockout", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error joining the household. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	if !lockedUntil.IsZero() {
+		viewData.Message = "Too many wrong codes. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	/*
+	 * The code is either an invitation sent to this user, or a household's
+	 * account code.
+	 */
+	accountID, err = c.accountInvitationService.AcceptAccountInvitation(accountCode, session.UserID)
+
+	if errors.Is(err, identity.ErrInvalidAccountInvitation) {
+		accountID, err = c.accountService.JoinAccountByJoinToken(accountCode, session.UserID)
+	}
+
+	if err != nil {
+		viewData.IsError = true
+
+		switch {
+		case errors.Is(err, identity.ErrAccountNotFound):
+			c.recordWrongJoinCode(throttleKeys)
+			viewData.Message = "That code doesn't match a household, or has expired."
+		case errors.Is(err, identity.ErrAccountInvitationEmail):
+			viewData.Message = "That invitation was sent to a different email address. Log in with that address to accept it."
+		case errors.Is(err, identity.ErrAlreadyAccountMember):
+			viewData.Message = "You already belong to that household."
+		default:
+			slog.Error("error joining account", "error", err, "userID", session.UserID)
+			viewData.Message = "There was an unexpected error joining the household. Please try again later."
+		}
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	slog.Info("user joined account", "userID", session.UserID, "accountID", accountID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, AccountID: &accountID, EventType: models.AuditEventHouseholdJoined})
+
+	if err = c.accountService.SwitchAccount(session.UserID, accountID); err != nil {
+		slog.Error("error switching to joined account", "error", err, "userID", session.UserID, "accountID", accountID)
+		c.redirect(w, r, "You joined the household, but we couldn't switch you to it. Choose it from the menu.")
+		return
+	}
+
+	session.AccountID = accountID
+
+	if err = c.auth.SaveSession(w, r, session); err != nil {
+		slog.Error("error saving session after joining account", "error", err, "userID", session.UserID)
+	}
+
+	c.redirect(w, r, "You joined the household. Switch between your households from the menu.")
+}
+
+/*
+POST /account/household/invite
+*/
+func (c HouseholdController) InviteAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		token string
+	)
+
+	session := c.GetSession(r)
+
+	viewData := viewmodels.Household{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Email: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "email")),
+	}
+
+	if !email.IsValidEmailAddress(viewData.Email) {
+		viewData.Message = "The email address you provided appears to be invalid."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	if _, err = c.userService.GetUserByEmail(viewData.Email, identity.WithMembershipInAccount(session.AccountID)); err == nil {
+		viewData.Message = "Someone with that email address is already in your household."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	} else if !errors.Is(err, identity.ErrUserNotFound) {
+		slog.Error("error checking for an existing member to invite", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error sending the invitation. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	/*
+	 * Someone who already has an account joins from their household page
+	 * instead of signing up.
+	 */
+	hasAccount := true
+
+	if _, err = c.userService.GetUserByEmail(viewData.Email); errors.Is(err, identity.ErrUserNotFound) {
+		hasAccount = false
+	} else if err != nil {
+		slog.Error("error checking for an existing user to invite", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error sending the invitation. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	request := models.CreateAccountInvitationRequest{
+		AccountID: session.AccountID,
+		Email:     viewData.Email,
+		InvitedBy: session.UserID,
+		Lifetime:  accountInvitationLifetime,
+	}
+
+	if token, err = c.accountInvitationService.CreateAccountInvitation(request); err != nil {
+		viewData.IsError = true
+
+		if errors.Is(err, identity.ErrNotAccountOwner) {
+			viewData.Message = "Only the account owner can invite people to the household."
+		} else {
+			slog.Error("error creating account invitation", "error", err, "userID", session.UserID, "accountID", session.AccountID)
+			viewData.Message = "There was an unexpected error sending the invitation. Please try again later."
+		}
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	joinLink := fmt.Sprintf("%s/account/sign-up?accountCode=%s", c.config.TLD, url.QueryEscape(token))
+	joinInstructions := "To create your account and join"
+
+	if hasAccount {
+		joinLink = fmt.Sprintf("%s/account/household?accountCode=%s", c.config.TLD, url.QueryEscape(token))
+		joinInstructions = "To join using your existing account"
+	}
+
+	mailBody := fmt.Sprintf(`
+		<p>%s invited you to join their household on Streaming Tracker, so you can keep track of the shows you watch together!</p>
+		<p>%s, please click the following link:
+		<a href="%s">Join Household</a>. If you're asked for an account code,
+		enter: %s</p>
+		<p>This invitation works once, only with this email address, and expires in 7 days.</p>
+	`,
+		template.HTMLEscapeString(session.Email),
+		joinInstructions,
+		joinLink,
+		token,
+	)
+
+	err = c.emailService.Send(email.Mail{
+		Body:       mailBody,
+		BodyIsHtml: true,
+		From:       email.EmailAddress{Email: c.config.EmailFrom},
+		Subject:    "You're invited to join a household on Streaming Tracker",
+		To: []email.EmailAddress{
+			{
+				Email: fmt.Sprintf("%s <%s>", viewData.Email, viewData.Email),
+			},
+		},
+	})
+
+	if err != nil {
+		slog.Error("failed to send account invitation", "error", err, "userID", session.UserID)
+		c.redirect(w, r, "The invitation was created, but we couldn't email it. Revoke it and try again later.")
+		return
+	}
+
+	slog.Info("account invitation sent", "userID", session.UserID, "accountID", session.AccountID)
+	c.redirect(w, r, fmt.Sprintf("We sent an invitation to %s.", viewData.Email))
+}
+
+/*
+POST /account/household/leave
+*/
+func (c HouseholdController) LeaveAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		detached *models.DetachedMember
+	)
+
+	session := c.GetSession(r)
+
+	if detached, err = c.accountService.LeaveAccount(session.AccountID, session.UserID); err != nil {
+		message := "There was an unexpected error leaving the household. Please try again later."
+
+		if errors.Is(err, identity.ErrOwnerCannotLeave) {
+			message = "You own this household. Make someone else the owner before you leave."
+		} else {
+			slog.Error("error leaving account", "error", err, "userID", session.UserID, "accountID", session.AccountID)
+		}
+
+		c.redirect(w, r, message)
+		return
+	}
+
+	slog.Info("user left account", "userID", session.UserID, "accountID", session.AccountID, "newAccountID", detached.AccountID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, AccountID: &session.AccountID, EventType: models.AuditEventHouseholdLeft})
+
+	/*
+	 * Keep this session, in the household the user was moved to.
+	 */
+	session.AccountID = detached.AccountID
+
+	if err = c.auth.SaveSession(w, r, session); err != nil {
+		slog.Error("error saving session after leaving account", "error", err, "userID", session.UserID)
+	}
+
+	c.redirect(w, r, "You left the household.")
+}
+
+/*
+POST /account/household/members/remove
+*/
+func (c HouseholdController) RemoveMemberAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	memberID := httphelpers.GetFromRequest[int](r, "id")
+	message := "They were removed from the household. Their watch history stays here."
+
+	if _, err = c.accountService.RemoveAccountMember(session.AccountID, session.UserID, memberID); err != nil {
+		switch {
+		case errors.Is(err, identity.ErrNotAccountOwner):
+			message = "Only the account owner can remove people from the household."
+		case errors.Is(err, identity.ErrOwnerCannotLeave):
+			message = "You can't remove yourself. Make someone else the owner first."
+		case errors.Is(err, identity.ErrAccountMemberNotFound):
+			message = "That person isn't in your household."
+		default:
+			slog.Error("error removing account member", "error", err, "memberID", memberID, "userID", session.UserID)
+			message = "There was an unexpected error removing them. Please try again later."
+		}
+	} else {
+		slog.Info("account member removed", "memberID", memberID, "accountID", session.AccountID, "userID", session.UserID)
+		c.recordAuditEvent(r, models.AuditEvent{UserID: memberID, AccountID: &session.AccountID, EventType: models.AuditEventHouseholdMemberRemoved, Details: "By " + session.Email})
+	}
+
+	c.redirect(w, r, message)
+}
+
+/*
+POST /account/household/members/role
+*/
+func (c HouseholdController) SetMemberRoleAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	memberID := httphelpers.GetFromRequest[int](r, "id")
+	role := models.AccountRole(httphelpers.GetFromRequest[string](r, "role"))
+	message := "Their role in the household was changed."
+
+	if err = c.accountService.SetMemberRole(session.AccountID, session.UserID, memberID, role); err != nil {
+		switch {
+		case errors.Is(err, identity.ErrNotAccountOwner):
+			message = "Only the account owner can change roles."
+		case errors.Is(err, identity.ErrInvalidAccountRole):
+			message = "Members can only be given the member or viewer role."
+		case errors.Is(err, identity.ErrAccountMemberNotFound):
+			message = "That person isn't in your household."
+		default:
+			slog.Error("error setting member role", "error", err, "memberID", memberID, "userID", session.UserID)
+			message = "There was an unexpected error changing their role. Please try again later."
+		}
+	} else {
+		slog.Info("account member role changed", "memberID", memberID, "role", role, "accountID", session.AccountID, "userID", session.UserID)
+	}
+
+	c.redirect(w, r, message)
+}
+
+/*
+POST /account/household/members/transfer
+*/
+func (c HouseholdController) TransferOwnershipAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	newOwnerID := httphelpers.GetFromRequest[int](r, "id")
+	message := "Ownership of the household was transferred."
+
+	if err = c.accountService.TransferOwnership(session.AccountID, session.UserID, newOwnerID); err != nil {
+		switch {
+		case errors.Is(err, identity.ErrNotAccountOwner):
+			message = "Only the account owner can transfer ownership."
+		case errors.Is(err, identity.ErrAccountMemberNotFound):
+			message = "Only someone in your household who has activated their account can become the owner."
+		default:
+			slog.Error("error transferring account ownership", "error", err, "newOwnerID", newOwnerID, "userID", session.UserID)
+			message = "There was an unexpected error transferring ownership. Please try again later."
+		}
+	} else {
+		slog.Info("account ownership transferred", "accountID", session.AccountID, "from", session.UserID, "to", newOwnerID)
+		c.recordAuditEvent(r, models.AuditEvent{UserID: newOwnerID, AccountID: &session.AccountID, EventType: models.AuditEventHouseholdOwnerChanged, Details: "From " + session.Email})
+	}
+
+	c.redirect(w, r, message)
+}
+
+/*
+POST /account/household/invitations/revoke
+*/
+func (c HouseholdController) RevokeInvitationAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	invitationID := httphelpers.GetFromRequest[int](r, "id")
+	message := "The invitation was revoked."
+
+	if err = c.accountInvitationService.RevokeAccountInvitation(session.AccountID, session.UserID, invitationID); err != nil {
+		if errors.Is(err, identity.ErrAccountInvitationNotFound) {
+			message = "That invitation doesn't exist or can no longer be used."
+		} else {
+			slog.Error("error revoking account invitation", "error", err, "invitationID", invitationID, "userID", session.UserID)
+			message = "There was an unexpected error revoking the invitation. Please try again later."
+		}
+	} else {
+		slog.Info("account invitation revoked", "invitationID", invitationID, "userID", session.UserID)
+	}
+
+	c.redirect(w, r, message)
+}
+
+/*
+POST /account/household/join-token/rotate
+*/
+func (c HouseholdController) RotateJoinTokenAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		account *models.Account
+	)
+
+	session := c.GetSession(r)
+	message := "Your household has a new account code. The old one no longer works."
+
+	if account, err = c.accountService.GetAccountByID(session.AccountID); err != nil {
+		slog.Error("error fetching account to rotate join token", "error", err, "accountID", session.AccountID)
+		c.redirect(w, r, "There was an unexpected error changing the account code. Please try again later.")
+		return
+	}
+
+	if account.Owner != session.UserID {
+		c.redirect(w, r, "Only the account owner can change the account code.")
+		return
+	}
+
+	if _, err = c.accountService.RegenerateJoinToken(account.ID.ID); err != nil {
+		slog.Error("error rotating join token", "error", err, "accountID", session.AccountID)
+		message = "There was an unexpected error changing the account code. Please try again later."
+	} else {
+		slog.Info("join token rotated", "accountID", session.AccountID, "userID", session.UserID)
+	}
+
+	c.redirect(w, r, message)
+}
+
+/*
+GET /account/household/security
+
+Lists recent security events for the household's members. Only the owner
+can see it.
+*/
+func (c HouseholdController) SecurityLogPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		account *models.Account
+		events  []models.AuditEvent
+	)
+
+	pageName := "pages/account/security-log"
+	session := c.GetSession(r)
+
+	viewData := viewmodels.SecurityLog{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Events: []viewmodels.SecurityEventDisplay{},
+	}
+
+	if account, err = c.accountService.GetAccountByID(session.AccountID); err != nil {
+		slog.Error("error fetching account for security log", "error", err, "accountID", session.AccountID)
+		c.redirect(w, r, "There was an unexpected error trying to load the security log. Please try again later.")
+		return
+	}
+
+	if account.Owner != session.UserID {
+		c.redirect(w, r, "Only the account owner can see the security log.")
+		return
+	}
+
+	if events, err = c.auditService.GetAccountAuditEvents(session.AccountID, maxSecurityLogEvents); err != nil {
+		slog.Error("error fetching audit events", "error", err, "accountID", session.AccountID)
+		viewData.Message = "There was an unexpected error trying to load the security log. Please try again later."
+		viewData.IsError = true
+	}
+
+	for _, event := range events {
+		viewData.Events = append(viewData.Events, viewmodels.SecurityEventDisplay{
+			Email:     event.UserEmail,
+			Event:     event.EventType.Description(),
+			Details:   event.Details,
+			IPAddress: event.IPAddress,
+			Device:    useragent.Describe(event.UserAgent),
+			CreatedAt: datetime.DisplayDateTime(event.CreatedAt),
+		})
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+render fills in the household's members, and for the owner the account's
+join token and pending invitations, then renders the page.
+*/
+func (c HouseholdController) render(w http.ResponseWriter, r *http.Request, viewData viewmodels.Household) {
+	var (
+		err         error
+		account     *models.Account
+		members     []models.AccountMember
+		invitations []models.AccountInvitation
+	)
+
+	pageName := "pages/account/household"
+	session := c.GetSession(r)
+	viewData.CurrentUserID = session.UserID
+	viewData.Invitations = []viewmodels.HouseholdInvitationDisplay{}
+	viewData.Members = []viewmodels.HouseholdMemberDisplay{}
+
+	if account, err = c.accountService.GetAccountByID(session.AccountID); err != nil {
+		slog.Error("error fetching account for household page", "error", err, "accountID", session.AccountID)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.IsOwner = account.Owner == session.UserID
+
+	if members, err = c.accountService.GetAccountMembers(session.AccountID); err != nil {
+		slog.Error("error fetching account members", "error", err, "accountID", session.AccountID)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	for _, member := range members {
+		viewData.Members = append(viewData.Members, viewmodels.HouseholdMemberDisplay{
+			UserID:      member.UserID,
+			Email:       member.Email,
+			WatcherName: member.WatcherName,
+			IsOwner:     member.IsOwner,
+			Role:        string(member.Role),
+			Active:      member.Active,
+		})
+	}
+
+	if !viewData.IsOwner {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.JoinToken = account.JoinToken
+
+	if invitations, err = c.accountInvitationService.GetPendingAccountInvitations(session.AccountID); err != nil {
+		slog.Error("error fetching account invitations", "error", err, "accountID", session.AccountID)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	for _, invitation := range invitations {
+		viewData.Invitations = append(viewData.Invitations, viewmodels.HouseholdInvitationDisplay{
+			ID:        invitation.ID,
+			Email:     invitation.Email,
+			InvitedBy: invitation.InvitedByEmail,
+			CreatedAt: datetime.DisplayDate(invitation.CreatedAt),
+			ExpiresAt: datetime.DisplayDate(invitation.ExpiresAt),
+		})
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+recordAuditEvent saves a security event. Failing to is only logged, since
+the change has already been made.
+*/
+func (c HouseholdController) recordAuditEvent(r *http.Request, event models.AuditEvent) {
+	if err := c.auditService.RecordAuditEvent(r, event); err != nil {
+		slog.Error("error recording audit event", "error", err, "userID", event.UserID, "eventType", event.EventType)
+	}
+}
+
+func (c HouseholdController) redirect(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/account/household?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+/*
+recordWrongJoinCode counts a code that matched neither an invitation nor a
+household against the user and their IP address.
+*/
+func (c HouseholdController) recordWrongJoinCode(throttleKeys []string) {
+	for _, key := range throttleKeys {
+		if _, err := c.loginThrottleService.RecordFailedLogin(key, identity.MaxJoinCodeAttempts); err != nil {
+			slog.Error("error recording wrong account code", "error", err, "key", key)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	emailLoginTokenLifetime = time.Minute * 15
+)
+
+/*
+GET /login/email
+*/
+func (c IdentityController) EmailLoginPage(w http.ResponseWriter, r *http.Request) {
+	viewData := viewmodels.LoginEmail{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx:  httphelpers.IsHtmx(r),
+			Message: c.GetMessage(r),
+		},
+		Email: httphelpers.GetFromRequest[string](r, "email"),
+	}
+
+	c.renderer.Render("pages/login-email", viewData, w)
+}
+
+/*
+POST /login/email
+
+Emails a link that logs the user in. The response is the same whether or
+not an account exists, so this page can't be used to find out who has
+signed up. Only a few links are sent to an address, or from an IP
+address, before a pause.
+*/
+func (c IdentityController) EmailLoginAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err         error
+		user        *models.User
+		token       string
+		lockedUntil time.Time
+	)
+
+	pageName := "pages/login-email"
+
+	viewData := viewmodels.LoginEmail{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Email: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "email")),
+	}
+
+	if !email.IsValidEmailAddress(viewData.Email) {
+		viewData.Message = "The email address you provided appears to be invalid."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	emailKey, ipKey := c.emailLinkThrottleKeys(r, viewData.Email)
+
+	if lockedUntil, err = c.loginThrottleService.GetLoginLockout(emailKey, ipKey); err != nil {
+		slog.Error("error checking log in link throttle", "error", err)
+		viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	/*
+	 * The request that goes over the limit is counted, and is the first
+	 * to be paused. Requests during the pause aren't counted, so asking
+	 * again doesn't make it longer.
+	 */
+	if !lockedUntil.IsZero() || c.recordEmailLinkRequest(r, viewData.Email) {
+		viewData.Message = "Too many log in links have been asked for. Please use the last one we sent, or wait a few minutes and try again."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Message = template.HTML(fmt.Sprintf(
+		"If there is an account for %s, we've sent it a link to log in. The link works for 15 minutes.",
+		template.HTMLEscapeString(viewData.Email),
+	))
+
+	if user, err = c.userService.GetUserByEmail(viewData.Email, identity.WithOnlyActiveUsers(true)); err != nil {
+		if !errors.Is(err, identity.ErrUserNotFound) {
+			slog.Error("error retrieving user for email log in", "error", err)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+			viewData.IsError = true
+		}
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if token, err = c.userTokenService.CreateUserToken(user.ID.ID, models.UserTokenPurposeEmailLogin, emailLoginTokenLifetime); err != nil {
+		slog.Error("error creating email log in token", "error", err, "userID", user.ID.ID)
+		viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	loginLink := fmt.Sprintf("%s/login/email/verify?token=%s", c.config.TLD, url.QueryEscape(token))
+
+	mailBody := fmt.Sprintf(`
+		<p>Someone asked for a link to log in to your Streaming Tracker account.</p>
+		<p>To log in, click the following link:
+		<a href="%s">Log In</a>. The link works once, for 15 minutes.</p>
+		<p>If you didn't ask for this, you can ignore this email.</p>
+	`,
+		loginLink,
+	)
+
+	if err = c.sendEmail(user.Email, "Log in to Streaming Tracker", mailBody); err != nil {
+		slog.Error("failed to send email log in link", "error", err, "userID", user.ID.ID)
+	} else {
+		slog.Info("email log in requested", "userID", user.ID.ID)
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+GET /login/email/verify?token={token}
+
+Shows a button rather than logging in straight away. Some mail services
+open every link in an email to scan it, which would use the link up before
+the user gets to click it.
+*/
+func (c IdentityController) EmailLoginVerifyPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/login-email-verify"
+
+	viewData := viewmodels.LoginEmailVerify{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Token: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "token")),
+	}
+
+	if _, err = c.userTokenService.GetUserToken(viewData.Token, models.UserTokenPurposeEmailLogin); err != nil {
+		if !errors.Is(err, identity.ErrInvalidUserToken) {
+			slog.Error("error checking email log in token", "error", err)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+
+		viewData.Message = "This link has expired or has already been used."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.TokenIsValid = true
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /login/email/verify
+
+Logs the user in, the same way logging in with a password does. Users with
+two-factor authentication on still need a code.
+*/
+func (c IdentityController) EmailLoginVerifyAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		token     *models.UserToken
+		user      *models.User
+		twoFactor *models.UserTwoFactor
+	)
+
+	tokenValue := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "token"))
+
+	if token, err = c.userTokenService.GetUserToken(tokenValue, models.UserTokenPurposeEmailLogin); err != nil {
+		c.endEmailLogin(w, r, err)
+		return
+	}
+
+	/*
+	 * Using the token up makes sure the link only logs in once.
+	 */
+	if _, err = c.userTokenService.ConsumeUserToken(tokenValue, models.UserTokenPurposeEmailLogin); err != nil {
+		c.endEmailLogin(w, r, err)
+		return
+	}
+
+	if user, err = c.userService.GetUserByEmail(token.UserEmail, identity.WithOnlyActiveUsers(true)); err != nil {
+		c.endEmailLogin(w, r, err)
+		return
+	}
+
+	if twoFactor, err = c.twoFactorService.GetTwoFactor(user.ID.ID); err != nil && !errors.Is(err, identity.ErrTwoFactorNotFound) {
+		c.endEmailLogin(w, r, err)
+		return
+	}
+
+	if twoFactor != nil && twoFactor.IsEnabled() {
+		if err = c.beginTwoFactorLogin(w, user); err != nil {
+			c.endEmailLogin(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, "/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	if err = c.saveSession(w, r, user); err != nil {
+		c.endEmailLogin(w, r, err)
+		return
+	}
+
+	slog.Info("user logged in", "userID", user.ID.ID, "accountID", user.Account.ID.ID, "emailLink", true)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventLogin, Details: "Emailed link"})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+/*
+endEmailLogin sends the user back to ask for a new link. Errors other than
+the link having expired are logged.
+*/
+func (c IdentityController) endEmailLogin(w http.ResponseWriter, r *http.Request, err error) {
+	message := "We are sorry, but an unexpected error occurred. Please try again later."
+
+	if errors.Is(err, identity.ErrInvalidUserToken) || errors.Is(err, identity.ErrUserNotFound) {
+		message = "That link has expired or has already been used. Ask for a new one below."
+	} else {
+		slog.Error("error during email log in", "error", err)
+	}
+
+	http.Redirect(w, r, "/login/email?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
@@ -0,0 +1,88 @@
+package identity_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	identityhandlers "github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/identity"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+)
+
+func TestEmailLoginLinksArePausedPerAddress(t *testing.T) {
+	mail := &fakeMailService{}
+	controller := newEmailLoginController(mail)
+
+	/*
+	 * Three links are sent, then the fourth request is paused. An address
+	 * without an account is paused the same way, so the pause doesn't give
+	 * away who has signed up.
+	 */
+	for _, address := range []string{"adam@example.com", "nobody@example.com"} {
+		for request := 1; request <= 3; request++ {
+			if body := askForLink(controller, address, "192.0.2.1:1234"); !strings.Contains(body, "we've sent it a link") {
+				t.Fatalf("%s request %d: expected a link to be sent, got %s", address, request, body)
+			}
+		}
+
+		if body := askForLink(controller, address, "192.0.2.1:1234"); !strings.Contains(body, "Too many log in links") {
+			t.Errorf("%s: expected the fourth request to be paused, got %s", address, body)
+		}
+	}
+
+	if len(mail.sent) != 3 {
+		t.Errorf("expected three links to adam@example.com, got %d emails", len(mail.sent))
+	}
+
+	/*
+	 * Asking from another IP address doesn't get around the pause.
+	 */
+	if body := askForLink(controller, "adam@example.com", "198.51.100.1:1234"); !strings.Contains(body, "Too many log in links") {
+		t.Errorf("expected the address to stay paused from another IP address, got %s", body)
+	}
+
+	if len(mail.sent) != 3 {
+		t.Errorf("expected no more emails, got %d", len(mail.sent))
+	}
+}
+
+func TestEmailLoginLinksArePausedPerIP(t *testing.T) {
+	controller := newEmailLoginController(&fakeMailService{})
+
+	for request := 1; request <= 10; request++ {
+		if body := askForLink(controller, fmt.Sprintf("person%d@example.com", request), "192.0.2.1:1234"); !strings.Contains(body, "we've sent it a link") {
+			t.Fatalf("request %d: expected a link to be sent, got %s", request, body)
+		}
+	}
+
+	if body := askForLink(controller, "adam@example.com", "192.0.2.1:1234"); !strings.Contains(body, "Too many log in links") {
+		t.Errorf("expected the IP address to be paused, got %s", body)
+	}
+
+	if body := askForLink(controller, "adam@example.com", "198.51.100.1:1234"); !strings.Contains(body, "we've sent it a link") {
+		t.Errorf("expected another IP address to get a link, got %s", body)
+	}
+}
+
+func newEmailLoginController(mail *fakeMailService) identityhandlers.IdentityController {
+	return identityhandlers.NewIdentityController(identityhandlers.IdentityControllerConfig{
+		AuditService:         fakeAuditService{},
+		Config:               &configuration.Config{TLD: testSite},
+		EmailService:         mail,
+		LoginThrottleService: &fakeLoginThrottleService{},
+		Renderer:             fakeRenderer{},
+		UserService:          fakeUserService{},
+		UserTokenService:     &fakeUserTokenService{},
+	})
+}
+
+func askForLink(controller identityhandlers.IdentityController, address, remoteAddr string) string {
+	r := form("/login/email", url.Values{"email": {address}})
+	r.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	controller.EmailLoginAction(w, r)
+	return w.Body.String()
+}
@@ -6,18 +6,23 @@ import (
 	"html/template"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/adampresley/adamgokit/auth2"
 	"github.com/adampresley/adamgokit/email"
 	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/adamgokit/rendering"
-	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/configuration"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/clientip"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
 	"github.com/adampresley/streaming-tracker/pkg/identity"
 	"github.com/adampresley/streaming-tracker/pkg/models"
 	"github.com/adampresley/streaming-tracker/pkg/watchers"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/adampresley/streaming-tracker/pkg/webauthn"
 )
 
 type IdentityHandlers interface {
@@ -26,57 +31,131 @@ type IdentityHandlers interface {
 	AccountSignUpSuccessPage(w http.ResponseWriter, r *http.Request)
 	AccountVerifyPage(w http.ResponseWriter, r *http.Request)
 	AccountVerifyAction(w http.ResponseWriter, r *http.Request)
+	BeginPasskeyLoginAction(w http.ResponseWriter, r *http.Request)
+	EmailLoginPage(w http.ResponseWriter, r *http.Request)
+	EmailLoginAction(w http.ResponseWriter, r *http.Request)
+	EmailLoginVerifyPage(w http.ResponseWriter, r *http.Request)
+	EmailLoginVerifyAction(w http.ResponseWriter, r *http.Request)
+	FinishPasskeyLoginAction(w http.ResponseWriter, r *http.Request)
+	ForgotPasswordPage(w http.ResponseWriter, r *http.Request)
+	ForgotPasswordAction(w http.ResponseWriter, r *http.Request)
 	LoginPage(w http.ResponseWriter, r *http.Request)
 	LoginAction(w http.ResponseWriter, r *http.Request)
 	LogoutAction(w http.ResponseWriter, r *http.Request)
+	ResetPasswordPage(w http.ResponseWriter, r *http.Request)
+	ResetPasswordAction(w http.ResponseWriter, r *http.Request)
+	SessionEnded(w http.ResponseWriter, r *http.Request, err error)
+	TwoFactorLoginPage(w http.ResponseWriter, r *http.Request)
+	TwoFactorLoginAction(w http.ResponseWriter, r *http.Request)
 }
 
 type IdentityControllerConfig struct {
-	AccountService identity.AccountServicer
-	Auth           auth2.Authenticator[*identity.UserSession]
-	Config         *configuration.Config
-	EmailService   email.MailServicer
-	Renderer       rendering.TemplateRenderer
-	UserService    identity.UserServicer
-	WatcherService watchers.WatcherServicer
+	AccountInvitationService      identity.AccountInvitationServicer
+	AccountService                identity.AccountServicer
+	AuditService                  audit.AuditServicer
+	Auth                          auth2.Authenticator[*identity.UserSession]
+	Config                        *configuration.Config
+	EmailService                  email.MailServicer
+	LoginThrottleService          identity.LoginThrottleServicer
+	PasskeyService                identity.PasskeyServicer
+	RegistrationInvitationService identity.RegistrationInvitationServicer
+	RelyingParty                  webauthn.RelyingParty
+	Renderer                      rendering.TemplateRenderer
+	TwoFactorService              identity.TwoFactorServicer
+	UserService                   identity.UserServicer
+	UserTokenService              identity.UserTokenServicer
+	WatcherService                watchers.WatcherServicer
 }
 
 type IdentityController struct {
-	accountService identity.AccountServicer
-	auth           auth2.Authenticator[*identity.UserSession]
-	config         *configuration.Config
-	emailService   email.MailServicer
-	renderer       rendering.TemplateRenderer
-	userService    identity.UserServicer
-	watcherService watchers.WatcherServicer
+	base.BaseHandler
+
+	accountInvitationService      identity.AccountInvitationServicer
+	accountService                identity.AccountServicer
+	auditService                  audit.AuditServicer
+	auth                          auth2.Authenticator[*identity.UserSession]
+	config                        *configuration.Config
+	emailService                  email.MailServicer
+	loginThrottleService          identity.LoginThrottleServicer
+	passkeyService                identity.PasskeyServicer
+	registrationInvitationService identity.RegistrationInvitationServicer
+	relyingParty                  webauthn.RelyingParty
+	renderer                      rendering.TemplateRenderer
+	twoFactorService              identity.TwoFactorServicer
+	userService                   identity.UserServicer
+	userTokenService              identity.UserTokenServicer
+	watcherService                watchers.WatcherServicer
 }
 
 func NewIdentityController(config IdentityControllerConfig) IdentityController {
 	return IdentityController{
-		accountService: config.AccountService,
-		auth:           config.Auth,
-		config:         config.Config,
-		emailService:   config.EmailService,
-		renderer:       config.Renderer,
-		userService:    config.UserService,
-		watcherService: config.WatcherService,
+		accountInvitationService:      config.AccountInvitationService,
+		accountService:                config.AccountService,
+		auditService:                  config.AuditService,
+		auth:                          config.Auth,
+		config:                        config.Config,
+		emailService:                  config.EmailService,
+		loginThrottleService:          config.LoginThrottleService,
+		passkeyService:                config.PasskeyService,
+		registrationInvitationService: config.RegistrationInvitationService,
+		relyingParty:                  config.RelyingParty,
+		renderer:                      config.Renderer,
+		twoFactorService:              config.TwoFactorService,
+		userService:                   config.UserService,
+		userTokenService:              config.UserTokenService,
+		watcherService:                config.WatcherService,
 	}
 }
 
 /*
-GET /account/sign-up
+GET /account/sign-up?invitation={code}&accountCode={joinToken}
+
+What the page offers depends on the registration mode. When it is invite
+only, the link in an invitation email fills in the invitation code. The
+link in a household invitation fills in the account code.
 */
 func (c IdentityController) AccountSignUpPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err               error
+		invitation        *models.RegistrationInvitation
+		accountInvitation *models.AccountInvitation
+	)
+
 	pageName := "pages/account/sign-up"
 
 	viewData := viewmodels.AccountSignUp{
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx:  httphelpers.IsHtmx(r),
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 		},
-		Email:       "",
-		Password:    "",
-		AccountCode: "",
+		Email:            "",
+		Password:         "",
+		AccountCode:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "accountCode")),
+		InvitationCode:   strings.TrimSpace(httphelpers.GetFromRequest[string](r, "invitation")),
+		RegistrationMode: c.config.RegistrationMode,
+	}
+
+	if viewData.RegistrationMode == configuration.RegistrationModeInviteOnly && viewData.InvitationCode != "" {
+		if invitation, err = c.registrationInvitationService.GetRegistrationInvitation(viewData.InvitationCode); err != nil {
+			if !errors.Is(err, identity.ErrInvalidRegistrationInvitation) {
+				slog.Error("error checking registration invitation", "error", err)
+			}
+
+			viewData.Message = "This invitation is invalid or has expired. Ask whoever invited you to send a new one."
+			viewData.IsWarning = true
+			viewData.InvitationCode = ""
+		} else {
+			viewData.Email = invitation.Email
+		}
+	}
+
+	if viewData.AccountCode != "" {
+		if accountInvitation, err = c.accountInvitationService.GetAccountInvitation(viewData.AccountCode); err == nil {
+			viewData.Email = accountInvitation.Email
+			viewData.HasAccountInvitation = true
+		} else if !errors.Is(err, identity.ErrInvalidAccountInvitation) {
+			slog.Error("error checking account invitation", "error", err)
+		}
 	}
 
 	c.renderer.Render(pageName, viewData, w)
@@ -91,19 +170,53 @@ func (c IdentityController) AccountSignUpAction(w http.ResponseWriter, r *http.R
 		user *models.User
 	)
 
-	http.Redirect(w, r, "/login", http.StatusSeeOther)
-	return
+	if c.config.RegistrationMode == configuration.RegistrationModeClosed {
+		http.Redirect(w, r, "/login?message="+url.QueryEscape("Sign ups are closed right now."), http.StatusSeeOther)
+		return
+	}
 
 	pageName := "pages/account/sign-up"
 
 	viewData := viewmodels.AccountSignUp{
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx:  httphelpers.IsHtmx(r),
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 		},
-		Email:       httphelpers.GetFromRequest[string](r, "email"),
-		Password:    strings.TrimSpace(httphelpers.GetFromRequest[string](r, "password")),
-		AccountCode: httphelpers.GetFromRequest[string](r, "accountCode"),
+		Email:            httphelpers.GetFromRequest[string](r, "email"),
+		Password:         strings.TrimSpace(httphelpers.GetFromRequest[string](r, "password")),
+		AccountCode:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "accountCode")),
+		InvitationCode:   strings.TrimSpace(httphelpers.GetFromRequest[string](r, "invitationCode")),
+		RegistrationMode: c.config.RegistrationMode,
+	}
+
+	if viewData.RegistrationMode != configuration.RegistrationModeInviteOnly {
+		viewData.InvitationCode = ""
+	}
+
+	/*
+	 * The account code is either a household invitation or an account's
+	 * join token. Invitations are used up when the user is created, and
+	 * also count as an invitation to sign up.
+	 */
+	if viewData.AccountCode != "" {
+		if _, err = c.accountInvitationService.GetAccountInvitation(viewData.AccountCode); err == nil {
+			viewData.HasAccountInvitation = true
+		} else if !errors.Is(err, identity.ErrInvalidAccountInvitation) {
+			slog.Error("error checking account invitation", "error", err)
+			viewData.Message = "An unexpected error occurred while checking your account code. Please try again later"
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+	}
+
+	if viewData.RegistrationMode == configuration.RegistrationModeInviteOnly && viewData.InvitationCode == "" && !viewData.HasAccountInvitation {
+		viewData.Message = "You need an invitation to sign up."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
 	}
 
 	if !email.IsValidEmailAddress(viewData.Email) {
@@ -114,8 +227,8 @@ func (c IdentityController) AccountSignUpAction(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if len(viewData.Password) < 5 {
-		viewData.Message = "The password must be at least 5 characters long."
+	if len(viewData.Password) < identity.MinPasswordLength {
+		viewData.Message = template.HTML(fmt.Sprintf("The password must be at least %d characters long.", identity.MinPasswordLength))
 		viewData.IsError = true
 
 		c.renderer.Render(pageName, viewData, w)
@@ -147,13 +260,35 @@ func (c IdentityController) AccountSignUpAction(w http.ResponseWriter, r *http.R
 	 * Create the user
 	 */
 	createUserRequest := models.CreateUserRequest{
-		Email:    viewData.Email,
-		Password: viewData.Password,
+		Email:          viewData.Email,
+		Password:       viewData.Password,
+		InvitationCode: viewData.InvitationCode,
+	}
+
+	if viewData.HasAccountInvitation {
+		createUserRequest.AccountInvitationCode = viewData.AccountCode
 	}
 
 	user, err = c.userService.CreateUser(createUserRequest)
 
+	if errors.Is(err, identity.ErrAccountInvitationEmail) {
+		viewData.Message = "This invitation was sent to a different email address. Sign up with the address it was sent to."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if errors.Is(err, identity.ErrInvalidRegistrationInvitation) || errors.Is(err, identity.ErrInvalidAccountInvitation) {
+		viewData.Message = "Your invitation is invalid or has expired. Ask whoever invited you to send a new one."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
 	if err != nil {
+		slog.Error("error creating user", "error", err)
 		viewData.Message = "An unexpected error occurred while creating the user. Please try again later"
 		viewData.IsError = true
 
@@ -166,7 +301,7 @@ func (c IdentityController) AccountSignUpAction(w http.ResponseWriter, r *http.R
 	 */
 	verifyLink := fmt.Sprintf("%s/account/verify?code=%s", c.config.TLD, user.ActivationCode)
 
-	if len(viewData.AccountCode) > 0 {
+	if len(viewData.AccountCode) > 0 && !viewData.HasAccountInvitation {
 		verifyLink += fmt.Sprintf("&accountCode=%s", viewData.AccountCode)
 	}
 
@@ -180,19 +315,7 @@ func (c IdentityController) AccountSignUpAction(w http.ResponseWriter, r *http.R
 		user.ActivationCode,
 	)
 
-	err = c.emailService.Send(email.Mail{
-		Body:       mailBody,
-		BodyIsHtml: true,
-		From:       email.EmailAddress{Email: c.config.EmailFrom},
-		Subject:    "Welcome to Streaming Tracker! Activate Your Account",
-		To: []email.EmailAddress{
-			{
-				Email: fmt.Sprintf("%s <%s>", user.Email, user.Email),
-			},
-		},
-	})
-
-	if err != nil {
+	if err = c.sendEmail(user.Email, "Welcome to Streaming Tracker! Activate Your Account", mailBody); err != nil {
 		slog.Error("Failed to send email verification code", "error", err)
 	}
 
@@ -207,6 +330,23 @@ func (c IdentityController) AccountSignUpAction(w http.ResponseWriter, r *http.R
 	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 }
 
+/*
+sendEmail sends an HTML email to one address from the site's address.
+*/
+func (c IdentityController) sendEmail(to, subject, body string) error {
+	return c.emailService.Send(email.Mail{
+		Body:       body,
+		BodyIsHtml: true,
+		From:       email.EmailAddress{Email: c.config.EmailFrom},
+		Subject:    subject,
+		To: []email.EmailAddress{
+			{
+				Email: fmt.Sprintf("%s <%s>", to, to),
+			},
+		},
+	})
+}
+
 /*
 GET /account/sign-up-success
 */
@@ -216,7 +356,7 @@ func (c IdentityController) AccountSignUpSuccessPage(w http.ResponseWriter, r *h
 	viewData := viewmodels.AccountSignUpSuccess{
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx:  httphelpers.IsHtmx(r),
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 		},
 		Email:          httphelpers.GetFromRequest[string](r, "email"),
 		HasAccountCode: len(httphelpers.GetFromRequest[string](r, "hasAccountCode")) > 0,
@@ -234,9 +374,10 @@ func (c IdentityController) LoginPage(w http.ResponseWriter, r *http.Request) {
 	viewData := viewmodels.Login{
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx:  httphelpers.IsHtmx(r),
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 			JavascriptIncludes: []rendering.JavascriptInclude{
 				{Src: "/static/js/pages/login.js", Type: "module"},
+				{Src: "/static/js/passkeys.js", Type: "module"},
 			},
 		},
 
@@ -244,6 +385,10 @@ func (c IdentityController) LoginPage(w http.ResponseWriter, r *http.Request) {
 		Password: "",
 	}
 
+	if c.config.OIDCEnabled() {
+		viewData.ProviderName = c.config.OIDCProviderName
+	}
+
 	c.renderer.Render(pageName, viewData, w)
 }
 
@@ -252,8 +397,10 @@ POST /login
 */
 func (c IdentityController) LoginAction(w http.ResponseWriter, r *http.Request) {
 	var (
-		err  error
-		user *models.User
+		err       error
+		locked    bool
+		user      *models.User
+		twoFactor *models.UserTwoFactor
 	)
 
 	pageName := "pages/login"
@@ -261,9 +408,10 @@ func (c IdentityController) LoginAction(w http.ResponseWriter, r *http.Request)
 	viewData := viewmodels.Login{
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx:  httphelpers.IsHtmx(r),
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 			JavascriptIncludes: []rendering.JavascriptInclude{
 				{Src: "/static/js/pages/login.js", Type: "module"},
+				{Src: "/static/js/passkeys.js", Type: "module"},
 			},
 		},
 
@@ -271,28 +419,62 @@ func (c IdentityController) LoginAction(w http.ResponseWriter, r *http.Request)
 		Password: httphelpers.GetFromRequest[string](r, "password"),
 	}
 
+	if c.config.OIDCEnabled() {
+		viewData.ProviderName = c.config.OIDCProviderName
+	}
+
+	/*
+	 * Too many failed log ins for this email address, or from this IP
+	 * address, lock log ins for a while. The message is the same whether
+	 * or not there is an account.
+	 */
+	if locked, err = c.isLoginLocked(r, viewData.Email); err != nil {
+		slog.Error("an error occurred while checking for a log in lockout", "error", err)
+		viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if locked {
+		viewData.Message = loginLockedMessage
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
 	/*
 	 * Get the user by email.
 	 */
 	user, err = c.userService.GetUserByEmail(viewData.Email, identity.WithOnlyActiveUsers(true))
 
 	if err != nil {
-		/*
-		 * User not found
-		 */
-		if errors.Is(err, identity.ErrUserNotFound) {
-			viewData.Message = "Invalid email address or password"
+		if !errors.Is(err, identity.ErrUserNotFound) {
+			slog.Error("an error occurred while retrieving the user", "error", err)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
 			viewData.IsError = true
 
 			c.renderer.Render(pageName, viewData, w)
 			return
 		}
 
-		/*
-		 * An unexpected error
-		 */
-		slog.Error("an error occurred while retrieving the user", "error", err)
-		viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+		user = nil
+	}
+
+	/*
+	 * Validate the password. A missing user is reported the same way as a
+	 * wrong password.
+	 */
+	if !checkPassword(user, viewData.Password) {
+		c.recordFailedLogin(r, viewData.Email, user)
+
+		if user != nil {
+			c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventLoginFailed, Details: "Wrong password"})
+		}
+
+		viewData.Message = "Invalid email address or password"
 		viewData.IsError = true
 
 		c.renderer.Render(pageName, viewData, w)
@@ -300,26 +482,39 @@ func (c IdentityController) LoginAction(w http.ResponseWriter, r *http.Request)
 	}
 
 	/*
-	 * Validate the password.
+	 * Users with two-factor authentication on need a code before they get
+	 * a session. Failed log ins are only cleared once that code is right,
+	 * so knowing the password doesn't reset the count of wrong codes.
 	 */
-	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(viewData.Password)); err != nil {
-		viewData.Message = "Invalid email address or password"
+	if twoFactor, err = c.twoFactorService.GetTwoFactor(user.ID.ID); err != nil && !errors.Is(err, identity.ErrTwoFactorNotFound) {
+		slog.Error("an error occurred while checking two-factor authentication", "error", err, "userID", user.ID.ID)
+		viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
 		viewData.IsError = true
 
 		c.renderer.Render(pageName, viewData, w)
 		return
 	}
 
+	if twoFactor != nil && twoFactor.IsEnabled() {
+		if err = c.beginTwoFactorLogin(w, user); err != nil {
+			slog.Error("an error occurred while starting a two-factor log in", "error", err, "userID", user.ID.ID)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+
+		http.Redirect(w, r, "/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	c.clearFailedLogins(r, viewData.Email)
+
 	/*
 	 * All is good. Create the session and redirect to the home page
 	 */
-	sessionValue := &identity.UserSession{
-		UserID:    user.ID.ID,
-		Email:     user.Email,
-		AccountID: user.Account.ID.ID,
-	}
-
-	if err = c.auth.SaveSession(w, r, sessionValue); err != nil {
+	if err = c.saveSession(w, r, user); err != nil {
 		slog.Error("an error occurred while saving the session", "error", err, "userID", user.ID.ID)
 		viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
 		viewData.IsError = true
@@ -329,9 +524,34 @@ func (c IdentityController) LoginAction(w http.ResponseWriter, r *http.Request)
 	}
 
 	slog.Info("user logged in", "userID", user.ID.ID, "accountID", user.Account.ID.ID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventLogin, Details: "Password"})
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+/*
+saveSession logs a user in to their current account.
+*/
+func (c IdentityController) saveSession(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	sessionValue := &identity.UserSession{
+		UserID:    user.ID.ID,
+		Email:     user.Email,
+		AccountID: user.Account.ID.ID,
+		AuthToken: user.AuthToken,
+	}
+
+	return c.auth.SaveSession(w, r, sessionValue)
+}
+
+/*
+recordAuditEvent saves a security event. Failing to is only logged, so it
+doesn't stop the user from logging in.
+*/
+func (c IdentityController) recordAuditEvent(r *http.Request, event models.AuditEvent) {
+	if err := c.auditService.RecordAuditEvent(r, event); err != nil {
+		slog.Error("error recording audit event", "error", err, "userID", event.UserID, "eventType", event.EventType)
+	}
+}
+
 /*
 GET /account/verify
 */
@@ -341,7 +561,7 @@ func (c IdentityController) AccountVerifyPage(w http.ResponseWriter, r *http.Req
 	viewData := viewmodels.AccountVerify{
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx:  httphelpers.IsHtmx(r),
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 		},
 		ActivationCode: httphelpers.GetFromRequest[string](r, "code"),
 		JoinToken:      httphelpers.GetFromRequest[string](r, "accountCode"),
@@ -355,9 +575,11 @@ POST /account/verify
 */
 func (c IdentityController) AccountVerifyAction(w http.ResponseWriter, r *http.Request) {
 	var (
-		err     error
-		user    *models.User
-		account *models.Account
+		err             error
+		user            *models.User
+		account         *models.Account
+		joinedHousehold bool
+		lockedUntil     time.Time
 	)
 
 	pageName := "pages/account/verify"
@@ -365,7 +587,7 @@ func (c IdentityController) AccountVerifyAction(w http.ResponseWriter, r *http.R
 	viewData := viewmodels.AccountVerify{
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx:  httphelpers.IsHtmx(r),
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 		},
 		ActivationCode: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "code")),
 		JoinToken:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "accountCode")),
@@ -402,13 +624,73 @@ func (c IdentityController) AccountVerifyAction(w http.ResponseWriter, r *http.R
 	}
 
 	/*
-	 * Check if we need to join an existing account
+	 * Active users only get activation codes when changing their email
+	 * address. Those are entered on the account settings page.
 	 */
-	if len(viewData.JoinToken) > 0 {
+	if user.Active {
+		viewData.Message = "Invalid activation code."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	/*
+	 * Users who accepted a household invitation joined its account when
+	 * they signed up.
+	 */
+	if user.Account != nil {
+		joinedHousehold = true
+
+		if err = c.userService.ActivateUser(viewData.ActivationCode); err != nil {
+			slog.Error("error activating user", "error", err)
+			viewData.Message = "We are sorry, but an unexpected error occurred while activating your account. Please try again later."
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+
+		if _, err = c.watcherService.CreateWatcher(user); err != nil {
+			slog.Error("error creating watcher record", "error", err, "userID", user.ID.ID)
+			viewData.Message = "We are sorry, but an unexpected error occurred while setting up your account. Please try again later."
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+	} else if len(viewData.JoinToken) > 0 {
+		/*
+		 * Join an existing account with its join token
+		 */
+		throttleKeys := identity.JoinCodeThrottleKeys(clientip.FromRequest(r, c.config.TrustProxyHeaders), user.ID.ID)
+
+		if lockedUntil, err = c.loginThrottleService.GetLoginLockout(throttleKeys...); err != nil {
+			slog.Error("error checking account code lockout", "error", err, "userID", user.ID.ID)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+
+		if !lockedUntil.IsZero() {
+			viewData.Message = "Too many wrong account codes. Please try again later."
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+
 		account, err = c.accountService.GetAccountByJoinToken(viewData.JoinToken)
 
 		if err != nil {
-			slog.Error("error retrieving account by join token", "error", err, "joinToken", viewData.JoinToken)
+			if errors.Is(err, identity.ErrAccountNotFound) {
+				c.recordWrongJoinCode(throttleKeys)
+			} else {
+				slog.Error("error retrieving account by join token", "error", err)
+			}
+
 			viewData.Message = "Invalid account code. Please check the code and try again."
 			viewData.IsError = true
 
@@ -443,6 +725,8 @@ func (c IdentityController) AccountVerifyAction(w http.ResponseWriter, r *http.R
 			return
 		}
 
+		joinedHousehold = true
+
 		/*
 		 * Create a watcher record for this user
 		 */
@@ -504,6 +788,12 @@ func (c IdentityController) AccountVerifyAction(w http.ResponseWriter, r *http.R
 		}
 	}
 
+	c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventAccountVerified})
+
+	if joinedHousehold {
+		c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, AccountID: &user.Account.ID.ID, EventType: models.AuditEventHouseholdJoined})
+	}
+
 	/*
 	 * Success! Redirect to login page with a success message
 	 */
@@ -511,6 +801,24 @@ func (c IdentityController) AccountVerifyAction(w http.ResponseWriter, r *http.R
 }
 
 func (c IdentityController) LogoutAction(w http.ResponseWriter, r *http.Request) {
+	if session := c.GetSession(r); session != nil {
+		c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventLogout})
+	}
+
 	_ = c.auth.DestroySession(w, r)
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
+
+/*
+SessionEnded responds to requests whose session is no longer valid, such as
+after the password was reset from another browser.
+*/
+func (c IdentityController) SessionEnded(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, identity.ErrUserNotFound) {
+		http.Redirect(w, r, "/error?message="+url.QueryEscape("We are sorry, but an unexpected error occurred. Please try again later."), http.StatusSeeOther)
+		return
+	}
+
+	_ = c.auth.DestroySession(w, r)
+	http.Redirect(w, r, "/login?message="+url.QueryEscape("Your session has ended. Please log in again."), http.StatusSeeOther)
+}
@@ -0,0 +1,189 @@
+package identity
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/clientip"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	/*
+	   Failed log ins allowed before a lockout. IP addresses get more, since
+	   a whole household can share one.
+	*/
+	maxEmailLoginAttempts = 5
+	maxIPLoginAttempts    = 20
+
+	loginLockedMessage = "Too many failed log in attempts. Please try again later, or log in with an emailed link."
+
+	/*
+	   Log in links that can be asked for before a pause, so the site can't
+	   be used to fill someone's inbox. IP addresses get more, since a
+	   whole household can share one.
+	*/
+	maxEmailLinkRequests   = 3
+	maxIPEmailLinkRequests = 10
+)
+
+/*
+dummyPasswordHash is checked against when there is no user, so a wrong
+email address takes as long as a wrong password.
+*/
+var dummyPasswordHash = []byte("$2a$10$yOTwp5G0AJAdO1CVxRnRiepBr2xXf0JjMblF8lheY1blpAQCKgIcC")
+
+func (c IdentityController) loginThrottleKeys(r *http.Request, email string) (emailKey, ipKey string) {
+	return identity.EmailLoginThrottleKey(email), identity.IPLoginThrottleKey(clientip.FromRequest(r, c.config.TrustProxyHeaders))
+}
+
+/*
+isLoginLocked returns true when log ins for the email address, or from the
+request's IP address, are locked.
+*/
+func (c IdentityController) isLoginLocked(r *http.Request, email string) (bool, error) {
+	var (
+		err         error
+		lockedUntil time.Time
+	)
+
+	emailKey, ipKey := c.loginThrottleKeys(r, email)
+
+	if lockedUntil, err = c.loginThrottleService.GetLoginLockout(emailKey, ipKey); err != nil {
+		return false, err
+	}
+
+	return !lockedUntil.IsZero(), nil
+}
+
+/*
+recordFailedLogin counts a failed log in, a wrong password or two-factor
+code, against the email address and the request's IP address. When this
+failure first locks an account, its owner is emailed. user is nil when
+there is no account for the address.
+*/
+func (c IdentityController) recordFailedLogin(r *http.Request, email string, user *models.User) {
+	var (
+		err      error
+		throttle *models.LoginThrottle
+	)
+
+	emailKey, ipKey := c.loginThrottleKeys(r, email)
+
+	if throttle, err = c.loginThrottleService.RecordFailedLogin(ipKey, maxIPLoginAttempts); err != nil {
+		slog.Error("error recording failed log in", "error", err, "key", ipKey)
+	} else if throttle.FailedAttempts == maxIPLoginAttempts+1 {
+		slog.Warn("log ins locked", "key", ipKey)
+	}
+
+	if throttle, err = c.loginThrottleService.RecordFailedLogin(emailKey, maxEmailLoginAttempts); err != nil {
+		slog.Error("error recording failed log in", "error", err, "key", emailKey)
+		return
+	}
+
+	if throttle.FailedAttempts != maxEmailLoginAttempts+1 {
+		return
+	}
+
+	slog.Warn("log ins locked", "key", emailKey)
+
+	if user == nil {
+		return
+	}
+
+	c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventLoginLocked})
+
+	mailBody := fmt.Sprintf(`
+		<p>There have been too many failed attempts to log in to your
+		Streaming Tracker account, so logging in with a password is paused
+		for a while.</p>
+		<p>If this was you, wait a few minutes and try again, or
+		<a href="%s/login/email">log in with an emailed link</a>.</p>
+		<p>If it wasn't, someone may be trying to guess your password or
+		two-factor code. Consider changing your password, and turning on
+		two-factor authentication in Settings if it isn't on already.</p>
+	`,
+		c.config.TLD,
+	)
+
+	if err = c.sendEmail(user.Email, "Failed log ins to your Streaming Tracker account", mailBody); err != nil {
+		slog.Error("failed to send log in lockout notice", "error", err, "userID", user.ID.ID)
+	}
+}
+
+/*
+clearFailedLogins forgets the failed log ins for an email address after a
+successful log in, including the two-factor code when one is needed. The
+IP address's count is left alone, so one good password doesn't let
+someone keep guessing others.
+*/
+func (c IdentityController) clearFailedLogins(r *http.Request, email string) {
+	emailKey, _ := c.loginThrottleKeys(r, email)
+
+	if err := c.loginThrottleService.ClearLoginThrottle(emailKey); err != nil {
+		slog.Error("error clearing failed log ins", "error", err, "key", emailKey)
+	}
+}
+
+func (c IdentityController) emailLinkThrottleKeys(r *http.Request, email string) (emailKey, ipKey string) {
+	return identity.EmailLinkThrottleKeys(email, clientip.FromRequest(r, c.config.TrustProxyHeaders))
+}
+
+/*
+recordEmailLinkRequest counts a request for a log in link against the
+email address and the request's IP address, whether or not there is an
+account for the address. It returns true when this request is one too
+many, and no link should be sent.
+*/
+func (c IdentityController) recordEmailLinkRequest(r *http.Request, email string) bool {
+	var (
+		err      error
+		throttle *models.LoginThrottle
+	)
+
+	tooMany := false
+	emailKey, ipKey := c.emailLinkThrottleKeys(r, email)
+
+	if throttle, err = c.loginThrottleService.RecordFailedLogin(ipKey, maxIPEmailLinkRequests); err != nil {
+		slog.Error("error recording log in link request", "error", err, "key", ipKey)
+	} else if throttle.FailedAttempts > maxIPEmailLinkRequests {
+		tooMany = true
+	}
+
+	if throttle, err = c.loginThrottleService.RecordFailedLogin(emailKey, maxEmailLinkRequests); err != nil {
+		slog.Error("error recording log in link request", "error", err, "key", emailKey)
+	} else if throttle.FailedAttempts > maxEmailLinkRequests {
+		tooMany = true
+	}
+
+	return tooMany
+}
+
+/*
+recordWrongJoinCode counts an account code that didn't match a household
+against the user and their IP address.
+*/
+func (c IdentityController) recordWrongJoinCode(throttleKeys []string) {
+	for _, key := range throttleKeys {
+		if _, err := c.loginThrottleService.RecordFailedLogin(key, identity.MaxJoinCodeAttempts); err != nil {
+			slog.Error("error recording wrong account code", "error", err, "key", key)
+		}
+	}
+}
+
+/*
+checkPassword returns true when password matches the user's. With no user
+it still takes as long as a real check, and returns false.
+*/
+func checkPassword(user *models.User, password string) bool {
+	if user == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+}
@@ -0,0 +1,155 @@
+package identity
+
+import (
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/webauthn"
+)
+
+const (
+	/*
+	   passkeyCookieName holds the challenge for a passkey log in while the
+	   browser asks the user for their passkey. The challenge is also kept
+	   as a single use token, so a finished log in can't be replayed.
+	*/
+	passkeyCookieName = "passkey-login"
+	passkeyCookiePath = "/login/passkey"
+)
+
+/*
+POST /login/passkey/begin
+
+Returns the options for navigator.credentials.get.
+*/
+func (c IdentityController) BeginPasskeyLoginAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		challenge string
+	)
+
+	if challenge, err = c.userTokenService.CreateChallengeToken(models.UserTokenPurposePasskeyLogin, webauthn.Timeout); err != nil {
+		slog.Error("error starting passkey log in", "error", err)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "We are sorry, but an unexpected error occurred. Please try again later.")
+		return
+	}
+
+	c.setPasskeyCookie(w, challenge, int(webauthn.Timeout.Seconds()))
+	httphelpers.JsonOK(w, c.relyingParty.RequestOptions(challenge))
+}
+
+/*
+POST /login/passkey/finish
+
+Checks the passkey the browser returned and logs the user in, the same way
+logging in with a password does. A passkey already proves the user has
+their device and unlocked it, so two-factor authentication isn't asked
+for.
+*/
+func (c IdentityController) FinishPasskeyLoginAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err          error
+		cookie       *http.Cookie
+		response     webauthn.AssertionResponse
+		credentialID []byte
+		passkey      *models.UserPasskey
+		signCount    uint32
+		user         *models.User
+	)
+
+	failedMessage := "That passkey didn't work. Try again, or log in with your password."
+
+	if cookie, err = r.Cookie(passkeyCookieName); err != nil || cookie.Value == "" {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Your log in took too long. Please try again.")
+		return
+	}
+
+	c.setPasskeyCookie(w, "", -1)
+
+	/*
+	 * Each challenge can only be used once, whether or not the passkey
+	 * checks out.
+	 */
+	if err = c.userTokenService.DeleteChallengeToken(cookie.Value, models.UserTokenPurposePasskeyLogin); err != nil {
+		if !errors.Is(err, identity.ErrInvalidUserToken) {
+			slog.Error("error using passkey log in challenge", "error", err)
+			httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "We are sorry, but an unexpected error occurred. Please try again later.")
+			return
+		}
+
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Your log in took too long. Please try again.")
+		return
+	}
+
+	if err = httphelpers.ReadJSONBody(r, &response); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, failedMessage)
+		return
+	}
+
+	if credentialID, err = response.CredentialID(); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, failedMessage)
+		return
+	}
+
+	if passkey, err = c.passkeyService.GetPasskeyByCredentialID(base64.RawURLEncoding.EncodeToString(credentialID)); err != nil {
+		if !errors.Is(err, identity.ErrPasskeyNotFound) {
+			slog.Error("error retrieving passkey", "error", err)
+			httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "We are sorry, but an unexpected error occurred. Please try again later.")
+			return
+		}
+
+		httphelpers.JsonErrorMessage(w, http.StatusUnauthorized, "That passkey isn't registered to an account here. Log in with your password, then add it in Settings.")
+		return
+	}
+
+	credential := webauthn.Credential{
+		ID:        credentialID,
+		PublicKey: passkey.PublicKey,
+		SignCount: uint32(passkey.SignCount),
+	}
+
+	if signCount, err = c.relyingParty.VerifyAssertion(cookie.Value, credential, response); err != nil {
+		slog.Warn("passkey log in failed", "error", err, "userID", passkey.UserID, "passkeyID", passkey.ID)
+		c.recordAuditEvent(r, models.AuditEvent{UserID: passkey.UserID, EventType: models.AuditEventLoginFailed, Details: "Passkey " + passkey.Name + " didn't verify"})
+		httphelpers.JsonErrorMessage(w, http.StatusUnauthorized, failedMessage)
+		return
+	}
+
+	if err = c.passkeyService.RecordPasskeyUse(passkey.ID, int64(signCount)); err != nil {
+		slog.Error("error recording passkey use", "error", err, "passkeyID", passkey.ID)
+	}
+
+	if user, err = c.userService.GetUserByEmail(passkey.UserEmail, identity.WithOnlyActiveUsers(true)); err != nil {
+		slog.Error("an error occurred while retrieving the user", "error", err, "userID", passkey.UserID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "We are sorry, but an unexpected error occurred. Please try again later.")
+		return
+	}
+
+	if err = c.saveSession(w, r, user); err != nil {
+		slog.Error("an error occurred while saving the session", "error", err, "userID", user.ID.ID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "We are sorry, but an unexpected error occurred. Please try again later.")
+		return
+	}
+
+	slog.Info("user logged in", "userID", user.ID.ID, "accountID", user.Account.ID.ID, "passkeyID", passkey.ID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventLogin, Details: "Passkey " + passkey.Name})
+	httphelpers.JsonOK(w, map[string]string{"redirect": "/"})
+}
+
+func (c IdentityController) setPasskeyCookie(w http.ResponseWriter, challenge string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCookieName,
+		Value:    challenge,
+		Path:     passkeyCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.config.TLD, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,308 @@
+package identity_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/auth2"
+	identityhandlers "github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/identity"
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/webauthn"
+)
+
+const (
+	testSite = "https://tracker.example.com"
+)
+
+func TestPasskeyLoginCanNotBeReplayed(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	relyingParty, err := webauthn.NewRelyingParty("Streaming Tracker", testSite)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tokens := &fakeUserTokenService{challenges: map[string]string{}}
+	auth := &fakeAuth{}
+
+	controller := identityhandlers.NewIdentityController(identityhandlers.IdentityControllerConfig{
+		AuditService:     fakeAuditService{},
+		Auth:             auth,
+		Config:           &configuration.Config{TLD: testSite},
+		PasskeyService:   fakePasskeyService{publicKey: coseEd25519Key(public)},
+		RelyingParty:     relyingParty,
+		UserService:      fakeUserService{},
+		UserTokenService: tokens,
+	})
+
+	/*
+	 * Begin hands out the challenge the authenticator signs.
+	 */
+	w := httptest.NewRecorder()
+	controller.BeginPasskeyLoginAction(w, httptest.NewRequest(http.MethodPost, "/login/passkey/begin", nil))
+
+	var options webauthn.RequestOptions
+
+	if err = json.NewDecoder(w.Body).Decode(&options); err != nil || options.Challenge == "" {
+		t.Fatalf("expected request options with a challenge, got %q (%v)", w.Body.String(), err)
+	}
+
+	if tokens.challenges[options.Challenge] != models.UserTokenPurposePasskeyLogin {
+		t.Fatalf("expected the challenge to be stored on the server")
+	}
+
+	body := signAssertion(t, relyingParty, private, options.Challenge)
+
+	finish := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/login/passkey/finish", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.AddCookie(&http.Cookie{Name: "passkey-login", Value: options.Challenge})
+
+		w := httptest.NewRecorder()
+		controller.FinishPasskeyLoginAction(w, r)
+
+		return w
+	}
+
+	if w = finish(); w.Code != http.StatusOK || auth.session == nil {
+		t.Fatalf("expected the first log in to work, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if _, ok := tokens.challenges[options.Challenge]; ok {
+		t.Errorf("expected the challenge to be deleted once used")
+	}
+
+	auth.session = nil
+
+	if w = finish(); w.Code != http.StatusBadRequest || auth.session != nil {
+		t.Errorf("expected a replayed log in to be refused, got %d and session %+v", w.Code, auth.session)
+	}
+}
+
+func TestPasskeyLoginNeedsAChallengeFromTheServer(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	relyingParty, _ := webauthn.NewRelyingParty("Streaming Tracker", testSite)
+	auth := &fakeAuth{}
+
+	controller := identityhandlers.NewIdentityController(identityhandlers.IdentityControllerConfig{
+		AuditService:     fakeAuditService{},
+		Auth:             auth,
+		Config:           &configuration.Config{TLD: testSite},
+		PasskeyService:   fakePasskeyService{publicKey: coseEd25519Key(public)},
+		RelyingParty:     relyingParty,
+		UserService:      fakeUserService{},
+		UserTokenService: &fakeUserTokenService{challenges: map[string]string{}},
+	})
+
+	/*
+	 * A challenge the client made up, signed and sent in its own cookie.
+	 */
+	r := httptest.NewRequest(http.MethodPost, "/login/passkey/finish", bytes.NewReader(signAssertion(t, relyingParty, private, "made-up")))
+	r.Header.Set("Content-Type", "application/json")
+	r.AddCookie(&http.Cookie{Name: "passkey-login", Value: "made-up"})
+
+	w := httptest.NewRecorder()
+	controller.FinishPasskeyLoginAction(w, r)
+
+	if w.Code != http.StatusBadRequest || auth.session != nil {
+		t.Errorf("expected the log in to be refused, got %d and session %+v", w.Code, auth.session)
+	}
+}
+
+/*
+signAssertion answers a challenge the way a passkey would, and returns the
+request body the log in page sends.
+*/
+func signAssertion(t *testing.T, relyingParty webauthn.RelyingParty, private ed25519.PrivateKey, challenge string) []byte {
+	t.Helper()
+
+	clientDataJSON, _ := json.Marshal(map[string]any{
+		"type":      "webauthn.get",
+		"challenge": challenge,
+		"origin":    relyingParty.Origin,
+	})
+
+	rpIDHash := sha256.Sum256([]byte(relyingParty.ID))
+	authData := append(rpIDHash[:], 0x05)
+	authData = binary.BigEndian.AppendUint32(authData, 0)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signature := ed25519.Sign(private, append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	var response webauthn.AssertionResponse
+
+	response.ID = base64.RawURLEncoding.EncodeToString([]byte("credential-1"))
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(clientDataJSON)
+	response.Response.AuthenticatorData = base64.RawURLEncoding.EncodeToString(authData)
+	response.Response.Signature = base64.RawURLEncoding.EncodeToString(signature)
+
+	body, _ := json.Marshal(response)
+	return body
+}
+
+/*
+coseEd25519Key encodes an Ed25519 public key as COSE: a map of key type
+OKP, algorithm EdDSA, curve Ed25519, and the key itself.
+*/
+func coseEd25519Key(public ed25519.PublicKey) []byte {
+	return append([]byte{0xa4, 0x01, 0x01, 0x03, 0x27, 0x20, 0x06, 0x21, 0x58, 0x20}, public...)
+}
+
+/*
+Fakes. Each embeds the service interface so only the methods the tests
+call need to be written. Calling any other method panics.
+*/
+
+/*
+fakeUserTokenService keeps challenges in memory, with the purpose each was
+made for, and user tokens with how many times each has failed.
+*/
+type fakeUserTokenService struct {
+	identity.UserTokenServicer
+
+	challenges map[string]string
+	tokens     map[string]*fakeUserToken
+}
+
+type fakeUserToken struct {
+	token    models.UserToken
+	failures int
+}
+
+func (s *fakeUserTokenService) CreateChallengeToken(purpose string, lifetime time.Duration) (string, error) {
+	challenge := rand.Text()
+	s.challenges[challenge] = purpose
+	return challenge, nil
+}
+
+func (s *fakeUserTokenService) DeleteChallengeToken(token, purpose string) error {
+	if s.challenges[token] != purpose {
+		return identity.ErrInvalidUserToken
+	}
+
+	delete(s.challenges, token)
+	return nil
+}
+
+func (s *fakeUserTokenService) CreateUserToken(userID int, purpose string, lifetime time.Duration) (string, error) {
+	if s.tokens == nil {
+		s.tokens = map[string]*fakeUserToken{}
+	}
+
+	token := rand.Text()
+	s.tokens[token] = &fakeUserToken{token: models.UserToken{UserID: userID, UserEmail: "adam@example.com", Purpose: purpose}}
+	return token, nil
+}
+
+func (s *fakeUserTokenService) GetUserToken(token, purpose string) (*models.UserToken, error) {
+	t, ok := s.tokens[token]
+
+	if !ok || t.token.Purpose != purpose {
+		return nil, identity.ErrInvalidUserToken
+	}
+
+	return &t.token, nil
+}
+
+func (s *fakeUserTokenService) ConsumeUserToken(token, purpose string) (int, error) {
+	t, err := s.GetUserToken(token, purpose)
+
+	if err != nil {
+		return 0, err
+	}
+
+	delete(s.tokens, token)
+	return t.UserID, nil
+}
+
+func (s *fakeUserTokenService) FailUserToken(token, purpose string, maxAttempts int) error {
+	if t, ok := s.tokens[token]; ok {
+		if t.failures++; t.failures >= maxAttempts {
+			delete(s.tokens, token)
+		}
+	}
+
+	return nil
+}
+
+type fakePasskeyService struct {
+	identity.PasskeyServicer
+
+	publicKey []byte
+}
+
+func (s fakePasskeyService) GetPasskeyByCredentialID(credentialID string) (*models.UserPasskey, error) {
+	if credentialID != base64.RawURLEncoding.EncodeToString([]byte("credential-1")) {
+		return nil, identity.ErrPasskeyNotFound
+	}
+
+	return &models.UserPasskey{ID: 1, UserID: 1, UserEmail: "adam@example.com", CredentialID: credentialID, PublicKey: s.publicKey, Name: "Laptop"}, nil
+}
+
+func (s fakePasskeyService) RecordPasskeyUse(passkeyID int, signCount int64) error {
+	return nil
+}
+
+type fakeUserService struct {
+	identity.UserServicer
+
+	passwordHash string
+}
+
+func (s fakeUserService) GetUserByEmail(email string, options ...identity.UserQueryOption) (*models.User, error) {
+	if email != "adam@example.com" {
+		return nil, identity.ErrUserNotFound
+	}
+
+	return &models.User{
+		ID:        models.ID{ID: 1},
+		Active:    true,
+		Email:     email,
+		Password:  s.passwordHash,
+		AuthToken: "auth-token",
+		Account:   &models.Account{ID: models.ID{ID: 10}},
+	}, nil
+}
+
+type fakeAuth struct {
+	auth2.Authenticator[*identity.UserSession]
+
+	session *identity.UserSession
+}
+
+func (a *fakeAuth) SaveSession(w http.ResponseWriter, r *http.Request, sessionValue *identity.UserSession) error {
+	a.session = sessionValue
+	return nil
+}
+
+type fakeAuditService struct {
+	audit.AuditServicer
+}
+
+func (s fakeAuditService) RecordAuditEvent(r *http.Request, event models.AuditEvent) error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	passwordResetTokenLifetime = time.Hour
+)
+
+/*
+GET /account/forgot-password
+*/
+func (c IdentityController) ForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	pageName := "pages/account/forgot-password"
+
+	viewData := viewmodels.ForgotPassword{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx:  httphelpers.IsHtmx(r),
+			Message: c.GetMessage(r),
+		},
+		Email: httphelpers.GetFromRequest[string](r, "email"),
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /account/forgot-password
+
+The response is the same whether or not an account exists, so this page
+can't be used to find out who has signed up.
+*/
+func (c IdentityController) ForgotPasswordAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		user  *models.User
+		token string
+	)
+
+	pageName := "pages/account/forgot-password"
+
+	viewData := viewmodels.ForgotPassword{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Email: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "email")),
+	}
+
+	if !email.IsValidEmailAddress(viewData.Email) {
+		viewData.Message = "The email address you provided appears to be invalid."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Message = template.HTML(fmt.Sprintf(
+		"If there is an account for %s, we've sent it a link to reset the password. The link works for one hour.",
+		template.HTMLEscapeString(viewData.Email),
+	))
+
+	if user, err = c.userService.GetUserByEmail(viewData.Email, identity.WithOnlyActiveUsers(true)); err != nil {
+		if !errors.Is(err, identity.ErrUserNotFound) {
+			slog.Error("error retrieving user for password reset", "error", err)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+			viewData.IsError = true
+		}
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if token, err = c.userTokenService.CreateUserToken(user.ID.ID, models.UserTokenPurposePasswordReset, passwordResetTokenLifetime); err != nil {
+		slog.Error("error creating password reset token", "error", err, "userID", user.ID.ID)
+		viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	resetLink := fmt.Sprintf("%s/account/reset-password?token=%s", c.config.TLD, url.QueryEscape(token))
+
+	mailBody := fmt.Sprintf(`
+		<p>Someone asked to reset the password for your Streaming Tracker account.</p>
+		<p>To choose a new password, click the following link:
+		<a href="%s">Reset Password</a>. The link works once, for one hour.</p>
+		<p>If you didn't ask for this, you can ignore this email. Your password
+		won't change.</p>
+	`,
+		resetLink,
+	)
+
+	if err = c.sendEmail(user.Email, "Reset your Streaming Tracker password", mailBody); err != nil {
+		slog.Error("failed to send password reset email", "error", err, "userID", user.ID.ID)
+	} else {
+		slog.Info("password reset requested", "userID", user.ID.ID)
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+GET /account/reset-password?token={token}
+*/
+func (c IdentityController) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/account/reset-password"
+
+	viewData := viewmodels.ResetPassword{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx:  httphelpers.IsHtmx(r),
+			Message: c.GetMessage(r),
+		},
+		Token: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "token")),
+	}
+
+	if _, err = c.userTokenService.GetUserToken(viewData.Token, models.UserTokenPurposePasswordReset); err != nil {
+		if !errors.Is(err, identity.ErrInvalidUserToken) {
+			slog.Error("error checking password reset token", "error", err)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+			viewData.IsError = true
+
+			c.renderer.Render(pageName, viewData, w)
+			return
+		}
+
+		viewData.Message = "This link has expired or has already been used."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.TokenIsValid = true
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /account/reset-password
+*/
+func (c IdentityController) ResetPasswordAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		userID int
+	)
+
+	pageName := "pages/account/reset-password"
+
+	viewData := viewmodels.ResetPassword{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Token:        strings.TrimSpace(httphelpers.GetFromRequest[string](r, "token")),
+		TokenIsValid: true,
+	}
+
+	password := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "password"))
+	confirmPassword := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "confirmPassword"))
+
+	if len(password) < identity.MinPasswordLength {
+		viewData.Message = template.HTML(fmt.Sprintf("The password must be at least %d characters long.", identity.MinPasswordLength))
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if password != confirmPassword {
+		viewData.Message = "The passwords don't match."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if userID, err = c.userService.ResetPassword(viewData.Token, password); err != nil {
+		viewData.IsError = true
+
+		if errors.Is(err, identity.ErrInvalidUserToken) {
+			viewData.Message = "This link has expired or has already been used."
+			viewData.TokenIsValid = false
+		} else {
+			slog.Error("error resetting password", "error", err)
+			viewData.Message = "We are sorry, but an unexpected error occurred. Please try again later."
+		}
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	slog.Info("password reset", "userID", userID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: userID, EventType: models.AuditEventPasswordReset})
+
+	_ = c.auth.DestroySession(w, r)
+	http.Redirect(w, r, "/login?message="+url.QueryEscape("Your password was changed. Please log in with your new password."), http.StatusSeeOther)
+}
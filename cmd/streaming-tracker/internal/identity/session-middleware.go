@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+/*
+CurrentSessionMiddleware makes sure the session put in the request context
+by the auth middleware still belongs to an active user with the same auth
+token, who is still a member of the session's account. The auth token
+changes when a password is reset, so this is what signs a user out of their
+other browsers, and the membership check signs out someone removed from a
+household. It also fills in the user's role in the account. Requests that
+fail the check are passed to onInvalid, with identity.ErrUserNotFound when
+the session has ended and the database error otherwise. Requests without a
+session, such as those to excluded paths, are passed through.
+*/
+func CurrentSessionMiddleware(userService identity.UserServicer, accountService identity.AccountServicer, onInvalid func(w http.ResponseWriter, r *http.Request, err error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				err  error
+				role models.AccountRole
+			)
+
+			session, ok := r.Context().Value("session").(*identity.UserSession)
+
+			if !ok || session == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if session.AuthToken == "" {
+				onInvalid(w, r, identity.ErrUserNotFound)
+				return
+			}
+
+			if _, err = userService.GetUserByIdAndAuthToken(session.UserID, session.AuthToken, identity.WithOnlyActiveUsers(true)); err != nil {
+				if !errors.Is(err, identity.ErrUserNotFound) {
+					slog.Error("error checking session", "error", err, "userID", session.UserID)
+				}
+
+				onInvalid(w, r, err)
+				return
+			}
+
+			if role, err = accountService.GetMemberRole(session.AccountID, session.UserID); err != nil {
+				if errors.Is(err, identity.ErrAccountMemberNotFound) {
+					err = identity.ErrUserNotFound
+				} else {
+					slog.Error("error checking session role", "error", err, "userID", session.UserID, "accountID", session.AccountID)
+				}
+
+				onInvalid(w, r, err)
+				return
+			}
+
+			session.Role = role
+			next.ServeHTTP(w, r)
+		})
+	}
+}
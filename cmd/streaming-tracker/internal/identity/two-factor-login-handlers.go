@@ -0,0 +1,229 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	/*
+	   twoFactorCookieName holds the token for a log in that is waiting for
+	   a two-factor code. The password has been checked, but there is no
+	   session yet.
+	*/
+	twoFactorCookieName       = "two-factor-login"
+	twoFactorLoginLifetime    = time.Minute * 5
+	maxTwoFactorLoginAttempts = 5
+)
+
+/*
+GET /login/two-factor
+*/
+func (c IdentityController) TwoFactorLoginPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	if _, err = c.getTwoFactorLogin(r); err != nil {
+		c.endTwoFactorLogin(w, r, err)
+		return
+	}
+
+	viewData := viewmodels.LoginTwoFactor{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx:  httphelpers.IsHtmx(r),
+			Message: c.GetMessage(r),
+		},
+	}
+
+	c.renderer.Render("pages/login-two-factor", viewData, w)
+}
+
+/*
+POST /login/two-factor
+*/
+func (c IdentityController) TwoFactorLoginAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		locked bool
+		token  *models.UserToken
+		user   *models.User
+	)
+
+	pageName := "pages/login-two-factor"
+
+	viewData := viewmodels.LoginTwoFactor{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+	}
+
+	if token, err = c.getTwoFactorLogin(r); err != nil {
+		c.endTwoFactorLogin(w, r, err)
+		return
+	}
+
+	/*
+	 * Wrong codes count against the same email and IP address limits as
+	 * wrong passwords, so logging in again for a new token doesn't allow
+	 * more guesses.
+	 */
+	if locked, err = c.isLoginLocked(r, token.UserEmail); err != nil {
+		c.endTwoFactorLogin(w, r, err)
+		return
+	}
+
+	if locked {
+		c.clearTwoFactorCookie(w)
+		http.Redirect(w, r, "/login?message="+url.QueryEscape(loginLockedMessage), http.StatusSeeOther)
+		return
+	}
+
+	cookie, _ := r.Cookie(twoFactorCookieName)
+	code := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "code"))
+
+	if err = c.twoFactorService.VerifyTwoFactorCode(token.UserID, code); err != nil {
+		if !errors.Is(err, identity.ErrInvalidTwoFactorCode) {
+			c.endTwoFactorLogin(w, r, err)
+			return
+		}
+
+		if err = c.userTokenService.FailUserToken(cookie.Value, models.UserTokenPurposeTwoFactorLogin, maxTwoFactorLoginAttempts); err != nil {
+			slog.Error("error recording failed two-factor code", "error", err, "userID", token.UserID)
+		}
+
+		c.recordFailedLogin(r, token.UserEmail, &models.User{ID: models.ID{ID: token.UserID}, Email: token.UserEmail})
+
+		slog.Info("wrong two-factor code", "userID", token.UserID)
+		c.recordAuditEvent(r, models.AuditEvent{UserID: token.UserID, EventType: models.AuditEventLoginFailed, Details: "Wrong two-factor code"})
+		viewData.Message = "That code didn't work. Check your authenticator app and try again."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	/*
+	 * Using the token up makes sure only one request finishes this log in.
+	 */
+	if _, err = c.userTokenService.ConsumeUserToken(cookie.Value, models.UserTokenPurposeTwoFactorLogin); err != nil {
+		c.endTwoFactorLogin(w, r, err)
+		return
+	}
+
+	if user, err = c.userService.GetUserByEmail(token.UserEmail, identity.WithOnlyActiveUsers(true)); err != nil {
+		c.endTwoFactorLogin(w, r, err)
+		return
+	}
+
+	c.clearTwoFactorCookie(w)
+	c.clearFailedLogins(r, user.Email)
+
+	if err = c.saveSession(w, r, user); err != nil {
+		c.endTwoFactorLogin(w, r, err)
+		return
+	}
+
+	slog.Info("user logged in", "userID", user.ID.ID, "accountID", user.Account.ID.ID, "twoFactor", true)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventLogin, Details: "With a two-factor code"})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+/*
+beginTwoFactorLogin remembers that a user's password was right, so the
+second step knows who is logging in.
+*/
+func (c IdentityController) beginTwoFactorLogin(w http.ResponseWriter, user *models.User) error {
+	return BeginTwoFactorLogin(w, c.userTokenService, c.config, user)
+}
+
+/*
+BeginTwoFactorLogin starts the second step of a log in for a user with
+two-factor authentication on. It is shared with the other ways to log in,
+such as a sign in provider. Send the user to /login/two-factor after it.
+*/
+func BeginTwoFactorLogin(w http.ResponseWriter, userTokenService identity.UserTokenServicer, config *configuration.Config, user *models.User) error {
+	var (
+		err   error
+		token string
+	)
+
+	if token, err = userTokenService.CreateUserToken(user.ID.ID, models.UserTokenPurposeTwoFactorLogin, twoFactorLoginLifetime); err != nil {
+		return fmt.Errorf("error creating two-factor log in token: %w", err)
+	}
+
+	/*
+	 * Lax, so the cookie is sent when a sign in provider's redirect lands
+	 * on the two-factor page. The code is only accepted by a POST, which
+	 * Lax cookies aren't sent with from other sites.
+	 */
+	http.SetCookie(w, &http.Cookie{
+		Name:     twoFactorCookieName,
+		Value:    token,
+		Path:     "/login/two-factor",
+		MaxAge:   int(twoFactorLoginLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.TLD, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+/*
+getTwoFactorLogin returns the token for the log in waiting on a two-factor
+code. Returns identity.ErrInvalidUserToken when there isn't one, or it has
+expired.
+*/
+func (c IdentityController) getTwoFactorLogin(r *http.Request) (*models.UserToken, error) {
+	var (
+		err    error
+		cookie *http.Cookie
+	)
+
+	if cookie, err = r.Cookie(twoFactorCookieName); err != nil || cookie.Value == "" {
+		return nil, identity.ErrInvalidUserToken
+	}
+
+	return c.userTokenService.GetUserToken(cookie.Value, models.UserTokenPurposeTwoFactorLogin)
+}
+
+/*
+endTwoFactorLogin sends the user back to log in again. Errors other than
+the log in having ended are logged.
+*/
+func (c IdentityController) endTwoFactorLogin(w http.ResponseWriter, r *http.Request, err error) {
+	message := "We are sorry, but an unexpected error occurred. Please try again later."
+
+	if errors.Is(err, identity.ErrInvalidUserToken) || errors.Is(err, identity.ErrUserNotFound) || errors.Is(err, identity.ErrTwoFactorNotFound) {
+		message = "Your log in expired, or too many wrong codes were entered. Please log in again."
+	} else {
+		slog.Error("error during two-factor log in", "error", err)
+	}
+
+	c.clearTwoFactorCookie(w)
+	http.Redirect(w, r, "/login?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+func (c IdentityController) clearTwoFactorCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     twoFactorCookieName,
+		Value:    "",
+		Path:     "/login/two-factor",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.config.TLD, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
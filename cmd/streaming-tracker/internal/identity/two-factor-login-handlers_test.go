@@ -0,0 +1,238 @@
+package identity_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/adamgokit/rendering"
+	identityhandlers "github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/identity"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestWrongTwoFactorCodesLockLogIns(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+
+	auth := &fakeAuth{}
+	mail := &fakeMailService{}
+	throttles := &fakeLoginThrottleService{}
+
+	controller := identityhandlers.NewIdentityController(identityhandlers.IdentityControllerConfig{
+		AuditService:         fakeAuditService{},
+		Auth:                 auth,
+		Config:               &configuration.Config{TLD: testSite},
+		EmailService:         mail,
+		LoginThrottleService: throttles,
+		Renderer:             fakeRenderer{},
+		TwoFactorService:     fakeTwoFactorService{code: "123456"},
+		UserService:          fakeUserService{passwordHash: string(hash)},
+		UserTokenService:     &fakeUserTokenService{},
+	})
+
+	logIn := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		controller.LoginAction(w, form("/login", url.Values{"email": {"adam@example.com"}, "password": {"password"}}))
+		return w
+	}
+
+	enterCode := func(cookie *http.Cookie, code string) *httptest.ResponseRecorder {
+		r := form("/login/two-factor", url.Values{"code": {code}})
+		r.AddCookie(cookie)
+
+		w := httptest.NewRecorder()
+		controller.TwoFactorLoginAction(w, r)
+		return w
+	}
+
+	/*
+	 * Each log in gets a new token, with its own allowance of wrong codes.
+	 * The password is right every time, so only the wrong codes are
+	 * counted against the email address. Five are allowed.
+	 */
+	var cookie *http.Cookie
+
+	for attempt := 1; attempt <= 6; attempt++ {
+		w := logIn()
+
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login/two-factor" {
+			t.Fatalf("attempt %d: expected to be asked for a code, got %d: %s", attempt, w.Code, w.Body.String())
+		}
+
+		if cookie = findCookie(w, "two-factor-login"); cookie == nil {
+			t.Fatalf("attempt %d: expected a two-factor log in cookie", attempt)
+		}
+
+		if w = enterCode(cookie, "000000"); !strings.Contains(w.Body.String(), "That code didn't work") {
+			t.Fatalf("attempt %d: expected the code to be refused, got %d: %s", attempt, w.Code, w.Body.String())
+		}
+	}
+
+	if len(mail.sent) != 1 {
+		t.Errorf("expected the owner to be told about the lockout, got %d emails", len(mail.sent))
+	}
+
+	/*
+	 * The right code is refused now too, as is the right password.
+	 */
+	if w := enterCode(cookie, "123456"); w.Code != http.StatusSeeOther || !strings.HasPrefix(w.Header().Get("Location"), "/login?message=Too+many+failed") {
+		t.Errorf("expected the right code to be refused while locked, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	if w := logIn(); !strings.Contains(w.Body.String(), "Too many failed log in attempts") {
+		t.Errorf("expected the password to be refused while locked, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if auth.session != nil {
+		t.Errorf("expected no session, got %+v", auth.session)
+	}
+}
+
+func TestRightTwoFactorCodeClearsFailedLogIns(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	auth := &fakeAuth{}
+	throttles := &fakeLoginThrottleService{}
+
+	controller := identityhandlers.NewIdentityController(identityhandlers.IdentityControllerConfig{
+		AuditService:         fakeAuditService{},
+		Auth:                 auth,
+		Config:               &configuration.Config{TLD: testSite},
+		LoginThrottleService: throttles,
+		Renderer:             fakeRenderer{},
+		TwoFactorService:     fakeTwoFactorService{code: "123456"},
+		UserService:          fakeUserService{passwordHash: string(hash)},
+		UserTokenService:     &fakeUserTokenService{},
+	})
+
+	emailKey := identity.EmailLoginThrottleKey("adam@example.com")
+	throttles.failures = map[string]int{emailKey: 3}
+
+	w := httptest.NewRecorder()
+	controller.LoginAction(w, form("/login", url.Values{"email": {"adam@example.com"}, "password": {"password"}}))
+
+	if throttles.failures[emailKey] != 3 {
+		t.Errorf("expected the right password alone not to clear failed log ins, got %d", throttles.failures[emailKey])
+	}
+
+	r := form("/login/two-factor", url.Values{"code": {"123456"}})
+	r.AddCookie(findCookie(w, "two-factor-login"))
+
+	w = httptest.NewRecorder()
+	controller.TwoFactorLoginAction(w, r)
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" || auth.session == nil {
+		t.Fatalf("expected to be logged in, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	if throttles.failures[emailKey] != 0 {
+		t.Errorf("expected failed log ins to be cleared, got %d", throttles.failures[emailKey])
+	}
+}
+
+func form(target string, values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+/*
+fakeLoginThrottleService counts failures in memory. A key is locked once it
+has more than its free attempts.
+*/
+type fakeLoginThrottleService struct {
+	identity.LoginThrottleServicer
+
+	failures     map[string]int
+	freeAttempts map[string]int
+}
+
+func (s *fakeLoginThrottleService) ClearLoginThrottle(key string) error {
+	delete(s.failures, key)
+	return nil
+}
+
+func (s *fakeLoginThrottleService) GetLoginLockout(keys ...string) (time.Time, error) {
+	for _, key := range keys {
+		if free, ok := s.freeAttempts[key]; ok && s.failures[key] > free {
+			return time.Now().Add(time.Minute), nil
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+func (s *fakeLoginThrottleService) RecordFailedLogin(key string, freeAttempts int) (*models.LoginThrottle, error) {
+	if s.failures == nil {
+		s.failures = map[string]int{}
+		s.freeAttempts = map[string]int{}
+	}
+
+	s.failures[key]++
+	s.freeAttempts[key] = freeAttempts
+
+	return &models.LoginThrottle{Key: key, FailedAttempts: s.failures[key]}, nil
+}
+
+type fakeTwoFactorService struct {
+	identity.TwoFactorServicer
+
+	code string
+}
+
+func (s fakeTwoFactorService) GetTwoFactor(userID int) (*models.UserTwoFactor, error) {
+	enabledAt := time.Now()
+	return &models.UserTwoFactor{UserID: userID, EnabledAt: &enabledAt}, nil
+}
+
+func (s fakeTwoFactorService) VerifyTwoFactorCode(userID int, code string) error {
+	if code != s.code {
+		return identity.ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+type fakeMailService struct {
+	sent []email.Mail
+}
+
+func (s *fakeMailService) Send(mail email.Mail) error {
+	s.sent = append(s.sent, mail)
+	return nil
+}
+
+/*
+fakeRenderer writes the page name and its data, so tests can look for the
+message shown.
+*/
+type fakeRenderer struct {
+	rendering.TemplateRenderer
+}
+
+func (fakeRenderer) Render(templateName string, data any, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s %+v", templateName, data)
+	return err
+}
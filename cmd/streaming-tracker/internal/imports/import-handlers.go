@@ -0,0 +1,415 @@
+package imports
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/imports"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/platforms"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
+)
+
+const (
+	maxUploadSize int64 = 5 << 20
+)
+
+type ImportHandlers interface {
+	ImportCSVPage(w http.ResponseWriter, r *http.Request)
+	ImportCSVPreviewAction(w http.ResponseWriter, r *http.Request)
+	ImportCSVCommitAction(w http.ResponseWriter, r *http.Request)
+	ImportWatchHistoryPage(w http.ResponseWriter, r *http.Request)
+	ImportWatchHistoryPreviewAction(w http.ResponseWriter, r *http.Request)
+	ImportWatchHistoryCommitAction(w http.ResponseWriter, r *http.Request)
+	ImportNetflixPage(w http.ResponseWriter, r *http.Request)
+	ImportNetflixPreviewAction(w http.ResponseWriter, r *http.Request)
+	ImportNetflixCommitAction(w http.ResponseWriter, r *http.Request)
+}
+
+type ImportControllerConfig struct {
+	Auth            auth2.Authenticator[*identity.UserSession]
+	Config          *configuration.Config
+	ImportService   imports.ImportServicer
+	PlatformService platforms.PlatformServicer
+	Renderer        rendering.TemplateRenderer
+	WatcherService  watchers.WatcherServicer
+}
+
+type ImportController struct {
+	base.BaseHandler
+
+	auth            auth2.Authenticator[*identity.UserSession]
+	config          *configuration.Config
+	importService   imports.ImportServicer
+	platformService platforms.PlatformServicer
+	renderer        rendering.TemplateRenderer
+	watcherService  watchers.WatcherServicer
+}
+
+func NewImportController(config ImportControllerConfig) ImportController {
+	return ImportController{
+		auth:            config.Auth,
+		config:          config.Config,
+		importService:   config.ImportService,
+		platformService: config.PlatformService,
+		renderer:        config.Renderer,
+		watcherService:  config.WatcherService,
+	}
+}
+
+/*
+GET /shows/import
+*/
+func (c ImportController) ImportCSVPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/shows/import-csv"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportCSV{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+		HasHeader: true,
+	}
+
+	if viewData.Platforms, viewData.Watchers, err = c.getPageData(session.AccountID, []int{}); err != nil {
+		slog.Error("error loading import page data", "error", err)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /shows/import/preview
+*/
+func (c ImportController) ImportCSVPreviewAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		plan models.ImportPlan
+	)
+
+	pageName := "pages/shows/import-csv"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportCSV{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+	}
+
+	if plan, err = c.buildPlan(w, r, session.AccountID, &viewData); err != nil {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Plan = &plan
+	viewData.CanImport = plan.NumErrors == 0 && plan.NumCreate+plan.NumUpdate > 0
+
+	switch {
+	case plan.NumErrors > 0:
+		viewData.Message = template.HTML(fmt.Sprintf("%d row(s) have problems. Fix the file or adjust the column mapping below, then preview again.", plan.NumErrors))
+		viewData.IsWarning = true
+
+	case !viewData.CanImport:
+		viewData.Message = "Everything in this file is already up to date. There is nothing to import."
+		viewData.IsWarning = true
+
+	default:
+		viewData.Message = "Nothing has been saved yet. Review the changes below, then click <strong>Import</strong> to save them."
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /shows/import/commit
+*/
+func (c ImportController) ImportCSVCommitAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		plan   models.ImportPlan
+		result models.ImportResult
+	)
+
+	pageName := "pages/shows/import-csv"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportCSV{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+	}
+
+	if plan, err = c.buildPlan(w, r, session.AccountID, &viewData); err != nil {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Plan = &plan
+
+	if result, err = c.importService.ApplyImport(session.AccountID, plan); err != nil {
+		viewData.IsError = true
+
+		switch {
+		case errors.Is(err, imports.ErrPlanHasErrors):
+			viewData.Message = "Some rows have problems. Please review the preview and try again."
+
+		case errors.Is(err, imports.ErrNothingToImport):
+			viewData.Message = "There is nothing to import."
+			viewData.IsError = false
+			viewData.IsWarning = true
+
+		default:
+			slog.Error("error applying import", "error", err, "accountID", session.AccountID)
+			viewData.Message = "There was an unexpected error importing your shows. Nothing was saved. Please try again later."
+		}
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	slog.Info("shows imported",
+		"accountID", session.AccountID,
+		"created", result.ShowsCreated,
+		"updated", result.ShowsUpdated,
+		"watchersCreated", result.WatchersCreated,
+	)
+
+	message := fmt.Sprintf("Import complete! %d show(s) added, %d updated, %d watcher(s) created.", result.ShowsCreated, result.ShowsUpdated, result.WatchersCreated)
+	http.Redirect(w, r, "/shows/manage?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+/*
+buildPlan reads the CSV and column mapping from the request and produces
+an import plan. The CSV comes from the uploaded file on the first preview,
+and from a hidden field after that. When an error is returned, viewData
+has already been populated with a message to display.
+*/
+func (c ImportController) buildPlan(w http.ResponseWriter, r *http.Request, accountID int, viewData *viewmodels.ImportCSV) (models.ImportPlan, error) {
+	var (
+		err     error
+		csvData string
+		records [][]string
+		plan    models.ImportPlan
+	)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	if err = r.ParseMultipartForm(maxUploadSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		slog.Error("error parsing import form", "error", err)
+		viewData.Message = "The file is too large or could not be read. Files must be smaller than 5MB."
+		viewData.IsError = true
+		viewData.Platforms, viewData.Watchers, _ = c.getPageData(accountID, []int{})
+		return plan, err
+	}
+
+	defaultWatcherIDs := httphelpers.GetFromRequest[[]int](r, "defaultWatchers")
+	viewData.DefaultPlatformID = httphelpers.GetFromRequest[int](r, "defaultPlatform")
+	viewData.HasHeader = httphelpers.GetFromRequest[string](r, "hasHeader") == "on"
+
+	if viewData.Platforms, viewData.Watchers, err = c.getPageData(accountID, defaultWatcherIDs); err != nil {
+		slog.Error("error loading import page data", "error", err)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	if csvData, err = readUploadedCSV(r); err != nil {
+		slog.Error("error reading uploaded CSV", "error", err)
+		viewData.Message = "The uploaded file could not be read. Please try again."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	if strings.TrimSpace(csvData) == "" {
+		viewData.Message = "Please choose a CSV file to import."
+		viewData.IsError = true
+		return plan, imports.ErrNothingToImport
+	}
+
+	viewData.CSVData = csvData
+
+	if records, err = imports.ReadCSV(strings.NewReader(csvData)); err != nil {
+		viewData.Message = template.HTML("The file could not be read as CSV: " + template.HTMLEscapeString(err.Error()))
+		viewData.IsError = true
+		return plan, err
+	}
+
+	if len(records) == 0 {
+		viewData.Message = "The file is empty."
+		viewData.IsError = true
+		return plan, imports.ErrNothingToImport
+	}
+
+	mapping := c.getMapping(r, records[0], viewData.HasHeader)
+	viewData.Columns = getColumns(records[0], viewData.HasHeader)
+	viewData.MappingFields = getMappingFields(mapping)
+
+	if mapping.ShowName == imports.NotMapped {
+		viewData.Message = "Please choose which column contains the show name."
+		viewData.IsError = true
+		return plan, imports.ErrNothingToImport
+	}
+
+	rows := imports.RowsFromCSV(records, mapping, viewData.HasHeader)
+
+	if plan, err = c.importService.PlanImport(
+		accountID,
+		rows,
+		imports.WithDefaultPlatformID(viewData.DefaultPlatformID),
+		imports.WithDefaultWatcherIDs(defaultWatcherIDs),
+	); err != nil {
+		slog.Error("error planning import", "error", err, "accountID", accountID)
+		viewData.Message = "There was an unexpected error reading your import. Please try again later."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	return plan, nil
+}
+
+/*
+getMapping uses the column mapping submitted with the form. On the first
+preview there is none, so it is guessed from the header row.
+*/
+func (c ImportController) getMapping(r *http.Request, firstRecord []string, hasHeader bool) imports.CSVColumnMapping {
+	if httphelpers.GetFromRequest[string](r, "hasMapping") != "true" {
+		if hasHeader {
+			return imports.GuessCSVColumnMapping(firstRecord)
+		}
+
+		return imports.CSVColumnMapping{
+			ShowName:      0,
+			Platform:      imports.NotMapped,
+			Status:        imports.NotMapped,
+			CurrentSeason: imports.NotMapped,
+			TotalSeasons:  imports.NotMapped,
+			Watchers:      imports.NotMapped,
+		}
+	}
+
+	return imports.CSVColumnMapping{
+		ShowName:      httphelpers.GetFromRequest[int](r, "mapShowName"),
+		Platform:      httphelpers.GetFromRequest[int](r, "mapPlatform"),
+		Status:        httphelpers.GetFromRequest[int](r, "mapStatus"),
+		CurrentSeason: httphelpers.GetFromRequest[int](r, "mapCurrentSeason"),
+		TotalSeasons:  httphelpers.GetFromRequest[int](r, "mapTotalSeasons"),
+		Watchers:      httphelpers.GetFromRequest[int](r, "mapWatchers"),
+	}
+}
+
+/*
+getPageData returns the platforms and watchers used to pick import defaults.
+*/
+func (c ImportController) getPageData(accountID int, selectedWatcherIDs []int) ([]*models.Platform, []viewmodels.SelectableWatcher, error) {
+	var (
+		err       error
+		platforms []*models.Platform
+		watchers  []*models.Watcher
+	)
+
+	selectable := []viewmodels.SelectableWatcher{}
+
+	if platforms, err = c.platformService.GetPlatforms(); err != nil {
+		return platforms, selectable, fmt.Errorf("error fetching platforms: %w", err)
+	}
+
+	if watchers, err = c.watcherService.GetWatchers(accountID); err != nil {
+		return platforms, selectable, fmt.Errorf("error fetching watchers: %w", err)
+	}
+
+	for _, watcher := range watchers {
+		selectable = append(selectable, viewmodels.SelectableWatcher{
+			Watcher:    watcher,
+			IsSelected: len(watchers) < 2 || slices.Contains(selectedWatcherIDs, watcher.ID.ID),
+		})
+	}
+
+	return platforms, selectable, nil
+}
+
+func readUploadedCSV(r *http.Request) (string, error) {
+	var (
+		err  error
+		file io.ReadCloser
+		b    []byte
+	)
+
+	if file, _, err = r.FormFile("csvFile"); err != nil {
+		if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+			return httphelpers.GetFromRequest[string](r, "csvData"), nil
+		}
+
+		return "", err
+	}
+
+	defer file.Close()
+
+	if b, err = io.ReadAll(file); err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func getColumns(firstRecord []string, hasHeader bool) []viewmodels.ImportColumn {
+	result := []viewmodels.ImportColumn{}
+
+	for index, value := range firstRecord {
+		name := fmt.Sprintf("Column %d", index+1)
+
+		if hasHeader && strings.TrimSpace(value) != "" {
+			name = strings.TrimSpace(value)
+		}
+
+		result = append(result, viewmodels.ImportColumn{Index: index, Name: name})
+	}
+
+	return result
+}
+
+func getMappingFields(mapping imports.CSVColumnMapping) []viewmodels.ImportMappingField {
+	return []viewmodels.ImportMappingField{
+		{Name: "mapShowName", Label: "Show name", Selected: mapping.ShowName, Required: true},
+		{Name: "mapPlatform", Label: "Platform", Selected: mapping.Platform},
+		{Name: "mapStatus", Label: "Status", Selected: mapping.Status},
+		{Name: "mapCurrentSeason", Label: "Current season", Selected: mapping.CurrentSeason},
+		{Name: "mapTotalSeasons", Label: "Total seasons", Selected: mapping.TotalSeasons},
+		{Name: "mapWatchers", Label: "Watchers", Selected: mapping.Watchers},
+	}
+}
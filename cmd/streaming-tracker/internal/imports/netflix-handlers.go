@@ -0,0 +1,331 @@
+package imports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/imports"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+var (
+	errNetflixPlatformNotFound = errors.New("netflix platform not found")
+)
+
+/*
+GET /shows/import/netflix
+*/
+func (c ImportController) ImportNetflixPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/shows/import-netflix"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportNetflix{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+		Unmatched: []models.UnmatchedImportItem{},
+		Watchers:  []*models.Watcher{},
+	}
+
+	if viewData.Watchers, err = c.watcherService.GetWatchers(session.AccountID); err != nil {
+		slog.Error("error fetching watchers", "error", err)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /shows/import/netflix/preview
+*/
+func (c ImportController) ImportNetflixPreviewAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		plan models.ImportPlan
+	)
+
+	pageName := "pages/shows/import-netflix"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportNetflix{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Unmatched: []models.UnmatchedImportItem{},
+		Watchers:  []*models.Watcher{},
+	}
+
+	if plan, err = c.buildNetflixPlan(w, r, session.AccountID, &viewData); err != nil {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Plan = &plan
+	viewData.CanImport = plan.NumErrors == 0 && plan.NumCreate+plan.NumUpdate > 0
+
+	switch {
+	case plan.NumErrors > 0:
+		viewData.Message = template.HTML(fmt.Sprintf("%d show(s) have problems and can't be imported.", plan.NumErrors))
+		viewData.IsWarning = true
+
+	case !viewData.CanImport:
+		viewData.Message = "Everything in your viewing history is already up to date. There is nothing to import."
+		viewData.IsWarning = true
+
+	default:
+		viewData.Message = "Nothing has been saved yet. Review the changes below, then click <strong>Import</strong> to save them."
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /shows/import/netflix/commit
+*/
+func (c ImportController) ImportNetflixCommitAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		plan   models.ImportPlan
+		result models.ImportResult
+	)
+
+	pageName := "pages/shows/import-netflix"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportNetflix{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Unmatched: []models.UnmatchedImportItem{},
+		Watchers:  []*models.Watcher{},
+	}
+
+	if plan, err = c.buildNetflixPlan(w, r, session.AccountID, &viewData); err != nil {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Plan = &plan
+
+	if result, err = c.importService.ApplyImport(session.AccountID, plan); err != nil {
+		viewData.IsError = true
+
+		switch {
+		case errors.Is(err, imports.ErrPlanHasErrors):
+			viewData.Message = "Some shows have problems. Please review the preview and try again."
+
+		case errors.Is(err, imports.ErrNothingToImport):
+			viewData.Message = "There is nothing to import."
+			viewData.IsError = false
+			viewData.IsWarning = true
+
+		default:
+			slog.Error("error applying Netflix import", "error", err, "accountID", session.AccountID)
+			viewData.Message = "There was an unexpected error importing your shows. Nothing was saved. Please try again later."
+		}
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	slog.Info("Netflix viewing history imported",
+		"accountID", session.AccountID,
+		"created", result.ShowsCreated,
+		"updated", result.ShowsUpdated,
+	)
+
+	message := fmt.Sprintf("Import complete! %d show(s) added, %d updated.", result.ShowsCreated, result.ShowsUpdated)
+	http.Redirect(w, r, "/shows/manage?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+/*
+buildNetflixPlan reads NetflixViewingHistory.csv, matches each show against
+TVMaze, and produces an import plan with every show on Netflix for the
+chosen watcher. Shows that TVMaze doesn't know about are still imported
+using the furthest season found in the file. Like the Trakt and TV Time
+import, matched rows are sent back with the preview so matching only
+happens once. When an error is returned, viewData has already been
+populated with a message to display.
+*/
+func (c ImportController) buildNetflixPlan(w http.ResponseWriter, r *http.Request, accountID int, viewData *viewmodels.ImportNetflix) (models.ImportPlan, error) {
+	var (
+		err               error
+		rows              []models.ImportRow
+		plan              models.ImportPlan
+		platforms         []*models.Platform
+		netflixPlatformID int
+	)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	if err = r.ParseMultipartForm(maxUploadSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		slog.Error("error parsing Netflix import form", "error", err)
+		viewData.Message = "The file is too large or could not be read. Files must be smaller than 5MB."
+		viewData.IsError = true
+		viewData.Watchers, _ = c.watcherService.GetWatchers(accountID)
+		return plan, err
+	}
+
+	viewData.WatcherID = httphelpers.GetFromRequest[int](r, "watcher")
+	viewData.NumSkipped = httphelpers.GetFromRequest[int](r, "numSkipped")
+
+	if viewData.Watchers, err = c.watcherService.GetWatchers(accountID); err != nil {
+		slog.Error("error fetching watchers", "error", err)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	if platforms, err = c.platformService.GetPlatforms(); err != nil {
+		slog.Error("error fetching platforms", "error", err)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	for _, platform := range platforms {
+		if strings.EqualFold(platform.Name, "Netflix") {
+			netflixPlatformID = platform.ID.ID
+		}
+	}
+
+	if netflixPlatformID == 0 {
+		slog.Error("Netflix platform is missing from the platforms table")
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+		return plan, errNetflixPlatformNotFound
+	}
+
+	if viewData.WatcherID == 0 {
+		viewData.Message = "Please choose who watched these shows."
+		viewData.IsError = true
+		return plan, imports.ErrNothingToImport
+	}
+
+	if r.MultipartForm != nil && len(r.MultipartForm.File["viewingHistory"]) > 0 {
+		if rows, err = c.matchNetflixViewingHistory(r.MultipartForm.File["viewingHistory"][0], viewData); err != nil {
+			return plan, err
+		}
+	} else {
+		if err = json.Unmarshal([]byte(httphelpers.GetFromRequest[string](r, "rowsData")), &rows); err != nil {
+			viewData.Message = "Please choose your NetflixViewingHistory.csv file."
+			viewData.IsError = true
+			return plan, imports.ErrNothingToImport
+		}
+
+		if err = json.Unmarshal([]byte(httphelpers.GetFromRequest[string](r, "unmatchedData")), &viewData.Unmatched); err != nil {
+			viewData.Unmatched = []models.UnmatchedImportItem{}
+		}
+	}
+
+	if len(rows) == 0 {
+		viewData.Message = "No TV shows were found in your viewing history."
+		viewData.IsError = true
+		return plan, imports.ErrNothingToImport
+	}
+
+	rowsData, _ := json.Marshal(rows)
+	unmatchedData, _ := json.Marshal(viewData.Unmatched)
+	viewData.RowsData = string(rowsData)
+	viewData.UnmatchedData = string(unmatchedData)
+
+	if plan, err = c.importService.PlanImport(
+		accountID,
+		rows,
+		imports.WithForcePlatformID(netflixPlatformID),
+		imports.WithDefaultWatcherIDs([]int{viewData.WatcherID}),
+	); err != nil {
+		slog.Error("error planning Netflix import", "error", err, "accountID", accountID)
+		viewData.Message = "There was an unexpected error reading your import. Please try again later."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	return plan, nil
+}
+
+func (c ImportController) matchNetflixViewingHistory(fileHeader *multipart.FileHeader, viewData *viewmodels.ImportNetflix) ([]models.ImportRow, error) {
+	var (
+		err     error
+		file    multipart.File
+		rows    []models.ImportRow
+		matched []models.ImportRow
+	)
+
+	if file, err = fileHeader.Open(); err != nil {
+		slog.Error("error opening Netflix viewing history", "error", err)
+		viewData.Message = "The uploaded file could not be read. Please try again."
+		viewData.IsError = true
+		return rows, err
+	}
+
+	defer file.Close()
+
+	history := imports.NewWatchHistory()
+
+	if viewData.NumSkipped, err = history.AddNetflixViewingHistory(file); err != nil {
+		slog.Error("error reading Netflix viewing history", "error", err)
+		viewData.Message = "The file could not be read. Please upload the NetflixViewingHistory.csv file downloaded from your Netflix account."
+		viewData.IsError = true
+		return rows, err
+	}
+
+	shows := history.Shows()
+
+	if matched, viewData.Unmatched, err = c.importService.MatchWatchHistory(shows); err != nil {
+		slog.Error("error matching Netflix viewing history", "error", err)
+		viewData.Message = "We couldn't reach TVMaze to look up your shows. Please try again later."
+		viewData.IsError = true
+		return rows, err
+	}
+
+	unmatchedTitles := map[string]struct{}{}
+
+	for _, item := range viewData.Unmatched {
+		unmatchedTitles[item.Title] = struct{}{}
+	}
+
+	rows = append(rows, matched...)
+
+	for _, show := range shows {
+		if _, ok := unmatchedTitles[show.Title]; ok {
+			rows = append(rows, imports.RowFromUnmatchedWatchHistory(show))
+		}
+	}
+
+	for index := range rows {
+		rows[index].RowNumber = index + 1
+	}
+
+	return rows, nil
+}
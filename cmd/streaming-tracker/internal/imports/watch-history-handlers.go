@@ -0,0 +1,298 @@
+package imports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/imports"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	maxWatchHistoryUploadSize int64 = 20 << 20
+)
+
+var (
+	errUnsupportedExportFile = errors.New("unsupported export file")
+)
+
+/*
+GET /shows/import/history
+*/
+func (c ImportController) ImportWatchHistoryPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	pageName := "pages/shows/import-history"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportWatchHistory{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+		Unmatched: []models.UnmatchedImportItem{},
+	}
+
+	if viewData.Platforms, viewData.Watchers, err = c.getPageData(session.AccountID, []int{}); err != nil {
+		slog.Error("error loading import page data", "error", err)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /shows/import/history/preview
+*/
+func (c ImportController) ImportWatchHistoryPreviewAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		plan models.ImportPlan
+	)
+
+	pageName := "pages/shows/import-history"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportWatchHistory{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Unmatched: []models.UnmatchedImportItem{},
+	}
+
+	if plan, err = c.buildWatchHistoryPlan(w, r, session.AccountID, &viewData); err != nil {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Plan = &plan
+	viewData.CanImport = plan.NumErrors == 0 && plan.NumCreate+plan.NumUpdate > 0
+
+	switch {
+	case len(plan.Items) == 0:
+		viewData.Message = "None of the shows in your export could be matched automatically. You can add them by hand using the links below."
+		viewData.IsWarning = true
+
+	case plan.NumErrors > 0:
+		viewData.Message = template.HTML(fmt.Sprintf("%d show(s) have problems. Choose a default platform for shows that don't have one, then preview again.", plan.NumErrors))
+		viewData.IsWarning = true
+
+	case !viewData.CanImport:
+		viewData.Message = "Everything in your export is already up to date. There is nothing to import."
+		viewData.IsWarning = true
+
+	default:
+		viewData.Message = "Nothing has been saved yet. Review the changes below, then click <strong>Import</strong> to save them."
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /shows/import/history/commit
+*/
+func (c ImportController) ImportWatchHistoryCommitAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		plan   models.ImportPlan
+		result models.ImportResult
+	)
+
+	pageName := "pages/shows/import-history"
+	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't import shows."), http.StatusSeeOther)
+		return
+	}
+
+	viewData := viewmodels.ImportWatchHistory{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Unmatched: []models.UnmatchedImportItem{},
+	}
+
+	if plan, err = c.buildWatchHistoryPlan(w, r, session.AccountID, &viewData); err != nil {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.Plan = &plan
+
+	if result, err = c.importService.ApplyImport(session.AccountID, plan); err != nil {
+		viewData.IsError = true
+
+		switch {
+		case errors.Is(err, imports.ErrPlanHasErrors):
+			viewData.Message = "Some shows have problems. Please review the preview and try again."
+
+		case errors.Is(err, imports.ErrNothingToImport):
+			viewData.Message = "There is nothing to import."
+			viewData.IsError = false
+			viewData.IsWarning = true
+
+		default:
+			slog.Error("error applying watch history import", "error", err, "accountID", session.AccountID)
+			viewData.Message = "There was an unexpected error importing your shows. Nothing was saved. Please try again later."
+		}
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	slog.Info("watch history imported",
+		"accountID", session.AccountID,
+		"created", result.ShowsCreated,
+		"updated", result.ShowsUpdated,
+		"unmatched", len(viewData.Unmatched),
+	)
+
+	message := fmt.Sprintf("Import complete! %d show(s) added, %d updated.", result.ShowsCreated, result.ShowsUpdated)
+
+	if len(viewData.Unmatched) > 0 {
+		message += fmt.Sprintf(" %d show(s) could not be matched and need to be added by hand.", len(viewData.Unmatched))
+	}
+
+	http.Redirect(w, r, "/shows/manage?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+/*
+buildWatchHistoryPlan matches uploaded export files against TVMaze and
+produces an import plan. Matching is slow, so the matched rows are sent
+back with the preview and reused when previewing again or importing.
+When an error is returned, viewData has already been populated with a
+message to display.
+*/
+func (c ImportController) buildWatchHistoryPlan(w http.ResponseWriter, r *http.Request, accountID int, viewData *viewmodels.ImportWatchHistory) (models.ImportPlan, error) {
+	var (
+		err  error
+		rows []models.ImportRow
+		plan models.ImportPlan
+	)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWatchHistoryUploadSize)
+
+	if err = r.ParseMultipartForm(maxWatchHistoryUploadSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		slog.Error("error parsing watch history import form", "error", err)
+		viewData.Message = "The files are too large or could not be read. Uploads must be smaller than 20MB."
+		viewData.IsError = true
+		viewData.Platforms, viewData.Watchers, _ = c.getPageData(accountID, []int{})
+		return plan, err
+	}
+
+	defaultWatcherIDs := httphelpers.GetFromRequest[[]int](r, "defaultWatchers")
+	viewData.DefaultPlatformID = httphelpers.GetFromRequest[int](r, "defaultPlatform")
+
+	if viewData.Platforms, viewData.Watchers, err = c.getPageData(accountID, defaultWatcherIDs); err != nil {
+		slog.Error("error loading import page data", "error", err)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	if r.MultipartForm != nil && len(r.MultipartForm.File["exportFiles"]) > 0 {
+		history := imports.NewWatchHistory()
+
+		for _, fileHeader := range r.MultipartForm.File["exportFiles"] {
+			if err = readExportFile(history, fileHeader); err != nil {
+				slog.Error("error reading export file", "fileName", fileHeader.Filename, "error", err)
+				viewData.Message = template.HTML(fmt.Sprintf("<strong>%s</strong> could not be read. Upload the .json files from a Trakt export or the .csv files from a TV Time export.", template.HTMLEscapeString(fileHeader.Filename)))
+				viewData.IsError = true
+				return plan, err
+			}
+		}
+
+		if rows, viewData.Unmatched, err = c.importService.MatchWatchHistory(history.Shows()); err != nil {
+			slog.Error("error matching watch history", "error", err, "accountID", accountID)
+			viewData.Message = "We couldn't reach TVMaze to look up your shows. Please try again later."
+			viewData.IsError = true
+			return plan, err
+		}
+	} else {
+		if err = json.Unmarshal([]byte(httphelpers.GetFromRequest[string](r, "rowsData")), &rows); err != nil {
+			viewData.Message = "Please choose one or more export files to import."
+			viewData.IsError = true
+			return plan, imports.ErrNothingToImport
+		}
+
+		if err = json.Unmarshal([]byte(httphelpers.GetFromRequest[string](r, "unmatchedData")), &viewData.Unmatched); err != nil {
+			viewData.Unmatched = []models.UnmatchedImportItem{}
+		}
+	}
+
+	if len(rows) == 0 && len(viewData.Unmatched) == 0 {
+		viewData.Message = "No shows were found in the uploaded files."
+		viewData.IsError = true
+		return plan, imports.ErrNothingToImport
+	}
+
+	rowsData, _ := json.Marshal(rows)
+	unmatchedData, _ := json.Marshal(viewData.Unmatched)
+	viewData.RowsData = string(rowsData)
+	viewData.UnmatchedData = string(unmatchedData)
+
+	if plan, err = c.importService.PlanImport(
+		accountID,
+		rows,
+		imports.WithDefaultPlatformID(viewData.DefaultPlatformID),
+		imports.WithDefaultWatcherIDs(defaultWatcherIDs),
+	); err != nil {
+		slog.Error("error planning watch history import", "error", err, "accountID", accountID)
+		viewData.Message = "There was an unexpected error reading your import. Please try again later."
+		viewData.IsError = true
+		return plan, err
+	}
+
+	return plan, nil
+}
+
+/*
+readExportFile adds a single uploaded export file to the watch history.
+Trakt exports are JSON and TV Time exports are CSV.
+*/
+func readExportFile(history *imports.WatchHistory, fileHeader *multipart.FileHeader) error {
+	var (
+		err  error
+		file multipart.File
+	)
+
+	if file, err = fileHeader.Open(); err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".json":
+		return history.AddTraktExport(file)
+
+	case ".csv":
+		return history.AddTVTimeExport(file)
+	}
+
+	return errUnsupportedExportFile
+}
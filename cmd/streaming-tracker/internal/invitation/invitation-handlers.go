@@ -0,0 +1,221 @@
+package invitation
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/datetime"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	registrationInvitationLifetime = time.Hour * 24 * 7
+)
+
+type InvitationHandlers interface {
+	ManageInvitationsPage(w http.ResponseWriter, r *http.Request)
+	SendInvitationAction(w http.ResponseWriter, r *http.Request)
+}
+
+type InvitationControllerConfig struct {
+	AccountService                identity.AccountServicer
+	Auth                          auth2.Authenticator[*identity.UserSession]
+	Config                        *configuration.Config
+	EmailService                  email.MailServicer
+	RegistrationInvitationService identity.RegistrationInvitationServicer
+	Renderer                      rendering.TemplateRenderer
+}
+
+type InvitationController struct {
+	base.BaseHandler
+
+	accountService                identity.AccountServicer
+	auth                          auth2.Authenticator[*identity.UserSession]
+	config                        *configuration.Config
+	emailService                  email.MailServicer
+	registrationInvitationService identity.RegistrationInvitationServicer
+	renderer                      rendering.TemplateRenderer
+}
+
+func NewInvitationController(config InvitationControllerConfig) InvitationController {
+	return InvitationController{
+		accountService:                config.AccountService,
+		auth:                          config.Auth,
+		config:                        config.Config,
+		emailService:                  config.EmailService,
+		registrationInvitationService: config.RegistrationInvitationService,
+		renderer:                      config.Renderer,
+	}
+}
+
+/*
+GET /account/invitations
+*/
+func (c InvitationController) ManageInvitationsPage(w http.ResponseWriter, r *http.Request) {
+	viewData := viewmodels.ManageInvitations{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+	}
+
+	c.render(w, r, viewData)
+}
+
+/*
+POST /account/invitations/send
+*/
+func (c InvitationController) SendInvitationAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		code string
+	)
+
+	session := c.GetSession(r)
+
+	viewData := viewmodels.ManageInvitations{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		Email: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "email")),
+	}
+
+	if !c.canInvite(session) {
+		c.render(w, r, viewData)
+		return
+	}
+
+	if !email.IsValidEmailAddress(viewData.Email) {
+		viewData.Message = "The email address you provided appears to be invalid."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	request := models.CreateRegistrationInvitationRequest{
+		Email:     viewData.Email,
+		InvitedBy: session.UserID,
+		Lifetime:  registrationInvitationLifetime,
+	}
+
+	if code, err = c.registrationInvitationService.CreateRegistrationInvitation(request); err != nil {
+		slog.Error("error creating registration invitation", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error sending the invitation. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	signUpLink := fmt.Sprintf("%s/account/sign-up?invitation=%s", c.config.TLD, url.QueryEscape(code))
+
+	mailBody := fmt.Sprintf(`
+		<p>%s invited you to keep track of your shows with Streaming Tracker!</p>
+		<p>To create your account, please click the following link:
+		<a href="%s">Sign Up</a>. If you're asked for an invitation code,
+		enter: %s</p>
+		<p>This invitation works once, and expires in 7 days.</p>
+	`,
+		template.HTMLEscapeString(session.Email),
+		signUpLink,
+		code,
+	)
+
+	err = c.emailService.Send(email.Mail{
+		Body:       mailBody,
+		BodyIsHtml: true,
+		From:       email.EmailAddress{Email: c.config.EmailFrom},
+		Subject:    "You're invited to Streaming Tracker",
+		To: []email.EmailAddress{
+			{
+				Email: fmt.Sprintf("%s <%s>", viewData.Email, viewData.Email),
+			},
+		},
+	})
+
+	if err != nil {
+		slog.Error("failed to send registration invitation", "error", err, "userID", session.UserID)
+		http.Redirect(w, r, "/account/invitations?message="+url.QueryEscape("The invitation was created, but we couldn't email it. Please try again later."), http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("registration invitation sent", "userID", session.UserID)
+	http.Redirect(w, r, "/account/invitations?message="+url.QueryEscape(fmt.Sprintf("We sent an invitation to %s.", viewData.Email)), http.StatusSeeOther)
+}
+
+/*
+canInvite returns true when registration isn't closed and the user owns
+the account they are signed in to.
+*/
+func (c InvitationController) canInvite(session *identity.UserSession) bool {
+	var (
+		err     error
+		account *models.Account
+	)
+
+	if c.config.RegistrationMode == configuration.RegistrationModeClosed {
+		return false
+	}
+
+	if account, err = c.accountService.GetAccountByID(session.AccountID); err != nil {
+		slog.Error("error fetching account to check invitation permission", "error", err, "accountID", session.AccountID)
+		return false
+	}
+
+	return account.Owner == session.UserID
+}
+
+/*
+render fills in who can send invitations and the user's pending
+invitations, then renders the page.
+*/
+func (c InvitationController) render(w http.ResponseWriter, r *http.Request, viewData viewmodels.ManageInvitations) {
+	var (
+		err         error
+		invitations []models.RegistrationInvitation
+	)
+
+	session := c.GetSession(r)
+	viewData.CanInvite = c.canInvite(session)
+	viewData.Invitations = []viewmodels.InvitationDisplay{}
+
+	if !viewData.CanInvite && viewData.Message == "" {
+		if c.config.RegistrationMode == configuration.RegistrationModeClosed {
+			viewData.Message = "Sign ups are closed right now, so invitations can't be sent."
+		} else {
+			viewData.Message = "Only the account owner can send invitations."
+		}
+
+		viewData.IsWarning = true
+	}
+
+	if invitations, err = c.registrationInvitationService.GetPendingRegistrationInvitations(session.UserID); err != nil {
+		slog.Error("error fetching registration invitations", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	}
+
+	for _, invitation := range invitations {
+		viewData.Invitations = append(viewData.Invitations, viewmodels.InvitationDisplay{
+			Email:     invitation.Email,
+			CreatedAt: datetime.DisplayDate(invitation.CreatedAt),
+			ExpiresAt: datetime.DisplayDate(invitation.ExpiresAt),
+		})
+	}
+
+	c.renderer.Render("pages/account/invitations", viewData, w)
+}
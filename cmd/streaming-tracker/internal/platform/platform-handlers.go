@@ -3,7 +3,7 @@ package platform
 import (
 	"github.com/adampresley/adamgokit/auth2"
 	"github.com/adampresley/adamgokit/rendering"
-	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
 	"github.com/adampresley/streaming-tracker/pkg/identity"
 )
 
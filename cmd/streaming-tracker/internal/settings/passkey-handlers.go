@@ -0,0 +1,183 @@
+package settings
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/webauthn"
+)
+
+const (
+	/*
+	   passkeyCookieName holds the challenge for a passkey registration
+	   while the browser asks the user to make one.
+	*/
+	passkeyCookieName    = "passkey-registration"
+	passkeyCookiePath    = "/account/settings/passkeys"
+	maxPasskeyNameLength = 100
+)
+
+type finishPasskeyRequest struct {
+	Name       string                        `json:"name"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+/*
+POST /account/settings/passkeys/begin
+
+Returns the options for navigator.credentials.create.
+*/
+func (c SettingsController) BeginPasskeyAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		challenge string
+		passkeys  []models.UserPasskey
+		existing  [][]byte
+		id        []byte
+	)
+
+	session := c.GetSession(r)
+
+	if passkeys, err = c.passkeyService.GetPasskeys(session.UserID); err != nil {
+		slog.Error("error fetching passkeys", "error", err, "userID", session.UserID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "There was an unexpected error adding a passkey. Please try again later.")
+		return
+	}
+
+	for _, passkey := range passkeys {
+		if id, err = base64.RawURLEncoding.DecodeString(passkey.CredentialID); err == nil {
+			existing = append(existing, id)
+		}
+	}
+
+	if challenge, err = webauthn.NewChallenge(); err != nil {
+		slog.Error("error starting passkey registration", "error", err, "userID", session.UserID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "There was an unexpected error adding a passkey. Please try again later.")
+		return
+	}
+
+	user := webauthn.User{
+		ID:          []byte(strconv.Itoa(session.UserID)),
+		Name:        session.Email,
+		DisplayName: session.Email,
+	}
+
+	c.setPasskeyCookie(w, challenge, int(webauthn.Timeout.Seconds()))
+	httphelpers.JsonOK(w, c.relyingParty.CreationOptions(challenge, user, existing))
+}
+
+/*
+POST /account/settings/passkeys/finish
+*/
+func (c SettingsController) FinishPasskeyAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err        error
+		cookie     *http.Cookie
+		request    finishPasskeyRequest
+		credential *webauthn.Credential
+	)
+
+	session := c.GetSession(r)
+
+	if cookie, err = r.Cookie(passkeyCookieName); err != nil || cookie.Value == "" {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "Adding your passkey took too long. Please try again.")
+		return
+	}
+
+	c.setPasskeyCookie(w, "", -1)
+
+	if err = httphelpers.ReadJSONBody(r, &request); err != nil {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "That passkey couldn't be added. Please try again.")
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+
+	if request.Name == "" {
+		request.Name = "Passkey"
+	}
+
+	if utf8.RuneCountInString(request.Name) > maxPasskeyNameLength {
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, fmt.Sprintf("Passkey names can be at most %d characters.", maxPasskeyNameLength))
+		return
+	}
+
+	if credential, err = c.relyingParty.VerifyRegistration(cookie.Value, request.Credential); err != nil {
+		slog.Warn("passkey registration failed", "error", err, "userID", session.UserID)
+		httphelpers.JsonErrorMessage(w, http.StatusBadRequest, "That passkey couldn't be added. Please try again.")
+		return
+	}
+
+	_, err = c.passkeyService.CreatePasskey(models.CreatePasskeyRequest{
+		UserID:       session.UserID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Name:         request.Name,
+	})
+
+	if err != nil {
+		if errors.Is(err, identity.ErrPasskeyInUse) {
+			httphelpers.JsonErrorMessage(w, http.StatusConflict, "That passkey is already registered.")
+			return
+		}
+
+		slog.Error("error saving passkey", "error", err, "userID", session.UserID)
+		httphelpers.JsonErrorMessage(w, http.StatusInternalServerError, "There was an unexpected error adding a passkey. Please try again later.")
+		return
+	}
+
+	slog.Info("passkey added", "userID", session.UserID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventPasskeyAdded, Details: request.Name})
+	message := fmt.Sprintf("Your passkey %q was added. You can use it to log in.", request.Name)
+	httphelpers.JsonOK(w, map[string]string{"redirect": "/account/settings?message=" + url.QueryEscape(message)})
+}
+
+/*
+POST /account/settings/passkeys/delete
+*/
+func (c SettingsController) DeletePasskeyAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	passkeyID := httphelpers.GetFromRequest[int](r, "id")
+	message := "Your passkey was removed. It can no longer be used to log in."
+
+	if err = c.passkeyService.DeletePasskey(session.UserID, passkeyID); err != nil {
+		if errors.Is(err, identity.ErrPasskeyNotFound) {
+			message = "That passkey isn't registered to your account."
+		} else {
+			slog.Error("error deleting passkey", "error", err, "passkeyID", passkeyID, "userID", session.UserID)
+			message = "There was an unexpected error removing the passkey. Please try again later."
+		}
+	} else {
+		slog.Info("passkey removed", "passkeyID", passkeyID, "userID", session.UserID)
+		c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventPasskeyRemoved})
+	}
+
+	c.redirect(w, r, message)
+}
+
+func (c SettingsController) setPasskeyCookie(w http.ResponseWriter, challenge string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCookieName,
+		Value:    challenge,
+		Path:     passkeyCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.config.TLD, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,126 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/datetime"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/useragent"
+)
+
+/*
+GET /account/settings/sessions
+
+Lists the devices the user is logged in on.
+*/
+func (c SettingsController) SessionsPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		sessions []models.LoginSession
+	)
+
+	pageName := "pages/account/sessions"
+	session := c.GetSession(r)
+
+	viewData := viewmodels.LoginSessions{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+		Sessions: []viewmodels.LoginSessionDisplay{},
+	}
+
+	if sessions, err = c.loginSessionService.GetLoginSessions(session.UserID); err != nil {
+		slog.Error("error fetching login sessions", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error getting your sessions. Please try again later."
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	currentID := c.loginSessionService.CurrentLoginSessionID(r)
+
+	for _, s := range sessions {
+		viewData.Sessions = append(viewData.Sessions, viewmodels.LoginSessionDisplay{
+			ID:        s.ID,
+			Device:    useragent.Describe(s.UserAgent),
+			IPAddress: s.IPAddress,
+			CreatedAt: datetime.DisplayDate(s.CreatedAt),
+			LastSeen:  datetime.DisplayDateTime(s.LastSeenAt),
+			IsCurrent: s.ID == currentID,
+		})
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+POST /account/settings/sessions/delete
+
+Logs one of the user's other devices out.
+*/
+func (c SettingsController) DeleteSessionAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	sessionID := httphelpers.GetFromRequest[int](r, "id")
+	message := "That device was logged out."
+
+	if sessionID == c.loginSessionService.CurrentLoginSessionID(r) {
+		c.redirectToSessions(w, r, "Use Log Out to log out of this device.")
+		return
+	}
+
+	if err = c.loginSessionService.DeleteLoginSession(session.UserID, sessionID); err != nil {
+		if errors.Is(err, identity.ErrLoginSessionNotFound) {
+			message = "That device is already logged out."
+		} else {
+			slog.Error("error deleting login session", "error", err, "sessionID", sessionID, "userID", session.UserID)
+			message = "There was an unexpected error logging that device out. Please try again later."
+		}
+	} else {
+		slog.Info("login session deleted", "sessionID", sessionID, "userID", session.UserID)
+		c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventSessionsLoggedOut, Details: "1 device"})
+	}
+
+	c.redirectToSessions(w, r, message)
+}
+
+/*
+POST /account/settings/sessions/delete-others
+
+Logs the user out everywhere except this device.
+*/
+func (c SettingsController) DeleteOtherSessionsAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		count int64
+	)
+
+	session := c.GetSession(r)
+	currentID := c.loginSessionService.CurrentLoginSessionID(r)
+
+	if count, err = c.loginSessionService.DeleteOtherLoginSessions(session.UserID, currentID); err != nil {
+		slog.Error("error deleting other login sessions", "error", err, "userID", session.UserID)
+		c.redirectToSessions(w, r, "There was an unexpected error logging your other devices out. Please try again later.")
+		return
+	}
+
+	slog.Info("other login sessions deleted", "count", count, "userID", session.UserID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventSessionsLoggedOut, Details: fmt.Sprintf("%d devices", count)})
+	c.redirectToSessions(w, r, fmt.Sprintf("Logged out of %d other devices.", count))
+}
+
+func (c SettingsController) redirectToSessions(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/account/settings/sessions?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
@@ -0,0 +1,476 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/adamgokit/email"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/datetime"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/webauthn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type SettingsHandlers interface {
+	AccountSettingsPage(w http.ResponseWriter, r *http.Request)
+	BeginPasskeyAction(w http.ResponseWriter, r *http.Request)
+	FinishPasskeyAction(w http.ResponseWriter, r *http.Request)
+	DeletePasskeyAction(w http.ResponseWriter, r *http.Request)
+	SessionsPage(w http.ResponseWriter, r *http.Request)
+	DeleteSessionAction(w http.ResponseWriter, r *http.Request)
+	DeleteOtherSessionsAction(w http.ResponseWriter, r *http.Request)
+	CancelEmailChangeAction(w http.ResponseWriter, r *http.Request)
+	ChangeEmailAction(w http.ResponseWriter, r *http.Request)
+	ChangePasswordAction(w http.ResponseWriter, r *http.Request)
+	TwoFactorPage(w http.ResponseWriter, r *http.Request)
+	BeginTwoFactorAction(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactorAction(w http.ResponseWriter, r *http.Request)
+	DisableTwoFactorAction(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodesAction(w http.ResponseWriter, r *http.Request)
+	UnlinkIdentityAction(w http.ResponseWriter, r *http.Request)
+	VerifyEmailAction(w http.ResponseWriter, r *http.Request)
+}
+
+type SettingsControllerConfig struct {
+	AuditService        audit.AuditServicer
+	Auth                auth2.Authenticator[*identity.UserSession]
+	Config              *configuration.Config
+	EmailService        email.MailServicer
+	LoginSessionService identity.LoginSessionServicer
+	PasskeyService      identity.PasskeyServicer
+	RelyingParty        webauthn.RelyingParty
+	Renderer            rendering.TemplateRenderer
+	TwoFactorService    identity.TwoFactorServicer
+	UserIdentityService identity.UserIdentityServicer
+	UserService         identity.UserServicer
+}
+
+type SettingsController struct {
+	base.BaseHandler
+
+	auditService        audit.AuditServicer
+	auth                auth2.Authenticator[*identity.UserSession]
+	config              *configuration.Config
+	emailService        email.MailServicer
+	loginSessionService identity.LoginSessionServicer
+	passkeyService      identity.PasskeyServicer
+	relyingParty        webauthn.RelyingParty
+	renderer            rendering.TemplateRenderer
+	twoFactorService    identity.TwoFactorServicer
+	userIdentityService identity.UserIdentityServicer
+	userService         identity.UserServicer
+}
+
+func NewSettingsController(config SettingsControllerConfig) SettingsController {
+	return SettingsController{
+		auditService:        config.AuditService,
+		auth:                config.Auth,
+		config:              config.Config,
+		emailService:        config.EmailService,
+		loginSessionService: config.LoginSessionService,
+		passkeyService:      config.PasskeyService,
+		relyingParty:        config.RelyingParty,
+		renderer:            config.Renderer,
+		twoFactorService:    config.TwoFactorService,
+		userIdentityService: config.UserIdentityService,
+		userService:         config.UserService,
+	}
+}
+
+/*
+GET /account/settings?code={code}
+
+The link in the email change message includes the code so it can be filled
+in for the user.
+*/
+func (c SettingsController) AccountSettingsPage(w http.ResponseWriter, r *http.Request) {
+	viewData := viewmodels.AccountSettings{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+		VerificationCode: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "code")),
+	}
+
+	c.render(w, r, viewData)
+}
+
+/*
+POST /account/settings/password
+*/
+func (c SettingsController) ChangePasswordAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		user      *models.User
+		authToken string
+	)
+
+	session := c.GetSession(r)
+
+	viewData := viewmodels.AccountSettings{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+	}
+
+	currentPassword := httphelpers.GetFromRequest[string](r, "currentPassword")
+	newPassword := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "newPassword"))
+	confirmPassword := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "confirmPassword"))
+
+	if user, err = c.userService.GetUserByIdAndAuthToken(session.UserID, session.AuthToken, identity.WithOnlyActiveUsers(true)); err != nil {
+		slog.Error("error fetching user to change password", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error changing your password. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	switch {
+	case bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)) != nil:
+		viewData.Message = "Your current password is incorrect."
+		viewData.IsError = true
+
+	case len(newPassword) < identity.MinPasswordLength:
+		viewData.Message = template.HTML(fmt.Sprintf("The new password must be at least %d characters long.", identity.MinPasswordLength))
+		viewData.IsError = true
+
+	case newPassword != confirmPassword:
+		viewData.Message = "The new passwords don't match."
+		viewData.IsError = true
+	}
+
+	if viewData.IsError {
+		c.render(w, r, viewData)
+		return
+	}
+
+	if authToken, err = c.userService.UpdatePassword(session.UserID, newPassword); err != nil {
+		slog.Error("error changing password", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error changing your password. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	/*
+	 * The new auth token ends every other session. Keep this one.
+	 */
+	session.AuthToken = authToken
+
+	if err = c.auth.SaveSession(w, r, session); err != nil {
+		slog.Error("error saving session after password change", "error", err, "userID", session.UserID)
+	}
+
+	slog.Info("password changed", "userID", session.UserID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventPasswordChanged})
+	c.redirect(w, r, "Your password was changed. You've been logged out everywhere else.")
+}
+
+/*
+POST /account/settings/email
+*/
+func (c SettingsController) ChangeEmailAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err            error
+		user           *models.User
+		activationCode string
+	)
+
+	session := c.GetSession(r)
+
+	viewData := viewmodels.AccountSettings{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		NewEmail: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "newEmail")),
+	}
+
+	currentPassword := httphelpers.GetFromRequest[string](r, "currentPassword")
+
+	if user, err = c.userService.GetUserByIdAndAuthToken(session.UserID, session.AuthToken, identity.WithOnlyActiveUsers(true)); err != nil {
+		slog.Error("error fetching user to change email", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error changing your email address. Please try again later."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	switch {
+	case !email.IsValidEmailAddress(viewData.NewEmail):
+		viewData.Message = "The email address you provided appears to be invalid."
+		viewData.IsError = true
+
+	case strings.EqualFold(viewData.NewEmail, user.Email):
+		viewData.Message = "That's already your email address."
+		viewData.IsError = true
+
+	case bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)) != nil:
+		viewData.Message = "Your current password is incorrect."
+		viewData.IsError = true
+	}
+
+	if viewData.IsError {
+		c.render(w, r, viewData)
+		return
+	}
+
+	if activationCode, err = c.userService.RequestEmailChange(session.UserID, viewData.NewEmail); err != nil {
+		viewData.IsError = true
+
+		if errors.Is(err, identity.ErrUserAlreadyExists) {
+			viewData.Message = "An account already exists with that email address."
+		} else {
+			slog.Error("error requesting email change", "error", err, "userID", session.UserID)
+			viewData.Message = "There was an unexpected error changing your email address. Please try again later."
+		}
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	verifyLink := fmt.Sprintf("%s/account/settings?code=%s", c.config.TLD, url.QueryEscape(activationCode))
+
+	mailBody := fmt.Sprintf(`
+		<p>You asked to change the email address for your Streaming Tracker account to this one.</p>
+		<p>To confirm, please click the following link:
+		<a href="%s">Confirm Email Address</a>. Then enter the following
+		code when prompted: %s</p>
+		<p>If you didn't ask for this, you can ignore this email.</p>
+	`,
+		verifyLink,
+		activationCode,
+	)
+
+	err = c.emailService.Send(email.Mail{
+		Body:       mailBody,
+		BodyIsHtml: true,
+		From:       email.EmailAddress{Email: c.config.EmailFrom},
+		Subject:    "Confirm your new Streaming Tracker email address",
+		To: []email.EmailAddress{
+			{
+				Email: fmt.Sprintf("%s <%s>", viewData.NewEmail, viewData.NewEmail),
+			},
+		},
+	})
+
+	if err != nil {
+		slog.Error("failed to send email change verification code", "error", err, "userID", session.UserID)
+	}
+
+	slog.Info("email change requested", "userID", session.UserID)
+	c.redirect(w, r, fmt.Sprintf("We sent a code to %s. Enter it below to finish changing your email address.", viewData.NewEmail))
+}
+
+/*
+POST /account/settings/email/verify
+*/
+func (c SettingsController) VerifyEmailAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		user *models.User
+	)
+
+	session := c.GetSession(r)
+
+	viewData := viewmodels.AccountSettings{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+		VerificationCode: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "code")),
+	}
+
+	/*
+	 * Make sure the code belongs to the person using it.
+	 */
+	if user, err = c.userService.GetUserByActivationCode(viewData.VerificationCode); err != nil || user.ID.ID != session.UserID {
+		if err != nil && !errors.Is(err, identity.ErrUserNotFound) {
+			slog.Error("error fetching user by activation code", "error", err, "userID", session.UserID)
+		}
+
+		viewData.Message = "That code is incorrect. Please check the email we sent and try again."
+		viewData.IsError = true
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	if err = c.userService.ActivateUser(viewData.VerificationCode); err != nil {
+		viewData.IsError = true
+
+		if errors.Is(err, identity.ErrUserAlreadyExists) {
+			viewData.Message = "Someone else started using that email address. Please choose a different one."
+		} else {
+			slog.Error("error verifying email change", "error", err, "userID", session.UserID)
+			viewData.Message = "There was an unexpected error changing your email address. Please try again later."
+		}
+
+		c.render(w, r, viewData)
+		return
+	}
+
+	if user, err = c.userService.GetUserByIdAndAuthToken(session.UserID, session.AuthToken); err != nil {
+		slog.Error("error fetching user after email change", "error", err, "userID", session.UserID)
+	} else {
+		session.Email = user.Email
+
+		if err = c.auth.SaveSession(w, r, session); err != nil {
+			slog.Error("error saving session after email change", "error", err, "userID", session.UserID)
+		}
+	}
+
+	slog.Info("email address changed", "userID", session.UserID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventEmailChanged})
+	c.redirect(w, r, "Your email address was changed. Use it the next time you log in.")
+}
+
+/*
+POST /account/settings/email/cancel
+*/
+func (c SettingsController) CancelEmailChangeAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	message := "Your email address change was cancelled."
+
+	if err = c.userService.CancelEmailChange(session.UserID); err != nil {
+		slog.Error("error cancelling email change", "error", err, "userID", session.UserID)
+		message = "There was an unexpected error cancelling the change. Please try again later."
+	}
+
+	c.redirect(w, r, message)
+}
+
+/*
+POST /account/settings/identities/unlink
+*/
+func (c SettingsController) UnlinkIdentityAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+	identityID := httphelpers.GetFromRequest[int](r, "id")
+	message := fmt.Sprintf("You can no longer sign in with that %s account.", c.config.OIDCProviderName)
+
+	if err = c.userIdentityService.UnlinkUserIdentity(session.UserID, identityID); err != nil {
+		if errors.Is(err, identity.ErrUserIdentityNotFound) {
+			message = "That sign in isn't linked to your account."
+		} else {
+			slog.Error("error unlinking user identity", "error", err, "identityID", identityID, "userID", session.UserID)
+			message = "There was an unexpected error unlinking it. Please try again later."
+		}
+	} else {
+		slog.Info("user identity unlinked", "identityID", identityID, "userID", session.UserID)
+		c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventIdentityUnlinked, Details: c.config.OIDCProviderName})
+	}
+
+	c.redirect(w, r, message)
+}
+
+/*
+render fills in the user's current email addresses, two-factor status,
+passkeys, and linked sign ins, and renders the page.
+*/
+func (c SettingsController) render(w http.ResponseWriter, r *http.Request, viewData viewmodels.AccountSettings) {
+	var (
+		err        error
+		user       *models.User
+		twoFactor  *models.UserTwoFactor
+		passkeys   []models.UserPasskey
+		identities []models.UserIdentity
+	)
+
+	session := c.GetSession(r)
+	viewData.Email = session.Email
+	viewData.JavascriptIncludes = []rendering.JavascriptInclude{
+		{Src: "/static/js/passkeys.js", Type: "module"},
+	}
+
+	if user, err = c.userService.GetUserByIdAndAuthToken(session.UserID, session.AuthToken); err != nil {
+		slog.Error("error fetching user for account settings", "error", err, "userID", session.UserID)
+		viewData.Message = "There was an unexpected error trying to load this page. Please try again later."
+		viewData.IsError = true
+	} else {
+		viewData.Email = user.Email
+		viewData.PendingEmail = user.PendingEmail
+	}
+
+	if twoFactor, err = c.twoFactorService.GetTwoFactor(session.UserID); err != nil && !errors.Is(err, identity.ErrTwoFactorNotFound) {
+		slog.Error("error fetching two-factor status", "error", err, "userID", session.UserID)
+	}
+
+	if twoFactor != nil && twoFactor.IsEnabled() {
+		viewData.TwoFactorEnabled = true
+		viewData.RemainingRecoveryCodes = twoFactor.RemainingRecoveryCodes
+	}
+
+	viewData.Passkeys = []viewmodels.PasskeyDisplay{}
+
+	if passkeys, err = c.passkeyService.GetPasskeys(session.UserID); err != nil {
+		slog.Error("error fetching passkeys", "error", err, "userID", session.UserID)
+	}
+
+	for _, passkey := range passkeys {
+		display := viewmodels.PasskeyDisplay{
+			ID:        passkey.ID,
+			Name:      passkey.Name,
+			CreatedAt: datetime.DisplayDate(passkey.CreatedAt),
+			LastUsed:  "Never",
+		}
+
+		if passkey.LastUsedAt != nil {
+			display.LastUsed = datetime.DisplayDate(*passkey.LastUsedAt)
+		}
+
+		viewData.Passkeys = append(viewData.Passkeys, display)
+	}
+
+	viewData.ProviderName = c.config.OIDCProviderName
+	viewData.Identities = []viewmodels.LinkedIdentityDisplay{}
+
+	if identities, err = c.userIdentityService.GetUserIdentities(session.UserID); err != nil {
+		slog.Error("error fetching user identities", "error", err, "userID", session.UserID)
+	}
+
+	for _, linked := range identities {
+		viewData.Identities = append(viewData.Identities, viewmodels.LinkedIdentityDisplay{
+			ID:       linked.ID,
+			Email:    linked.Email,
+			LinkedAt: datetime.DisplayDate(linked.CreatedAt),
+		})
+	}
+
+	c.renderer.Render("pages/account/settings", viewData, w)
+}
+
+/*
+recordAuditEvent saves a security event. Failing to is only logged, since
+the change has already been made.
+*/
+func (c SettingsController) recordAuditEvent(r *http.Request, event models.AuditEvent) {
+	if err := c.auditService.RecordAuditEvent(r, event); err != nil {
+		slog.Error("error recording audit event", "error", err, "userID", event.UserID, "eventType", event.EventType)
+	}
+}
+
+func (c SettingsController) redirect(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/account/settings?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
@@ -0,0 +1,237 @@
+package settings
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/qrcode"
+	"github.com/adampresley/streaming-tracker/pkg/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	twoFactorIssuer   = "Streaming Tracker"
+	qrCodeModuleSize  = 4
+	twoFactorPageName = "pages/account/two-factor"
+)
+
+/*
+GET /account/settings/two-factor
+
+Shows the QR code for a setup that hasn't been confirmed yet.
+*/
+func (c SettingsController) TwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	viewData := viewmodels.TwoFactorSetup{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Message: c.GetMessage(r),
+			IsHtmx:  httphelpers.IsHtmx(r),
+		},
+	}
+
+	c.renderTwoFactorSetup(w, r, viewData)
+}
+
+/*
+POST /account/settings/two-factor
+*/
+func (c SettingsController) BeginTwoFactorAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+
+	if _, err = c.twoFactorService.BeginTwoFactor(session.UserID); err != nil {
+		if errors.Is(err, identity.ErrTwoFactorAlreadyEnabled) {
+			c.redirect(w, r, "Two-factor authentication is already on.")
+			return
+		}
+
+		slog.Error("error beginning two-factor setup", "error", err, "userID", session.UserID)
+		c.redirect(w, r, "There was an unexpected error setting up two-factor authentication. Please try again later.")
+		return
+	}
+
+	http.Redirect(w, r, "/account/settings/two-factor", http.StatusSeeOther)
+}
+
+/*
+POST /account/settings/two-factor/confirm
+*/
+func (c SettingsController) ConfirmTwoFactorAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err           error
+		recoveryCodes []string
+	)
+
+	session := c.GetSession(r)
+
+	viewData := viewmodels.TwoFactorSetup{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx: httphelpers.IsHtmx(r),
+		},
+	}
+
+	if recoveryCodes, err = c.twoFactorService.ConfirmTwoFactor(session.UserID, httphelpers.GetFromRequest[string](r, "code")); err != nil {
+		switch {
+		case errors.Is(err, identity.ErrInvalidTwoFactorCode):
+			viewData.Message = "That code didn't work. Check your authenticator app and try again."
+			viewData.IsError = true
+
+			c.renderTwoFactorSetup(w, r, viewData)
+
+		case errors.Is(err, identity.ErrTwoFactorNotFound):
+			c.redirect(w, r, "Start setting up two-factor authentication again.")
+
+		default:
+			slog.Error("error confirming two-factor setup", "error", err, "userID", session.UserID)
+			c.redirect(w, r, "There was an unexpected error setting up two-factor authentication. Please try again later.")
+		}
+
+		return
+	}
+
+	slog.Info("two-factor authentication enabled", "userID", session.UserID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventTwoFactorEnabled})
+
+	viewData.Message = "Two-factor authentication is on. You'll need a code from your app each time you log in with your password."
+	viewData.RecoveryCodes = recoveryCodes
+
+	c.renderer.Render(twoFactorPageName, viewData, w)
+}
+
+/*
+POST /account/settings/two-factor/recovery-codes
+*/
+func (c SettingsController) RegenerateRecoveryCodesAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err           error
+		recoveryCodes []string
+	)
+
+	session := c.GetSession(r)
+
+	if !c.checkCurrentPassword(w, r, session) {
+		return
+	}
+
+	if recoveryCodes, err = c.twoFactorService.RegenerateRecoveryCodes(session.UserID); err != nil {
+		if errors.Is(err, identity.ErrTwoFactorNotFound) {
+			c.redirect(w, r, "Two-factor authentication isn't on.")
+			return
+		}
+
+		slog.Error("error regenerating recovery codes", "error", err, "userID", session.UserID)
+		c.redirect(w, r, "There was an unexpected error making new recovery codes. Please try again later.")
+		return
+	}
+
+	slog.Info("recovery codes regenerated", "userID", session.UserID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventRecoveryCodesRegenerated})
+
+	viewData := viewmodels.TwoFactorSetup{
+		BaseViewModel: viewmodels.BaseViewModel{
+			IsHtmx:  httphelpers.IsHtmx(r),
+			Message: "Here are your new recovery codes. Your old ones no longer work.",
+		},
+		RecoveryCodes: recoveryCodes,
+	}
+
+	c.renderer.Render(twoFactorPageName, viewData, w)
+}
+
+/*
+POST /account/settings/two-factor/disable
+*/
+func (c SettingsController) DisableTwoFactorAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	session := c.GetSession(r)
+
+	if !c.checkCurrentPassword(w, r, session) {
+		return
+	}
+
+	if err = c.twoFactorService.DisableTwoFactor(session.UserID); err != nil {
+		slog.Error("error disabling two-factor", "error", err, "userID", session.UserID)
+		c.redirect(w, r, "There was an unexpected error turning off two-factor authentication. Please try again later.")
+		return
+	}
+
+	slog.Info("two-factor authentication disabled", "userID", session.UserID)
+	c.recordAuditEvent(r, models.AuditEvent{UserID: session.UserID, EventType: models.AuditEventTwoFactorDisabled})
+	c.redirect(w, r, "Two-factor authentication is off.")
+}
+
+/*
+renderTwoFactorSetup draws the QR code for the user's unconfirmed setup
+and renders the page. Users without one are sent back to settings.
+*/
+func (c SettingsController) renderTwoFactorSetup(w http.ResponseWriter, r *http.Request, viewData viewmodels.TwoFactorSetup) {
+	var (
+		err       error
+		twoFactor *models.UserTwoFactor
+		code      *qrcode.Code
+	)
+
+	session := c.GetSession(r)
+
+	if twoFactor, err = c.twoFactorService.GetTwoFactor(session.UserID); err != nil {
+		if !errors.Is(err, identity.ErrTwoFactorNotFound) {
+			slog.Error("error fetching two-factor setup", "error", err, "userID", session.UserID)
+		}
+
+		c.redirect(w, r, "Start setting up two-factor authentication below.")
+		return
+	}
+
+	if twoFactor.IsEnabled() {
+		c.redirect(w, r, "Two-factor authentication is already on.")
+		return
+	}
+
+	viewData.Secret = twoFactor.Secret
+
+	if code, err = qrcode.Encode(totp.KeyURI(twoFactorIssuer, session.Email, twoFactor.Secret)); err != nil {
+		slog.Error("error drawing two-factor QR code", "error", err, "userID", session.UserID)
+	} else {
+		viewData.QRCode = template.HTML(code.SVG(qrCodeModuleSize))
+	}
+
+	c.renderer.Render(twoFactorPageName, viewData, w)
+}
+
+/*
+checkCurrentPassword makes sure the user typed their password before a
+change to how they log in. When it is wrong they are sent back to settings
+and false is returned.
+*/
+func (c SettingsController) checkCurrentPassword(w http.ResponseWriter, r *http.Request, session *identity.UserSession) bool {
+	var (
+		err  error
+		user *models.User
+	)
+
+	currentPassword := httphelpers.GetFromRequest[string](r, "currentPassword")
+
+	if user, err = c.userService.GetUserByIdAndAuthToken(session.UserID, session.AuthToken, identity.WithOnlyActiveUsers(true)); err != nil {
+		slog.Error("error fetching user to check password", "error", err, "userID", session.UserID)
+		c.redirect(w, r, "There was an unexpected error. Please try again later.")
+		return false
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)) != nil {
+		c.redirect(w, r, "Your current password is incorrect.")
+		return false
+	}
+
+	return true
+}
@@ -2,9 +2,9 @@ package show
 
 import (
 	"fmt"
-	"html/template"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"slices"
 
 	"github.com/adampresley/adamgokit/auth2"
@@ -12,8 +12,8 @@ import (
 	"github.com/adampresley/adamgokit/paging"
 	"github.com/adampresley/adamgokit/rendering"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
-	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/configuration"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
 	"github.com/adampresley/streaming-tracker/pkg/datetime"
 	"github.com/adampresley/streaming-tracker/pkg/identity"
 	"github.com/adampresley/streaming-tracker/pkg/models"
@@ -84,15 +84,20 @@ func (c ShowController) AddShowPage(w http.ResponseWriter, r *http.Request) {
 	pageName := "pages/shows/add-show"
 	session := c.GetSession(r)
 
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't add shows."), http.StatusSeeOther)
+		return
+	}
+
 	viewData := viewmodels.AddShow{
 		BaseViewModel: viewmodels.BaseViewModel{
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 			IsHtmx:  httphelpers.IsHtmx(r),
 			JavascriptIncludes: []rendering.JavascriptInclude{
 				{Src: "/static/js/pages/add-show.js", Type: "module"},
 			},
 		},
-		ShowName:     "",
+		ShowName:     httphelpers.GetFromRequest[string](r, "showName"),
 		TotalSeasons: 0,
 		PlatformID:   0,
 		WatcherIDs:   []int{},
@@ -146,9 +151,14 @@ func (c ShowController) AddShowAction(w http.ResponseWriter, r *http.Request) {
 	pageName := "pages/shows/add-show"
 	session := c.GetSession(r)
 
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/?message="+url.QueryEscape("Your role in this household can't add shows."), http.StatusSeeOther)
+		return
+	}
+
 	viewData := viewmodels.AddShow{
 		BaseViewModel: viewmodels.BaseViewModel{
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 			IsHtmx:  httphelpers.IsHtmx(r),
 		},
 		ShowName:     httphelpers.GetFromRequest[string](r, "showName"),
@@ -229,6 +239,11 @@ func (c ShowController) AddSeasonAction(w http.ResponseWriter, r *http.Request)
 	session := c.GetSession(r)
 	showID := httphelpers.GetFromRequest[int](r, "id")
 
+	if !session.Role.CanEditShows() {
+		http.Error(w, "Your role in this household can't change shows.", http.StatusForbidden)
+		return
+	}
+
 	if err = c.showService.AddSeason(session.AccountID, showID); err != nil {
 		if err == shows.ErrShowNotFound {
 			slog.Error("attempt to add season to non-existent show", "showID", showID, "accountID", session.AccountID)
@@ -275,6 +290,11 @@ func (c ShowController) CancelShowAction(w http.ResponseWriter, r *http.Request)
 	session := c.GetSession(r)
 	showID := httphelpers.GetFromRequest[int](r, "id")
 
+	if !session.Role.CanEditShows() {
+		http.Error(w, "Your role in this household can't change shows.", http.StatusForbidden)
+		return
+	}
+
 	if err = c.showService.CancelShow(session.AccountID, showID); err != nil {
 		if err == shows.ErrShowNotFound {
 			slog.Error("attempt to cancel non-existent show", "showID", showID, "accountID", session.AccountID)
@@ -322,9 +342,14 @@ func (c ShowController) EditShowPage(w http.ResponseWriter, r *http.Request) {
 	pageName := "pages/shows/edit-show"
 	session := c.GetSession(r)
 
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/shows/manage?message="+url.QueryEscape("Your role in this household can't edit shows."), http.StatusSeeOther)
+		return
+	}
+
 	viewData := viewmodels.EditShow{
 		BaseViewModel: viewmodels.BaseViewModel{
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 			IsHtmx:  httphelpers.IsHtmx(r),
 			JavascriptIncludes: []rendering.JavascriptInclude{
 				{Src: "/static/js/pages/edit-show.js", Type: "module"},
@@ -411,11 +436,16 @@ func (c ShowController) EditShowAction(w http.ResponseWriter, r *http.Request) {
 
 	pageName := "pages/shows/edit-show"
 	session := c.GetSession(r)
+
+	if !session.Role.CanEditShows() {
+		http.Redirect(w, r, "/shows/manage?message="+url.QueryEscape("Your role in this household can't edit shows."), http.StatusSeeOther)
+		return
+	}
 	showID := httphelpers.GetFromRequest[int](r, "id")
 
 	viewData := viewmodels.EditShow{
 		BaseViewModel: viewmodels.BaseViewModel{
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 			IsHtmx:  httphelpers.IsHtmx(r),
 		},
 		ShowID:         showID,
@@ -520,7 +550,7 @@ func (c ShowController) ManageShowsPage(w http.ResponseWriter, r *http.Request)
 	session := c.GetSession(r)
 
 	baseViewModel := viewmodels.BaseViewModel{
-		Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+		Message: c.GetMessage(r),
 		IsHtmx:  httphelpers.IsHtmx(r),
 		JavascriptIncludes: []rendering.JavascriptInclude{
 			{Src: "/static/js/pages/manage-shows.js", Type: "module"},
@@ -584,6 +614,11 @@ func (c ShowController) DeleteShowAction(w http.ResponseWriter, r *http.Request)
 	session := c.GetSession(r)
 	showID := httphelpers.GetFromRequest[int](r, "id")
 
+	if !session.Role.CanDeleteShows() {
+		http.Error(w, "Only the household owner can delete shows.", http.StatusForbidden)
+		return
+	}
+
 	if err = c.showService.DeleteShow(session.AccountID, showID); err != nil {
 		if err == shows.ErrShowHasWatchedSeasons {
 			slog.Error("attempt to delete show with watched seasons", "showID", showID, "accountID", session.AccountID)
@@ -618,6 +653,11 @@ func (c ShowController) StartWatchingAction(w http.ResponseWriter, r *http.Reque
 	session := c.GetSession(r)
 	showID := httphelpers.GetFromRequest[int](r, "id")
 
+	if !session.Role.CanEditShows() {
+		http.Error(w, "Your role in this household can't change shows.", http.StatusForbidden)
+		return
+	}
+
 	if err = c.showService.StartWatching(session.AccountID, showID); err != nil {
 		if err == shows.ErrShowNotFound {
 			slog.Error("attempt to start watching non-existent show", "showID", showID, "accountID", session.AccountID)
@@ -641,7 +681,8 @@ func (c ShowController) StartWatchingAction(w http.ResponseWriter, r *http.Reque
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx: true,
 		},
-		Shows: viewmodels.NewDashboardShowsFromDbModel(showsData),
+		Shows:        viewmodels.NewDashboardShowsFromDbModel(showsData),
+		CanEditShows: session.Role.CanEditShows(),
 	}
 
 	slog.Info("start watching show", "showID", showID, "accountID", session.AccountID)
@@ -660,6 +701,11 @@ func (c ShowController) BackToWantToWatchAction(w http.ResponseWriter, r *http.R
 	session := c.GetSession(r)
 	showID := httphelpers.GetFromRequest[int](r, "id")
 
+	if !session.Role.CanEditShows() {
+		http.Error(w, "Your role in this household can't change shows.", http.StatusForbidden)
+		return
+	}
+
 	if err = c.showService.BackToWantToWatch(session.AccountID, showID); err != nil {
 		if err == shows.ErrShowNotFound {
 			slog.Error("attempt to move non-existent show back to want to watch", "showID", showID, "accountID", session.AccountID)
@@ -683,7 +729,8 @@ func (c ShowController) BackToWantToWatchAction(w http.ResponseWriter, r *http.R
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx: true,
 		},
-		Shows: viewmodels.NewDashboardShowsFromDbModel(showsData),
+		Shows:        viewmodels.NewDashboardShowsFromDbModel(showsData),
+		CanEditShows: session.Role.CanEditShows(),
 	}
 
 	slog.Info("move show back to want to watch", "showID", showID, "accountID", session.AccountID)
@@ -702,6 +749,11 @@ func (c ShowController) FinishSeasonAction(w http.ResponseWriter, r *http.Reques
 	session := c.GetSession(r)
 	showID := httphelpers.GetFromRequest[int](r, "id")
 
+	if !session.Role.CanEditShows() {
+		http.Error(w, "Your role in this household can't change shows.", http.StatusForbidden)
+		return
+	}
+
 	if err = c.showService.FinishSeason(session.AccountID, showID); err != nil {
 		if err == shows.ErrShowNotFound {
 			slog.Error("attempt to finish season for non-existent show", "showID", showID, "accountID", session.AccountID)
@@ -725,7 +777,8 @@ func (c ShowController) FinishSeasonAction(w http.ResponseWriter, r *http.Reques
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx: true,
 		},
-		Shows: viewmodels.NewDashboardShowsFromDbModel(showsData),
+		Shows:        viewmodels.NewDashboardShowsFromDbModel(showsData),
+		CanEditShows: session.Role.CanEditShows(),
 	}
 
 	slog.Info("season finished for show", "showID", showID, "accountID", session.AccountID)
@@ -809,6 +862,10 @@ func (c ShowController) searchShowsAndAssembleViewData(accountID, page int, show
 		SortDirection: sortDirection,
 	}
 
+	role := c.GetSession(r).Role
+	viewData.CanEditShows = role.CanEditShows()
+	viewData.CanDeleteShows = role.CanDeleteShows()
+
 	// Search for shows with current filters
 	showResults, totalRecords, err = c.showService.SearchShows(
 		accountID,
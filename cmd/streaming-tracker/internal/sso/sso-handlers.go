@@ -0,0 +1,265 @@
+package sso
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
+	identityhandlers "github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/identity"
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/oidc"
+)
+
+const (
+	/*
+	   loginCookieName holds the state, nonce, and PKCE code verifier for a
+	   sign in while the user is at the provider.
+	*/
+	loginCookieName = "oidc-login"
+	loginLifetime   = time.Minute * 10
+)
+
+type SSOHandlers interface {
+	CallbackAction(w http.ResponseWriter, r *http.Request)
+	LoginAction(w http.ResponseWriter, r *http.Request)
+}
+
+type SSOControllerConfig struct {
+	AuditService        audit.AuditServicer
+	Auth                auth2.Authenticator[*identity.UserSession]
+	Config              *configuration.Config
+	ProviderService     oidc.ProviderServicer
+	TwoFactorService    identity.TwoFactorServicer
+	UserIdentityService identity.UserIdentityServicer
+	UserService         identity.UserServicer
+	UserTokenService    identity.UserTokenServicer
+}
+
+type SSOController struct {
+	base.BaseHandler
+
+	auditService        audit.AuditServicer
+	auth                auth2.Authenticator[*identity.UserSession]
+	config              *configuration.Config
+	providerService     oidc.ProviderServicer
+	twoFactorService    identity.TwoFactorServicer
+	userIdentityService identity.UserIdentityServicer
+	userService         identity.UserServicer
+	userTokenService    identity.UserTokenServicer
+}
+
+func NewSSOController(config SSOControllerConfig) SSOController {
+	return SSOController{
+		auditService:        config.AuditService,
+		auth:                config.Auth,
+		config:              config.Config,
+		providerService:     config.ProviderService,
+		twoFactorService:    config.TwoFactorService,
+		userIdentityService: config.UserIdentityService,
+		userService:         config.UserService,
+		userTokenService:    config.UserTokenService,
+	}
+}
+
+/*
+GET /login/oidc
+*/
+func (c SSOController) LoginAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err          error
+		state        string
+		nonce        string
+		codeVerifier string
+		authURL      string
+	)
+
+	if !c.config.OIDCEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if state, err = oidc.NewSecret(); err == nil {
+		if nonce, err = oidc.NewSecret(); err == nil {
+			codeVerifier, err = oidc.NewSecret()
+		}
+	}
+
+	if err != nil {
+		slog.Error("error generating sign in secrets", "error", err)
+		c.loginError(w, r, "We are sorry, but an unexpected error occurred. Please try again later.")
+		return
+	}
+
+	if authURL, err = c.providerService.AuthCodeURL(state, nonce, codeVerifier); err != nil {
+		slog.Error("error building sign in address", "error", err, "issuer", c.config.OIDCIssuer)
+		c.loginError(w, r, fmt.Sprintf("We couldn't reach %s. Please try again later, or log in with your password.", c.config.OIDCProviderName))
+		return
+	}
+
+	/*
+	 * Lax, so the cookie comes back with the provider's redirect.
+	 */
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    strings.Join([]string{state, nonce, codeVerifier}, "."),
+		Path:     "/login/oidc",
+		MaxAge:   int(loginLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.config.TLD, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+/*
+GET /login/oidc/callback
+*/
+func (c SSOController) CallbackAction(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		cookie    *http.Cookie
+		claims    *oidc.Claims
+		user      *models.User
+		twoFactor *models.UserTwoFactor
+	)
+
+	if !c.config.OIDCEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	providerName := c.config.OIDCProviderName
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    "",
+		Path:     "/login/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.config.TLD, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if providerError := httphelpers.GetFromRequest[string](r, "error"); providerError != "" {
+		slog.Info("sign in provider returned an error", "error", providerError, "description", httphelpers.GetFromRequest[string](r, "error_description"))
+		c.loginError(w, r, fmt.Sprintf("Signing in with %s didn't work. Please try again, or log in with your password.", providerName))
+		return
+	}
+
+	if cookie, err = r.Cookie(loginCookieName); err != nil {
+		c.loginError(w, r, "Your sign in took too long. Please try again.")
+		return
+	}
+
+	parts := strings.Split(cookie.Value, ".")
+	state := httphelpers.GetFromRequest[string](r, "state")
+
+	if len(parts) != 3 || state == "" || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		slog.Warn("sign in state doesn't match")
+		c.loginError(w, r, "Your sign in couldn't be verified. Please try again.")
+		return
+	}
+
+	if claims, err = c.providerService.Exchange(httphelpers.GetFromRequest[string](r, "code"), parts[2], parts[1]); err != nil {
+		slog.Error("error completing sign in", "error", err, "issuer", c.config.OIDCIssuer)
+		c.loginError(w, r, fmt.Sprintf("Signing in with %s didn't work. Please try again, or log in with your password.", providerName))
+		return
+	}
+
+	/*
+	 * Someone who has signed in this way before is linked to their user.
+	 * Otherwise a verified email address that matches a user links them.
+	 */
+	user, err = c.userIdentityService.GetUserByIdentity(claims.Issuer, claims.Subject)
+
+	if errors.Is(err, identity.ErrUserNotFound) {
+		verifiedEmail := claims.VerifiedEmail()
+
+		if verifiedEmail == "" {
+			c.loginError(w, r, fmt.Sprintf("Your %s account doesn't have a verified email address, so we can't match it to a Streaming Tracker account.", providerName))
+			return
+		}
+
+		if user, err = c.userService.GetUserByEmail(verifiedEmail, identity.WithOnlyActiveUsers(true)); err == nil {
+			err = c.userIdentityService.LinkUserIdentity(models.LinkUserIdentityRequest{
+				UserID:  user.ID.ID,
+				Issuer:  claims.Issuer,
+				Subject: claims.Subject,
+				Email:   verifiedEmail,
+			})
+
+			if err == nil {
+				slog.Info("linked sign in identity", "userID", user.ID.ID, "issuer", claims.Issuer)
+			}
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			c.loginError(w, r, fmt.Sprintf("There isn't an activated Streaming Tracker account for %s. Sign up with that email address first.", claims.Email))
+			return
+		}
+
+		slog.Error("error finding user for sign in identity", "error", err, "issuer", claims.Issuer)
+		c.loginError(w, r, "We are sorry, but an unexpected error occurred. Please try again later.")
+		return
+	}
+
+	/*
+	 * The provider stands in for the password. Users with two-factor
+	 * authentication on still need a code before they get a session.
+	 */
+	if twoFactor, err = c.twoFactorService.GetTwoFactor(user.ID.ID); err != nil && !errors.Is(err, identity.ErrTwoFactorNotFound) {
+		slog.Error("an error occurred while checking two-factor authentication", "error", err, "userID", user.ID.ID)
+		c.loginError(w, r, "We are sorry, but an unexpected error occurred. Please try again later.")
+		return
+	}
+
+	if twoFactor != nil && twoFactor.IsEnabled() {
+		if err = identityhandlers.BeginTwoFactorLogin(w, c.userTokenService, c.config, user); err != nil {
+			slog.Error("an error occurred while starting a two-factor log in", "error", err, "userID", user.ID.ID)
+			c.loginError(w, r, "We are sorry, but an unexpected error occurred. Please try again later.")
+			return
+		}
+
+		http.Redirect(w, r, "/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	sessionValue := &identity.UserSession{
+		UserID:    user.ID.ID,
+		Email:     user.Email,
+		AccountID: user.Account.ID.ID,
+		AuthToken: user.AuthToken,
+	}
+
+	if err = c.auth.SaveSession(w, r, sessionValue); err != nil {
+		slog.Error("an error occurred while saving the session", "error", err, "userID", user.ID.ID)
+		c.loginError(w, r, "We are sorry, but an unexpected error occurred. Please try again later.")
+		return
+	}
+
+	slog.Info("user logged in", "userID", user.ID.ID, "accountID", user.Account.ID.ID, "issuer", claims.Issuer)
+
+	if err = c.auditService.RecordAuditEvent(r, models.AuditEvent{UserID: user.ID.ID, EventType: models.AuditEventLogin, Details: providerName}); err != nil {
+		slog.Error("error recording audit event", "error", err, "userID", user.ID.ID, "eventType", models.AuditEventLogin)
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (c SSOController) loginError(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/login?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
@@ -0,0 +1,296 @@
+package sso_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/auth2"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/sso"
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/oidc"
+)
+
+const (
+	testIssuer = "https://id.example.com"
+)
+
+func TestCallbackLinksOnlyVerifiedEmails(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified bool
+		linked        *models.User
+		wantLink      bool
+		wantLogin     bool
+	}{
+		{
+			name:          "verified email matching a user is linked",
+			emailVerified: true,
+			wantLink:      true,
+			wantLogin:     true,
+		},
+		{
+			name:          "unverified email matching a user is not linked",
+			emailVerified: false,
+		},
+		{
+			name:          "identity linked before logs in without a verified email",
+			emailVerified: false,
+			linked:        testUser(),
+			wantLogin:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identities := &fakeUserIdentityService{linked: tt.linked}
+			auth := &fakeAuth{}
+
+			claims := &oidc.Claims{
+				Issuer:  testIssuer,
+				Subject: "user-123",
+				Email:   "adam@example.com",
+			}
+
+			if tt.emailVerified {
+				claims.EmailVerified = true
+			}
+
+			controller := sso.NewSSOController(sso.SSOControllerConfig{
+				AuditService:        fakeAuditService{},
+				Auth:                auth,
+				Config:              &configuration.Config{OIDCIssuer: testIssuer, OIDCClientID: "client", OIDCProviderName: "Example"},
+				ProviderService:     fakeProviderService{claims: claims},
+				TwoFactorService:    fakeTwoFactorService{},
+				UserIdentityService: identities,
+				UserService:         fakeUserService{},
+				UserTokenService:    &fakeUserTokenService{},
+			})
+
+			w := httptest.NewRecorder()
+			controller.CallbackAction(w, callbackRequest())
+
+			if (identities.linkRequest != nil) != tt.wantLink {
+				t.Fatalf("expected linking to be %v, got %+v", tt.wantLink, identities.linkRequest)
+			}
+
+			if tt.wantLink && (identities.linkRequest.UserID != 1 || identities.linkRequest.Email != "adam@example.com" || identities.linkRequest.Subject != "user-123") {
+				t.Errorf("unexpected link request %+v", identities.linkRequest)
+			}
+
+			if (auth.session != nil) != tt.wantLogin {
+				t.Fatalf("expected logging in to be %v, got session %+v", tt.wantLogin, auth.session)
+			}
+
+			location := w.Header().Get("Location")
+
+			if tt.wantLogin && location != "/" {
+				t.Errorf("expected a redirect home, got %q", location)
+			}
+
+			if !tt.wantLogin && !strings.Contains(location, url.QueryEscape("verified email address")) {
+				t.Errorf("expected a message about the unverified email address, got %q", location)
+			}
+		})
+	}
+}
+
+func TestCallbackAsksForTwoFactorCode(t *testing.T) {
+	enabledAt := time.Now()
+
+	tests := []struct {
+		name          string
+		twoFactor     *models.UserTwoFactor
+		wantTwoFactor bool
+	}{
+		{
+			name: "user without two-factor gets a session",
+		},
+		{
+			name:      "user still setting up two-factor gets a session",
+			twoFactor: &models.UserTwoFactor{UserID: 1},
+		},
+		{
+			name:          "user with two-factor is asked for a code",
+			twoFactor:     &models.UserTwoFactor{UserID: 1, EnabledAt: &enabledAt},
+			wantTwoFactor: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &fakeAuth{}
+			tokens := &fakeUserTokenService{}
+
+			controller := sso.NewSSOController(sso.SSOControllerConfig{
+				AuditService:        fakeAuditService{},
+				Auth:                auth,
+				Config:              &configuration.Config{OIDCIssuer: testIssuer, OIDCClientID: "client", OIDCProviderName: "Example"},
+				ProviderService:     fakeProviderService{claims: &oidc.Claims{Issuer: testIssuer, Subject: "user-123"}},
+				TwoFactorService:    fakeTwoFactorService{twoFactor: tt.twoFactor},
+				UserIdentityService: &fakeUserIdentityService{linked: testUser()},
+				UserService:         fakeUserService{},
+				UserTokenService:    tokens,
+			})
+
+			w := httptest.NewRecorder()
+			controller.CallbackAction(w, callbackRequest())
+
+			location := w.Header().Get("Location")
+
+			if !tt.wantTwoFactor {
+				if auth.session == nil || location != "/" {
+					t.Fatalf("expected a session and a redirect home, got session %+v and %q", auth.session, location)
+				}
+
+				return
+			}
+
+			if auth.session != nil {
+				t.Fatalf("expected no session before the two-factor code, got %+v", auth.session)
+			}
+
+			if location != "/login/two-factor" {
+				t.Errorf("expected a redirect to the two-factor page, got %q", location)
+			}
+
+			if tokens.userID != 1 || tokens.purpose != models.UserTokenPurposeTwoFactorLogin {
+				t.Errorf("expected a two-factor log in token for user 1, got user %d and purpose %q", tokens.userID, tokens.purpose)
+			}
+
+			found := false
+
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name == "two-factor-login" && cookie.Value == "two-factor-token" {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("expected the two-factor log in cookie to be set")
+			}
+		})
+	}
+}
+
+func callbackRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?state=the-state&code=the-code", nil)
+	r.AddCookie(&http.Cookie{Name: "oidc-login", Value: "the-state.the-nonce.the-verifier"})
+
+	return r
+}
+
+func testUser() *models.User {
+	return &models.User{
+		ID:        models.ID{ID: 1},
+		Active:    true,
+		Email:     "adam@example.com",
+		AuthToken: "auth-token",
+		Account:   &models.Account{ID: models.ID{ID: 10}},
+	}
+}
+
+/*
+Fakes. Each embeds the service interface so only the methods the tests
+call need to be written. Calling any other method panics.
+*/
+
+type fakeProviderService struct {
+	claims *oidc.Claims
+}
+
+func (s fakeProviderService) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	return testIssuer + "/authorize", nil
+}
+
+func (s fakeProviderService) Exchange(code, codeVerifier, nonce string) (*oidc.Claims, error) {
+	if code != "the-code" || codeVerifier != "the-verifier" || nonce != "the-nonce" {
+		return nil, oidc.ErrInvalidIDToken
+	}
+
+	return s.claims, nil
+}
+
+type fakeUserIdentityService struct {
+	identity.UserIdentityServicer
+
+	linked      *models.User
+	linkRequest *models.LinkUserIdentityRequest
+}
+
+func (s *fakeUserIdentityService) GetUserByIdentity(issuer, subject string) (*models.User, error) {
+	if s.linked == nil {
+		return nil, identity.ErrUserNotFound
+	}
+
+	return s.linked, nil
+}
+
+func (s *fakeUserIdentityService) LinkUserIdentity(request models.LinkUserIdentityRequest) error {
+	s.linkRequest = &request
+	return nil
+}
+
+type fakeUserService struct {
+	identity.UserServicer
+}
+
+func (s fakeUserService) GetUserByEmail(email string, options ...identity.UserQueryOption) (*models.User, error) {
+	if email == "adam@example.com" {
+		return testUser(), nil
+	}
+
+	return nil, identity.ErrUserNotFound
+}
+
+type fakeTwoFactorService struct {
+	identity.TwoFactorServicer
+
+	twoFactor *models.UserTwoFactor
+}
+
+func (s fakeTwoFactorService) GetTwoFactor(userID int) (*models.UserTwoFactor, error) {
+	if s.twoFactor == nil {
+		return nil, identity.ErrTwoFactorNotFound
+	}
+
+	return s.twoFactor, nil
+}
+
+type fakeUserTokenService struct {
+	identity.UserTokenServicer
+
+	userID  int
+	purpose string
+}
+
+func (s *fakeUserTokenService) CreateUserToken(userID int, purpose string, lifetime time.Duration) (string, error) {
+	s.userID = userID
+	s.purpose = purpose
+	return "two-factor-token", nil
+}
+
+type fakeAuth struct {
+	auth2.Authenticator[*identity.UserSession]
+
+	session *identity.UserSession
+}
+
+func (a *fakeAuth) SaveSession(w http.ResponseWriter, r *http.Request, sessionValue *identity.UserSession) error {
+	a.session = sessionValue
+	return nil
+}
+
+type fakeAuditService struct {
+	audit.AuditServicer
+}
+
+func (s fakeAuditService) RecordAuditEvent(r *http.Request, event models.AuditEvent) error {
+	return nil
+}
@@ -3,9 +3,13 @@ package viewmodels
 type AccountSignUp struct {
 	BaseViewModel
 
-	Email       string
-	Password    string
-	AccountCode string
+	Email            string
+	Password         string
+	AccountCode      string
+	InvitationCode   string
+	RegistrationMode string
+
+	HasAccountInvitation bool
 }
 
 type AccountVerify struct {
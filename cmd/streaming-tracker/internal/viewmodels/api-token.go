@@ -0,0 +1,21 @@
+package viewmodels
+
+type ManageApiTokens struct {
+	BaseViewModel
+
+	Tokens   []ApiTokenDisplay
+	NewToken string
+	Name     string
+	Scope    string
+}
+
+type ApiTokenDisplay struct {
+	ID          int
+	Name        string
+	TokenPrefix string
+	Scope       string
+	CreatedAt   string
+	LastUsedAt  string
+	RevokedAt   string
+	IsRevoked   bool
+}
@@ -7,7 +7,8 @@ import (
 
 type Home struct {
 	BaseViewModel
-	Shows []DashboardShow
+	Shows        []DashboardShow
+	CanEditShows bool
 }
 
 type DashboardShow struct {
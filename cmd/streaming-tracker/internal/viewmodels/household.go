@@ -0,0 +1,55 @@
+package viewmodels
+
+type Household struct {
+	BaseViewModel
+
+	IsOwner       bool
+	CurrentUserID int
+	JoinToken     string
+	AccountCode   string
+	Email         string
+	Invitations   []HouseholdInvitationDisplay
+	Members       []HouseholdMemberDisplay
+}
+
+type HouseholdMemberDisplay struct {
+	UserID      int
+	Email       string
+	WatcherName string
+	IsOwner     bool
+	Role        string
+	Active      bool
+}
+
+type HouseholdInvitationDisplay struct {
+	ID        int
+	Email     string
+	InvitedBy string
+	CreatedAt string
+	ExpiresAt string
+}
+
+type SecurityLog struct {
+	BaseViewModel
+
+	Events []SecurityEventDisplay
+}
+
+type SecurityEventDisplay struct {
+	Email     string
+	Event     string
+	Details   string
+	IPAddress string
+	Device    string
+	CreatedAt string
+}
+
+type AccountSwitcher struct {
+	CurrentAccountID int
+	Accounts         []AccountSwitcherOption
+}
+
+type AccountSwitcherOption struct {
+	AccountID int
+	Label     string
+}
@@ -5,4 +5,40 @@ type Login struct {
 
 	Email    string
 	Password string
+
+	/*
+	   ProviderName is the OpenID Connect provider people can sign in with.
+	   It is empty when there isn't one.
+	*/
+	ProviderName string
+}
+
+type LoginTwoFactor struct {
+	BaseViewModel
+}
+
+type LoginEmail struct {
+	BaseViewModel
+
+	Email string
+}
+
+type LoginEmailVerify struct {
+	BaseViewModel
+
+	Token        string
+	TokenIsValid bool
+}
+
+type ForgotPassword struct {
+	BaseViewModel
+
+	Email string
+}
+
+type ResetPassword struct {
+	BaseViewModel
+
+	Token        string
+	TokenIsValid bool
 }
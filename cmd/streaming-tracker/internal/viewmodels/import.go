@@ -0,0 +1,55 @@
+package viewmodels
+
+import "github.com/adampresley/streaming-tracker/pkg/models"
+
+type ImportCSV struct {
+	BaseViewModel
+
+	CSVData           string
+	HasHeader         bool
+	Columns           []ImportColumn
+	MappingFields     []ImportMappingField
+	DefaultPlatformID int
+	Platforms         []*models.Platform
+	Watchers          []SelectableWatcher
+	Plan              *models.ImportPlan
+	CanImport         bool
+}
+
+type ImportColumn struct {
+	Index int
+	Name  string
+}
+
+type ImportMappingField struct {
+	Name     string
+	Label    string
+	Selected int
+	Required bool
+}
+
+type ImportWatchHistory struct {
+	BaseViewModel
+
+	RowsData          string
+	UnmatchedData     string
+	Unmatched         []models.UnmatchedImportItem
+	DefaultPlatformID int
+	Platforms         []*models.Platform
+	Watchers          []SelectableWatcher
+	Plan              *models.ImportPlan
+	CanImport         bool
+}
+
+type ImportNetflix struct {
+	BaseViewModel
+
+	RowsData      string
+	UnmatchedData string
+	Unmatched     []models.UnmatchedImportItem
+	NumSkipped    int
+	WatcherID     int
+	Watchers      []*models.Watcher
+	Plan          *models.ImportPlan
+	CanImport     bool
+}
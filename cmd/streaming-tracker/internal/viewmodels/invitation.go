@@ -0,0 +1,15 @@
+package viewmodels
+
+type ManageInvitations struct {
+	BaseViewModel
+
+	CanInvite   bool
+	Email       string
+	Invitations []InvitationDisplay
+}
+
+type InvitationDisplay struct {
+	Email     string
+	CreatedAt string
+	ExpiresAt string
+}
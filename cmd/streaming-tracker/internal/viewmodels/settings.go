@@ -0,0 +1,58 @@
+package viewmodels
+
+import "html/template"
+
+type AccountSettings struct {
+	BaseViewModel
+
+	Email                  string
+	PendingEmail           string
+	NewEmail               string
+	VerificationCode       string
+	TwoFactorEnabled       bool
+	RemainingRecoveryCodes int
+	Passkeys               []PasskeyDisplay
+	ProviderName           string
+	Identities             []LinkedIdentityDisplay
+}
+
+type PasskeyDisplay struct {
+	ID        int
+	Name      string
+	CreatedAt string
+	LastUsed  string
+}
+
+type LinkedIdentityDisplay struct {
+	ID       int
+	Email    string
+	LinkedAt string
+}
+
+/*
+TwoFactorSetup is the page for setting up an authenticator app. Once it is
+confirmed the same page shows the recovery codes, which are only shown
+once.
+*/
+type TwoFactorSetup struct {
+	BaseViewModel
+
+	Secret        string
+	QRCode        template.HTML
+	RecoveryCodes []string
+}
+
+type LoginSessions struct {
+	BaseViewModel
+
+	Sessions []LoginSessionDisplay
+}
+
+type LoginSessionDisplay struct {
+	ID        int
+	Device    string
+	IPAddress string
+	CreatedAt string
+	LastSeen  string
+	IsCurrent bool
+}
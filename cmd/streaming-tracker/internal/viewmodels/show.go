@@ -48,6 +48,9 @@ type ManageShows struct {
 	Shows         []Show
 	Paging        paging.Paging
 	Referer       string
+
+	CanEditShows   bool
+	CanDeleteShows bool
 }
 
 type Show struct {
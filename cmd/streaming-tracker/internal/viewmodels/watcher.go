@@ -9,7 +9,8 @@ type SelectableWatcher struct {
 
 type ManageWatchers struct {
 	BaseViewModel
-	Watchers []WatcherDisplay `json:"watchers"`
+	Watchers       []WatcherDisplay `json:"watchers"`
+	CanAddWatchers bool             `json:"canAddWatchers"`
 }
 
 type WatcherDisplay struct {
@@ -1,7 +1,6 @@
 package watcher
 
 import (
-	"html/template"
 	"log/slog"
 	"net/http"
 
@@ -9,8 +8,8 @@ import (
 	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/adamgokit/rendering"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/base"
-	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/configuration"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/viewmodels"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
 	"github.com/adampresley/streaming-tracker/pkg/identity"
 	"github.com/adampresley/streaming-tracker/pkg/models"
 	"github.com/adampresley/streaming-tracker/pkg/watchers"
@@ -61,10 +60,11 @@ func (c WatcherController) ManageWatchersPage(w http.ResponseWriter, r *http.Req
 
 	viewData := viewmodels.ManageWatchers{
 		BaseViewModel: viewmodels.BaseViewModel{
-			Message: template.HTML(httphelpers.GetFromRequest[string](r, "message")),
+			Message: c.GetMessage(r),
 			IsHtmx:  httphelpers.IsHtmx(r),
 		},
-		Watchers: []viewmodels.WatcherDisplay{},
+		Watchers:       []viewmodels.WatcherDisplay{},
+		CanAddWatchers: session.Role.CanAddWatchers(),
 	}
 
 	if watchersWithInfo, err = c.watcherService.GetWatchersWithUserInfo(session.AccountID, session.UserID); err != nil {
@@ -128,6 +128,11 @@ func (c WatcherController) AddWatcherAction(w http.ResponseWriter, r *http.Reque
 	session := c.GetSession(r)
 	watcherName := httphelpers.GetFromRequest[string](r, "watcherName")
 
+	if !session.Role.CanAddWatchers() {
+		http.Error(w, "Your role in this household can't add watchers.", http.StatusForbidden)
+		return
+	}
+
 	if watcherName == "" {
 		http.Error(w, "Watcher name is required", http.StatusBadRequest)
 		return
@@ -150,7 +155,8 @@ func (c WatcherController) AddWatcherAction(w http.ResponseWriter, r *http.Reque
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx: true,
 		},
-		Watchers: []viewmodels.WatcherDisplay{},
+		Watchers:       []viewmodels.WatcherDisplay{},
+		CanAddWatchers: session.Role.CanAddWatchers(),
 	}
 
 	// Check if current user is account owner
@@ -228,7 +234,8 @@ func (c WatcherController) UpdateWatcherNameAction(w http.ResponseWriter, r *htt
 		BaseViewModel: viewmodels.BaseViewModel{
 			IsHtmx: true,
 		},
-		Watchers: []viewmodels.WatcherDisplay{},
+		Watchers:       []viewmodels.WatcherDisplay{},
+		CanAddWatchers: session.Role.CanAddWatchers(),
 	}
 
 	// Check if current user is account owner
@@ -4,9 +4,12 @@ import (
 	"context"
 	"embed"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -17,18 +20,31 @@ import (
 	"github.com/adampresley/adamgokit/mux2"
 	"github.com/adampresley/adamgokit/rendering"
 	"github.com/adampresley/adamgokit/rest/clientoptions"
-	"github.com/adampresley/adamgokit/sessions"
-	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/configuration"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/api"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/apitoken"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/home"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/household"
 	identityhandlers "github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/identity"
+	importhandlers "github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/imports"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/invitation"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/platform"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/settings"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/show"
+	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/sso"
 	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/watcher"
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/csrf"
 	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/imports"
+	"github.com/adampresley/streaming-tracker/pkg/migrations"
+	"github.com/adampresley/streaming-tracker/pkg/oidc"
 	"github.com/adampresley/streaming-tracker/pkg/platforms"
 	"github.com/adampresley/streaming-tracker/pkg/services"
 	"github.com/adampresley/streaming-tracker/pkg/shows"
 	"github.com/adampresley/streaming-tracker/pkg/watchers"
+	"github.com/adampresley/streaming-tracker/pkg/webauthn"
+	gorillasessions "github.com/gorilla/sessions"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -45,31 +61,65 @@ var (
 	sqlMigrationsFS embed.FS
 
 	/* Services */
-	db              *pgxpool.Pool
-	emailService    email.MailServicer
-	renderer        rendering.TemplateRenderer
-	accountService  identity.AccountServicer
-	userService     identity.UserServicer
-	watcherService  watchers.WatcherServicer
-	platformService platforms.PlatformServicer
-	showService     shows.ShowServicer
+	db                            *pgxpool.Pool
+	emailService                  email.MailServicer
+	renderer                      rendering.TemplateRenderer
+	accountService                identity.AccountServicer
+	accountInvitationService      identity.AccountInvitationServicer
+	apiTokenService               identity.ApiTokenServicer
+	auditService                  audit.AuditServicer
+	loginThrottleService          identity.LoginThrottleServicer
+	passkeyService                identity.PasskeyServicer
+	registrationInvitationService identity.RegistrationInvitationServicer
+	twoFactorService              identity.TwoFactorServicer
+	userService                   identity.UserServicer
+	userIdentityService           identity.UserIdentityServicer
+	userTokenService              identity.UserTokenServicer
+	oidcProviderService           oidc.ProviderServicer
+	watcherService                watchers.WatcherServicer
+	relyingParty                  webauthn.RelyingParty
+	platformService               platforms.PlatformServicer
+	showService                   shows.ShowServicer
+	importService                 imports.ImportServicer
 
 	/* Controllers */
-	homeController     home.HomeHandlers
-	identityController identityhandlers.IdentityHandlers
-	platformController platform.PlatformHandlers
-	showController     show.ShowHandlers
-	watcherController  watcher.WatcherHandlers
+	apiController        api.ApiHandlers
+	apiTokenController   apitoken.ApiTokenHandlers
+	homeController       home.HomeHandlers
+	householdController  household.HouseholdHandlers
+	identityController   identityhandlers.IdentityHandlers
+	importController     importhandlers.ImportHandlers
+	invitationController invitation.InvitationHandlers
+	platformController   platform.PlatformHandlers
+	settingsController   settings.SettingsHandlers
+	ssoController        sso.SSOHandlers
+	showController       show.ShowHandlers
+	watcherController    watcher.WatcherHandlers
 )
 
 func main() {
 	var (
-		err error
+		err             error
+		sessionKeyPairs [][]byte
 	)
 
 	config := configuration.LoadConfig()
 	setupLogger(&config, Version)
 
+	if !config.IsValidRegistrationMode() {
+		panic(fmt.Errorf("invalid registration mode %q. Use 'open', 'invite-only', or 'closed'", config.RegistrationMode))
+	}
+
+	if Version != "development" {
+		if err = config.CheckSessionSecrets(); err != nil {
+			panic(err)
+		}
+	}
+
+	if sessionKeyPairs, err = config.SessionKeyPairs(); err != nil {
+		panic(err)
+	}
+
 	shutdownCtx, stopApp := context.WithCancel(context.Background())
 
 	slog.Info("configuration loaded",
@@ -77,6 +127,10 @@ func main() {
 		slog.String("version", Version),
 		slog.String("loglevel", config.LogLevel),
 		slog.String("host", config.Host),
+		slog.String("registrationmode", config.RegistrationMode),
+		slog.Bool("oidcenabled", config.OIDCEnabled()),
+		slog.Bool("trustproxyheaders", config.TrustProxyHeaders),
+		slog.Int("previoussessionsecrets", len(sessionKeyPairs)/2-1),
 	)
 
 	slog.Debug("setting up...")
@@ -91,32 +145,48 @@ func main() {
 		panic(err)
 	}
 
-	migrateDatabase()
+	migrateDatabase(&config)
 
 	/*
 	 * Setup services
 	 */
-	sessionStore := sessions.NewCookieStore(
-		sessionKey,
-		sessions.WithMaxAge(time.Hour*24),
-	)
+	loginSessionStore := identity.NewLoginSessionStore(identity.LoginSessionStoreConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+		},
+		KeyPairs: sessionKeyPairs,
+		Options: &gorillasessions.Options{
+			Path:     "/",
+			MaxAge:   int((time.Hour * 24).Seconds()),
+			Secure:   strings.HasPrefix(config.TLD, "https://"),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		SessionKey:        sessionKey,
+		SessionName:       sessionName,
+		TrustProxyHeaders: config.TrustProxyHeaders,
+	})
 
-	emailService = getMailService(&config)
+	emailService = configuration.NewMailService(&config)
 
 	gob.Register(&identity.UserSession{})
 
 	auth := auth2.New(
 		auth2.UserNameAndPassword[*identity.UserSession](
-			sessionStore,
+			loginSessionStore,
 			sessionName,
 			sessionKey,
 			auth2.WithContextKey("session"),
 			auth2.WithExcludedPaths([]string{
 				"/error",
+				"/csrf-token",
 				"/login",
 				"/account/sign-up",
 				"/account/sign-up-success",
 				"/account/verify",
+				"/account/forgot-password",
+				"/account/reset-password",
 				"/favicon.ico",
 				"/app.webmanifest",
 				"/heartbeat",
@@ -128,6 +198,26 @@ func main() {
 		),
 	)
 
+	/*
+	 * API requests can use a personal access token, or the same session as
+	 * the web app. They get a JSON error instead of being redirected to the
+	 * login page.
+	 */
+	apiAuth := auth2.New(
+		auth2.UserNameAndPassword[*identity.UserSession](
+			loginSessionStore,
+			sessionName,
+			sessionKey,
+			auth2.WithContextKey("session"),
+			auth2.WithExcludedPaths([]string{
+				"/api/v1/openapi.json",
+			}),
+			auth2.WithExcludedPathsExact(true),
+			auth2.WithResponder(api.Unauthorized),
+			auth2.WithErrorFunc(api.Unauthorized),
+		),
+	)
+
 	if renderer, err = rendering.NewGoTemplateRenderer(appFS); err != nil {
 		panic(err)
 	}
@@ -147,6 +237,91 @@ func main() {
 		},
 	})
 
+	userIdentityService = identity.NewUserIdentityService(identity.UserIdentityServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	oidcProviderService = oidc.NewProviderService(oidc.ProviderServiceConfig{
+		Issuer:       config.OIDCIssuer,
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  strings.TrimSuffix(config.TLD, "/") + "/login/oidc/callback",
+		Scopes:       strings.Fields(config.OIDCScopes),
+	})
+
+	userTokenService = identity.NewUserTokenService(identity.UserTokenServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	twoFactorService = identity.NewTwoFactorService(identity.TwoFactorServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	loginThrottleService = identity.NewLoginThrottleService(identity.LoginThrottleServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	auditService = audit.NewAuditService(audit.AuditServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+		TrustProxyHeaders: config.TrustProxyHeaders,
+	})
+
+	passkeyService = identity.NewPasskeyService(identity.PasskeyServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	if relyingParty, err = webauthn.NewRelyingParty("Streaming Tracker", config.TLD); err != nil {
+		panic(err)
+	}
+
+	accountInvitationService = identity.NewAccountInvitationService(identity.AccountInvitationServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	registrationInvitationService = identity.NewRegistrationInvitationService(identity.RegistrationInvitationServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
+	apiTokenService = identity.NewApiTokenService(identity.ApiTokenServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+	})
+
 	watcherService = watchers.NewWatcherService(watchers.WatcherServiceConfig{
 		DbServiceBaseConfig: services.DbServiceBaseConfig{
 			QueryTimeout: config.QueryTimeout,
@@ -176,9 +351,34 @@ func main() {
 		},
 	})
 
+	importService = imports.NewImportService(imports.ImportServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: config.QueryTimeout,
+			DB:           db,
+			PageSize:     config.PageSize,
+		},
+		ShowService:    showService,
+		WatcherService: watcherService,
+	})
+
 	/*
 	 * Setup controllers
 	 */
+	apiController = api.NewApiController(api.ApiControllerConfig{
+		Auth:            apiAuth,
+		Config:          &config,
+		PlatformService: platformService,
+		ShowService:     showService,
+		WatcherService:  watcherService,
+	})
+
+	apiTokenController = apitoken.NewApiTokenController(apitoken.ApiTokenControllerConfig{
+		ApiTokenService: apiTokenService,
+		Auth:            auth,
+		Config:          &config,
+		Renderer:        renderer,
+	})
+
 	homeController = home.NewHomeController(home.HomeControllerConfig{
 		Auth:        auth,
 		Config:      &config,
@@ -186,14 +386,43 @@ func main() {
 		ShowService: showService,
 	})
 
+	householdController = household.NewHouseholdController(household.HouseholdControllerConfig{
+		AccountInvitationService: accountInvitationService,
+		AccountService:           accountService,
+		AuditService:             auditService,
+		Auth:                     auth,
+		Config:                   &config,
+		EmailService:             emailService,
+		LoginThrottleService:     loginThrottleService,
+		Renderer:                 renderer,
+		UserService:              userService,
+	})
+
 	identityController = identityhandlers.NewIdentityController(identityhandlers.IdentityControllerConfig{
-		AccountService: accountService,
-		Auth:           auth,
-		Config:         &config,
-		Renderer:       renderer,
-		UserService:    userService,
-		EmailService:   emailService,
-		WatcherService: watcherService,
+		AccountInvitationService:      accountInvitationService,
+		AccountService:                accountService,
+		AuditService:                  auditService,
+		Auth:                          auth,
+		Config:                        &config,
+		LoginThrottleService:          loginThrottleService,
+		PasskeyService:                passkeyService,
+		RegistrationInvitationService: registrationInvitationService,
+		RelyingParty:                  relyingParty,
+		Renderer:                      renderer,
+		TwoFactorService:              twoFactorService,
+		UserService:                   userService,
+		UserTokenService:              userTokenService,
+		EmailService:                  emailService,
+		WatcherService:                watcherService,
+	})
+
+	importController = importhandlers.NewImportController(importhandlers.ImportControllerConfig{
+		Auth:            auth,
+		Config:          &config,
+		ImportService:   importService,
+		PlatformService: platformService,
+		Renderer:        renderer,
+		WatcherService:  watcherService,
 	})
 
 	platformController = platform.NewPlatformController(platform.PlatformControllerConfig{
@@ -211,6 +440,40 @@ func main() {
 		WatcherService:  watcherService,
 	})
 
+	invitationController = invitation.NewInvitationController(invitation.InvitationControllerConfig{
+		AccountService:                accountService,
+		Auth:                          auth,
+		Config:                        &config,
+		EmailService:                  emailService,
+		RegistrationInvitationService: registrationInvitationService,
+		Renderer:                      renderer,
+	})
+
+	settingsController = settings.NewSettingsController(settings.SettingsControllerConfig{
+		AuditService:        auditService,
+		Auth:                auth,
+		Config:              &config,
+		EmailService:        emailService,
+		LoginSessionService: loginSessionStore,
+		PasskeyService:      passkeyService,
+		RelyingParty:        relyingParty,
+		Renderer:            renderer,
+		TwoFactorService:    twoFactorService,
+		UserIdentityService: userIdentityService,
+		UserService:         userService,
+	})
+
+	ssoController = sso.NewSSOController(sso.SSOControllerConfig{
+		AuditService:        auditService,
+		Auth:                auth,
+		Config:              &config,
+		ProviderService:     oidcProviderService,
+		TwoFactorService:    twoFactorService,
+		UserIdentityService: userIdentityService,
+		UserService:         userService,
+		UserTokenService:    userTokenService,
+	})
+
 	watcherController = watcher.NewWatcherController(watcher.WatcherControllerConfig{
 		Auth:           auth,
 		Config:         &config,
@@ -227,19 +490,77 @@ func main() {
 		{Path: "GET /heartbeat", HandlerFunc: heartbeat},
 		{Path: "GET /", HandlerFunc: homeController.HomePage},
 		{Path: "GET /error", HandlerFunc: homeController.ErrorPage},
+		{Path: "GET /csrf-token", HandlerFunc: csrf.TokenHandler},
 		{Path: "GET /login", HandlerFunc: identityController.LoginPage},
 		{Path: "POST /login", HandlerFunc: identityController.LoginAction},
+		{Path: "GET /login/two-factor", HandlerFunc: identityController.TwoFactorLoginPage},
+		{Path: "POST /login/two-factor", HandlerFunc: identityController.TwoFactorLoginAction},
+		{Path: "GET /login/email", HandlerFunc: identityController.EmailLoginPage},
+		{Path: "POST /login/email", HandlerFunc: identityController.EmailLoginAction},
+		{Path: "GET /login/email/verify", HandlerFunc: identityController.EmailLoginVerifyPage},
+		{Path: "POST /login/email/verify", HandlerFunc: identityController.EmailLoginVerifyAction},
+		{Path: "POST /login/passkey/begin", HandlerFunc: identityController.BeginPasskeyLoginAction},
+		{Path: "POST /login/passkey/finish", HandlerFunc: identityController.FinishPasskeyLoginAction},
+		{Path: "GET /login/oidc", HandlerFunc: ssoController.LoginAction},
+		{Path: "GET /login/oidc/callback", HandlerFunc: ssoController.CallbackAction},
 		{Path: "GET /logout", HandlerFunc: identityController.LogoutAction},
 		{Path: "GET /account/sign-up", HandlerFunc: identityController.AccountSignUpPage},
 		{Path: "POST /account/sign-up", HandlerFunc: identityController.AccountSignUpAction},
 		{Path: "GET /account/sign-up-success", HandlerFunc: identityController.AccountSignUpSuccessPage},
 		{Path: "GET /account/verify", HandlerFunc: identityController.AccountVerifyPage},
 		{Path: "POST /account/verify", HandlerFunc: identityController.AccountVerifyAction},
+		{Path: "GET /account/forgot-password", HandlerFunc: identityController.ForgotPasswordPage},
+		{Path: "POST /account/forgot-password", HandlerFunc: identityController.ForgotPasswordAction},
+		{Path: "GET /account/reset-password", HandlerFunc: identityController.ResetPasswordPage},
+		{Path: "POST /account/reset-password", HandlerFunc: identityController.ResetPasswordAction},
 		{Path: "GET /account/manage-watchers", HandlerFunc: watcherController.ManageWatchersPage},
 		{Path: "POST /account/watchers/add", HandlerFunc: watcherController.AddWatcherAction},
 		{Path: "POST /account/watchers/update-name", HandlerFunc: watcherController.UpdateWatcherNameAction},
+		{Path: "GET /account/household", HandlerFunc: householdController.HouseholdPage},
+		{Path: "POST /account/household/invite", HandlerFunc: householdController.InviteAction},
+		{Path: "POST /account/household/invitations/revoke", HandlerFunc: householdController.RevokeInvitationAction},
+		{Path: "POST /account/household/join-token/rotate", HandlerFunc: householdController.RotateJoinTokenAction},
+		{Path: "POST /account/household/join", HandlerFunc: householdController.JoinAction},
+		{Path: "POST /account/household/leave", HandlerFunc: householdController.LeaveAction},
+		{Path: "POST /account/household/members/remove", HandlerFunc: householdController.RemoveMemberAction},
+		{Path: "POST /account/household/members/role", HandlerFunc: householdController.SetMemberRoleAction},
+		{Path: "POST /account/household/members/transfer", HandlerFunc: householdController.TransferOwnershipAction},
+		{Path: "GET /account/household/security", HandlerFunc: householdController.SecurityLogPage},
+		{Path: "GET /account/switcher", HandlerFunc: householdController.AccountSwitcher},
+		{Path: "POST /account/switch", HandlerFunc: householdController.SwitchAccountAction},
+		{Path: "GET /account/invitations", HandlerFunc: invitationController.ManageInvitationsPage},
+		{Path: "POST /account/invitations/send", HandlerFunc: invitationController.SendInvitationAction},
+		{Path: "GET /account/api-tokens", HandlerFunc: apiTokenController.ManageApiTokensPage},
+		{Path: "POST /account/api-tokens/create", HandlerFunc: apiTokenController.CreateApiTokenAction},
+		{Path: "POST /account/api-tokens/revoke", HandlerFunc: apiTokenController.RevokeApiTokenAction},
+		{Path: "GET /account/settings", HandlerFunc: settingsController.AccountSettingsPage},
+		{Path: "POST /account/settings/password", HandlerFunc: settingsController.ChangePasswordAction},
+		{Path: "POST /account/settings/email", HandlerFunc: settingsController.ChangeEmailAction},
+		{Path: "POST /account/settings/email/verify", HandlerFunc: settingsController.VerifyEmailAction},
+		{Path: "POST /account/settings/email/cancel", HandlerFunc: settingsController.CancelEmailChangeAction},
+		{Path: "POST /account/settings/identities/unlink", HandlerFunc: settingsController.UnlinkIdentityAction},
+		{Path: "POST /account/settings/passkeys/begin", HandlerFunc: settingsController.BeginPasskeyAction},
+		{Path: "POST /account/settings/passkeys/finish", HandlerFunc: settingsController.FinishPasskeyAction},
+		{Path: "POST /account/settings/passkeys/delete", HandlerFunc: settingsController.DeletePasskeyAction},
+		{Path: "GET /account/settings/sessions", HandlerFunc: settingsController.SessionsPage},
+		{Path: "POST /account/settings/sessions/delete", HandlerFunc: settingsController.DeleteSessionAction},
+		{Path: "POST /account/settings/sessions/delete-others", HandlerFunc: settingsController.DeleteOtherSessionsAction},
+		{Path: "GET /account/settings/two-factor", HandlerFunc: settingsController.TwoFactorPage},
+		{Path: "POST /account/settings/two-factor", HandlerFunc: settingsController.BeginTwoFactorAction},
+		{Path: "POST /account/settings/two-factor/confirm", HandlerFunc: settingsController.ConfirmTwoFactorAction},
+		{Path: "POST /account/settings/two-factor/disable", HandlerFunc: settingsController.DisableTwoFactorAction},
+		{Path: "POST /account/settings/two-factor/recovery-codes", HandlerFunc: settingsController.RegenerateRecoveryCodesAction},
 		{Path: "GET /shows/add", HandlerFunc: showController.AddShowPage},
 		{Path: "POST /shows/add", HandlerFunc: showController.AddShowAction},
+		{Path: "GET /shows/import", HandlerFunc: importController.ImportCSVPage},
+		{Path: "POST /shows/import/preview", HandlerFunc: importController.ImportCSVPreviewAction},
+		{Path: "POST /shows/import/commit", HandlerFunc: importController.ImportCSVCommitAction},
+		{Path: "GET /shows/import/history", HandlerFunc: importController.ImportWatchHistoryPage},
+		{Path: "POST /shows/import/history/preview", HandlerFunc: importController.ImportWatchHistoryPreviewAction},
+		{Path: "POST /shows/import/history/commit", HandlerFunc: importController.ImportWatchHistoryCommitAction},
+		{Path: "GET /shows/import/netflix", HandlerFunc: importController.ImportNetflixPage},
+		{Path: "POST /shows/import/netflix/preview", HandlerFunc: importController.ImportNetflixPreviewAction},
+		{Path: "POST /shows/import/netflix/commit", HandlerFunc: importController.ImportNetflixCommitAction},
 		{Path: "DELETE /shows/delete", HandlerFunc: showController.DeleteShowAction},
 		{Path: "GET /shows/edit/{id}", HandlerFunc: showController.EditShowPage},
 		{Path: "POST /shows/edit/{id}", HandlerFunc: showController.EditShowAction},
@@ -251,6 +572,29 @@ func main() {
 		{Path: "POST /shows/add-season", HandlerFunc: showController.AddSeasonAction},
 		{Path: "POST /shows/cancel", HandlerFunc: showController.CancelShowAction},
 		{Path: "POST /shows/back-to-want-to-watch", HandlerFunc: showController.BackToWantToWatchAction},
+
+		{Path: "GET /api/", HandlerFunc: api.NotFound},
+		{Path: "GET /api/v1/openapi.json", HandlerFunc: apiController.OpenAPIDocument},
+		{Path: "GET /api/v1/platforms", HandlerFunc: apiController.GetPlatforms},
+		{Path: "GET /api/v1/shows", HandlerFunc: apiController.SearchShows},
+		{Path: "POST /api/v1/shows", HandlerFunc: apiController.AddShow},
+		{Path: "GET /api/v1/shows/active", HandlerFunc: apiController.GetActiveShows},
+		{Path: "GET /api/v1/shows/finished", HandlerFunc: apiController.GetFinishedShows},
+		{Path: "GET /api/v1/shows/{id}", HandlerFunc: apiController.GetShow},
+		{Path: "PUT /api/v1/shows/{id}", HandlerFunc: apiController.UpdateShow},
+		{Path: "DELETE /api/v1/shows/{id}", HandlerFunc: apiController.DeleteShow},
+		{Path: "PUT /api/v1/shows/{id}/progress", HandlerFunc: apiController.UpdateShowProgress},
+		{Path: "POST /api/v1/shows/{id}/start-watching", HandlerFunc: apiController.StartWatching},
+		{Path: "POST /api/v1/shows/{id}/finish-season", HandlerFunc: apiController.FinishSeason},
+		{Path: "POST /api/v1/shows/{id}/add-season", HandlerFunc: apiController.AddSeason},
+		{Path: "POST /api/v1/shows/{id}/cancel", HandlerFunc: apiController.CancelShow},
+		{Path: "POST /api/v1/shows/{id}/back-to-want-to-watch", HandlerFunc: apiController.BackToWantToWatch},
+		{Path: "GET /api/v1/online/shows", HandlerFunc: apiController.OnlineSearch},
+		{Path: "GET /api/v1/online/shows/image", HandlerFunc: apiController.FindShowImage},
+		{Path: "GET /api/v1/online/shows/match", HandlerFunc: apiController.MatchOnlineShow},
+		{Path: "GET /api/v1/watchers", HandlerFunc: apiController.GetWatchers},
+		{Path: "POST /api/v1/watchers", HandlerFunc: apiController.AddWatcher},
+		{Path: "PUT /api/v1/watchers/{id}", HandlerFunc: apiController.UpdateWatcherName},
 	}
 
 	mux := mux2.Setup(
@@ -263,7 +607,15 @@ func main() {
 		mux2.WithStaticContent("app", "/static/", appFS),
 		mux2.UseGzip(),
 		mux2.UseGzipForStaticFiles(),
-		mux2.WithMiddlewares(auth.Middleware),
+		mux2.WithMiddlewares(csrf.Middleware(csrf.Config{
+			ErrorFunc: csrfFailed,
+			Exempt:    isAccessTokenRequest,
+			Secrets:   csrfSecrets(sessionKeyPairs),
+			Secure:    strings.HasPrefix(config.TLD, "https://"),
+		}), routeAuthMiddleware(
+			chainMiddleware(auth.Middleware, identityhandlers.CurrentSessionMiddleware(userService, accountService, identityController.SessionEnded)),
+			api.BearerTokenMiddleware(apiTokenService, accountService, chainMiddleware(apiAuth.Middleware, identityhandlers.CurrentSessionMiddleware(userService, accountService, api.Unauthorized))),
+		)),
 	)
 
 	slog.Info("server started")
@@ -271,79 +623,134 @@ func main() {
 	slog.Info("server stopped")
 }
 
-func heartbeat(w http.ResponseWriter, r *http.Request) {
-	httphelpers.TextOK(w, "OK")
+/*
+routeAuthMiddleware sends API requests through apiMiddleware and everything
+else through webMiddleware.
+*/
+func routeAuthMiddleware(webMiddleware, apiMiddleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		web := webMiddleware(next)
+		api := apiMiddleware(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				api.ServeHTTP(w, r)
+				return
+			}
+
+			web.ServeHTTP(w, r)
+		})
+	}
 }
 
-func migrateDatabase() {
-	var (
-		err  error
-		dirs []os.DirEntry
-		b    []byte
-	)
+/*
+csrfSecrets derives the CSRF secrets from the hash keys in the session key
+pairs, so the CSRF tokens rotate with the session secret without being
+signed by the same key.
+*/
+func csrfSecrets(keyPairs [][]byte) [][]byte {
+	result := [][]byte{}
 
-	if dirs, err = fs.ReadDir(sqlMigrationsFS, "."); err != nil {
-		panic(err)
+	for i := 0; i < len(keyPairs); i += 2 {
+		result = append(result, csrf.DeriveSecret(keyPairs[i]))
 	}
 
-	for _, d := range dirs {
-		if d.IsDir() {
-			slog.Debug("skipping directory", "name", d.Name())
-			continue
-		}
+	return result
+}
 
-		slog.Debug("checking for SQL script", "name", d.Name())
+/*
+isAccessTokenRequest is true for API requests with an Authorization header.
+They don't use the session cookie, so they can't be forged by another site.
+*/
+func isAccessTokenRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") && r.Header.Get("Authorization") != ""
+}
 
-		if strings.HasPrefix(d.Name(), "commit") {
-			if b, err = fs.ReadFile(sqlMigrationsFS, d.Name()); err != nil {
-				panic(err)
-			}
+/*
+csrfFailed responds to requests that fail the CSRF check. HTMX requests are
+sent to the error page with HX-Redirect, since HTMX doesn't swap in error
+responses.
+*/
+func csrfFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		api.InvalidCSRFToken(w, r, err)
+		return
+	}
 
-			if err = runSqlScript(d.Name(), b); err != nil {
-				if !isIgnorableError(err) {
-					panic(err)
-				}
-			}
-		}
+	message := "This page has expired. Please reload it and try again."
+
+	if errors.Is(err, csrf.ErrInvalidToken) || errors.Is(err, csrf.ErrCrossSiteRequest) {
+		slog.Warn("request failed the csrf check", "error", err, "method", r.Method, "path", r.URL.Path)
+	} else {
+		slog.Error("error checking csrf token", "error", err)
+		message = "We are sorry, but an unexpected error occurred. Please try again later."
 	}
-}
 
-func runSqlScript(name string, script []byte) error {
-	slog.Info("running SQL script", "name", name)
+	redirectURL := "/error?message=" + url.QueryEscape(message)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
+	if httphelpers.IsHtmx(r) {
+		w.Header().Set("HX-Redirect", redirectURL)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 
-	_, err := db.Exec(ctx, string(script))
-	return err
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 }
 
-func isIgnorableError(err error) bool {
-	if strings.Contains(err.Error(), "duplicate column") {
-		return true
-	}
+/*
+chainMiddleware combines middlewares into one. The first one runs first.
+*/
+func chainMiddleware(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
 
-	if strings.Contains(err.Error(), "duplicate key value") {
-		return true
+		return next
 	}
+}
 
-	return false
+func heartbeat(w http.ResponseWriter, r *http.Request) {
+	httphelpers.TextOK(w, "OK")
 }
 
-func getMailService(config *configuration.Config) email.MailServicer {
-	mailTimeout := time.Second * 20
+/*
+migrateDatabase applies any new migrations. The copies built into the
+application are used unless a migration directory is configured.
+*/
+func migrateDatabase(config *configuration.Config) {
+	var (
+		err     error
+		source  fs.FS
+		applied []migrations.Migration
+	)
 
-	if config.EmailApiKey != "" && config.EmailDomain != "" {
-		return email.NewMailgunService(&email.Config{
-			ApiKey:  config.EmailApiKey,
-			Domain:  config.EmailDomain,
-			Timeout: mailTimeout,
-		})
+	if source, err = fs.Sub(sqlMigrationsFS, "sql-migrations"); err != nil {
+		panic(err)
 	}
 
-	return email.NewSmtpMailService(&email.Config{
-		Host:    config.EmailHost,
-		Port:    config.EmailPort,
-		Timeout: mailTimeout,
+	if config.DataMigrationDir != "" {
+		if _, err = os.Stat(config.DataMigrationDir); err != nil {
+			panic(fmt.Errorf("error reading migration directory: %w", err))
+		}
+
+		source = os.DirFS(config.DataMigrationDir)
+	}
+
+	migrationService := migrations.NewMigrationService(migrations.MigrationServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			QueryTimeout: time.Minute * 5,
+			DB:           db,
+		},
+		Source:                source,
+		LegacyBaselineVersion: migrations.LegacyBaselineVersion,
 	})
+
+	if applied, err = migrationService.Up(); err != nil {
+		panic(err)
+	}
+
+	for _, migration := range applied {
+		slog.Info("applied migration", "name", migration.Name)
+	}
 }
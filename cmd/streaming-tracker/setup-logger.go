@@ -5,7 +5,7 @@ import (
 	"os"
 	"strings"
 
-	"github.com/adampresley/streaming-tracker/cmd/streaming-tracker/internal/configuration"
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
 )
 
 func setupLogger(config *configuration.Config, version string) {
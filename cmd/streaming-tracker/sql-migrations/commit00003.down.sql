@@ -0,0 +1 @@
+ALTER TABLE shows DROP COLUMN IF EXISTS poster_image;
@@ -0,0 +1 @@
+DELETE FROM platforms WHERE name = 'Plex';
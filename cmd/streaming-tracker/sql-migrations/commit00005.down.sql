@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_shows_account_id_tvmaze_id;
+ALTER TABLE shows DROP COLUMN IF EXISTS tvmaze_id;
@@ -0,0 +1,17 @@
+--
+-- Add tvmaze_id column to shows table so imported shows can be matched
+-- to their TVMaze entry
+--
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1
+        FROM information_schema.columns
+        WHERE table_name = 'shows'
+          AND column_name = 'tvmaze_id'
+    ) THEN
+      ALTER TABLE shows ADD COLUMN tvmaze_id integer;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_shows_account_id_tvmaze_id ON shows (account_id, tvmaze_id);
@@ -0,0 +1,19 @@
+--
+-- Personal access tokens for calling the API without a browser session.
+-- Only a SHA-256 hash of each token is stored. The prefix is kept so people
+-- can tell their tokens apart.
+--
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+   id serial PRIMARY KEY,
+   user_id integer REFERENCES users(id) NOT NULL,
+   account_id integer REFERENCES accounts(id) NOT NULL,
+   name text NOT NULL,
+   token_hash text UNIQUE NOT NULL,
+   token_prefix text NOT NULL,
+   scope text NOT NULL CHECK (scope IN ('read', 'write')),
+   created_at timestamp NOT NULL,
+   last_used_at timestamp,
+   revoked_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
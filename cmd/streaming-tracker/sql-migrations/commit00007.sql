@@ -0,0 +1,15 @@
+--
+-- Single use tokens emailed to users, such as password reset links. Only a
+-- SHA-256 hash of each token is stored.
+--
+CREATE TABLE IF NOT EXISTS "user_tokens" (
+   id serial PRIMARY KEY,
+   user_id integer REFERENCES users(id) NOT NULL,
+   purpose text NOT NULL,
+   token_hash text UNIQUE NOT NULL,
+   created_at timestamp NOT NULL,
+   expires_at timestamp NOT NULL,
+   used_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id_purpose ON user_tokens (user_id, purpose);
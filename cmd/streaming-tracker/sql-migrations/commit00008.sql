@@ -0,0 +1,5 @@
+--
+-- A new email address a user asked to change to. It replaces email once the
+-- user enters the activation code sent to the new address.
+--
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email text;
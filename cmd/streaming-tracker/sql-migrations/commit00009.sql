@@ -0,0 +1,17 @@
+--
+-- Single use codes that let someone sign up when registration is invite
+-- only. invited_by is NULL for invitations made with the admin tool. Only a
+-- SHA-256 hash of each code is stored.
+--
+CREATE TABLE IF NOT EXISTS "registration_invitations" (
+   id serial PRIMARY KEY,
+   email text NOT NULL,
+   invited_by integer REFERENCES users(id) ON DELETE SET NULL,
+   code_hash text UNIQUE NOT NULL,
+   created_at timestamp NOT NULL,
+   expires_at timestamp NOT NULL,
+   used_at timestamp,
+   used_by integer REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_registration_invitations_invited_by ON registration_invitations (invited_by);
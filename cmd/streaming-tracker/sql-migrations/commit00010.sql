@@ -0,0 +1,19 @@
+--
+-- Invitations for a specific email address to join a household. Unlike the
+-- account join token, each one works once and expires. Only a SHA-256 hash
+-- of each token is stored.
+--
+CREATE TABLE IF NOT EXISTS "account_invitations" (
+   id serial PRIMARY KEY,
+   account_id integer REFERENCES accounts(id) ON DELETE CASCADE NOT NULL,
+   email text NOT NULL,
+   invited_by integer REFERENCES users(id) ON DELETE SET NULL,
+   token_hash text UNIQUE NOT NULL,
+   created_at timestamp NOT NULL,
+   expires_at timestamp NOT NULL,
+   used_at timestamp,
+   used_by integer REFERENCES users(id) ON DELETE SET NULL,
+   revoked_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_invitations_account_id ON account_invitations (account_id);
@@ -0,0 +1,18 @@
+--
+-- The households each user belongs to. users.account_id is the one they
+-- are using now, and is where they start when they log in.
+--
+CREATE TABLE IF NOT EXISTS "account_memberships" (
+   user_id integer REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+   account_id integer REFERENCES accounts(id) ON DELETE CASCADE NOT NULL,
+   joined_at timestamp NOT NULL,
+   PRIMARY KEY (user_id, account_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_memberships_account_id ON account_memberships (account_id);
+
+INSERT INTO account_memberships (user_id, account_id, joined_at)
+SELECT u.id, u.account_id, u.created_at
+FROM users AS u
+WHERE u.account_id IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+ALTER TABLE account_memberships DROP CONSTRAINT IF EXISTS chk_account_memberships_role;
+ALTER TABLE account_memberships DROP COLUMN IF EXISTS role;
@@ -0,0 +1,7 @@
+--
+-- What each member may do in a household. The account's owner can do
+-- everything no matter what is stored here, so only member and viewer are
+-- kept.
+--
+ALTER TABLE account_memberships ADD COLUMN IF NOT EXISTS role varchar(20) NOT NULL DEFAULT 'member';
+ALTER TABLE account_memberships ADD CONSTRAINT chk_account_memberships_role CHECK (role IN ('member', 'viewer'));
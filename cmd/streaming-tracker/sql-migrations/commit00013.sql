@@ -0,0 +1,16 @@
+--
+-- Accounts at an OpenID Connect provider that users sign in with. An
+-- identity is linked the first time someone signs in with a verified email
+-- address that matches their user.
+--
+CREATE TABLE IF NOT EXISTS "user_identities" (
+   id serial PRIMARY KEY,
+   user_id integer REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+   issuer text NOT NULL,
+   subject text NOT NULL,
+   email text NOT NULL,
+   created_at timestamp NOT NULL,
+   UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
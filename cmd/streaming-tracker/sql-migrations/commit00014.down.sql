@@ -0,0 +1,3 @@
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS failed_attempts;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_two_factor;
@@ -0,0 +1,31 @@
+--
+-- Two-factor authentication with an authenticator app. A row without
+-- enabled_at is an enrollment the user hasn't confirmed yet. last_used_step
+-- is the time step of the last code used, so a code can't be used twice.
+--
+CREATE TABLE IF NOT EXISTS "user_two_factor" (
+   user_id integer PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+   secret text NOT NULL,
+   last_used_step bigint NOT NULL DEFAULT 0,
+   created_at timestamp NOT NULL,
+   enabled_at timestamp
+);
+
+--
+-- Single use codes for logging in without the authenticator app. Only a
+-- hash of each code is kept.
+--
+CREATE TABLE IF NOT EXISTS "user_recovery_codes" (
+   id serial PRIMARY KEY,
+   user_id integer REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+   code_hash text NOT NULL,
+   created_at timestamp NOT NULL,
+   used_at timestamp,
+   UNIQUE (user_id, code_hash)
+);
+
+--
+-- Wrong codes entered against a token, such as the second step of a log
+-- in. The token stops working after too many.
+--
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS failed_attempts integer NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+--
+-- Passkeys users can log in with instead of a password. credential_id is
+-- the base64url ID the authenticator gave the passkey, and public_key is
+-- its COSE encoded key. sign_count is checked to catch cloned
+-- authenticators.
+--
+CREATE TABLE IF NOT EXISTS "user_passkeys" (
+   id serial PRIMARY KEY,
+   user_id integer REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+   credential_id text UNIQUE NOT NULL,
+   public_key bytea NOT NULL,
+   sign_count bigint NOT NULL DEFAULT 0,
+   name varchar(100) NOT NULL,
+   created_at timestamp NOT NULL,
+   last_used_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_passkeys_user_id ON user_passkeys (user_id);
@@ -0,0 +1,13 @@
+--
+-- Failed log ins, counted per email address and per IP address. key is
+-- "email:<address>" or "ip:<address>". Once there are too many, log ins
+-- are refused until locked_until, which doubles with each further failure.
+--
+CREATE TABLE IF NOT EXISTS "login_throttles" (
+   key varchar(300) PRIMARY KEY,
+   failed_attempts integer NOT NULL DEFAULT 0,
+   locked_until timestamp,
+   updated_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttles_updated_at ON login_throttles (updated_at);
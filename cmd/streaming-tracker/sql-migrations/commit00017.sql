@@ -0,0 +1,19 @@
+--
+-- Logged in sessions. The cookie holds a signed, random session ID, and only
+-- a hash of it is kept here with the session's values. Deleting a row logs
+-- that device out.
+--
+CREATE TABLE IF NOT EXISTS "login_sessions" (
+   id serial PRIMARY KEY,
+   token_hash text UNIQUE NOT NULL,
+   user_id integer REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+   data bytea NOT NULL,
+   user_agent varchar(500) NOT NULL DEFAULT '',
+   ip_address varchar(45) NOT NULL DEFAULT '',
+   created_at timestamp NOT NULL,
+   last_seen_at timestamp NOT NULL,
+   expires_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_sessions_user_id ON login_sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_login_sessions_expires_at ON login_sessions (expires_at);
@@ -0,0 +1,20 @@
+--
+-- Security events, such as log ins, password changes, and household joins,
+-- so account owners can see what has happened. account_id is set for
+-- events about a household. Other events belong to the user, and are shown
+-- to the owners of the households they are in.
+--
+CREATE TABLE IF NOT EXISTS "audit_events" (
+   id serial PRIMARY KEY,
+   user_id integer REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+   account_id integer REFERENCES accounts(id) ON DELETE CASCADE,
+   event_type varchar(50) NOT NULL,
+   details varchar(500) NOT NULL DEFAULT '',
+   ip_address varchar(45) NOT NULL DEFAULT '',
+   user_agent varchar(500) NOT NULL DEFAULT '',
+   created_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id_created_at ON audit_events (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_account_id_created_at ON audit_events (account_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE show_status DROP CONSTRAINT IF EXISTS fk_show_status_show_account;
+ALTER TABLE shows DROP CONSTRAINT IF EXISTS uq_shows_id_account_id;
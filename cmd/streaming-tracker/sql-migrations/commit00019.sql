@@ -0,0 +1,26 @@
+--
+-- A show's status must belong to the same account as the show, so a query
+-- that forgets to check the account can't tie one household's show to
+-- another's status.
+--
+-- Statuses that already belong to another account are reported rather than
+-- moved, since only someone looking at the data can say which household the
+-- show really belongs to. Fix them, then start the application again.
+--
+DO $$
+DECLARE
+   mismatched text;
+BEGIN
+   SELECT string_agg(format('show_status %s (account %s) for show %s (account %s)', ss.id, ss.account_id, s.id, s.account_id), ', ' ORDER BY ss.id)
+   INTO mismatched
+   FROM show_status AS ss
+      INNER JOIN shows AS s ON s.id = ss.show_id
+   WHERE ss.account_id <> s.account_id;
+
+   IF mismatched IS NOT NULL THEN
+      RAISE EXCEPTION 'show statuses belong to a different account than their show: %', mismatched;
+   END IF;
+END $$;
+
+ALTER TABLE shows ADD CONSTRAINT uq_shows_id_account_id UNIQUE (id, account_id);
+ALTER TABLE show_status ADD CONSTRAINT fk_show_status_show_account FOREIGN KEY (show_id, account_id) REFERENCES shows (id, account_id);
@@ -0,0 +1,5 @@
+--
+-- The old account codes are gone, and the new ones work fine with the
+-- previous version, so there is nothing to undo.
+--
+SELECT 1;
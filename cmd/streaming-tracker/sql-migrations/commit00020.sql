@@ -0,0 +1,7 @@
+--
+-- Account codes used to be six characters, few enough to guess. Give every
+-- account with a short code a long random one. Owners see the new code on
+-- the Household page.
+--
+UPDATE accounts SET join_token = replace(gen_random_uuid()::text, '-', '')
+WHERE length(join_token) < 24;
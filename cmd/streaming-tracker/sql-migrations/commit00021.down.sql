@@ -0,0 +1,2 @@
+DELETE FROM user_tokens WHERE user_id IS NULL;
+ALTER TABLE user_tokens ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,5 @@
+--
+-- Passkey log in challenges are kept as single use tokens. They are made
+-- before anyone knows who is logging in, so they don't have a user.
+--
+ALTER TABLE user_tokens ALTER COLUMN user_id DROP NOT NULL;
@@ -0,0 +1,175 @@
+/*
+Package audit records security events, such as log ins and password
+changes, so account owners can review them.
+*/
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/clientip"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/useragent"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+const (
+	/*
+	   auditEventRetention is how long events are kept.
+	*/
+	auditEventRetention = time.Hour * 24 * 90
+
+	maxUserAgentLength = 500
+)
+
+type AuditServicer interface {
+	/*
+	   GetAccountAuditEvents returns a household's most recent events,
+	   newest first. That is the events about the household, and what its
+	   members did while they were using it.
+	*/
+	GetAccountAuditEvents(accountID, limit int) ([]models.AuditEvent, error)
+
+	/*
+	   RecordAuditEvent saves an event, with the IP address and user agent
+	   of the request that caused it. Events without an AccountID are
+	   recorded against the household the user is using.
+	*/
+	RecordAuditEvent(r *http.Request, event models.AuditEvent) error
+}
+
+type AuditServiceConfig struct {
+	services.DbServiceBaseConfig
+
+	TrustProxyHeaders bool
+}
+
+type AuditService struct {
+	services.DbServiceBase
+
+	trustProxyHeaders bool
+}
+
+func NewAuditService(config AuditServiceConfig) AuditService {
+	return AuditService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+		trustProxyHeaders: config.TrustProxyHeaders,
+	}
+}
+
+/*
+GetAccountAuditEvents returns a household's most recent events, newest
+first. Events recorded before account_id was set on every event have none,
+so they are shown to the households the user was in when they happened.
+*/
+func (s AuditService) GetAccountAuditEvents(accountID, limit int) ([]models.AuditEvent, error) {
+	var (
+		err     error
+		results = []models.AuditEvent{}
+	)
+
+	query := `
+SELECT
+	ae.id
+	, ae.user_id
+	, u.email AS user_email
+	, ae.account_id
+	, ae.event_type
+	, ae.details
+	, ae.ip_address
+	, ae.user_agent
+	, ae.created_at
+FROM audit_events AS ae
+	INNER JOIN users AS u ON u.id = ae.user_id
+WHERE 1=1
+	AND (
+		ae.account_id = $1
+		OR (
+			ae.account_id IS NULL
+			AND EXISTS (
+				SELECT 1
+				FROM account_memberships AS am
+				WHERE 1=1
+					AND am.account_id = $1
+					AND am.user_id = ae.user_id
+					AND am.joined_at <= ae.created_at
+			)
+		)
+	)
+ORDER BY ae.created_at DESC, ae.id DESC
+LIMIT $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, accountID, limit); err != nil {
+		return results, fmt.Errorf("error fetching audit events: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+RecordAuditEvent saves an event, with the IP address and user agent of the
+request that caused it. Events older than auditEventRetention are removed
+at the same time. An event without an AccountID, such as a log in or
+password change, is recorded against the household the user is using, so
+the owners of their other households don't see it.
+*/
+func (s AuditService) RecordAuditEvent(r *http.Request, event models.AuditEvent) error {
+	var (
+		err error
+	)
+
+	now := time.Now().UTC()
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, "DELETE FROM audit_events WHERE created_at < $1", now.Add(-auditEventRetention)); err != nil {
+		return fmt.Errorf("error removing old audit events: %w", err)
+	}
+
+	query := `
+INSERT INTO audit_events (
+	user_id
+	, account_id
+	, event_type
+	, details
+	, ip_address
+	, user_agent
+	, created_at
+) VALUES (
+	$1
+	, COALESCE($2, (SELECT u.account_id FROM users AS u WHERE u.id = $1))
+	, $3
+	, $4
+	, $5
+	, $6
+	, $7
+)
+	`
+
+	args := []any{
+		event.UserID,
+		event.AccountID,
+		event.EventType,
+		event.Details,
+		clientip.FromRequest(r, s.trustProxyHeaders),
+		useragent.Truncate(r.UserAgent(), maxUserAgentLength),
+		now,
+	}
+
+	if _, err = s.DB.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("error recording audit event: %w", err)
+	}
+
+	return nil
+}
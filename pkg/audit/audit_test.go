@@ -0,0 +1,165 @@
+package audit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/audit"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/testdb"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestGetAccountAuditEventsForMemberOfTwoHouseholds(t *testing.T) {
+	db := testdb.New(t)
+	now := time.Now().UTC()
+
+	service := audit.NewAuditService(audit.AuditServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			DB:           db,
+			QueryTimeout: testdb.QueryTimeout,
+		},
+	})
+
+	/*
+	 * Sam has been in the first household for a month, and joined the
+	 * second an hour ago.
+	 */
+	firstOwner := insertUser(t, db, "first@example.com")
+	secondOwner := insertUser(t, db, "second@example.com")
+	sam := insertUser(t, db, "sam@example.com")
+
+	first := insertAccount(t, db, firstOwner, now.AddDate(0, -1, 0))
+	second := insertAccount(t, db, secondOwner, now.AddDate(0, -1, 0))
+
+	joinAccount(t, db, sam, first, now.AddDate(0, 0, -30))
+	joinAccount(t, db, sam, second, now.Add(-time.Hour))
+
+	/*
+	 * Events recorded before account_id was set on every event.
+	 */
+	insertEvent(t, db, sam, nil, models.AuditEventPasswordChanged, "before joining the second", now.AddDate(0, 0, -5))
+	insertEvent(t, db, sam, nil, models.AuditEventLogin, "before joining either", now.AddDate(0, -2, 0))
+
+	/*
+	 * Sam uses the first household, then switches to the second.
+	 */
+	useAccount(t, db, sam, first)
+	recordEvent(t, service, models.AuditEvent{UserID: sam, EventType: models.AuditEventLogin, Details: "using the first"})
+
+	useAccount(t, db, sam, second)
+	recordEvent(t, service, models.AuditEvent{UserID: sam, AccountID: &second, EventType: models.AuditEventHouseholdJoined, Details: "joined the second"})
+	recordEvent(t, service, models.AuditEvent{UserID: sam, EventType: models.AuditEventTwoFactorEnabled, Details: "using the second"})
+
+	tests := []struct {
+		name      string
+		accountID int
+		want      []string
+	}{
+		{
+			name:      "first household",
+			accountID: first,
+			want:      []string{"using the first", "before joining the second"},
+		},
+		{
+			name:      "second household",
+			accountID: second,
+			want:      []string{"using the second", "joined the second"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := service.GetAccountAuditEvents(tt.accountID, 50)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := []string{}
+
+			for _, event := range events {
+				got = append(got, event.Details)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected events %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func insertUser(t *testing.T, db *pgxpool.Pool, email string) int {
+	t.Helper()
+
+	var id int
+
+	query := `
+INSERT INTO users (created_at, active, email, password, auth_token)
+VALUES ($1, true, $2, '', $2)
+RETURNING id
+	`
+
+	if err := db.QueryRow(context.Background(), query, time.Now().UTC(), email).Scan(&id); err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+
+	return id
+}
+
+/*
+insertAccount makes a household owned by ownerID, who joined it when it was
+made and is using it.
+*/
+func insertAccount(t *testing.T, db *pgxpool.Pool, ownerID int, createdAt time.Time) int {
+	t.Helper()
+
+	var id int
+
+	if err := db.QueryRow(context.Background(), "INSERT INTO accounts (owner, join_token) VALUES ($1, $2) RETURNING id", ownerID, "join-"+strconv.Itoa(ownerID)).Scan(&id); err != nil {
+		t.Fatalf("error inserting account: %v", err)
+	}
+
+	joinAccount(t, db, ownerID, id, createdAt)
+	useAccount(t, db, ownerID, id)
+
+	return id
+}
+
+func joinAccount(t *testing.T, db *pgxpool.Pool, userID, accountID int, joinedAt time.Time) {
+	t.Helper()
+
+	if _, err := db.Exec(context.Background(), "INSERT INTO account_memberships (user_id, account_id, joined_at) VALUES ($1, $2, $3)", userID, accountID, joinedAt); err != nil {
+		t.Fatalf("error adding membership: %v", err)
+	}
+}
+
+func useAccount(t *testing.T, db *pgxpool.Pool, userID, accountID int) {
+	t.Helper()
+
+	if _, err := db.Exec(context.Background(), "UPDATE users SET account_id=$1 WHERE id=$2", accountID, userID); err != nil {
+		t.Fatalf("error switching account: %v", err)
+	}
+}
+
+func insertEvent(t *testing.T, db *pgxpool.Pool, userID int, accountID *int, eventType models.AuditEventType, details string, createdAt time.Time) {
+	t.Helper()
+
+	if _, err := db.Exec(context.Background(), "INSERT INTO audit_events (user_id, account_id, event_type, details, created_at) VALUES ($1, $2, $3, $4, $5)", userID, accountID, eventType, details, createdAt); err != nil {
+		t.Fatalf("error inserting audit event: %v", err)
+	}
+}
+
+func recordEvent(t *testing.T, service audit.AuditService, event models.AuditEvent) {
+	t.Helper()
+
+	if err := service.RecordAuditEvent(httptest.NewRequest(http.MethodPost, "/", nil), event); err != nil {
+		t.Fatalf("error recording audit event: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"net/http"
+)
+
+type ClientOption func(co *ClientOptions)
+
+type ClientOptions struct {
+	HttpClient *http.Client
+	UserAgent  string
+}
+
+/*
+WithHttpClient sets the HTTP client used to make requests. Use this to set
+timeouts or a custom transport. The default is http.DefaultClient.
+*/
+func WithHttpClient(httpClient *http.Client) ClientOption {
+	return func(co *ClientOptions) {
+		co.HttpClient = httpClient
+	}
+}
+
+/*
+WithUserAgent sets the User-Agent header sent with every request.
+*/
+func WithUserAgent(userAgent string) ClientOption {
+	return func(co *ClientOptions) {
+		co.UserAgent = userAgent
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Package client is a typed Go client for the Streaming Tracker JSON API. Its
+methods mirror the show, watcher, and platform services, minus the account
+and user arguments. Those come from the personal access token the client is
+created with.
+
+	c := client.New("https://tracker.example.com", "st_...")
+	show, err := c.GetShowByID(ctx, 12)
+
+	if errors.Is(err, client.ErrShowNotFound) {
+		...
+	}
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+)
+
+const (
+	apiBasePath          = "/api/v1"
+	maxResponseBodySize  = 10 << 20
+	maxErrorMessageBytes = 200
+)
+
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	userAgent  string
+}
+
+/*
+New creates a client for the Streaming Tracker server at baseURL, such as
+"https://tracker.example.com". token is a personal access token created on
+the API Tokens page. Read only tokens can call the Get and Search methods but
+nothing that makes changes.
+*/
+func New(baseURL, token string, options ...ClientOption) Client {
+	clientOptions := &ClientOptions{
+		HttpClient: http.DefaultClient,
+		UserAgent:  "streaming-tracker-client",
+	}
+
+	for _, option := range options {
+		option(clientOptions)
+	}
+
+	return Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: clientOptions.HttpClient,
+		userAgent:  clientOptions.UserAgent,
+	}
+}
+
+/*
+do sends a request to the API and decodes the response into result. result
+may be nil when the response body isn't needed. Error responses are returned
+as *APIError.
+*/
+func (c Client) do(ctx context.Context, method, path string, query url.Values, body, result any) error {
+	var (
+		err          error
+		req          *http.Request
+		resp         *http.Response
+		requestBody  io.Reader
+		responseBody []byte
+	)
+
+	u := c.baseURL + apiBasePath + path
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	if body != nil {
+		var b []byte
+
+		if b, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("error encoding request body for %s %s: %w", method, path, err)
+		}
+
+		requestBody = bytes.NewReader(b)
+	}
+
+	if req, err = http.NewRequestWithContext(ctx, method, u, requestBody); err != nil {
+		return fmt.Errorf("error creating request for %s %s: %w", method, path, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if resp, err = c.httpClient.Do(req); err != nil {
+		return fmt.Errorf("error calling %s %s: %w", method, path, err)
+	}
+
+	defer resp.Body.Close()
+
+	if responseBody, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize)); err != nil {
+		return fmt.Errorf("error reading response from %s %s: %w", method, path, err)
+	}
+
+	if resp.StatusCode > 299 {
+		return newAPIError(resp.StatusCode, responseBody)
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err = json.Unmarshal(responseBody, result); err != nil {
+		return fmt.Errorf("error decoding response from %s %s: %w", method, path, err)
+	}
+
+	return nil
+}
+
+/*
+newAPIError builds an APIError from an error response. Responses that aren't
+in the API's error format, such as those from a proxy, keep the status code
+and a short piece of the body as the message.
+*/
+func newAPIError(statusCode int, body []byte) *APIError {
+	var (
+		errorResponse responsetypes.ErrorResponse
+	)
+
+	if err := json.Unmarshal(body, &errorResponse); err == nil && errorResponse.Error.Code != "" {
+		return &APIError{
+			StatusCode: statusCode,
+			Code:       errorResponse.Error.Code,
+			Message:    errorResponse.Error.Message,
+			Details:    errorResponse.Error.Details,
+		}
+	}
+
+	message := strings.TrimSpace(string(body))
+
+	if len(message) > maxErrorMessageBytes {
+		message = message[:maxErrorMessageBytes]
+	}
+
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Message:    message,
+	}
+}
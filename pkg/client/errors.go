@@ -0,0 +1,73 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+)
+
+/*
+These errors can be checked with errors.Is against any error returned by
+the client. They match the sentinel errors returned by the services on the
+server.
+*/
+var (
+	ErrBadRequest            = errors.New("bad request")
+	ErrValidationFailed      = errors.New("validation failed")
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrForbidden             = errors.New("forbidden")
+	ErrNotFound              = errors.New("not found")
+	ErrShowNotFound          = errors.New("show not found")
+	ErrShowHasWatchedSeasons = errors.New("show has watched seasons and cannot be deleted")
+	ErrOnlineShowNotFound    = errors.New("show not found on TVMaze")
+	ErrWatcherNotFound       = errors.New("watcher not found")
+	ErrInternalError         = errors.New("internal server error")
+
+	errorsByCode = map[string]error{
+		responsetypes.ErrorCodeBadRequest:            ErrBadRequest,
+		responsetypes.ErrorCodeValidationFailed:      ErrValidationFailed,
+		responsetypes.ErrorCodeUnauthorized:          ErrUnauthorized,
+		responsetypes.ErrorCodeInvalidToken:          ErrUnauthorized,
+		responsetypes.ErrorCodeForbidden:             ErrForbidden,
+		responsetypes.ErrorCodeInsufficientScope:     ErrForbidden,
+		responsetypes.ErrorCodeNotFound:              ErrNotFound,
+		responsetypes.ErrorCodeShowNotFound:          ErrShowNotFound,
+		responsetypes.ErrorCodeShowHasWatchedSeasons: ErrShowHasWatchedSeasons,
+		responsetypes.ErrorCodeOnlineShowNotFound:    ErrOnlineShowNotFound,
+		responsetypes.ErrorCodeWatcherNotFound:       ErrWatcherNotFound,
+		responsetypes.ErrorCodeInternalError:         ErrInternalError,
+	}
+)
+
+/*
+APIError is returned when the server responds with an error. Code is one of
+the responsetypes.ErrorCode values, and Details lists each problem when
+validation fails.
+*/
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    []string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("streaming tracker api error (%d): %s", e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("streaming tracker api error (%d %s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+/*
+Is lets errors.Is compare an APIError with the sentinel errors in this
+package, such as ErrShowNotFound.
+*/
+func (e *APIError) Is(target error) bool {
+	if sentinel, ok := errorsByCode[e.Code]; ok {
+		return sentinel == target
+	}
+
+	return false
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+/*
+GetPlatforms returns every streaming platform.
+*/
+func (c Client) GetPlatforms(ctx context.Context) ([]*models.Platform, error) {
+	var (
+		err    error
+		result = []*models.Platform{}
+	)
+
+	if err = c.do(ctx, http.MethodGet, "/platforms", nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
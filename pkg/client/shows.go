@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+type ActiveShows = orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, []models.ShowGroupedByStatusAndWatchers]]
+
+/*
+AddSeason adds a season to a finished show and puts it back in
+"Want To Watch".
+*/
+func (c Client) AddSeason(ctx context.Context, showID int) error {
+	return c.changeShowStatus(ctx, showID, "add-season")
+}
+
+/*
+AddShow adds a new show and returns its ID.
+*/
+func (c Client) AddShow(ctx context.Context, show requesttypes.AddShowRequest) (int, error) {
+	var (
+		err    error
+		result responsetypes.CreatedShow
+	)
+
+	if err = c.do(ctx, http.MethodPost, "/shows", nil, show, &result); err != nil {
+		return 0, err
+	}
+
+	return result.ID, nil
+}
+
+/*
+BackToWantToWatch moves a show from "Watching" back to "Want To Watch".
+*/
+func (c Client) BackToWantToWatch(ctx context.Context, showID int) error {
+	return c.changeShowStatus(ctx, showID, "back-to-want-to-watch")
+}
+
+/*
+CancelShow marks a show as cancelled.
+*/
+func (c Client) CancelShow(ctx context.Context, showID int) error {
+	return c.changeShowStatus(ctx, showID, "cancel")
+}
+
+/*
+DeleteShow deletes a show. Shows with watched seasons can't be deleted and
+return ErrShowHasWatchedSeasons.
+*/
+func (c Client) DeleteShow(ctx context.Context, showID int) error {
+	return c.do(ctx, http.MethodDelete, showPath(showID), nil, nil, nil)
+}
+
+/*
+FindShowImageByName returns the URL of a poster image for a show on TVMaze.
+*/
+func (c Client) FindShowImageByName(ctx context.Context, name string) (string, error) {
+	var (
+		err    error
+		result responsetypes.ShowImage
+	)
+
+	query := url.Values{}
+	query.Set("name", name)
+
+	if err = c.do(ctx, http.MethodGet, "/online/shows/image", query, nil, &result); err != nil {
+		return "", err
+	}
+
+	return result.ImageURL, nil
+}
+
+/*
+FinishSeason finishes the current season of a show. Finishing the last
+season moves the show to "Finished Watching".
+*/
+func (c Client) FinishSeason(ctx context.Context, showID int) error {
+	return c.changeShowStatus(ctx, showID, "finish-season")
+}
+
+/*
+GetActiveShowsGroupedByStatusAndWatchers returns shows that are not finished,
+grouped by watch status, then by watchers.
+*/
+func (c Client) GetActiveShowsGroupedByStatusAndWatchers(ctx context.Context) (*ActiveShows, error) {
+	return c.getActiveShows(ctx, "status")
+}
+
+/*
+GetActiveShowsGroupedByWatchersAndStatus returns shows that are not
+finished, grouped by watchers, then by watch status.
+*/
+func (c Client) GetActiveShowsGroupedByWatchersAndStatus(ctx context.Context) (*ActiveShows, error) {
+	return c.getActiveShows(ctx, "watchers")
+}
+
+/*
+GetFinishedShows returns shows that have been watched to the end.
+*/
+func (c Client) GetFinishedShows(ctx context.Context) ([]responsetypes.Show, error) {
+	var (
+		err    error
+		result = []responsetypes.Show{}
+	)
+
+	if err = c.do(ctx, http.MethodGet, "/shows/finished", nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+GetShowByID returns a single show.
+*/
+func (c Client) GetShowByID(ctx context.Context, showID int) (*models.ShowForEdit, error) {
+	var (
+		err    error
+		result = &models.ShowForEdit{}
+	)
+
+	if err = c.do(ctx, http.MethodGet, showPath(showID), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+MatchOnlineShow finds the best match for a show on TVMaze. imdbID and tvdbID
+are tried before the title when given. Returns ErrOnlineShowNotFound when
+nothing matches.
+*/
+func (c Client) MatchOnlineShow(ctx context.Context, title string, year int, imdbID string, tvdbID int) (*models.OnlineShowMatch, error) {
+	var (
+		err    error
+		result = &models.OnlineShowMatch{}
+	)
+
+	query := url.Values{}
+	setString(query, "title", title)
+	setInt(query, "year", year)
+	setString(query, "imdbID", imdbID)
+	setInt(query, "tvdbID", tvdbID)
+
+	if err = c.do(ctx, http.MethodGet, "/online/shows/match", query, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+OnlineSearch searches TVMaze for shows by name.
+*/
+func (c Client) OnlineSearch(ctx context.Context, searchTerm string) ([]models.OnlineShowSearchResult, error) {
+	var (
+		err    error
+		result = []models.OnlineShowSearchResult{}
+	)
+
+	query := url.Values{}
+	query.Set("name", searchTerm)
+
+	if err = c.do(ctx, http.MethodGet, "/online/shows", query, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+SearchShows returns one page of shows and the total number of shows that
+match.
+*/
+func (c Client) SearchShows(ctx context.Context, options ...SearchShowsOption) ([]responsetypes.Show, int, error) {
+	var (
+		err    error
+		result responsetypes.PagedShows
+	)
+
+	searchOptions := &SearchShowsOptions{
+		Page: 1,
+	}
+
+	for _, option := range options {
+		option(searchOptions)
+	}
+
+	query := url.Values{}
+	setInt(query, "page", searchOptions.Page)
+	setString(query, "showName", searchOptions.ShowName)
+	setInt(query, "platform", searchOptions.Platform)
+	setInt(query, "watcher", searchOptions.Watcher)
+	setString(query, "sortBy", searchOptions.SortBy)
+	setString(query, "sortDirection", searchOptions.SortDirection)
+
+	if err = c.do(ctx, http.MethodGet, "/shows", query, nil, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result.Shows, result.TotalCount, nil
+}
+
+/*
+StartWatching moves a show from "Want To Watch" to "Watching".
+*/
+func (c Client) StartWatching(ctx context.Context, showID int) error {
+	return c.changeShowStatus(ctx, showID, "start-watching")
+}
+
+/*
+UpdateShow updates a show's details. show.ID picks the show to update.
+*/
+func (c Client) UpdateShow(ctx context.Context, show requesttypes.EditShowRequest) error {
+	return c.do(ctx, http.MethodPut, showPath(show.ID), nil, show, nil)
+}
+
+/*
+UpdateShowProgress sets a show's watch status and current season.
+progress.ShowID picks the show to update.
+*/
+func (c Client) UpdateShowProgress(ctx context.Context, progress requesttypes.UpdateShowProgressRequest) error {
+	return c.do(ctx, http.MethodPut, showPath(progress.ShowID)+"/progress", nil, progress, nil)
+}
+
+func (c Client) changeShowStatus(ctx context.Context, showID int, action string) error {
+	return c.do(ctx, http.MethodPost, showPath(showID)+"/"+action, nil, nil, nil)
+}
+
+func (c Client) getActiveShows(ctx context.Context, groupBy string) (*ActiveShows, error) {
+	var (
+		err    error
+		result = orderedmap.New[string, *orderedmap.OrderedMap[string, []models.ShowGroupedByStatusAndWatchers]]()
+	)
+
+	query := url.Values{}
+	query.Set("groupBy", groupBy)
+
+	if err = c.do(ctx, http.MethodGet, "/shows/active", query, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func showPath(showID int) string {
+	return fmt.Sprintf("/shows/%d", showID)
+}
+
+func setString(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func setInt(query url.Values, key string, value int) {
+	if value != 0 {
+		query.Set(key, strconv.Itoa(value))
+	}
+}
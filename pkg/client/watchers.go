@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
+	"github.com/adampresley/streaming-tracker/pkg/responsetypes"
+)
+
+/*
+CreateWatcherManual adds a watcher that isn't tied to a user.
+*/
+func (c Client) CreateWatcherManual(ctx context.Context, name string) (*responsetypes.Watcher, error) {
+	var (
+		err    error
+		result = &responsetypes.Watcher{}
+	)
+
+	if err = c.do(ctx, http.MethodPost, "/watchers", nil, requesttypes.WatcherNameRequest{Name: name}, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+GetWatchersWithUserInfo returns the account's watchers, including the email
+of the user each one belongs to, if any.
+*/
+func (c Client) GetWatchersWithUserInfo(ctx context.Context) ([]responsetypes.Watcher, error) {
+	var (
+		err    error
+		result = []responsetypes.Watcher{}
+	)
+
+	if err = c.do(ctx, http.MethodGet, "/watchers", nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+UpdateWatcherName renames a watcher. Renaming a watcher you aren't allowed
+to edit returns ErrForbidden.
+*/
+func (c Client) UpdateWatcherName(ctx context.Context, watcherID int, name string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/watchers/%d", watcherID), nil, requesttypes.WatcherNameRequest{Name: name}, nil)
+}
@@ -0,0 +1,36 @@
+/*
+Package clientip works out the IP address a request came from.
+*/
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+/*
+FromRequest returns the IP address of the client that made a request. When
+trustProxyHeaders is true, the last address in X-Forwarded-For is used,
+which is the one the reverse proxy in front of the app saw. Earlier
+addresses are set by the client and can't be trusted.
+*/
+func FromRequest(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+
+			if ip := net.ParseIP(strings.TrimSpace(addresses[len(addresses)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,164 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/mux2"
+	"github.com/adampresley/configinator"
+)
+
+const (
+	/*
+	   DefaultSessionSecret is SessionSecret's default. It is the same in
+	   every copy of the app, so it is only allowed in development.
+	*/
+	DefaultSessionSecret = "streaming-tracker-session"
+
+	/*
+	   MinSessionSecretLength is the shortest session secret allowed
+	   outside development, in bytes.
+	*/
+	MinSessionSecretLength = 32
+
+	RegistrationModeOpen       = "open"
+	RegistrationModeInviteOnly = "invite-only"
+	RegistrationModeClosed     = "closed"
+)
+
+type Config struct {
+	mux2.Config
+
+	DataMigrationDir       string        `flag:"migrationdir" env:"DATA_MIGRATION_DIR" default:"" description:"Directory to read SQL migration scripts from instead of the copy built into the application. Leave empty to use the built-in copy"`
+	DSN                    string        `flag:"dsn" env:"DSN" default:"host=localhost dbname=streamingtracker user=streamingtracker password=password port=5432 sslmode=disable" description:"Database connection"`
+	EmailApiKey            string        `flag:"emailapikey" env:"EMAIL_API_KEY" default:"" description:"The API key for sending emails"`
+	EmailDomain            string        `flag:"emaildomain" env:"EMAIL_DOMAIN" default:"" description:"The domain for sending emails"`
+	EmailFrom              string        `flag:"emailfrom" env:"EMAIL_FROM" default:"noreply@example.com" description:"The email address to use for sending emails"`
+	EmailHost              string        `flag:"emailhost" env:"EMAIL_HOST" default:"localhost" description:"The SMTP host for sending emails"`
+	EmailPort              int           `flag:"emailport" env:"EMAIL_PORT" default:"2500" description:"The SMTP port for sending emails"`
+	LogLevel               string        `flag:"loglevel" env:"LOG_LEVEL" default:"debug" description:"The log level to use. Valid values are 'debug', 'info', 'warn', and 'error'"`
+	OIDCClientID           string        `flag:"oidcclientid" env:"OIDC_CLIENT_ID" default:"" description:"The client ID registered with the OpenID Connect provider"`
+	OIDCClientSecret       string        `flag:"oidcclientsecret" env:"OIDC_CLIENT_SECRET" default:"" description:"The client secret registered with the OpenID Connect provider. Leave empty for a public client"`
+	OIDCIssuer             string        `flag:"oidcissuer" env:"OIDC_ISSUER" default:"" description:"The issuer URL of an OpenID Connect provider to sign in with. Leave empty to turn it off"`
+	OIDCProviderName       string        `flag:"oidcprovidername" env:"OIDC_PROVIDER_NAME" default:"Single Sign-On" description:"The name of the OpenID Connect provider shown on the sign in button"`
+	OIDCScopes             string        `flag:"oidcscopes" env:"OIDC_SCOPES" default:"openid email profile" description:"Space separated scopes to request from the OpenID Connect provider"`
+	PageSize               int           `flag:"pagesize" env:"PAGE_SIZE" default:"20" description:"The number of items to display per page"`
+	QueryTimeout           time.Duration `flag:"querytimeout" env:"QUERY_TIMEOUT" default:"10s" description:"The maximum time to wait for a query to complete"`
+	RegistrationMode       string        `flag:"registrationmode" env:"REGISTRATION_MODE" default:"invite-only" description:"Who can sign up. Valid values are 'open', 'invite-only', and 'closed'"`
+	SessionEncryptionKey   string        `flag:"sessionencryptionkey" env:"SESSION_ENCRYPTION_KEY" default:"" description:"Encrypts the session cookie when set. Must be 16, 24, or 32 bytes long"`
+	SessionPreviousSecrets string        `flag:"sessionprevioussecrets" env:"SESSION_PREVIOUS_SECRETS" default:"" description:"Comma separated secrets, each optionally followed by :encryptionkey, that session cookies made before a key change were signed with. They are still accepted, but new cookies use the current secret"`
+	SessionSecret          string        `flag:"sessionsecret" env:"SESSION_SECRET" default:"streaming-tracker-session" description:"The secret session cookies are signed with. Use at least 32 random characters. The default, and shorter secrets, are refused outside development"`
+	TLD                    string        `flag:"tld" env:"TLD" default:"http://localhost:8080" description:"The top-level domain for email addresses"`
+	TrustProxyHeaders      bool          `flag:"trustproxyheaders" env:"TRUST_PROXY_HEADERS" default:"false" description:"Take the client's IP address from the X-Forwarded-For header. Only turn this on behind a reverse proxy that sets it"`
+	TvmazeBaseURL          string        `flag:"tvmazebaseurl" env:"TVMAZE_BASE_URL" default:"https://api.tvmaze.com" description:"The base URL for the tvmaze api"`
+	UtellyApiKey           string        `flag:"utellyapikey" env:"UTELLY_API_KEY" default:"" description:"The API key for Utelly"`
+	UtellyBaseURL          string        `flag:"utellybaseurl" env:"UTELLY_BASE_URL" default:"https://utelly-tv-shows-and-movies-availability-v1.p.rapidapi.com" description:"The base URL for Utelly"`
+	UtellyRapidApiHost     string        `flag:"utellyrapidapihost" env:"UTELLY_RAPIDAPI_HOST" default:"utelly-tv-shows-and-movies-availability-v1.p.rapidapi.com" description:""`
+}
+
+func LoadConfig() Config {
+	config := Config{}
+	configinator.Behold(&config)
+	return config
+}
+
+/*
+IsValidRegistrationMode returns true when RegistrationMode is one of the
+RegistrationMode constants.
+*/
+func (c Config) IsValidRegistrationMode() bool {
+	switch c.RegistrationMode {
+	case RegistrationModeOpen, RegistrationModeInviteOnly, RegistrationModeClosed:
+		return true
+	}
+
+	return false
+}
+
+/*
+OIDCEnabled returns true when an OpenID Connect provider is configured.
+*/
+func (c Config) OIDCEnabled() bool {
+	return c.OIDCIssuer != "" && c.OIDCClientID != ""
+}
+
+/*
+SessionKeyPairs returns the keys for signing and encrypting session
+cookies, in the form securecookie.CodecsFromPairs takes. The current secret
+comes first, and is used for new cookies. The previous secrets follow, so
+cookies they signed keep working until they expire.
+*/
+func (c Config) SessionKeyPairs() ([][]byte, error) {
+	var (
+		err   error
+		pairs [][]byte
+	)
+
+	if pairs, err = appendSessionKeyPair(pairs, c.SessionSecret, c.SessionEncryptionKey); err != nil {
+		return nil, err
+	}
+
+	for _, previous := range strings.Split(c.SessionPreviousSecrets, ",") {
+		if previous = strings.TrimSpace(previous); previous == "" {
+			continue
+		}
+
+		secret, encryptionKey, _ := strings.Cut(previous, ":")
+
+		if pairs, err = appendSessionKeyPair(pairs, secret, encryptionKey); err != nil {
+			return nil, fmt.Errorf("invalid previous session secret: %w", err)
+		}
+	}
+
+	return pairs, nil
+}
+
+/*
+CheckSessionSecrets makes sure the current and previous session secrets
+are long enough that cookies signed with them can't be forged. The default
+secret is refused too, since every copy of the app has it.
+*/
+func (c Config) CheckSessionSecrets() error {
+	var (
+		err   error
+		pairs [][]byte
+	)
+
+	if c.SessionSecret == DefaultSessionSecret {
+		return fmt.Errorf("SESSION_SECRET is set to the default. Set it to at least %d random characters", MinSessionSecretLength)
+	}
+
+	if pairs, err = c.SessionKeyPairs(); err != nil {
+		return err
+	}
+
+	for index := 0; index < len(pairs); index += 2 {
+		if len(pairs[index]) >= MinSessionSecretLength {
+			continue
+		}
+
+		if index == 0 {
+			return fmt.Errorf("SESSION_SECRET is too short. Set it to at least %d random characters", MinSessionSecretLength)
+		}
+
+		return fmt.Errorf("secret %d in SESSION_PREVIOUS_SECRETS is too short. Each must be at least %d characters", index/2, MinSessionSecretLength)
+	}
+
+	return nil
+}
+
+func appendSessionKeyPair(pairs [][]byte, secret, encryptionKey string) ([][]byte, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("session secret can't be empty")
+	}
+
+	switch len(encryptionKey) {
+	case 0:
+		return append(pairs, []byte(secret), nil), nil
+	case 16, 24, 32:
+		return append(pairs, []byte(secret), []byte(encryptionKey)), nil
+	}
+
+	return nil, fmt.Errorf("session encryption key must be 16, 24, or 32 bytes long, not %d", len(encryptionKey))
+}
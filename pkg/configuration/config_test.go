@@ -0,0 +1,91 @@
+package configuration_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adampresley/streaming-tracker/pkg/configuration"
+)
+
+func TestCheckSessionSecrets(t *testing.T) {
+	long := strings.Repeat("a", configuration.MinSessionSecretLength)
+	otherLong := strings.Repeat("b", configuration.MinSessionSecretLength)
+
+	tests := []struct {
+		name            string
+		secret          string
+		previousSecrets string
+		wantError       string
+	}{
+		{
+			name:   "long secret",
+			secret: long,
+		},
+		{
+			name:            "long secret and previous secrets",
+			secret:          long,
+			previousSecrets: otherLong + ", " + otherLong + ":0123456789abcdef",
+		},
+		{
+			name:      "default secret",
+			secret:    configuration.DefaultSessionSecret,
+			wantError: "set to the default",
+		},
+		{
+			name:      "empty secret",
+			secret:    "",
+			wantError: "can't be empty",
+		},
+		{
+			name:      "short secret",
+			secret:    "sessionsecret",
+			wantError: "SESSION_SECRET is too short",
+		},
+		{
+			name:      "one byte too short",
+			secret:    long[1:],
+			wantError: "SESSION_SECRET is too short",
+		},
+		{
+			name:            "short previous secret",
+			secret:          long,
+			previousSecrets: otherLong + ",short",
+			wantError:       "secret 2 in SESSION_PREVIOUS_SECRETS is too short",
+		},
+		{
+			name:            "short previous secret with an encryption key",
+			secret:          long,
+			previousSecrets: "short:0123456789abcdef",
+			wantError:       "secret 1 in SESSION_PREVIOUS_SECRETS is too short",
+		},
+		{
+			name:            "bad previous encryption key",
+			secret:          long,
+			previousSecrets: otherLong + ":short",
+			wantError:       "invalid previous session secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configuration.Config{
+				SessionSecret:          tt.secret,
+				SessionPreviousSecrets: tt.previousSecrets,
+			}
+
+			err := config.CheckSessionSecrets()
+
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package configuration
+
+import (
+	"time"
+
+	"github.com/adampresley/adamgokit/email"
+)
+
+/*
+NewMailService returns a Mailgun mail service when an API key and domain
+are configured, otherwise an SMTP mail service.
+*/
+func NewMailService(config *Config) email.MailServicer {
+	mailTimeout := time.Second * 20
+
+	if config.EmailApiKey != "" && config.EmailDomain != "" {
+		return email.NewMailgunService(&email.Config{
+			ApiKey:  config.EmailApiKey,
+			Domain:  config.EmailDomain,
+			Timeout: mailTimeout,
+		})
+	}
+
+	return email.NewSmtpMailService(&email.Config{
+		Host:    config.EmailHost,
+		Port:    config.EmailPort,
+		Timeout: mailTimeout,
+	})
+}
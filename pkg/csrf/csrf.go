@@ -0,0 +1,316 @@
+/*
+Package csrf protects state-changing requests from being forged by other
+sites. It uses signed double-submit cookies: every browser gets a random
+token in a cookie, and unsafe requests must send the same token back in a
+header or form field. Other sites can make a browser send the cookie, but
+they can't read it to copy it into the request. The cookie is HttpOnly, so
+the page's JavaScript gets the token from TokenHandler instead, which other
+sites can't read either.
+
+Over HTTPS the cookie has the __Host- prefix. Browsers only accept that
+cookie from this host, so a sibling subdomain can't set its own token in
+the cookie and then send it with a forged request.
+*/
+package csrf
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+const (
+	/*
+	   CookieName holds the token when the site is served over HTTP, such
+	   as in development. SecureCookieName holds it over HTTPS.
+	*/
+	CookieName       = "csrf-token"
+	SecureCookieName = "__Host-csrf-token"
+
+	/*
+	   FieldName is the form field the token is sent in by regular form
+	   posts. In multipart forms it must be the first field, so it can be
+	   checked without reading the upload before the handler sets its own
+	   size limit.
+	*/
+	FieldName = "csrf_token"
+
+	/*
+	   HeaderName is the header the token is sent in by HTMX and fetch
+	   requests.
+	*/
+	HeaderName = "X-CSRF-Token"
+
+	tokenNumBytes = 32
+
+	/*
+	   maxMultipartPeekBytes is how much of a multipart body is read looking
+	   for the token in the first field. The rest is left for the handler.
+	*/
+	maxMultipartPeekBytes = 64 << 10
+	maxTokenBytes         = 256
+
+	/*
+	   secretLabel is mixed into the secrets the tokens are signed with, so
+	   they are never signed with the same key as something else, such as
+	   the session cookie.
+	*/
+	secretLabel = "streaming-tracker csrf token"
+)
+
+type contextKey struct{}
+
+var (
+	ErrCrossSiteRequest = errors.New("request was sent from another site")
+	ErrInvalidToken     = errors.New("csrf token is missing or invalid")
+)
+
+type Config struct {
+	/*
+	   ErrorFunc responds to requests that fail the check.
+	*/
+	ErrorFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+	/*
+	   Exempt, when set, skips the check for requests it returns true for,
+	   such as API requests authenticated with a header instead of a
+	   cookie.
+	*/
+	Exempt func(r *http.Request) bool
+
+	/*
+	   Secrets sign the tokens. The first one signs new tokens, and the rest
+	   are still accepted so rotating secrets doesn't break open pages. Use
+	   DeriveSecret to make them from another secret.
+	*/
+	Secrets [][]byte
+
+	/*
+	   Secure is true when the site is served over HTTPS. The cookie is
+	   then only sent over HTTPS, and named SecureCookieName.
+	*/
+	Secure bool
+}
+
+/*
+DeriveSecret returns a secret for signing tokens made from another one,
+such as the session secret. The result can't be used to sign anything the
+original secret signs.
+*/
+func DeriveSecret(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(secretLabel))
+	return mac.Sum(nil)
+}
+
+/*
+Middleware makes sure every browser has a token cookie, and rejects POST,
+PUT, PATCH, and DELETE requests that don't send the token back. The token
+is put in the request context for TokenHandler.
+*/
+func Middleware(config Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				err    error
+				cookie *http.Cookie
+				token  string
+			)
+
+			cookieName := CookieName
+
+			if config.Secure {
+				cookieName = SecureCookieName
+			}
+
+			if cookie, err = r.Cookie(cookieName); err == nil && validToken(cookie.Value, config.Secrets) {
+				token = cookie.Value
+			}
+
+			if token == "" {
+				if token, err = newToken(config.Secrets[0]); err != nil {
+					config.ErrorFunc(w, r, err)
+					return
+				}
+
+				http.SetCookie(w, &http.Cookie{
+					Name:     cookieName,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   config.Secure,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, token))
+
+			if isSafeMethod(r.Method) || (config.Exempt != nil && config.Exempt(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			/*
+			 * Browsers say when a request came from another site. Older ones
+			 * don't, and are covered by the token alone.
+			 */
+			if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+				config.ErrorFunc(w, r, ErrCrossSiteRequest)
+				return
+			}
+
+			sent := requestToken(r)
+
+			if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				config.ErrorFunc(w, r, ErrInvalidToken)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+Token returns the token for a request that has been through Middleware.
+*/
+func Token(r *http.Request) string {
+	token, _ := r.Context().Value(contextKey{}).(string)
+	return token
+}
+
+/*
+TokenHandler responds with the request's token as JSON, for the page's
+JavaScript to send back. Browsers don't let other sites read the response.
+*/
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"token": Token(r)})
+}
+
+/*
+requestToken returns the token sent with a request, from the header or the
+form.
+*/
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get(HeaderName); token != "" {
+		return token
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return ""
+		}
+
+		return r.PostForm.Get(FieldName)
+
+	case "multipart/form-data":
+		return multipartToken(r, params["boundary"])
+	}
+
+	return ""
+}
+
+/*
+multipartToken returns the token when it is the first field of a multipart
+form. What is read to find it is put back in front of the body, so the
+handler still reads the whole form, with its own size limit.
+*/
+func multipartToken(r *http.Request, boundary string) string {
+	var (
+		err      error
+		part     *multipart.Part
+		token    []byte
+		buffered bytes.Buffer
+	)
+
+	if boundary == "" {
+		return ""
+	}
+
+	body := r.Body
+	reader := multipart.NewReader(io.TeeReader(io.LimitReader(body, maxMultipartPeekBytes), &buffered), boundary)
+
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&buffered, body), body}
+	}()
+
+	if part, err = reader.NextPart(); err != nil || part.FormName() != FieldName {
+		return ""
+	}
+
+	if token, err = io.ReadAll(io.LimitReader(part, maxTokenBytes)); err != nil {
+		return ""
+	}
+
+	return string(token)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
+
+/*
+newToken returns a random value and its signature. The signature only
+proves the server made the token. It isn't tied to a session, so it
+doesn't stop a token the server handed out from being planted in another
+browser. The __Host- cookie prefix does that.
+*/
+func newToken(secret []byte) (string, error) {
+	b := make([]byte, tokenNumBytes)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating csrf token: %w", err)
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(b)
+	return value + "." + sign(value, secret), nil
+}
+
+func validToken(token string, secrets [][]byte) bool {
+	value, signature, ok := strings.Cut(token, ".")
+
+	if !ok || value == "" {
+		return false
+	}
+
+	for _, secret := range secrets {
+		if hmac.Equal([]byte(signature), []byte(sign(value, secret))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sign(value string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
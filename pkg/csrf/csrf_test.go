@@ -0,0 +1,380 @@
+package csrf_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/streaming-tracker/pkg/csrf"
+)
+
+var (
+	testSecret = csrf.DeriveSecret([]byte("a session secret that is long enough"))
+)
+
+func TestTokenHandler(t *testing.T) {
+	server := newServer([][]byte{testSecret})
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/csrf-token", nil))
+
+	cookie := findCookie(w, csrf.CookieName)
+
+	if cookie == nil {
+		t.Fatalf("expected a %s cookie", csrf.CookieName)
+	}
+
+	if !cookie.HttpOnly {
+		t.Errorf("expected the cookie to be HttpOnly")
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding token: %v", err)
+	}
+
+	if result.Token != cookie.Value {
+		t.Errorf("expected the token %q from the cookie, got %q", cookie.Value, result.Token)
+	}
+
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected the token not to be cached, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	/*
+	 * A browser that already has a token keeps it.
+	 */
+	r := httptest.NewRequest(http.MethodGet, "/csrf-token", nil)
+	r.AddCookie(cookie)
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if findCookie(w, csrf.CookieName) != nil || !strings.Contains(w.Body.String(), cookie.Value) {
+		t.Errorf("expected the same token without a new cookie, got %s", w.Body.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	token := newToken(t, testSecret)
+	oldToken := newToken(t, csrf.DeriveSecret([]byte("the previous session secret")))
+	forgedToken := newToken(t, csrf.DeriveSecret([]byte("someone else's secret")))
+
+	/*
+	 * A token signed with the session secret itself, rather than the key
+	 * derived from it, isn't accepted.
+	 */
+	sessionKeyToken := newToken(t, []byte("a session secret that is long enough"))
+
+	tests := []struct {
+		name      string
+		request   func() *http.Request
+		wantError error
+	}{
+		{
+			name: "safe request without a token",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/change", nil)
+			},
+		},
+		{
+			name: "token in the header",
+			request: func() *http.Request {
+				r := post(token, "")
+				r.Header.Set(csrf.HeaderName, token)
+				return r
+			},
+		},
+		{
+			name: "token in a form",
+			request: func() *http.Request {
+				return post(token, url.Values{csrf.FieldName: {token}}.Encode())
+			},
+		},
+		{
+			name: "token first in a multipart form",
+			request: func() *http.Request {
+				return multipartPost(token, csrf.FieldName, token)
+			},
+		},
+		{
+			name: "token after another field in a multipart form",
+			request: func() *http.Request {
+				return multipartPost(token, "name", "value", csrf.FieldName, token)
+			},
+			wantError: csrf.ErrInvalidToken,
+		},
+		{
+			name: "token in the query string of a multipart form",
+			request: func() *http.Request {
+				r := multipartPost(token, "name", "value")
+				r.URL.RawQuery = url.Values{csrf.FieldName: {token}}.Encode()
+				return r
+			},
+			wantError: csrf.ErrInvalidToken,
+		},
+		{
+			name: "token signed with a previous secret",
+			request: func() *http.Request {
+				r := post(oldToken, "")
+				r.Header.Set(csrf.HeaderName, oldToken)
+				return r
+			},
+		},
+		{
+			name: "no token",
+			request: func() *http.Request {
+				return post(token, "")
+			},
+			wantError: csrf.ErrInvalidToken,
+		},
+		{
+			name: "token that doesn't match the cookie",
+			request: func() *http.Request {
+				r := post(token, "")
+				r.Header.Set(csrf.HeaderName, oldToken)
+				return r
+			},
+			wantError: csrf.ErrInvalidToken,
+		},
+		{
+			name: "token in the query string of a regular form",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/change?"+url.Values{csrf.FieldName: {token}}.Encode(), strings.NewReader(""))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				r.AddCookie(&http.Cookie{Name: csrf.CookieName, Value: token})
+				return r
+			},
+			wantError: csrf.ErrInvalidToken,
+		},
+		{
+			name: "cookie and token made up by another site",
+			request: func() *http.Request {
+				r := post(forgedToken, "")
+				r.Header.Set(csrf.HeaderName, forgedToken)
+				return r
+			},
+			wantError: csrf.ErrInvalidToken,
+		},
+		{
+			name: "cookie and token signed with the session key",
+			request: func() *http.Request {
+				r := post(sessionKeyToken, "")
+				r.Header.Set(csrf.HeaderName, sessionKeyToken)
+				return r
+			},
+			wantError: csrf.ErrInvalidToken,
+		},
+		{
+			name: "cross site request",
+			request: func() *http.Request {
+				r := post(token, "")
+				r.Header.Set(csrf.HeaderName, token)
+				r.Header.Set("Sec-Fetch-Site", "cross-site")
+				return r
+			},
+			wantError: csrf.ErrCrossSiteRequest,
+		},
+		{
+			name: "exempt request",
+			request: func() *http.Request {
+				r := post("", "")
+				r.Header.Set("Authorization", "Bearer st_token")
+				return r
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotError error
+
+			handled := false
+
+			handler := csrf.Middleware(csrf.Config{
+				ErrorFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+					gotError = err
+					w.WriteHeader(http.StatusForbidden)
+				},
+				Exempt: func(r *http.Request) bool {
+					return r.Header.Get("Authorization") != ""
+				},
+				Secrets: [][]byte{testSecret, csrf.DeriveSecret([]byte("the previous session secret"))},
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), tt.request())
+
+			if !errors.Is(gotError, tt.wantError) {
+				t.Fatalf("expected error %v, got %v", tt.wantError, gotError)
+			}
+
+			if handled != (tt.wantError == nil) {
+				t.Errorf("expected the request to be handled to be %v", tt.wantError == nil)
+			}
+		})
+	}
+}
+
+func TestMultipartFormIsLeftForTheHandler(t *testing.T) {
+	token := newToken(t, testSecret)
+	upload := strings.Repeat("a line of an uploaded file\n", 10000)
+
+	var got string
+
+	handler := csrf.Middleware(csrf.Config{
+		ErrorFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			t.Errorf("unexpected error: %v", err)
+		},
+		Secrets: [][]byte{testSecret},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("error parsing form: %v", err)
+		}
+
+		got = r.FormValue("upload")
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), multipartPost(token, csrf.FieldName, token, "upload", upload))
+
+	if got != upload {
+		t.Errorf("expected the handler to read the whole upload, got %d bytes", len(got))
+	}
+}
+
+func TestSecureCookie(t *testing.T) {
+	handler := csrf.Middleware(csrf.Config{
+		ErrorFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		},
+		Secrets: [][]byte{testSecret},
+		Secure:  true,
+	})(http.HandlerFunc(csrf.TokenHandler))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://tracker.example.com/csrf-token", nil))
+
+	cookie := findCookie(w, csrf.SecureCookieName)
+
+	if cookie == nil || !cookie.Secure || cookie.Path != "/" || cookie.Domain != "" {
+		t.Fatalf("expected a host-only secure cookie, got %+v", cookie)
+	}
+
+	/*
+	 * A token planted in the unprefixed cookie, as a sibling subdomain
+	 * could, isn't used.
+	 */
+	planted := newToken(t, testSecret)
+
+	r := httptest.NewRequest(http.MethodPost, "https://tracker.example.com/change", nil)
+	r.AddCookie(&http.Cookie{Name: csrf.CookieName, Value: planted})
+	r.AddCookie(cookie)
+	r.Header.Set(csrf.HeaderName, planted)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected the planted token to be refused, got %d", w.Code)
+	}
+}
+
+func TestDeriveSecret(t *testing.T) {
+	secret := []byte("a session secret that is long enough")
+
+	if bytes.Equal(csrf.DeriveSecret(secret), secret) {
+		t.Errorf("expected the derived secret to differ from the session secret")
+	}
+
+	if !bytes.Equal(csrf.DeriveSecret(secret), csrf.DeriveSecret(secret)) {
+		t.Errorf("expected the same secret to derive the same key")
+	}
+
+	if bytes.Equal(csrf.DeriveSecret(secret), csrf.DeriveSecret([]byte("another session secret"))) {
+		t.Errorf("expected different secrets to derive different keys")
+	}
+}
+
+func newServer(secrets [][]byte) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /csrf-token", csrf.TokenHandler)
+
+	return csrf.Middleware(csrf.Config{
+		ErrorFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		},
+		Secrets: secrets,
+	})(mux)
+}
+
+/*
+newToken gets a token signed with secret the way a browser would, from the
+token endpoint.
+*/
+func newToken(t *testing.T, secret []byte) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	newServer([][]byte{secret}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/csrf-token", nil))
+
+	cookie := findCookie(w, csrf.CookieName)
+
+	if cookie == nil {
+		t.Fatalf("expected a %s cookie", csrf.CookieName)
+	}
+
+	return cookie.Value
+}
+
+func post(cookieToken, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/change", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if cookieToken != "" {
+		r.AddCookie(&http.Cookie{Name: csrf.CookieName, Value: cookieToken})
+	}
+
+	return r
+}
+
+/*
+multipartPost makes a multipart form post with the token cookie and the
+given field names and values, in order.
+*/
+func multipartPost(cookieToken string, fields ...string) *http.Request {
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+
+	for i := 0; i < len(fields); i += 2 {
+		_ = writer.WriteField(fields[i], fields[i+1])
+	}
+
+	_ = writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/change", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.AddCookie(&http.Cookie{Name: csrf.CookieName, Value: cookieToken})
+
+	return r
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
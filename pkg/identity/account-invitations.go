@@ -0,0 +1,385 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	accountInvitationNumBytes = 16
+)
+
+var (
+	ErrAccountInvitationNotFound = errors.New("account invitation not found")
+	ErrInvalidAccountInvitation  = errors.New("invalid or expired account invitation")
+	ErrAccountInvitationEmail    = errors.New("account invitation was sent to a different email address")
+)
+
+type AccountInvitationServicer interface {
+	/*
+	   AcceptAccountInvitation uses up an invitation to make an existing user
+	   a member of the account it is for, with a watcher there, and returns
+	   the account's ID.
+	   Returns ErrInvalidAccountInvitation when it can't be used,
+	   ErrAccountInvitationEmail when it was sent to a different email
+	   address, and ErrAlreadyAccountMember when the user already belongs.
+	*/
+	AcceptAccountInvitation(token string, userID int) (int, error)
+
+	/*
+	   CreateAccountInvitation invites an email address to join an account
+	   and returns the token to send them. Only the account owner can invite
+	   people. Anyone else gets ErrNotAccountOwner.
+	*/
+	CreateAccountInvitation(request models.CreateAccountInvitationRequest) (string, error)
+
+	/*
+	   GetAccountInvitation returns an unused, unrevoked, unexpired invitation
+	   without using it up. Anything else returns ErrInvalidAccountInvitation.
+	*/
+	GetAccountInvitation(token string) (*models.AccountInvitation, error)
+
+	/*
+	   GetPendingAccountInvitations returns the invitations to an account that
+	   can still be used, newest first.
+	*/
+	GetPendingAccountInvitations(accountID int) ([]models.AccountInvitation, error)
+
+	/*
+	   RevokeAccountInvitation stops a pending invitation from working. Only
+	   the account owner can revoke invitations.
+	*/
+	RevokeAccountInvitation(accountID, ownerID, invitationID int) error
+}
+
+type AccountInvitationServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type AccountInvitationService struct {
+	services.DbServiceBase
+}
+
+func NewAccountInvitationService(config AccountInvitationServiceConfig) AccountInvitationService {
+	return AccountInvitationService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+AcceptAccountInvitation uses up an invitation to make an existing user a
+member of the account it is for, and returns the account's ID. Using the
+invitation, the membership, and the user's watcher in the account all
+happen in one transaction. An invitation isn't wasted on someone who
+already belongs, and a member is never left without a watcher.
+*/
+func (s AccountInvitationService) AcceptAccountInvitation(token string, userID int) (int, error) {
+	var (
+		err       error
+		tx        pgx.Tx
+		accountID int
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if accountID, err = consumeAccountInvitation(ctx, tx, token, userID); err != nil {
+		return 0, err
+	}
+
+	if err = addAccountMembership(ctx, tx, userID, accountID); err != nil {
+		return 0, err
+	}
+
+	if err = addMemberWatcher(ctx, tx, userID, accountID); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing account invitation: %w", err)
+	}
+
+	return accountID, nil
+}
+
+/*
+CreateAccountInvitation invites an email address to join an account and
+returns the token to send them. The insert only happens when the person
+inviting owns the account. Only a hash of the token is stored.
+*/
+func (s AccountInvitationService) CreateAccountInvitation(request models.CreateAccountInvitationRequest) (string, error) {
+	var (
+		err    error
+		token  string
+		result pgconn.CommandTag
+	)
+
+	if token, err = newSecureToken(accountInvitationNumBytes); err != nil {
+		return "", err
+	}
+
+	createdAt := time.Now().UTC()
+
+	query := `
+INSERT INTO account_invitations (
+	account_id
+	, email
+	, invited_by
+	, token_hash
+	, created_at
+	, expires_at
+)
+SELECT
+	a.id
+	, $3::text
+	, $2::integer
+	, $4::text
+	, $5::timestamp
+	, $6::timestamp
+FROM accounts AS a
+WHERE 1=1
+	AND a.id = $1
+	AND a.owner = $2
+	`
+
+	args := []any{
+		request.AccountID,
+		request.InvitedBy,
+		strings.TrimSpace(request.Email),
+		hashToken(token),
+		createdAt,
+		createdAt.Add(request.Lifetime),
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, args...); err != nil {
+		return "", fmt.Errorf("error creating account invitation: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return "", ErrNotAccountOwner
+	}
+
+	return token, nil
+}
+
+/*
+GetAccountInvitation returns an unused, unrevoked, unexpired invitation
+without using it up, so sign up can tell an invitation apart from an
+account join token.
+*/
+func (s AccountInvitationService) GetAccountInvitation(token string) (*models.AccountInvitation, error) {
+	var (
+		err     error
+		results []models.AccountInvitation
+	)
+
+	query := `
+SELECT
+	i.id
+	, i.account_id
+	, i.email
+	, i.invited_by
+	, COALESCE(u.email, '') AS invited_by_email
+	, i.created_at
+	, i.expires_at
+	, i.used_at
+	, i.revoked_at
+FROM account_invitations AS i
+	LEFT JOIN users AS u ON u.id = i.invited_by
+WHERE 1=1
+	AND i.token_hash = $1
+	AND i.used_at IS NULL
+	AND i.revoked_at IS NULL
+	AND i.expires_at > $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, hashToken(token), time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("error querying account invitation: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrInvalidAccountInvitation
+	}
+
+	return &results[0], nil
+}
+
+/*
+GetPendingAccountInvitations returns the invitations to an account that can
+still be used, newest first.
+*/
+func (s AccountInvitationService) GetPendingAccountInvitations(accountID int) ([]models.AccountInvitation, error) {
+	var (
+		err     error
+		results = []models.AccountInvitation{}
+	)
+
+	query := `
+SELECT
+	i.id
+	, i.account_id
+	, i.email
+	, i.invited_by
+	, COALESCE(u.email, '') AS invited_by_email
+	, i.created_at
+	, i.expires_at
+	, i.used_at
+	, i.revoked_at
+FROM account_invitations AS i
+	LEFT JOIN users AS u ON u.id = i.invited_by
+WHERE 1=1
+	AND i.account_id = $1
+	AND i.used_at IS NULL
+	AND i.revoked_at IS NULL
+	AND i.expires_at > $2
+ORDER BY i.created_at DESC
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, accountID, time.Now().UTC()); err != nil {
+		return results, fmt.Errorf("error fetching account invitations: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+RevokeAccountInvitation stops a pending invitation from working. Only the
+account owner can revoke invitations. Returns ErrAccountInvitationNotFound
+when there is no pending invitation with that ID in the account.
+*/
+func (s AccountInvitationService) RevokeAccountInvitation(accountID, ownerID, invitationID int) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	query := `
+UPDATE account_invitations AS i SET
+	revoked_at = $1
+FROM accounts AS a
+WHERE 1=1
+	AND a.id = i.account_id
+	AND i.id = $2
+	AND i.account_id = $3
+	AND a.owner = $4
+	AND i.used_at IS NULL
+	AND i.revoked_at IS NULL
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, time.Now().UTC(), invitationID, accountID, ownerID); err != nil {
+		return fmt.Errorf("error revoking account invitation: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrAccountInvitationNotFound
+	}
+
+	return nil
+}
+
+/*
+consumeAccountInvitation marks an invitation as used by a user and returns
+the ID of the account it is for. Only the user with the invited email
+address can use it, so a forwarded or leaked link is no good to anyone
+else. Checking and marking it is one statement, so two people racing with
+the same token can't both join.
+*/
+func consumeAccountInvitation(ctx context.Context, q services.Querier, token string, userID int) (int, error) {
+	var (
+		err       error
+		accountID int
+	)
+
+	now := time.Now().UTC()
+
+	query := `
+UPDATE account_invitations SET
+	used_at = $1
+	, used_by = $2
+WHERE 1=1
+	AND token_hash = $3
+	AND used_at IS NULL
+	AND revoked_at IS NULL
+	AND expires_at > $1
+	AND LOWER(email) = (SELECT LOWER(u.email) FROM users AS u WHERE u.id = $2)
+RETURNING account_id
+	`
+
+	if err = q.QueryRow(ctx, query, now, userID, hashToken(token)).Scan(&accountID); err != nil {
+		if pgxscan.NotFound(err) {
+			return 0, invalidAccountInvitationError(ctx, q, token, now)
+		}
+
+		return 0, fmt.Errorf("error using account invitation: %w", err)
+	}
+
+	return accountID, nil
+}
+
+/*
+invalidAccountInvitationError explains why an invitation couldn't be used.
+It is ErrAccountInvitationEmail when the invitation is otherwise good, so
+the user can be told to use the address it was sent to.
+*/
+func invalidAccountInvitationError(ctx context.Context, q services.Querier, token string, now time.Time) error {
+	var (
+		err     error
+		pending bool
+	)
+
+	query := `
+SELECT EXISTS (
+	SELECT 1
+	FROM account_invitations
+	WHERE 1=1
+		AND token_hash = $1
+		AND used_at IS NULL
+		AND revoked_at IS NULL
+		AND expires_at > $2
+)
+	`
+
+	if err = q.QueryRow(ctx, query, hashToken(token), now).Scan(&pending); err != nil {
+		return fmt.Errorf("error checking account invitation: %w", err)
+	}
+
+	if pending {
+		return ErrAccountInvitationEmail
+	}
+
+	return ErrInvalidAccountInvitation
+}
@@ -2,13 +2,33 @@ package identity
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
-	"github.com/adampresley/adamgokit/random"
 	"github.com/adampresley/streaming-tracker/pkg/models"
 	"github.com/adampresley/streaming-tracker/pkg/services"
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	/*
+	   joinTokenNumBytes is how much randomness goes in an account code.
+	   Account codes never expire, so they are long enough that they can't
+	   be guessed.
+	*/
+	joinTokenNumBytes = 18
+)
+
+var (
+	ErrAccountNotFound       = errors.New("account not found")
+	ErrAccountMemberNotFound = errors.New("account member not found")
+	ErrAlreadyAccountMember  = errors.New("already a member of the account")
+	ErrInvalidAccountRole    = errors.New("that role can't be given to a member")
+	ErrNotAccountOwner       = errors.New("only the account owner can do that")
+	ErrOwnerCannotLeave      = errors.New("the account owner can't leave or be removed")
 )
 
 type AccountServicer interface {
@@ -18,9 +38,88 @@ type AccountServicer interface {
 	CreateAccount(account models.CreateAccountRequest, options ...CreateAccountOption) (*models.Account, error)
 
 	/*
-	   GetAccountByJoinToken retrieves an account by its join token.
+	   GetAccountByID retrieves an account by its ID. Returns
+	   ErrAccountNotFound when there isn't one.
+	*/
+	GetAccountByID(accountID int) (*models.Account, error)
+
+	/*
+	   GetAccountByJoinToken retrieves an account by its join token. Returns
+	   ErrAccountNotFound when no account has it.
 	*/
 	GetAccountByJoinToken(joinToken string) (*models.Account, error)
+
+	/*
+	   GetAccounts returns a summary of every account, ordered by ID.
+	*/
+	GetAccounts() ([]models.AccountSummary, error)
+
+	/*
+	   GetAccountMembers returns the users in an account, owner first.
+	*/
+	GetAccountMembers(accountID int) ([]models.AccountMember, error)
+
+	/*
+	   GetMemberRole returns what a user may do in an account. Returns
+	   ErrAccountMemberNotFound when they don't belong to it.
+	*/
+	GetMemberRole(accountID, userID int) (models.AccountRole, error)
+
+	/*
+	   GetUserAccounts returns the households a user belongs to, oldest
+	   first.
+	*/
+	GetUserAccounts(userID int) ([]models.AccountMembership, error)
+
+	/*
+	   JoinAccountByJoinToken makes a user a member of the account with the
+	   join token, with a watcher there, and returns its ID. Returns
+	   ErrAccountNotFound for an unknown token, and ErrAlreadyAccountMember
+	   when they already belong.
+	*/
+	JoinAccountByJoinToken(joinToken string, userID int) (int, error)
+
+	/*
+	   LeaveAccount takes a member out of an account. Their watcher, and
+	   everything it watched, stays behind. If it was the account they were
+	   using they move to another of their households, or get one of their
+	   own. The owner gets ErrOwnerCannotLeave, and must transfer ownership
+	   first.
+	*/
+	LeaveAccount(accountID, userID int) (*models.DetachedMember, error)
+
+	/*
+	   RegenerateJoinToken gives an account a new join token and returns it.
+	   The old token stops working.
+	*/
+	RegenerateJoinToken(accountID int) (string, error)
+
+	/*
+	   RemoveAccountMember is LeaveAccount done by the owner to someone
+	   else. Anyone other than the owner gets ErrNotAccountOwner.
+	*/
+	RemoveAccountMember(accountID, ownerID, memberID int) (*models.DetachedMember, error)
+
+	/*
+	   SetMemberRole changes what a member may do in an account. Only the
+	   owner can do this, and anyone else gets ErrNotAccountOwner. Returns
+	   ErrInvalidAccountRole for the owner's own role, or a role that can't
+	   be assigned.
+	*/
+	SetMemberRole(accountID, ownerID, memberID int, role models.AccountRole) error
+
+	/*
+	   SwitchAccount makes one of a user's households the one they are using,
+	   and the one they start in when they next log in. Returns
+	   ErrAccountMemberNotFound when they don't belong to it.
+	*/
+	SwitchAccount(userID, accountID int) error
+
+	/*
+	   TransferOwnership makes another member of an account its owner. Only
+	   the current owner can do this.
+	*/
+	TransferOwnership(accountID, ownerID, newOwnerID int) error
 }
 
 type AccountServiceConfig struct {
@@ -49,6 +148,7 @@ func (s AccountService) CreateAccount(account models.CreateAccountRequest, optio
 		accountID int64
 		tx        pgx.Tx
 		query     string
+		joinToken string
 	)
 
 	opts := &CreateAccountOptions{}
@@ -84,7 +184,9 @@ INSERT INTO accounts (
 RETURNING id
 `
 
-	joinToken := random.String(6)
+	if joinToken, err = newJoinToken(); err != nil {
+		return nil, err
+	}
 
 	args := []any{
 		account.UserID,
@@ -111,25 +213,63 @@ RETURNING id
 		if _, err = tx.Exec(ctx, query, args...); err != nil {
 			return nil, fmt.Errorf("error associating account to user: %w", err)
 		}
+
+		if err = addAccountMembership(ctx, tx, opts.AssociateToUser, newAccount.ID.ID); err != nil {
+			return nil, err
+		}
 	}
 
 	return newAccount, tx.Commit(ctx)
 }
 
 /*
-GetAccountByJoinToken retrieves an account by its join token.
+GetAccountByID retrieves an account by its ID. Returns ErrAccountNotFound
+when there isn't one.
+*/
+func (s AccountService) GetAccountByID(accountID int) (*models.Account, error) {
+	var (
+		err     error
+		account = &models.Account{}
+	)
+
+	query := `
+SELECT
+	id
+	, owner
+	, join_token
+FROM accounts
+WHERE id = $1
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, query, accountID).Scan(&account.ID.ID, &account.Owner, &account.JoinToken); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, ErrAccountNotFound
+		}
+
+		return nil, fmt.Errorf("error querying account by ID: %w", err)
+	}
+
+	return account, nil
+}
+
+/*
+GetAccountByJoinToken retrieves an account by its join token. Returns
+ErrAccountNotFound when no account has it.
 */
 func (s AccountService) GetAccountByJoinToken(joinToken string) (*models.Account, error) {
 	var (
 		err     error
-		results []models.Account
+		account = &models.Account{}
 	)
 
 	query := `
-SELECT 
-	id,
-	owner,
-	join_token
+SELECT
+	id
+	, owner
+	, join_token
 FROM accounts
 WHERE join_token = $1
 	`
@@ -137,16 +277,645 @@ WHERE join_token = $1
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	if err = pgxscan.Select(ctx, s.DB, &results, query, joinToken); err != nil {
+	if err = s.DB.QueryRow(ctx, query, joinToken).Scan(&account.ID.ID, &account.Owner, &account.JoinToken); err != nil {
 		if pgxscan.NotFound(err) {
-			return nil, fmt.Errorf("account not found with join token: %s", joinToken)
+			return nil, ErrAccountNotFound
 		}
+
 		return nil, fmt.Errorf("error querying account by join token: %w", err)
 	}
 
-	if len(results) == 0 {
-		return nil, fmt.Errorf("account not found with join token: %s", joinToken)
+	return account, nil
+}
+
+/*
+GetAccounts returns a summary of every account, ordered by ID. Members
+include the owner.
+*/
+func (s AccountService) GetAccounts() ([]models.AccountSummary, error) {
+	var (
+		err     error
+		results = []models.AccountSummary{}
+	)
+
+	query := `
+SELECT
+	a.id
+	, a.owner
+	, COALESCE(o.email, '') AS owner_email
+	, a.join_token
+	, (SELECT COUNT(*) FROM account_memberships AS m WHERE m.account_id = a.id) AS num_members
+	, (SELECT COUNT(*) FROM watchers AS w WHERE w.account_id = a.id) AS num_watchers
+	, (SELECT COUNT(*) FROM shows AS s WHERE s.account_id = a.id) AS num_shows
+FROM accounts AS a
+	LEFT JOIN users AS o ON o.id = a.owner
+ORDER BY a.id
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query); err != nil {
+		return results, fmt.Errorf("error fetching accounts: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+RegenerateJoinToken gives an account a new join token and returns it. The
+old token stops working, so anyone it was shared with will need the new one.
+*/
+func (s AccountService) RegenerateJoinToken(accountID int) (string, error) {
+	var (
+		err       error
+		result    pgconn.CommandTag
+		joinToken string
+	)
+
+	if joinToken, err = newJoinToken(); err != nil {
+		return "", err
+	}
+
+	query := `UPDATE accounts SET join_token=$1 WHERE id=$2`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, joinToken, accountID); err != nil {
+		return "", fmt.Errorf("error regenerating join token: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return "", ErrAccountNotFound
 	}
 
-	return &results[0], nil
+	return joinToken, nil
+}
+
+/*
+GetAccountMembers returns the users in an account, owner first, then by
+email. WatcherName is the name of the member's watcher in the account.
+*/
+func (s AccountService) GetAccountMembers(accountID int) ([]models.AccountMember, error) {
+	var (
+		err     error
+		results = []models.AccountMember{}
+	)
+
+	query := `
+SELECT
+	u.id AS user_id
+	, u.email
+	, u.active
+	, CASE WHEN u.id = a.owner THEN true ELSE false END AS is_owner
+	, CASE WHEN u.id = a.owner THEN 'owner' ELSE m.role END AS role
+	, COALESCE((
+		SELECT w.name FROM watchers AS w
+		WHERE w.account_id = a.id AND w.user_id = u.id
+		ORDER BY w.id
+		LIMIT 1
+	), '') AS watcher_name
+FROM account_memberships AS m
+	INNER JOIN users AS u ON u.id = m.user_id
+	INNER JOIN accounts AS a ON a.id = m.account_id
+WHERE a.id = $1
+ORDER BY is_owner DESC, u.email
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, accountID); err != nil {
+		return results, fmt.Errorf("error fetching account members: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+GetMemberRole returns what a user may do in an account. The owner is always
+models.AccountRoleOwner, whatever their membership says.
+*/
+func (s AccountService) GetMemberRole(accountID, userID int) (models.AccountRole, error) {
+	var (
+		err  error
+		role models.AccountRole
+	)
+
+	query := `
+SELECT
+	CASE WHEN a.owner = m.user_id THEN 'owner' ELSE m.role END AS role
+FROM account_memberships AS m
+	INNER JOIN accounts AS a ON a.id = m.account_id
+WHERE 1=1
+	AND m.account_id = $1
+	AND m.user_id = $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, query, accountID, userID).Scan(&role); err != nil {
+		if pgxscan.NotFound(err) {
+			return "", ErrAccountMemberNotFound
+		}
+
+		return "", fmt.Errorf("error fetching member role: %w", err)
+	}
+
+	return role, nil
+}
+
+/*
+GetUserAccounts returns the households a user belongs to, oldest first.
+*/
+func (s AccountService) GetUserAccounts(userID int) ([]models.AccountMembership, error) {
+	var (
+		err     error
+		results = []models.AccountMembership{}
+	)
+
+	query := `
+SELECT
+	a.id AS account_id
+	, COALESCE(o.email, '') AS owner_email
+	, CASE WHEN a.owner = m.user_id THEN true ELSE false END AS is_owner
+	, (SELECT COUNT(*) FROM account_memberships AS am WHERE am.account_id = a.id) AS num_members
+	, m.joined_at
+FROM account_memberships AS m
+	INNER JOIN accounts AS a ON a.id = m.account_id
+	LEFT JOIN users AS o ON o.id = a.owner
+WHERE m.user_id = $1
+ORDER BY m.joined_at, a.id
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, userID); err != nil {
+		return results, fmt.Errorf("error fetching user accounts: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+JoinAccountByJoinToken makes a user a member of the account with the join
+token, and returns its ID. The membership and the user's watcher in the
+account are added in one transaction, so a member is never left without
+one. The user keeps using the account they are in.
+*/
+func (s AccountService) JoinAccountByJoinToken(joinToken string, userID int) (int, error) {
+	var (
+		err       error
+		tx        pgx.Tx
+		accountID int
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if err = tx.QueryRow(ctx, "SELECT id FROM accounts WHERE join_token=$1", joinToken).Scan(&accountID); err != nil {
+		if pgxscan.NotFound(err) {
+			err = ErrAccountNotFound
+			return 0, err
+		}
+
+		return 0, fmt.Errorf("error querying account by join token: %w", err)
+	}
+
+	if err = addAccountMembership(ctx, tx, userID, accountID); err != nil {
+		return 0, err
+	}
+
+	if err = addMemberWatcher(ctx, tx, userID, accountID); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing joining account: %w", err)
+	}
+
+	return accountID, nil
+}
+
+/*
+LeaveAccount takes a member out of an account. Their watcher, and everything
+it watched, stays behind. If it was the account they were using they move
+to another of their households, or get one of their own. The owner gets
+ErrOwnerCannotLeave, and must transfer ownership first.
+*/
+func (s AccountService) LeaveAccount(accountID, userID int) (*models.DetachedMember, error) {
+	var (
+		err      error
+		tx       pgx.Tx
+		ownerID  int
+		detached *models.DetachedMember
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if ownerID, err = lockAccount(ctx, tx, accountID); err != nil {
+		return nil, err
+	}
+
+	if ownerID == userID {
+		err = ErrOwnerCannotLeave
+		return nil, err
+	}
+
+	if detached, err = detachMember(ctx, tx, accountID, userID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing leaving account: %w", err)
+	}
+
+	return detached, nil
+}
+
+/*
+RemoveAccountMember is LeaveAccount done by the owner to someone else.
+Anyone other than the owner gets ErrNotAccountOwner, and the owner can't
+remove themselves.
+*/
+func (s AccountService) RemoveAccountMember(accountID, ownerID, memberID int) (*models.DetachedMember, error) {
+	var (
+		err         error
+		tx          pgx.Tx
+		actualOwner int
+		detached    *models.DetachedMember
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if actualOwner, err = lockAccount(ctx, tx, accountID); err != nil {
+		return nil, err
+	}
+
+	if actualOwner != ownerID {
+		err = ErrNotAccountOwner
+		return nil, err
+	}
+
+	if memberID == ownerID {
+		err = ErrOwnerCannotLeave
+		return nil, err
+	}
+
+	if detached, err = detachMember(ctx, tx, accountID, memberID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing member removal: %w", err)
+	}
+
+	return detached, nil
+}
+
+/*
+SetMemberRole changes what a member may do in an account. Only the owner can
+do this, and their own role can't be changed.
+*/
+func (s AccountService) SetMemberRole(accountID, ownerID, memberID int, role models.AccountRole) error {
+	var (
+		err         error
+		tx          pgx.Tx
+		actualOwner int
+		result      pgconn.CommandTag
+	)
+
+	if !role.IsAssignable() {
+		return ErrInvalidAccountRole
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if actualOwner, err = lockAccount(ctx, tx, accountID); err != nil {
+		return err
+	}
+
+	if actualOwner != ownerID {
+		err = ErrNotAccountOwner
+		return err
+	}
+
+	if memberID == ownerID {
+		err = ErrInvalidAccountRole
+		return err
+	}
+
+	if result, err = tx.Exec(ctx, "UPDATE account_memberships SET role=$1 WHERE account_id=$2 AND user_id=$3", role, accountID, memberID); err != nil {
+		return fmt.Errorf("error setting member role: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		err = ErrAccountMemberNotFound
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing member role: %w", err)
+	}
+
+	return nil
+}
+
+/*
+SwitchAccount makes one of a user's households the one they are using, and
+the one they start in when they next log in.
+*/
+func (s AccountService) SwitchAccount(userID, accountID int) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	query := `
+UPDATE users AS u SET
+	account_id = m.account_id
+FROM account_memberships AS m
+WHERE 1=1
+	AND m.user_id = u.id
+	AND u.id = $1
+	AND m.account_id = $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, userID, accountID); err != nil {
+		return fmt.Errorf("error switching account: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrAccountMemberNotFound
+	}
+
+	return nil
+}
+
+/*
+TransferOwnership makes another active member of an account its owner. Only
+the current owner can do this. The old owner stays on with the member role.
+*/
+func (s AccountService) TransferOwnership(accountID, ownerID, newOwnerID int) error {
+	var (
+		err         error
+		tx          pgx.Tx
+		actualOwner int
+		result      pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if actualOwner, err = lockAccount(ctx, tx, accountID); err != nil {
+		return err
+	}
+
+	if actualOwner != ownerID {
+		err = ErrNotAccountOwner
+		return err
+	}
+
+	query := `
+UPDATE accounts AS a SET
+	owner = u.id
+FROM users AS u
+	INNER JOIN account_memberships AS m ON m.user_id = u.id
+WHERE 1=1
+	AND a.id = $1
+	AND u.id = $2
+	AND m.account_id = a.id
+	AND u.active = true
+	`
+
+	if result, err = tx.Exec(ctx, query, accountID, newOwnerID); err != nil {
+		return fmt.Errorf("error transferring account ownership: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		err = ErrAccountMemberNotFound
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE account_memberships SET role=$1 WHERE account_id=$2 AND user_id=$3", models.AccountRoleMember, accountID, ownerID); err != nil {
+		return fmt.Errorf("error setting previous owner's role: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing ownership transfer: %w", err)
+	}
+
+	return nil
+}
+
+/*
+lockAccount locks an account's row until the transaction ends, so
+membership changes don't race each other, and returns its owner.
+*/
+func lockAccount(ctx context.Context, tx pgx.Tx, accountID int) (int, error) {
+	var (
+		err     error
+		ownerID int
+	)
+
+	if err = tx.QueryRow(ctx, "SELECT owner FROM accounts WHERE id=$1 FOR UPDATE", accountID).Scan(&ownerID); err != nil {
+		if pgxscan.NotFound(err) {
+			return 0, ErrAccountNotFound
+		}
+
+		return 0, fmt.Errorf("error locking account: %w", err)
+	}
+
+	return ownerID, nil
+}
+
+/*
+detachMember takes a user out of an account. Their watcher there is
+unlinked rather than deleted so its history stays, and their API tokens for
+the account are revoked. If it was the account they were using, they move
+to another household they belong to, or a new one of their own with a
+watcher named like the old one. Their sessions in the old account end
+because they are no longer a member.
+*/
+func detachMember(ctx context.Context, tx pgx.Tx, accountID, userID int) (*models.DetachedMember, error) {
+	var (
+		err              error
+		result           pgconn.CommandTag
+		email            string
+		currentAccountID *int
+		watcherNames     []string
+		otherAccountIDs  []int
+		joinToken        string
+	)
+
+	if result, err = tx.Exec(ctx, "DELETE FROM account_memberships WHERE user_id=$1 AND account_id=$2", userID, accountID); err != nil {
+		return nil, fmt.Errorf("error removing account membership: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return nil, ErrAccountMemberNotFound
+	}
+
+	if err = tx.QueryRow(ctx, "SELECT email, account_id FROM users WHERE id=$1", userID).Scan(&email, &currentAccountID); err != nil {
+		return nil, fmt.Errorf("error fetching account member: %w", err)
+	}
+
+	if err = pgxscan.Select(ctx, tx, &watcherNames, "UPDATE watchers SET user_id=NULL WHERE account_id=$1 AND user_id=$2 RETURNING name", accountID, userID); err != nil {
+		return nil, fmt.Errorf("error unlinking member's watcher: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE api_tokens SET revoked_at=$1 WHERE user_id=$2 AND account_id=$3 AND revoked_at IS NULL", time.Now().UTC(), userID, accountID); err != nil {
+		return nil, fmt.Errorf("error revoking member's api tokens: %w", err)
+	}
+
+	if currentAccountID != nil && *currentAccountID != accountID {
+		return &models.DetachedMember{AccountID: *currentAccountID}, nil
+	}
+
+	if err = pgxscan.Select(ctx, tx, &otherAccountIDs, "SELECT account_id FROM account_memberships WHERE user_id=$1 ORDER BY joined_at, account_id LIMIT 1", userID); err != nil {
+		return nil, fmt.Errorf("error fetching member's other accounts: %w", err)
+	}
+
+	newAccountID := 0
+
+	if len(otherAccountIDs) > 0 {
+		newAccountID = otherAccountIDs[0]
+	} else {
+		watcherName := email
+
+		if len(watcherNames) > 0 {
+			watcherName = watcherNames[0]
+		}
+
+		if joinToken, err = newJoinToken(); err != nil {
+			return nil, err
+		}
+
+		if err = tx.QueryRow(ctx, "INSERT INTO accounts (owner, join_token) VALUES ($1, $2) RETURNING id", userID, joinToken).Scan(&newAccountID); err != nil {
+			return nil, fmt.Errorf("error creating account for detached member: %w", err)
+		}
+
+		if err = addAccountMembership(ctx, tx, userID, newAccountID); err != nil {
+			return nil, err
+		}
+
+		if _, err = tx.Exec(ctx, "INSERT INTO watchers (user_id, name, account_id) VALUES ($1, $2, $3)", userID, watcherName, newAccountID); err != nil {
+			return nil, fmt.Errorf("error creating watcher for detached member: %w", err)
+		}
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE users SET account_id=$1 WHERE id=$2", newAccountID, userID); err != nil {
+		return nil, fmt.Errorf("error moving member to another account: %w", err)
+	}
+
+	return &models.DetachedMember{AccountID: newAccountID}, nil
+}
+
+/*
+addAccountMembership makes a user a member of an account. Returns
+ErrAlreadyAccountMember when they already are.
+*/
+func addAccountMembership(ctx context.Context, q services.Querier, userID, accountID int) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	query := `
+INSERT INTO account_memberships (
+	user_id
+	, account_id
+	, joined_at
+) VALUES (
+	$1
+	, $2
+	, $3
+)
+ON CONFLICT DO NOTHING
+	`
+
+	if result, err = q.Exec(ctx, query, userID, accountID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error adding account membership: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrAlreadyAccountMember
+	}
+
+	return nil
+}
+
+/*
+addMemberWatcher gives a new member of an account their own watcher there,
+named after their email address, as signing up does.
+*/
+func addMemberWatcher(ctx context.Context, q services.Querier, userID, accountID int) error {
+	if _, err := q.Exec(ctx, "INSERT INTO watchers (user_id, name, account_id) SELECT id, email, $2 FROM users WHERE id=$1", userID, accountID); err != nil {
+		return fmt.Errorf("error creating watcher for account member: %w", err)
+	}
+
+	return nil
+}
+
+func newJoinToken() (string, error) {
+	return newSecureToken(joinTokenNumBytes)
 }
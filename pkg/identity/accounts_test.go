@@ -0,0 +1,142 @@
+package identity_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/identity"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/testdb"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestJoiningAnAccountAddsAWatcher(t *testing.T) {
+	db := testdb.New(t)
+
+	accountService := identity.NewAccountService(identity.AccountServiceConfig{
+		DbServiceBase: services.DbServiceBase{DB: db, QueryTimeout: testdb.QueryTimeout},
+	})
+
+	invitationService := identity.NewAccountInvitationService(identity.AccountInvitationServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{DB: db, QueryTimeout: testdb.QueryTimeout},
+	})
+
+	ownerID, accountID, joinToken := insertAccount(t, db, "owner@example.com")
+
+	t.Run("join token", func(t *testing.T) {
+		userID, _, _ := insertAccount(t, db, "joiner@example.com")
+
+		got, err := accountService.JoinAccountByJoinToken(joinToken, userID)
+
+		if err != nil || got != accountID {
+			t.Fatalf("expected to join account %d, got %d (%v)", accountID, got, err)
+		}
+
+		assertWatchers(t, db, accountID, userID, []string{"joiner@example.com"})
+
+		if _, err = accountService.JoinAccountByJoinToken(joinToken, userID); !errors.Is(err, identity.ErrAlreadyAccountMember) {
+			t.Errorf("expected ErrAlreadyAccountMember joining again, got %v", err)
+		}
+
+		assertWatchers(t, db, accountID, userID, []string{"joiner@example.com"})
+	})
+
+	t.Run("invitation", func(t *testing.T) {
+		userID, _, _ := insertAccount(t, db, "invited@example.com")
+
+		token, err := invitationService.CreateAccountInvitation(models.CreateAccountInvitationRequest{
+			AccountID: accountID,
+			Email:     "invited@example.com",
+			InvitedBy: ownerID,
+			Lifetime:  time.Hour,
+		})
+
+		if err != nil {
+			t.Fatalf("error creating invitation: %v", err)
+		}
+
+		got, err := invitationService.AcceptAccountInvitation(token, userID)
+
+		if err != nil || got != accountID {
+			t.Fatalf("expected to join account %d, got %d (%v)", accountID, got, err)
+		}
+
+		assertWatchers(t, db, accountID, userID, []string{"invited@example.com"})
+	})
+
+	t.Run("unknown join token", func(t *testing.T) {
+		userID, _, _ := insertAccount(t, db, "stranger@example.com")
+
+		if _, err := accountService.JoinAccountByJoinToken("not a join token", userID); !errors.Is(err, identity.ErrAccountNotFound) {
+			t.Fatalf("expected ErrAccountNotFound, got %v", err)
+		}
+
+		assertWatchers(t, db, accountID, userID, nil)
+	})
+}
+
+/*
+assertWatchers checks the names of a user's watchers in an account.
+*/
+func assertWatchers(t *testing.T, db *pgxpool.Pool, accountID, userID int, want []string) {
+	t.Helper()
+
+	var (
+		names []string
+	)
+
+	if err := pgxscan.Select(context.Background(), db, &names, "SELECT name FROM watchers WHERE account_id=$1 AND user_id=$2 ORDER BY id", accountID, userID); err != nil {
+		t.Fatalf("error getting watchers: %v", err)
+	}
+
+	if len(names) != len(want) {
+		t.Fatalf("expected watchers %v, got %v", want, names)
+	}
+
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("expected watchers %v, got %v", want, names)
+		}
+	}
+}
+
+/*
+insertAccount makes an active user with their own household, and returns
+the user's ID, the household's ID, and its join token.
+*/
+func insertAccount(t *testing.T, db *pgxpool.Pool, email string) (int, int, string) {
+	t.Helper()
+
+	var (
+		err       error
+		userID    int
+		accountID int
+	)
+
+	ctx := context.Background()
+
+	if err = db.QueryRow(ctx, "INSERT INTO users (created_at, active, email, password, auth_token) VALUES ($1, true, $2, '', $2) RETURNING id", time.Now().UTC(), email).Scan(&userID); err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+
+	joinToken := "join-" + strconv.Itoa(userID)
+
+	if err = db.QueryRow(ctx, "INSERT INTO accounts (owner, join_token) VALUES ($1, $2) RETURNING id", userID, joinToken).Scan(&accountID); err != nil {
+		t.Fatalf("error inserting account: %v", err)
+	}
+
+	if _, err = db.Exec(ctx, "UPDATE users SET account_id=$1 WHERE id=$2", accountID, userID); err != nil {
+		t.Fatalf("error setting account: %v", err)
+	}
+
+	if _, err = db.Exec(ctx, "INSERT INTO account_memberships (user_id, account_id, joined_at) VALUES ($1, $2, $3)", userID, accountID, time.Now().UTC()); err != nil {
+		t.Fatalf("error adding membership: %v", err)
+	}
+
+	return userID, accountID, joinToken
+}
@@ -0,0 +1,285 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	/*
+	   ApiTokenPrefix starts every personal access token so they are easy to
+	   recognize, for example by secret scanners.
+	*/
+	ApiTokenPrefix = "st_"
+
+	apiTokenNumBytes      = 32
+	apiTokenDisplayLength = 8
+)
+
+var (
+	ErrApiTokenNotFound = errors.New("api token not found")
+	ErrInvalidApiToken  = errors.New("invalid api token")
+	ErrInvalidScope     = errors.New("invalid api token scope")
+)
+
+type ApiTokenServicer interface {
+	/*
+	   AuthenticateApiToken returns the token record for a personal access
+	   token and records that it was used. Unknown tokens, revoked tokens, and
+	   tokens belonging to inactive users return ErrInvalidApiToken.
+	*/
+	AuthenticateApiToken(token string) (*models.ApiToken, error)
+
+	/*
+	   CreateApiToken creates a new personal access token for a user in an
+	   account. The token itself is only returned here. It can't be read back
+	   later.
+	*/
+	CreateApiToken(userID, accountID int, name, scope string) (string, *models.ApiToken, error)
+
+	/*
+	   GetApiTokens returns all of a user's tokens for an account, newest first.
+	*/
+	GetApiTokens(userID, accountID int) ([]models.ApiToken, error)
+
+	/*
+	   RevokeApiToken revokes one of a user's tokens.
+	*/
+	RevokeApiToken(userID, tokenID int) error
+}
+
+type ApiTokenServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type ApiTokenService struct {
+	services.DbServiceBase
+}
+
+func NewApiTokenService(config ApiTokenServiceConfig) ApiTokenService {
+	return ApiTokenService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+AuthenticateApiToken returns the token record for a personal access token
+and records that it was used. Unknown tokens, revoked tokens, and tokens
+belonging to inactive users return ErrInvalidApiToken. The last used time
+is only written once a minute to avoid a write on every request.
+*/
+func (s ApiTokenService) AuthenticateApiToken(token string) (*models.ApiToken, error) {
+	var (
+		err     error
+		results []models.ApiToken
+	)
+
+	if !strings.HasPrefix(token, ApiTokenPrefix) {
+		return nil, ErrInvalidApiToken
+	}
+
+	query := `
+SELECT
+	t.id
+	, t.user_id
+	, u.email AS user_email
+	, t.account_id
+	, t.name
+	, t.token_prefix
+	, t.scope
+	, t.created_at
+	, t.last_used_at
+	, t.revoked_at
+FROM api_tokens AS t
+	INNER JOIN users AS u ON u.id = t.user_id
+WHERE 1=1
+	AND t.token_hash = $1
+	AND t.revoked_at IS NULL
+	AND u.active = true
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, hashToken(token)); err != nil {
+		return nil, fmt.Errorf("error querying api token: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrInvalidApiToken
+	}
+
+	result := results[0]
+
+	updateQuery := `
+UPDATE api_tokens SET
+	last_used_at = NOW() AT TIME ZONE 'UTC'
+WHERE id = $1
+	AND (last_used_at IS NULL OR last_used_at < (NOW() AT TIME ZONE 'UTC') - INTERVAL '1 minute')
+	`
+
+	if _, err = s.DB.Exec(ctx, updateQuery, result.ID); err != nil {
+		return nil, fmt.Errorf("error updating api token last used time: %w", err)
+	}
+
+	return &result, nil
+}
+
+/*
+CreateApiToken creates a new personal access token for a user in an
+account. The token itself is only returned here. Only its hash is stored,
+so it can't be read back later.
+*/
+func (s ApiTokenService) CreateApiToken(userID, accountID int, name, scope string) (string, *models.ApiToken, error) {
+	var (
+		err        error
+		secret     string
+		newTokenID int
+	)
+
+	if scope != models.ApiTokenScopeRead && scope != models.ApiTokenScopeWrite {
+		return "", nil, ErrInvalidScope
+	}
+
+	if secret, err = newSecureToken(apiTokenNumBytes); err != nil {
+		return "", nil, err
+	}
+
+	token := ApiTokenPrefix + secret
+	tokenPrefix := token[:len(ApiTokenPrefix)+apiTokenDisplayLength]
+	createdAt := time.Now().UTC()
+
+	query := `
+INSERT INTO api_tokens (
+	user_id
+	, account_id
+	, name
+	, token_hash
+	, token_prefix
+	, scope
+	, created_at
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+	, $5
+	, $6
+	, $7
+)
+RETURNING id
+	`
+
+	args := []any{
+		userID,
+		accountID,
+		name,
+		hashToken(token),
+		tokenPrefix,
+		scope,
+		createdAt,
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, query, args...).Scan(&newTokenID); err != nil {
+		return "", nil, fmt.Errorf("error creating api token: %w", err)
+	}
+
+	newToken := &models.ApiToken{
+		ID:          newTokenID,
+		UserID:      userID,
+		AccountID:   accountID,
+		Name:        name,
+		TokenPrefix: tokenPrefix,
+		Scope:       scope,
+		CreatedAt:   createdAt,
+	}
+
+	return token, newToken, nil
+}
+
+/*
+GetApiTokens returns all of a user's tokens for an account, newest first.
+Revoked tokens are included so people can see what was revoked.
+*/
+func (s ApiTokenService) GetApiTokens(userID, accountID int) ([]models.ApiToken, error) {
+	var (
+		err     error
+		results = []models.ApiToken{}
+	)
+
+	query := `
+SELECT
+	t.id
+	, t.user_id
+	, u.email AS user_email
+	, t.account_id
+	, t.name
+	, t.token_prefix
+	, t.scope
+	, t.created_at
+	, t.last_used_at
+	, t.revoked_at
+FROM api_tokens AS t
+	INNER JOIN users AS u ON u.id = t.user_id
+WHERE 1=1
+	AND t.user_id = $1
+	AND t.account_id = $2
+ORDER BY
+	t.revoked_at IS NOT NULL,
+	t.created_at DESC
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, userID, accountID); err != nil {
+		return results, fmt.Errorf("error fetching api tokens: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+RevokeApiToken revokes one of a user's tokens. Revoking a token that is
+already revoked returns ErrApiTokenNotFound.
+*/
+func (s ApiTokenService) RevokeApiToken(userID, tokenID int) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	query := `
+UPDATE api_tokens SET
+	revoked_at = NOW() AT TIME ZONE 'UTC'
+WHERE id = $1
+	AND user_id = $2
+	AND revoked_at IS NULL
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, tokenID, userID); err != nil {
+		return fmt.Errorf("error revoking api token: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrApiTokenNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,452 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/clientip"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/useragent"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	loginSessionNumBytes = 32
+
+	/*
+	   loginSessionSeenInterval is how often a session's last activity is
+	   saved. Saving it on every request would write to the database for
+	   every page.
+	*/
+	loginSessionSeenInterval = time.Minute
+
+	maxUserAgentLength = 500
+)
+
+var (
+	ErrLoginSessionNotFound = errors.New("login session not found")
+)
+
+type LoginSessionServicer interface {
+	/*
+	   CurrentLoginSessionID returns the ID of the session the request was
+	   made with, or 0 when there isn't one.
+	*/
+	CurrentLoginSessionID(r *http.Request) int
+
+	/*
+	   DeleteLoginSession logs one of a user's sessions out. Returns
+	   ErrLoginSessionNotFound when it isn't theirs.
+	*/
+	DeleteLoginSession(userID, sessionID int) error
+
+	/*
+	   DeleteOtherLoginSessions logs out all of a user's sessions except
+	   one, and returns how many there were.
+	*/
+	DeleteOtherLoginSessions(userID, keepSessionID int) (int64, error)
+
+	/*
+	   GetLoginSessions returns a user's unexpired sessions, most recently
+	   used first.
+	*/
+	GetLoginSessions(userID int) ([]models.LoginSession, error)
+}
+
+type LoginSessionStoreConfig struct {
+	services.DbServiceBaseConfig
+
+	/*
+	   KeyPairs sign the session ID in the cookie, as in
+	   securecookie.CodecsFromPairs.
+	*/
+	KeyPairs [][]byte
+
+	/*
+	   Options are the cookie options. MaxAge is also how long a session
+	   lasts.
+	*/
+	Options *sessions.Options
+
+	/*
+	   SessionKey is the key in the session's values that holds the
+	   *UserSession.
+	*/
+	SessionKey        string
+	SessionName       string
+	TrustProxyHeaders bool
+}
+
+/*
+LoginSessionStore is a session store that keeps sessions in the database,
+so each one can be listed and logged out. It only keeps sessions that have
+a user logged in.
+*/
+type LoginSessionStore struct {
+	services.DbServiceBase
+
+	codecs            []securecookie.Codec
+	options           *sessions.Options
+	sessionKey        string
+	sessionName       string
+	trustProxyHeaders bool
+}
+
+func NewLoginSessionStore(config LoginSessionStoreConfig) *LoginSessionStore {
+	return &LoginSessionStore{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+		codecs:            securecookie.CodecsFromPairs(config.KeyPairs...),
+		options:           config.Options,
+		sessionKey:        config.SessionKey,
+		sessionName:       config.SessionName,
+		trustProxyHeaders: config.TrustProxyHeaders,
+	}
+}
+
+/*
+Get returns the named session for a request, loading it only once per
+request.
+*/
+func (s *LoginSessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+/*
+New loads the session named in the request's cookie. A missing, expired,
+or logged out session isn't an error. The session is just empty, as if
+the user had never logged in.
+*/
+func (s *LoginSessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	var (
+		err     error
+		session *sessions.Session
+		cookie  *http.Cookie
+		id      string
+	)
+
+	session = sessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+
+	if cookie, err = r.Cookie(name); err != nil {
+		return session, nil
+	}
+
+	if err = securecookie.DecodeMulti(name, cookie.Value, &id, s.codecs...); err != nil {
+		return session, nil
+	}
+
+	if err = s.load(r, id, session); err != nil {
+		if !errors.Is(err, ErrLoginSessionNotFound) {
+			slog.Error("error loading login session", "error", err)
+		}
+
+		return session, nil
+	}
+
+	session.ID = id
+	session.IsNew = false
+	return session, nil
+}
+
+/*
+Save writes the session to the database and sets its cookie. A session
+with MaxAge <= 0, or without a user, is deleted instead.
+
+A session is only updated when it belongs to the same user. Logging in with
+a session ID someone else got hold of gets a new ID.
+*/
+func (s *LoginSessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	var (
+		err     error
+		data    bytes.Buffer
+		result  pgconn.CommandTag
+		encoded string
+	)
+
+	userSession, _ := session.Values[s.sessionKey].(*UserSession)
+
+	if session.Options.MaxAge <= 0 || userSession == nil {
+		if err = s.delete(session.ID); err != nil {
+			return err
+		}
+
+		session.ID = ""
+		session.Options.MaxAge = -1
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if err = gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return fmt.Errorf("error encoding session values: %w", err)
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Duration(session.Options.MaxAge) * time.Second)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if session.ID != "" {
+		query := `
+UPDATE login_sessions SET
+	data = $1
+	, expires_at = $2
+WHERE 1=1
+	AND token_hash = $3
+	AND user_id = $4
+	AND expires_at > $5
+		`
+
+		if result, err = s.DB.Exec(ctx, query, data.Bytes(), expiresAt, hashToken(session.ID), userSession.UserID, now); err != nil {
+			return fmt.Errorf("error updating login session: %w", err)
+		}
+	}
+
+	if session.ID == "" || result.RowsAffected() == 0 {
+		if session.ID, err = newSecureToken(loginSessionNumBytes); err != nil {
+			return err
+		}
+
+		if _, err = s.DB.Exec(ctx, "DELETE FROM login_sessions WHERE expires_at <= $1", now); err != nil {
+			return fmt.Errorf("error removing expired login sessions: %w", err)
+		}
+
+		query := `
+INSERT INTO login_sessions (
+	token_hash
+	, user_id
+	, data
+	, user_agent
+	, ip_address
+	, created_at
+	, last_seen_at
+	, expires_at
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+	, $5
+	, $6
+	, $6
+	, $7
+)
+		`
+
+		args := []any{
+			hashToken(session.ID),
+			userSession.UserID,
+			data.Bytes(),
+			useragent.Truncate(r.UserAgent(), maxUserAgentLength),
+			clientip.FromRequest(r, s.trustProxyHeaders),
+			now,
+			expiresAt,
+		}
+
+		if _, err = s.DB.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("error creating login session: %w", err)
+		}
+	}
+
+	if encoded, err = securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...); err != nil {
+		return fmt.Errorf("error encoding session cookie: %w", err)
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+/*
+CurrentLoginSessionID returns the ID of the session the request was made
+with, or 0 when there isn't one.
+*/
+func (s *LoginSessionStore) CurrentLoginSessionID(r *http.Request) int {
+	var (
+		err     error
+		session *sessions.Session
+		result  int
+	)
+
+	if session, err = s.Get(r, s.sessionName); err != nil || session.ID == "" {
+		return 0
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, "SELECT id FROM login_sessions WHERE token_hash=$1", hashToken(session.ID)).Scan(&result); err != nil {
+		return 0
+	}
+
+	return result
+}
+
+/*
+DeleteLoginSession logs one of a user's sessions out.
+*/
+func (s *LoginSessionStore) DeleteLoginSession(userID, sessionID int) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, "DELETE FROM login_sessions WHERE id=$1 AND user_id=$2", sessionID, userID); err != nil {
+		return fmt.Errorf("error deleting login session: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrLoginSessionNotFound
+	}
+
+	return nil
+}
+
+/*
+DeleteOtherLoginSessions logs out all of a user's sessions except
+keepSessionID.
+*/
+func (s *LoginSessionStore) DeleteOtherLoginSessions(userID, keepSessionID int) (int64, error) {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, "DELETE FROM login_sessions WHERE user_id=$1 AND id<>$2", userID, keepSessionID); err != nil {
+		return 0, fmt.Errorf("error deleting other login sessions: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+/*
+GetLoginSessions returns a user's unexpired sessions, most recently used
+first.
+*/
+func (s *LoginSessionStore) GetLoginSessions(userID int) ([]models.LoginSession, error) {
+	var (
+		err     error
+		results = []models.LoginSession{}
+	)
+
+	query := `
+SELECT
+	ls.id
+	, ls.user_id
+	, ls.user_agent
+	, ls.ip_address
+	, ls.created_at
+	, ls.last_seen_at
+	, ls.expires_at
+FROM login_sessions AS ls
+WHERE 1=1
+	AND ls.user_id = $1
+	AND ls.expires_at > $2
+ORDER BY ls.last_seen_at DESC, ls.id DESC
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, userID, time.Now().UTC()); err != nil {
+		return results, fmt.Errorf("error fetching login sessions: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+load reads a session's values, and notes that it was used, from where, at
+most once every loginSessionSeenInterval.
+*/
+func (s *LoginSessionStore) load(r *http.Request, id string, session *sessions.Session) error {
+	var (
+		err        error
+		sessionID  int
+		data       []byte
+		lastSeenAt time.Time
+	)
+
+	now := time.Now().UTC()
+
+	query := `
+SELECT
+	id
+	, data
+	, last_seen_at
+FROM login_sessions
+WHERE 1=1
+	AND token_hash = $1
+	AND expires_at > $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, query, hashToken(id), now).Scan(&sessionID, &data, &lastSeenAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLoginSessionNotFound
+		}
+
+		return fmt.Errorf("error querying login session: %w", err)
+	}
+
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return fmt.Errorf("error decoding session values: %w", err)
+	}
+
+	if now.Sub(lastSeenAt) >= loginSessionSeenInterval {
+		query = `
+UPDATE login_sessions SET
+	last_seen_at = $1
+	, user_agent = $2
+	, ip_address = $3
+WHERE id = $4
+		`
+
+		if _, err = s.DB.Exec(ctx, query, now, useragent.Truncate(r.UserAgent(), maxUserAgentLength), clientip.FromRequest(r, s.trustProxyHeaders), sessionID); err != nil {
+			slog.Error("error recording login session activity", "error", err, "sessionID", sessionID)
+		}
+	}
+
+	return nil
+}
+
+func (s *LoginSessionStore) delete(id string) error {
+	var (
+		err error
+	)
+
+	if id == "" {
+		return nil
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, "DELETE FROM login_sessions WHERE token_hash=$1", hashToken(id)); err != nil {
+		return fmt.Errorf("error deleting login session: %w", err)
+	}
+
+	return nil
+}
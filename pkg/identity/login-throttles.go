@@ -0,0 +1,237 @@
+package identity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	/*
+	   loginLockoutBase is how long the first lockout lasts. Each failure
+	   after that doubles it, up to loginLockoutMax.
+	*/
+	loginLockoutBase = time.Minute
+	loginLockoutMax  = time.Hour * 24
+
+	/*
+	   loginThrottleWindow is how long failures are remembered. A key with
+	   no failures for this long starts counting again from zero.
+	*/
+	loginThrottleWindow = time.Hour * 24
+
+	/*
+	   MaxJoinCodeAttempts is how many wrong account codes a user, or an IP
+	   address, may try before they are locked out. Account codes never
+	   expire, so guessing them has to be slow.
+	*/
+	MaxJoinCodeAttempts = 10
+)
+
+type LoginThrottleServicer interface {
+	/*
+	   ClearLoginThrottle forgets the failures for a key, such as after a
+	   successful log in.
+	*/
+	ClearLoginThrottle(key string) error
+
+	/*
+	   GetLoginLockout returns the latest time any of the keys is locked
+	   until. The zero time means none of them are locked.
+	*/
+	GetLoginLockout(keys ...string) (time.Time, error)
+
+	/*
+	   RecordFailedLogin counts a failed log in against a key. Once there
+	   have been more than freeAttempts, the key is locked, for longer with
+	   each further failure.
+	*/
+	RecordFailedLogin(key string, freeAttempts int) (*models.LoginThrottle, error)
+}
+
+type LoginThrottleServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type LoginThrottleService struct {
+	services.DbServiceBase
+}
+
+func NewLoginThrottleService(config LoginThrottleServiceConfig) LoginThrottleService {
+	return LoginThrottleService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+EmailLoginThrottleKey returns the throttle key for log ins to an email
+address. Addresses without an account get a key too, so a lockout doesn't
+give away who has signed up.
+*/
+func EmailLoginThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+/*
+IPLoginThrottleKey returns the throttle key for log ins from an IP address.
+*/
+func IPLoginThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+/*
+JoinCodeThrottleKeys returns the throttle keys for a user trying account
+codes from an IP address. They are counted apart from log ins, so someone
+who mistypes a code isn't kept from logging in.
+*/
+func JoinCodeThrottleKeys(ip string, userID int) []string {
+	return []string{"join-ip:" + ip, fmt.Sprintf("join-user:%d", userID)}
+}
+
+/*
+EmailLinkThrottleKeys returns the throttle keys for asking for log in links
+to an email address from an IP address. They are counted apart from log
+ins, so asking for links doesn't lock out anyone's password.
+*/
+func EmailLinkThrottleKeys(email, ip string) (emailKey, ipKey string) {
+	return "email-link:" + strings.ToLower(strings.TrimSpace(email)), "email-link-ip:" + ip
+}
+
+/*
+ClearLoginThrottle forgets the failures for a key.
+*/
+func (s LoginThrottleService) ClearLoginThrottle(key string) error {
+	var (
+		err error
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, "DELETE FROM login_throttles WHERE key=$1", key); err != nil {
+		return fmt.Errorf("error clearing login throttle: %w", err)
+	}
+
+	return nil
+}
+
+/*
+GetLoginLockout returns the latest time any of the keys is locked until, or
+the zero time when none are locked.
+*/
+func (s LoginThrottleService) GetLoginLockout(keys ...string) (time.Time, error) {
+	var (
+		err         error
+		lockedUntil *time.Time
+	)
+
+	query := `
+SELECT MAX(locked_until)
+FROM login_throttles
+WHERE 1=1
+	AND key = ANY($1)
+	AND locked_until > $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, query, keys, time.Now().UTC()).Scan(&lockedUntil); err != nil {
+		return time.Time{}, fmt.Errorf("error querying login lockout: %w", err)
+	}
+
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+
+	return *lockedUntil, nil
+}
+
+/*
+RecordFailedLogin counts a failed log in against a key, and locks it once
+there have been more than freeAttempts. The first lockout lasts a minute,
+and each failure after that doubles it, up to a day.
+*/
+func (s LoginThrottleService) RecordFailedLogin(key string, freeAttempts int) (*models.LoginThrottle, error) {
+	var (
+		err      error
+		tx       pgx.Tx
+		throttle models.LoginThrottle
+	)
+
+	now := time.Now().UTC()
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	/*
+	 * Failures that are old enough are forgotten, so the key starts
+	 * counting from zero again, and the table doesn't grow forever.
+	 */
+	if _, err = tx.Exec(ctx, "DELETE FROM login_throttles WHERE updated_at < $1", now.Add(-loginThrottleWindow)); err != nil {
+		return nil, fmt.Errorf("error removing old login throttles: %w", err)
+	}
+
+	query := `
+INSERT INTO login_throttles (
+	key
+	, failed_attempts
+	, updated_at
+) VALUES (
+	$1
+	, 1
+	, $2
+)
+ON CONFLICT (key) DO UPDATE SET
+	failed_attempts = login_throttles.failed_attempts + 1
+	, updated_at = $2
+RETURNING
+	key
+	, failed_attempts
+	, locked_until
+	, updated_at
+	`
+
+	if err = pgxscan.Get(ctx, tx, &throttle, query, key, now); err != nil {
+		return nil, fmt.Errorf("error recording failed login: %w", err)
+	}
+
+	if throttle.FailedAttempts > freeAttempts {
+		lockout := loginLockoutMax
+
+		if doublings := throttle.FailedAttempts - freeAttempts - 1; doublings < 20 {
+			lockout = min(loginLockoutBase<<doublings, loginLockoutMax)
+		}
+
+		lockedUntil := now.Add(lockout)
+		throttle.LockedUntil = &lockedUntil
+
+		if _, err = tx.Exec(ctx, "UPDATE login_throttles SET locked_until=$1 WHERE key=$2", lockedUntil, key); err != nil {
+			return nil, fmt.Errorf("error locking login: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing failed login: %w", err)
+	}
+
+	return &throttle, nil
+}
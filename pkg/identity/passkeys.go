@@ -0,0 +1,242 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrPasskeyInUse    = errors.New("that passkey is already registered")
+	ErrPasskeyNotFound = errors.New("passkey not found")
+)
+
+type PasskeyServicer interface {
+	/*
+	   CreatePasskey saves a passkey a user has registered. Returns
+	   ErrPasskeyInUse when the credential is already registered.
+	*/
+	CreatePasskey(request models.CreatePasskeyRequest) (*models.UserPasskey, error)
+
+	/*
+	   DeletePasskey removes one of a user's passkeys. Returns
+	   ErrPasskeyNotFound when it isn't theirs.
+	*/
+	DeletePasskey(userID, passkeyID int) error
+
+	/*
+	   GetPasskeyByCredentialID returns the passkey with a credential ID, as
+	   long as its user is active. Returns ErrPasskeyNotFound otherwise.
+	*/
+	GetPasskeyByCredentialID(credentialID string) (*models.UserPasskey, error)
+
+	/*
+	   GetPasskeys returns a user's passkeys, oldest first.
+	*/
+	GetPasskeys(userID int) ([]models.UserPasskey, error)
+
+	/*
+	   RecordPasskeyUse saves a passkey's new sign count and when it was
+	   used.
+	*/
+	RecordPasskeyUse(passkeyID int, signCount int64) error
+}
+
+type PasskeyServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type PasskeyService struct {
+	services.DbServiceBase
+}
+
+func NewPasskeyService(config PasskeyServiceConfig) PasskeyService {
+	return PasskeyService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+CreatePasskey saves a passkey a user has registered.
+*/
+func (s PasskeyService) CreatePasskey(request models.CreatePasskeyRequest) (*models.UserPasskey, error) {
+	var (
+		err     error
+		results []models.UserPasskey
+	)
+
+	query := `
+INSERT INTO user_passkeys (
+	user_id
+	, credential_id
+	, public_key
+	, sign_count
+	, name
+	, created_at
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+	, $5
+	, $6
+)
+ON CONFLICT (credential_id) DO NOTHING
+RETURNING
+	id
+	, user_id
+	, credential_id
+	, public_key
+	, sign_count
+	, name
+	, created_at
+	, last_used_at
+	`
+
+	args := []any{
+		request.UserID,
+		request.CredentialID,
+		request.PublicKey,
+		request.SignCount,
+		request.Name,
+		time.Now().UTC(),
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, args...); err != nil {
+		return nil, fmt.Errorf("error creating passkey: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrPasskeyInUse
+	}
+
+	return &results[0], nil
+}
+
+/*
+DeletePasskey removes one of a user's passkeys.
+*/
+func (s PasskeyService) DeletePasskey(userID, passkeyID int) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, "DELETE FROM user_passkeys WHERE id=$1 AND user_id=$2", passkeyID, userID); err != nil {
+		return fmt.Errorf("error deleting passkey: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+/*
+GetPasskeyByCredentialID returns the passkey with a credential ID, with its
+user's email address, as long as the user is active.
+*/
+func (s PasskeyService) GetPasskeyByCredentialID(credentialID string) (*models.UserPasskey, error) {
+	var (
+		err    error
+		result models.UserPasskey
+	)
+
+	query := `
+SELECT
+	p.id
+	, p.user_id
+	, u.email AS user_email
+	, p.credential_id
+	, p.public_key
+	, p.sign_count
+	, p.name
+	, p.created_at
+	, p.last_used_at
+FROM user_passkeys AS p
+	INNER JOIN users AS u ON u.id = p.user_id
+WHERE 1=1
+	AND p.credential_id = $1
+	AND u.active = true
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Get(ctx, s.DB, &result, query, credentialID); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, ErrPasskeyNotFound
+		}
+
+		return nil, fmt.Errorf("error querying passkey: %w", err)
+	}
+
+	return &result, nil
+}
+
+/*
+GetPasskeys returns a user's passkeys, oldest first.
+*/
+func (s PasskeyService) GetPasskeys(userID int) ([]models.UserPasskey, error) {
+	var (
+		err     error
+		results = []models.UserPasskey{}
+	)
+
+	query := `
+SELECT
+	p.id
+	, p.user_id
+	, p.credential_id
+	, p.public_key
+	, p.sign_count
+	, p.name
+	, p.created_at
+	, p.last_used_at
+FROM user_passkeys AS p
+WHERE p.user_id = $1
+ORDER BY p.created_at, p.id
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, userID); err != nil {
+		return results, fmt.Errorf("error fetching passkeys: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+RecordPasskeyUse saves a passkey's new sign count and when it was used.
+*/
+func (s PasskeyService) RecordPasskeyUse(passkeyID int, signCount int64) error {
+	var (
+		err error
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, "UPDATE user_passkeys SET sign_count=$1, last_used_at=$2 WHERE id=$3", signCount, time.Now().UTC(), passkeyID); err != nil {
+		return fmt.Errorf("error recording passkey use: %w", err)
+	}
+
+	return nil
+}
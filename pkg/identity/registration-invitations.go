@@ -0,0 +1,230 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+const (
+	registrationInvitationNumBytes = 16
+)
+
+var (
+	ErrInvalidRegistrationInvitation = errors.New("invalid or expired invitation")
+)
+
+type RegistrationInvitationServicer interface {
+	/*
+	   CreateRegistrationInvitation creates a single use invitation code that
+	   lets someone sign up until it expires. The code itself is only
+	   returned here.
+	*/
+	CreateRegistrationInvitation(request models.CreateRegistrationInvitationRequest) (string, error)
+
+	/*
+	   GetPendingRegistrationInvitations returns the unused, unexpired
+	   invitations a user has sent, newest first.
+	*/
+	GetPendingRegistrationInvitations(invitedBy int) ([]models.RegistrationInvitation, error)
+
+	/*
+	   GetRegistrationInvitation returns an unused, unexpired invitation
+	   without using it up. Anything else returns
+	   ErrInvalidRegistrationInvitation.
+	*/
+	GetRegistrationInvitation(code string) (*models.RegistrationInvitation, error)
+}
+
+type RegistrationInvitationServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type RegistrationInvitationService struct {
+	services.DbServiceBase
+}
+
+func NewRegistrationInvitationService(config RegistrationInvitationServiceConfig) RegistrationInvitationService {
+	return RegistrationInvitationService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+CreateRegistrationInvitation creates a single use invitation code that lets
+someone sign up until it expires. Only a hash of the code is stored.
+*/
+func (s RegistrationInvitationService) CreateRegistrationInvitation(request models.CreateRegistrationInvitationRequest) (string, error) {
+	var (
+		err       error
+		code      string
+		invitedBy *int
+	)
+
+	if code, err = newSecureToken(registrationInvitationNumBytes); err != nil {
+		return "", err
+	}
+
+	if request.InvitedBy > 0 {
+		invitedBy = &request.InvitedBy
+	}
+
+	createdAt := time.Now().UTC()
+
+	query := `
+INSERT INTO registration_invitations (
+	email
+	, invited_by
+	, code_hash
+	, created_at
+	, expires_at
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+	, $5
+)
+	`
+
+	args := []any{
+		strings.TrimSpace(request.Email),
+		invitedBy,
+		hashToken(code),
+		createdAt,
+		createdAt.Add(request.Lifetime),
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, query, args...); err != nil {
+		return "", fmt.Errorf("error creating registration invitation: %w", err)
+	}
+
+	return code, nil
+}
+
+/*
+GetPendingRegistrationInvitations returns the unused, unexpired invitations
+a user has sent, newest first.
+*/
+func (s RegistrationInvitationService) GetPendingRegistrationInvitations(invitedBy int) ([]models.RegistrationInvitation, error) {
+	var (
+		err     error
+		results = []models.RegistrationInvitation{}
+	)
+
+	query := `
+SELECT
+	i.id
+	, i.email
+	, i.invited_by
+	, COALESCE(u.email, '') AS invited_by_email
+	, i.created_at
+	, i.expires_at
+	, i.used_at
+FROM registration_invitations AS i
+	LEFT JOIN users AS u ON u.id = i.invited_by
+WHERE 1=1
+	AND i.invited_by = $1
+	AND i.used_at IS NULL
+	AND i.expires_at > $2
+ORDER BY i.created_at DESC
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, invitedBy, time.Now().UTC()); err != nil {
+		return results, fmt.Errorf("error fetching registration invitations: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+GetRegistrationInvitation returns an unused, unexpired invitation without
+using it up, so the sign up page can check a link before asking for
+anything.
+*/
+func (s RegistrationInvitationService) GetRegistrationInvitation(code string) (*models.RegistrationInvitation, error) {
+	var (
+		err     error
+		results []models.RegistrationInvitation
+	)
+
+	query := `
+SELECT
+	i.id
+	, i.email
+	, i.invited_by
+	, COALESCE(u.email, '') AS invited_by_email
+	, i.created_at
+	, i.expires_at
+	, i.used_at
+FROM registration_invitations AS i
+	LEFT JOIN users AS u ON u.id = i.invited_by
+WHERE 1=1
+	AND i.code_hash = $1
+	AND i.used_at IS NULL
+	AND i.expires_at > $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, hashToken(code), time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("error querying registration invitation: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrInvalidRegistrationInvitation
+	}
+
+	return &results[0], nil
+}
+
+/*
+consumeRegistrationInvitation marks an invitation as used by a new user.
+Checking and marking it is one statement, so two people racing with the
+same code can't both sign up.
+*/
+func consumeRegistrationInvitation(ctx context.Context, q services.Querier, code string, userID int) error {
+	var (
+		err          error
+		invitationID int
+	)
+
+	now := time.Now().UTC()
+
+	query := `
+UPDATE registration_invitations SET
+	used_at = $1
+	, used_by = $2
+WHERE 1=1
+	AND code_hash = $3
+	AND used_at IS NULL
+	AND expires_at > $1
+RETURNING id
+	`
+
+	if err = q.QueryRow(ctx, query, now, userID, hashToken(code)).Scan(&invitationID); err != nil {
+		if pgxscan.NotFound(err) {
+			return ErrInvalidRegistrationInvitation
+		}
+
+		return fmt.Errorf("error using registration invitation: %w", err)
+	}
+
+	return nil
+}
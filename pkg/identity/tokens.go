@@ -0,0 +1,32 @@
+package identity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+/*
+newSecureToken returns a random, URL safe token made from numBytes bytes
+of cryptographically secure randomness.
+*/
+func newSecureToken(numBytes int) (string, error) {
+	b := make([]byte, numBytes)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+hashToken returns the SHA-256 hash of a token as hex. Tokens are long and
+random, so a fast hash is enough, and it lets tokens be looked up directly.
+*/
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
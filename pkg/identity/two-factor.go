@@ -0,0 +1,497 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/totp"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeNumBytes = 10
+	recoveryCodeGroup    = 4
+)
+
+var (
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already on")
+	ErrTwoFactorNotFound       = errors.New("two-factor authentication not found")
+
+	recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+type TwoFactorServicer interface {
+	/*
+	   BeginTwoFactor starts setting up an authenticator app for a user and
+	   returns the secret to share with it. Starting again replaces a setup
+	   that wasn't confirmed. Returns ErrTwoFactorAlreadyEnabled when it is
+	   already on.
+	*/
+	BeginTwoFactor(userID int) (string, error)
+
+	/*
+	   ConfirmTwoFactor turns two-factor authentication on once the user
+	   enters a code from their app, and returns their recovery codes. The
+	   codes are only returned here. Returns ErrInvalidTwoFactorCode when
+	   the code is wrong.
+	*/
+	ConfirmTwoFactor(userID int, code string) ([]string, error)
+
+	/*
+	   DisableTwoFactor turns two-factor authentication off and deletes the
+	   user's recovery codes.
+	*/
+	DisableTwoFactor(userID int) error
+
+	/*
+	   GetTwoFactor returns a user's two-factor setup, enabled or not.
+	   Returns ErrTwoFactorNotFound when they haven't started one.
+	*/
+	GetTwoFactor(userID int) (*models.UserTwoFactor, error)
+
+	/*
+	   RegenerateRecoveryCodes replaces a user's recovery codes with new
+	   ones. Returns ErrTwoFactorNotFound when two-factor isn't on.
+	*/
+	RegenerateRecoveryCodes(userID int) ([]string, error)
+
+	/*
+	   VerifyTwoFactorCode checks a code from the user's app, or one of
+	   their recovery codes, and uses it up. Returns ErrInvalidTwoFactorCode
+	   when it doesn't match or has been used.
+	*/
+	VerifyTwoFactorCode(userID int, code string) error
+}
+
+type TwoFactorServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type TwoFactorService struct {
+	services.DbServiceBase
+}
+
+func NewTwoFactorService(config TwoFactorServiceConfig) TwoFactorService {
+	return TwoFactorService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+BeginTwoFactor starts setting up an authenticator app for a user and
+returns the secret to share with it.
+*/
+func (s TwoFactorService) BeginTwoFactor(userID int) (string, error) {
+	var (
+		err    error
+		secret string
+		result pgconn.CommandTag
+	)
+
+	if secret, err = totp.NewSecret(); err != nil {
+		return "", err
+	}
+
+	query := `
+INSERT INTO user_two_factor (
+	user_id
+	, secret
+	, created_at
+) VALUES (
+	$1
+	, $2
+	, $3
+)
+ON CONFLICT (user_id) DO UPDATE SET
+	secret = EXCLUDED.secret
+	, last_used_step = 0
+	, created_at = EXCLUDED.created_at
+WHERE user_two_factor.enabled_at IS NULL
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, userID, secret, time.Now().UTC()); err != nil {
+		return "", fmt.Errorf("error beginning two-factor setup: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return "", ErrTwoFactorAlreadyEnabled
+	}
+
+	return secret, nil
+}
+
+/*
+ConfirmTwoFactor turns two-factor authentication on once the user enters a
+code from their app, and returns their recovery codes.
+*/
+func (s TwoFactorService) ConfirmTwoFactor(userID int, code string) ([]string, error) {
+	var (
+		err           error
+		tx            pgx.Tx
+		secret        string
+		lastUsedStep  int64
+		recoveryCodes []string
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	query := `
+SELECT
+	secret
+	, last_used_step
+FROM user_two_factor
+WHERE user_id = $1
+	AND enabled_at IS NULL
+FOR UPDATE
+	`
+
+	if err = tx.QueryRow(ctx, query, userID).Scan(&secret, &lastUsedStep); err != nil {
+		if pgxscan.NotFound(err) {
+			err = ErrTwoFactorNotFound
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("error querying two-factor setup: %w", err)
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), lastUsedStep)
+
+	if !ok {
+		err = ErrInvalidTwoFactorCode
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	if _, err = tx.Exec(ctx, "UPDATE user_two_factor SET enabled_at=$1, last_used_step=$2 WHERE user_id=$3", now, step, userID); err != nil {
+		return nil, fmt.Errorf("error enabling two-factor: %w", err)
+	}
+
+	if recoveryCodes, err = replaceRecoveryCodes(ctx, tx, userID, now); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing two-factor setup: %w", err)
+	}
+
+	return recoveryCodes, nil
+}
+
+/*
+DisableTwoFactor turns two-factor authentication off and deletes the user's
+recovery codes.
+*/
+func (s TwoFactorService) DisableTwoFactor(userID int) error {
+	var (
+		err error
+		tx  pgx.Tx
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id=$1", userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM user_two_factor WHERE user_id=$1", userID); err != nil {
+		return fmt.Errorf("error disabling two-factor: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing two-factor removal: %w", err)
+	}
+
+	return nil
+}
+
+/*
+GetTwoFactor returns a user's two-factor setup, enabled or not, with how
+many recovery codes they have left.
+*/
+func (s TwoFactorService) GetTwoFactor(userID int) (*models.UserTwoFactor, error) {
+	var (
+		err    error
+		result models.UserTwoFactor
+	)
+
+	query := `
+SELECT
+	t.user_id
+	, t.secret
+	, t.last_used_step
+	, t.created_at
+	, t.enabled_at
+	, (
+		SELECT COUNT(*)
+		FROM user_recovery_codes AS c
+		WHERE c.user_id = t.user_id
+			AND c.used_at IS NULL
+	) AS remaining_recovery_codes
+FROM user_two_factor AS t
+WHERE t.user_id = $1
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Get(ctx, s.DB, &result, query, userID); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, ErrTwoFactorNotFound
+		}
+
+		return nil, fmt.Errorf("error querying two-factor setup: %w", err)
+	}
+
+	return &result, nil
+}
+
+/*
+RegenerateRecoveryCodes replaces a user's recovery codes with new ones. The
+old codes stop working.
+*/
+func (s TwoFactorService) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	var (
+		err           error
+		tx            pgx.Tx
+		enabled       bool
+		recoveryCodes []string
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if err = tx.QueryRow(ctx, "SELECT enabled_at IS NOT NULL FROM user_two_factor WHERE user_id=$1 FOR UPDATE", userID).Scan(&enabled); err != nil {
+		if pgxscan.NotFound(err) {
+			err = ErrTwoFactorNotFound
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("error querying two-factor setup: %w", err)
+	}
+
+	if !enabled {
+		err = ErrTwoFactorNotFound
+		return nil, err
+	}
+
+	if recoveryCodes, err = replaceRecoveryCodes(ctx, tx, userID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing recovery codes: %w", err)
+	}
+
+	return recoveryCodes, nil
+}
+
+/*
+VerifyTwoFactorCode checks a code from the user's app, or one of their
+recovery codes, and uses it up. An app code's time step is recorded, so the
+same code can't be used again while it is still showing.
+*/
+func (s TwoFactorService) VerifyTwoFactorCode(userID int, code string) error {
+	var (
+		err          error
+		secret       string
+		lastUsedStep int64
+		result       pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	query := `
+SELECT
+	secret
+	, last_used_step
+FROM user_two_factor
+WHERE user_id = $1
+	AND enabled_at IS NOT NULL
+	`
+
+	if err = s.DB.QueryRow(ctx, query, userID).Scan(&secret, &lastUsedStep); err != nil {
+		if pgxscan.NotFound(err) {
+			return ErrTwoFactorNotFound
+		}
+
+		return fmt.Errorf("error querying two-factor setup: %w", err)
+	}
+
+	/*
+	 * App codes are often typed in two groups, like "123 456". Without
+	 * the spaces they are still app codes, not recovery codes.
+	 */
+	code = strings.Join(strings.Fields(code), "")
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(secret, code, time.Now(), lastUsedStep)
+
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+
+		/*
+		 * Only move last_used_step forward, so two requests racing with the
+		 * same code can't both succeed.
+		 */
+		if result, err = s.DB.Exec(ctx, "UPDATE user_two_factor SET last_used_step=$1 WHERE user_id=$2 AND last_used_step < $1", step, userID); err != nil {
+			return fmt.Errorf("error recording two-factor code: %w", err)
+		}
+
+		if result.RowsAffected() == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	query = `
+UPDATE user_recovery_codes SET
+	used_at = $1
+WHERE 1=1
+	AND user_id = $2
+	AND code_hash = $3
+	AND used_at IS NULL
+	`
+
+	if result, err = s.DB.Exec(ctx, query, time.Now().UTC(), userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+		return fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+/*
+replaceRecoveryCodes deletes a user's recovery codes and creates new ones.
+Only hashes are stored. The codes are long and random, so a fast hash is
+enough, just like tokens.
+*/
+func replaceRecoveryCodes(ctx context.Context, q services.Querier, userID int, createdAt time.Time) ([]string, error) {
+	var (
+		err  error
+		code string
+	)
+
+	if _, err = q.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id=$1", userID); err != nil {
+		return nil, fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	query := `
+INSERT INTO user_recovery_codes (
+	user_id
+	, code_hash
+	, created_at
+) VALUES (
+	$1
+	, $2
+	, $3
+)
+	`
+
+	result := make([]string, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		if code, err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+
+		if _, err = q.Exec(ctx, query, userID, hashToken(normalizeRecoveryCode(code)), createdAt); err != nil {
+			return nil, fmt.Errorf("error creating recovery code: %w", err)
+		}
+
+		result = append(result, code)
+	}
+
+	return result, nil
+}
+
+/*
+newRecoveryCode returns a random code, lowercase and split into groups so
+it is easy to write down, like "abcd-efgh-ijkl-mnop".
+*/
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeNumBytes)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating recovery code: %w", err)
+	}
+
+	encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+	groups := []string{}
+
+	for i := 0; i < len(encoded); i += recoveryCodeGroup {
+		groups = append(groups, encoded[i:min(i+recoveryCodeGroup, len(encoded))])
+	}
+
+	return strings.Join(groups, "-"), nil
+}
+
+/*
+normalizeRecoveryCode ignores case, spaces, and dashes, so a code can be
+typed however it was written down.
+*/
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, code)
+}
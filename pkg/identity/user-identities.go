@@ -0,0 +1,231 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrUserIdentityInUse    = errors.New("that identity is linked to another user")
+	ErrUserIdentityNotFound = errors.New("user identity not found")
+)
+
+type UserIdentityServicer interface {
+	/*
+	   GetUserByIdentity retrieves the active user an identity at a sign in
+	   provider is linked to. Returns ErrUserNotFound when it isn't linked.
+	*/
+	GetUserByIdentity(issuer, subject string) (*models.User, error)
+
+	/*
+	   GetUserIdentities returns the identities linked to a user, oldest
+	   first.
+	*/
+	GetUserIdentities(userID int) ([]models.UserIdentity, error)
+
+	/*
+	   LinkUserIdentity lets a user sign in with an identity at a provider.
+	   Returns ErrUserIdentityInUse when it is already linked to someone
+	   else.
+	*/
+	LinkUserIdentity(request models.LinkUserIdentityRequest) error
+
+	/*
+	   UnlinkUserIdentity stops a user signing in with one of their
+	   identities. Returns ErrUserIdentityNotFound when it isn't theirs.
+	*/
+	UnlinkUserIdentity(userID, identityID int) error
+}
+
+type UserIdentityServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type UserIdentityService struct {
+	services.DbServiceBase
+}
+
+func NewUserIdentityService(config UserIdentityServiceConfig) UserIdentityService {
+	return UserIdentityService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+GetUserByIdentity retrieves the active user an identity at a sign in
+provider is linked to.
+*/
+func (s UserIdentityService) GetUserByIdentity(issuer, subject string) (*models.User, error) {
+	var (
+		err    error
+		result models.UserQueryResult
+	)
+
+	query := `
+SELECT
+	u.id
+	, u.created_at
+	, u.active
+	, u.email
+	, u.password
+	, u.auth_token
+	, a.id AS account_id
+	, a.owner AS account_owner
+	, a.join_token
+FROM user_identities AS i
+	INNER JOIN users AS u ON u.id = i.user_id
+	LEFT JOIN accounts AS a ON u.account_id = a.id
+WHERE 1=1
+	AND i.issuer = $1
+	AND i.subject = $2
+	AND u.active = true
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Get(ctx, s.DB, &result, query, issuer, subject); err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf("error querying user by identity: %w", err)
+	}
+
+	user := &models.User{
+		ID:        models.ID{ID: result.ID},
+		Created:   models.Created{CreatedAt: result.CreatedAt},
+		Active:    result.Active,
+		Email:     result.Email,
+		Password:  result.Password,
+		AuthToken: result.AuthToken,
+		Account:   nil,
+	}
+
+	if result.AccountID != nil && result.AccountOwner != nil {
+		user.Account = &models.Account{
+			ID:    models.ID{ID: *result.AccountID},
+			Owner: *result.AccountOwner,
+		}
+
+		if result.AccountJoinToken != nil {
+			user.Account.JoinToken = *result.AccountJoinToken
+		}
+	}
+
+	return user, nil
+}
+
+/*
+GetUserIdentities returns the identities linked to a user, oldest first.
+*/
+func (s UserIdentityService) GetUserIdentities(userID int) ([]models.UserIdentity, error) {
+	var (
+		err     error
+		results = []models.UserIdentity{}
+	)
+
+	query := `
+SELECT
+	i.id
+	, i.user_id
+	, i.issuer
+	, i.subject
+	, i.email
+	, i.created_at
+FROM user_identities AS i
+WHERE i.user_id = $1
+ORDER BY i.created_at, i.id
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, userID); err != nil {
+		return results, fmt.Errorf("error fetching user identities: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+LinkUserIdentity lets a user sign in with an identity at a provider.
+Linking one that is already theirs does nothing.
+*/
+func (s UserIdentityService) LinkUserIdentity(request models.LinkUserIdentityRequest) error {
+	var (
+		err     error
+		result  pgconn.CommandTag
+		ownerID int
+	)
+
+	query := `
+INSERT INTO user_identities (
+	user_id
+	, issuer
+	, subject
+	, email
+	, created_at
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+	, $5
+)
+ON CONFLICT (issuer, subject) DO NOTHING
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, request.UserID, request.Issuer, request.Subject, request.Email, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error linking user identity: %w", err)
+	}
+
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	if err = s.DB.QueryRow(ctx, "SELECT user_id FROM user_identities WHERE issuer=$1 AND subject=$2", request.Issuer, request.Subject).Scan(&ownerID); err != nil {
+		return fmt.Errorf("error checking linked user identity: %w", err)
+	}
+
+	if ownerID != request.UserID {
+		return ErrUserIdentityInUse
+	}
+
+	return nil
+}
+
+/*
+UnlinkUserIdentity stops a user signing in with one of their identities.
+*/
+func (s UserIdentityService) UnlinkUserIdentity(userID, identityID int) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, "DELETE FROM user_identities WHERE id=$1 AND user_id=$2", identityID, userID); err != nil {
+		return fmt.Errorf("error unlinking user identity: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrUserIdentityNotFound
+	}
+
+	return nil
+}
@@ -3,7 +3,8 @@ package identity
 type UserQueryOption func(uqo *UserQueryOptions)
 
 type UserQueryOptions struct {
-	OnlyActive bool
+	OnlyActive      bool
+	MemberOfAccount int
 }
 
 func WithOnlyActiveUsers(onlyActive bool) UserQueryOption {
@@ -11,3 +12,13 @@ func WithOnlyActiveUsers(onlyActive bool) UserQueryOption {
 		uqo.OnlyActive = onlyActive
 	}
 }
+
+/*
+WithMembershipInAccount only finds the user when they belong to the given
+account.
+*/
+func WithMembershipInAccount(accountID int) UserQueryOption {
+	return func(uqo *UserQueryOptions) {
+		uqo.MemberOfAccount = accountID
+	}
+}
@@ -1,7 +1,21 @@
 package identity
 
+import "github.com/adampresley/streaming-tracker/pkg/models"
+
 type UserSession struct {
 	UserID    int
 	Email     string
 	AccountID int
+
+	/*
+	   AuthToken is the user's auth token when the session was created. It
+	   changes when the password does, which ends every older session.
+	*/
+	AuthToken string
+
+	/*
+	   Role is what the user may do in AccountID. It is looked up on every
+	   request, so a change made by the owner applies right away.
+	*/
+	Role models.AccountRole
 }
@@ -0,0 +1,368 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	userTokenNumBytes = 32
+)
+
+var (
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+)
+
+type UserTokenServicer interface {
+	/*
+	   CreateUserToken creates a single use token that lets a user do one thing,
+	   such as reset their password, until it expires. Any earlier unused
+	   tokens the user has for the same purpose stop working. The token itself
+	   is only returned here.
+	*/
+	CreateUserToken(userID int, purpose string, lifetime time.Duration) (string, error)
+
+	/*
+	   CreateChallengeToken creates a single use token that doesn't belong to
+	   a user yet, such as the challenge for a passkey log in. It works until
+	   it expires or DeleteChallengeToken is called.
+	*/
+	CreateChallengeToken(purpose string, lifetime time.Duration) (string, error)
+
+	/*
+	   DeleteChallengeToken deletes a token made by CreateChallengeToken, so
+	   it can't be used again. Returns ErrInvalidUserToken when it is expired
+	   or doesn't exist.
+	*/
+	DeleteChallengeToken(token, purpose string) error
+
+	/*
+	   GetUserToken returns an unused, unexpired token without using it up.
+	   Anything else returns ErrInvalidUserToken.
+	*/
+	GetUserToken(token, purpose string) (*models.UserToken, error)
+
+	/*
+	   ConsumeUserToken uses up a token and returns the ID of the user it
+	   belongs to. Returns ErrInvalidUserToken when it is used, expired, or
+	   doesn't exist.
+	*/
+	ConsumeUserToken(token, purpose string) (int, error)
+
+	/*
+	   FailUserToken records a wrong answer given with a token. Once
+	   maxAttempts have been recorded the token stops working.
+	*/
+	FailUserToken(token, purpose string, maxAttempts int) error
+}
+
+type UserTokenServiceConfig struct {
+	services.DbServiceBaseConfig
+}
+
+type UserTokenService struct {
+	services.DbServiceBase
+}
+
+func NewUserTokenService(config UserTokenServiceConfig) UserTokenService {
+	return UserTokenService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+	}
+}
+
+/*
+CreateUserToken creates a single use token that lets a user do one thing,
+such as reset their password, until it expires. Any earlier unused tokens
+the user has for the same purpose stop working, so only the newest email
+works. Only a hash of the token is stored.
+*/
+func (s UserTokenService) CreateUserToken(userID int, purpose string, lifetime time.Duration) (string, error) {
+	var (
+		err   error
+		token string
+		tx    pgx.Tx
+	)
+
+	if token, err = newSecureToken(userTokenNumBytes); err != nil {
+		return "", err
+	}
+
+	createdAt := time.Now().UTC()
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	expireQuery := `
+UPDATE user_tokens SET
+	expires_at = $1
+WHERE user_id = $2
+	AND purpose = $3
+	AND used_at IS NULL
+	AND expires_at > $1
+	`
+
+	if _, err = tx.Exec(ctx, expireQuery, createdAt, userID, purpose); err != nil {
+		return "", fmt.Errorf("error expiring earlier user tokens: %w", err)
+	}
+
+	insertQuery := `
+INSERT INTO user_tokens (
+	user_id
+	, purpose
+	, token_hash
+	, created_at
+	, expires_at
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+	, $5
+)
+	`
+
+	args := []any{
+		userID,
+		purpose,
+		hashToken(token),
+		createdAt,
+		createdAt.Add(lifetime),
+	}
+
+	if _, err = tx.Exec(ctx, insertQuery, args...); err != nil {
+		return "", fmt.Errorf("error creating user token: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("error committing user token: %w", err)
+	}
+
+	return token, nil
+}
+
+/*
+CreateChallengeToken creates a single use token that doesn't belong to a
+user yet, such as the challenge for a passkey log in. Tokens are base64url
+encoded, so they can be used as a challenge as is. Expired challenges for
+the same purpose are cleared out first. Only a hash of the token is stored.
+*/
+func (s UserTokenService) CreateChallengeToken(purpose string, lifetime time.Duration) (string, error) {
+	var (
+		err   error
+		token string
+	)
+
+	if token, err = newSecureToken(userTokenNumBytes); err != nil {
+		return "", err
+	}
+
+	createdAt := time.Now().UTC()
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, "DELETE FROM user_tokens WHERE user_id IS NULL AND purpose=$1 AND expires_at <= $2", purpose, createdAt); err != nil {
+		return "", fmt.Errorf("error deleting expired challenge tokens: %w", err)
+	}
+
+	query := `
+INSERT INTO user_tokens (
+	purpose
+	, token_hash
+	, created_at
+	, expires_at
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+)
+	`
+
+	if _, err = s.DB.Exec(ctx, query, purpose, hashToken(token), createdAt, createdAt.Add(lifetime)); err != nil {
+		return "", fmt.Errorf("error creating challenge token: %w", err)
+	}
+
+	return token, nil
+}
+
+/*
+DeleteChallengeToken deletes a token made by CreateChallengeToken. Checking
+it and deleting it is one statement, so two requests racing with the same
+challenge can't both succeed.
+*/
+func (s UserTokenService) DeleteChallengeToken(token, purpose string) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	query := `
+DELETE FROM user_tokens
+WHERE 1=1
+	AND token_hash = $1
+	AND purpose = $2
+	AND user_id IS NULL
+	AND expires_at > $3
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, hashToken(token), purpose, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error deleting challenge token: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrInvalidUserToken
+	}
+
+	return nil
+}
+
+/*
+GetUserToken returns an unused, unexpired token without using it up, so a
+page can check a link is still good before asking for anything. Tokens
+belonging to inactive users are treated as invalid.
+*/
+func (s UserTokenService) GetUserToken(token, purpose string) (*models.UserToken, error) {
+	var (
+		err     error
+		results []models.UserToken
+	)
+
+	query := `
+SELECT
+	t.id
+	, t.user_id
+	, u.email AS user_email
+	, t.purpose
+	, t.created_at
+	, t.expires_at
+	, t.used_at
+FROM user_tokens AS t
+	INNER JOIN users AS u ON u.id = t.user_id
+WHERE 1=1
+	AND t.token_hash = $1
+	AND t.purpose = $2
+	AND t.used_at IS NULL
+	AND t.expires_at > $3
+	AND u.active = true
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &results, query, hashToken(token), purpose, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("error querying user token: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrInvalidUserToken
+	}
+
+	return &results[0], nil
+}
+
+/*
+ConsumeUserToken uses up a token and returns the ID of the user it belongs
+to.
+*/
+func (s UserTokenService) ConsumeUserToken(token, purpose string) (int, error) {
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	return consumeUserToken(ctx, s.DB, token, purpose)
+}
+
+/*
+FailUserToken records a wrong answer given with a token, such as a wrong
+code in the second step of a log in. The token expires when it reaches
+maxAttempts, so it can't be used to guess codes forever.
+*/
+func (s UserTokenService) FailUserToken(token, purpose string, maxAttempts int) error {
+	var (
+		err error
+	)
+
+	now := time.Now().UTC()
+
+	query := `
+UPDATE user_tokens SET
+	failed_attempts = failed_attempts + 1
+	, expires_at = CASE WHEN failed_attempts + 1 >= $1 THEN $2 ELSE expires_at END
+WHERE 1=1
+	AND token_hash = $3
+	AND purpose = $4
+	AND used_at IS NULL
+	AND expires_at > $2
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, query, maxAttempts, now, hashToken(token), purpose); err != nil {
+		return fmt.Errorf("error recording failed user token attempt: %w", err)
+	}
+
+	return nil
+}
+
+/*
+consumeUserToken marks a token as used and returns the ID of the user it
+belongs to. Marking it used and checking it is one statement, so two
+requests racing with the same token can't both succeed.
+*/
+func consumeUserToken(ctx context.Context, q services.Querier, token, purpose string) (int, error) {
+	var (
+		err    error
+		userID int
+	)
+
+	now := time.Now().UTC()
+
+	query := `
+UPDATE user_tokens AS t SET
+	used_at = $1
+FROM users AS u
+WHERE 1=1
+	AND u.id = t.user_id
+	AND t.token_hash = $2
+	AND t.purpose = $3
+	AND t.used_at IS NULL
+	AND t.expires_at > $1
+	AND u.active = true
+RETURNING t.user_id
+	`
+
+	if err = q.QueryRow(ctx, query, now, hashToken(token), purpose).Scan(&userID); err != nil {
+		if pgxscan.NotFound(err) {
+			return 0, ErrInvalidUserToken
+		}
+
+		return 0, fmt.Errorf("error using user token: %w", err)
+	}
+
+	return userID, nil
+}
@@ -1,6 +1,7 @@
 package identity
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -9,10 +10,18 @@ import (
 	"github.com/adampresley/streaming-tracker/pkg/models"
 	"github.com/adampresley/streaming-tracker/pkg/services"
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	/*
+	   MinPasswordLength is the fewest characters a password can have.
+	*/
+	MinPasswordLength = 5
+)
+
 var (
 	ErrUserNotFound           = errors.New("user not found")
 	ErrUserAlreadyExists      = errors.New("user already exists")
@@ -27,13 +36,33 @@ type UserServicer interface {
 	ActivateUser(activationCode string) error
 
 	/*
-	   Associates a user with an account.
+	   ActivateUserByEmail marks a user as active without needing their
+	   activation code. This is meant for administrators helping someone whose
+	   activation email never arrived.
+	*/
+	ActivateUserByEmail(email string) error
+
+	/*
+	   Associates a user with an account, making it the one they are using
+	   and adding them as a member. Returns ErrAlreadyAccountMember if they
+	   already belong to it.
 	*/
 	AddUserToAccount(userID, accountID int) error
 
+	/*
+	   CancelEmailChange forgets a requested email change that hasn't been
+	   verified yet.
+	*/
+	CancelEmailChange(userID int) error
+
 	/*
 	   CreateUser creates a new user account. The user is not automatically
-	   associated with an account, and it is initially inactive.
+	   associated with an account, and it is initially inactive. When the
+	   request has an invitation code it is used up, and
+	   ErrInvalidRegistrationInvitation is returned if it can't be. An
+	   account invitation code joins the user to that account, or returns
+	   ErrInvalidAccountInvitation, or ErrAccountInvitationEmail when it
+	   was sent to a different email address.
 	*/
 	CreateUser(user models.CreateUserRequest) (*models.User, error)
 
@@ -51,6 +80,26 @@ type UserServicer interface {
 	   GetUserByIdAndAuthToken retrieves an active user account by their user ID and auth token.
 	*/
 	GetUserByIdAndAuthToken(id int, authToken string, options ...UserQueryOption) (*models.User, error)
+
+	/*
+	   RequestEmailChange records a new email address for a user and returns
+	   the activation code that must be given to ActivateUser to switch to it.
+	   Returns ErrUserAlreadyExists when another user has the address.
+	*/
+	RequestEmailChange(userID int, newEmail string) (string, error)
+
+	/*
+	   ResetPassword uses up a password reset token and sets the user's new
+	   password. It returns the ID of the user whose password was reset, or
+	   ErrInvalidUserToken when the token is unknown, used, or expired.
+	*/
+	ResetPassword(token, password string) (int, error)
+
+	/*
+	   UpdatePassword sets a new password for a user and returns their new auth
+	   token. Rotating the auth token signs them out everywhere else.
+	*/
+	UpdatePassword(userID int, password string) (string, error)
 }
 
 type UserServiceConfig struct {
@@ -73,6 +122,9 @@ func NewUserService(config UserServiceConfig) UserService {
 /*
 Attempts to activate a user account using an activation code.
 Calling this will mark the user as active and removes the activation code.
+When the user has asked to change their email address, the new address
+replaces the old one. If someone else has taken the new address in the
+meantime, ErrUserAlreadyExists is returned.
 */
 func (s UserService) ActivateUser(activationCode string) error {
 	var (
@@ -80,27 +132,97 @@ func (s UserService) ActivateUser(activationCode string) error {
 		result pgconn.CommandTag
 	)
 
-	query := `UPDATE users SET active=true, activation_code=NULL WHERE activation_code=$1`
+	query := `
+UPDATE users SET
+	active=true
+	, activation_code=NULL
+	, email=COALESCE(pending_email, email)
+	, pending_email=NULL
+WHERE activation_code=$1
+	`
+
 	args := []any{activationCode}
 
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	result, err = s.DB.Exec(ctx, query, args...)
+	if result, err = s.DB.Exec(ctx, query, args...); err != nil {
+		if s.IsDuplicateRecordError(err) {
+			return ErrUserAlreadyExists
+		}
+
+		return fmt.Errorf("error activating user: %w", err)
+	}
 
 	if result.RowsAffected() == 0 {
 		return ErrActivationCodeNotFound
 	}
 
-	return err
+	return nil
+}
+
+/*
+CancelEmailChange forgets a requested email change that hasn't been verified
+yet. The old activation code stops working.
+*/
+func (s UserService) CancelEmailChange(userID int) error {
+	var (
+		err error
+	)
+
+	query := `
+UPDATE users SET
+	pending_email=NULL
+	, activation_code=NULL
+WHERE id=$1
+	AND pending_email IS NOT NULL
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if _, err = s.DB.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("error cancelling email change: %w", err)
+	}
+
+	return nil
 }
 
 /*
-Associates a user with an account.
+ActivateUserByEmail marks a user as active without needing their activation
+code. This is meant for administrators helping someone whose activation
+email never arrived. Users that are already active are left alone.
+*/
+func (s UserService) ActivateUserByEmail(email string) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	query := `UPDATE users SET active=true, activation_code=NULL WHERE email=$1`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if result, err = s.DB.Exec(ctx, query, email); err != nil {
+		return fmt.Errorf("error activating user by email: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+/*
+Associates a user with an account, making it the one they are using and
+adding them as a member.
 */
 func (s UserService) AddUserToAccount(userID, accountID int) error {
 	var (
 		err error
+		tx  pgx.Tx
 	)
 
 	query := `
@@ -114,22 +236,46 @@ WHERE id=$2
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	if _, err = s.DB.Exec(ctx, query, args...); err != nil {
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
 		return fmt.Errorf("error updating user account: %w", err)
 	}
 
+	if err = addAccountMembership(ctx, tx, userID, accountID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing user account: %w", err)
+	}
+
 	return nil
 }
 
 /*
 CreateUser creates a new user account. The user is not automatically
-associated with an account, and it is initially inactive.
+associated with an account, and it is initially inactive. Invitation codes
+in the request are used up in the same transaction, so a bad code creates
+nothing. An account invitation is the exception to the rule above: the
+user joins that account right away.
 */
 func (s UserService) CreateUser(user models.CreateUserRequest) (*models.User, error) {
 	var (
 		err           error
 		passwordBytes []byte
 		newUserID     int64
+		tx            pgx.Tx
+		accountID     int
+		account       *models.Account
 	)
 
 	query := `
@@ -173,7 +319,17 @@ RETURNING id
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	if err = s.DB.QueryRow(ctx, query, args...).Scan(&newUserID); err != nil {
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if err = tx.QueryRow(ctx, query, args...).Scan(&newUserID); err != nil {
 		if s.IsDuplicateRecordError(err) {
 			return nil, ErrUserAlreadyExists
 		}
@@ -181,6 +337,32 @@ RETURNING id
 		return nil, fmt.Errorf("error creating user: %w", err)
 	}
 
+	if user.InvitationCode != "" {
+		if err = consumeRegistrationInvitation(ctx, tx, user.InvitationCode, int(newUserID)); err != nil {
+			return nil, err
+		}
+	}
+
+	if user.AccountInvitationCode != "" {
+		if accountID, err = consumeAccountInvitation(ctx, tx, user.AccountInvitationCode, int(newUserID)); err != nil {
+			return nil, err
+		}
+
+		if _, err = tx.Exec(ctx, "UPDATE users SET account_id=$1 WHERE id=$2", accountID, newUserID); err != nil {
+			return nil, fmt.Errorf("error adding user to invited account: %w", err)
+		}
+
+		if err = addAccountMembership(ctx, tx, int(newUserID), accountID); err != nil {
+			return nil, err
+		}
+
+		account = &models.Account{ID: models.ID{ID: accountID}}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing user: %w", err)
+	}
+
 	newUser := &models.User{
 		ID:             models.ID{ID: int(newUserID)},
 		Created:        models.Created{CreatedAt: createdAt},
@@ -189,7 +371,7 @@ RETURNING id
 		Password:       "",
 		AuthToken:      authToken,
 		ActivationCode: activationCode,
-		Account:        nil,
+		Account:        account,
 	}
 
 	return newUser, nil
@@ -216,7 +398,7 @@ SELECT
 	, a.owner as account_owner
 	, a.join_token
 FROM users u
-	LEFT JOIN accounts a ON u.id = a.owner
+	LEFT JOIN accounts a ON u.account_id = a.id
 WHERE 1=1
 	AND u.email = $1 
 `
@@ -234,13 +416,20 @@ WHERE 1=1
 		query += " AND u.active = true "
 	}
 
+	args := []any{email}
+
+	if opts.MemberOfAccount > 0 {
+		args = append(args, opts.MemberOfAccount)
+		query += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM account_memberships AS m WHERE m.user_id = u.id AND m.account_id = $%d) ", len(args))
+	}
+
 	/*
 	 * Run the query
 	 */
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	if err = pgxscan.Select(ctx, s.DB, &results, query, email); err != nil {
+	if err = pgxscan.Select(ctx, s.DB, &results, query, args...); err != nil {
 		if pgxscan.NotFound(err) {
 			return nil, ErrUserNotFound
 		}
@@ -295,10 +484,11 @@ SELECT
 	u.email,
 	u.password,
 	u.auth_token,
+	u.pending_email,
 	a.id as account_id,
 	a.owner as account_owner
 FROM users u
-LEFT JOIN accounts a ON u.id = a.owner
+LEFT JOIN accounts a ON u.account_id = a.id
 WHERE 1=1
 	AND u.id=$1
 	AND u.auth_token=$2
@@ -319,6 +509,11 @@ WHERE 1=1
 
 	args := []any{id, authToken}
 
+	if opts.MemberOfAccount > 0 {
+		args = append(args, opts.MemberOfAccount)
+		query += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM account_memberships AS m WHERE m.user_id = u.id AND m.account_id = $%d) ", len(args))
+	}
+
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
@@ -346,6 +541,10 @@ WHERE 1=1
 		Account:   nil,
 	}
 
+	if result.PendingEmail != nil {
+		user.PendingEmail = *result.PendingEmail
+	}
+
 	if result.AccountID != nil && result.AccountOwner != nil {
 		user.Account = &models.Account{
 			ID:    models.ID{ID: *result.AccountID},
@@ -423,3 +622,139 @@ WHERE u.activation_code = $1
 
 	return user, nil
 }
+
+/*
+RequestEmailChange records a new email address for a user and returns the
+activation code that must be given to ActivateUser to switch to it. The
+user keeps logging in with their old address until then. Asking again
+replaces the earlier request.
+*/
+func (s UserService) RequestEmailChange(userID int, newEmail string) (string, error) {
+	var (
+		err    error
+		taken  bool
+		result pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email=$1 AND id<>$2)`, newEmail, userID).Scan(&taken); err != nil {
+		return "", fmt.Errorf("error checking for existing email address: %w", err)
+	}
+
+	if taken {
+		return "", ErrUserAlreadyExists
+	}
+
+	activationCode := random.String(6)
+
+	query := `
+UPDATE users SET
+	pending_email=$1
+	, activation_code=$2
+WHERE id=$3
+	AND active=true
+	`
+
+	if result, err = s.DB.Exec(ctx, query, newEmail, activationCode, userID); err != nil {
+		return "", fmt.Errorf("error requesting email change: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return "", ErrUserNotFound
+	}
+
+	return activationCode, nil
+}
+
+/*
+ResetPassword uses up a password reset token and sets the user's new
+password in one transaction. The auth token is rotated too, which signs the
+user out everywhere. Returns ErrInvalidUserToken when the token is unknown,
+used, or expired.
+*/
+func (s UserService) ResetPassword(token, password string) (int, error) {
+	var (
+		err    error
+		userID int
+		tx     pgx.Tx
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	defer func() {
+		if err != nil && tx != nil {
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if tx, err = s.DB.Begin(ctx); err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if userID, err = consumeUserToken(ctx, tx, token, models.UserTokenPurposePasswordReset); err != nil {
+		return 0, err
+	}
+
+	if _, err = updatePassword(ctx, tx, userID, password); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing password reset: %w", err)
+	}
+
+	return userID, nil
+}
+
+/*
+UpdatePassword sets a new password for a user and returns their new auth
+token. Sessions hold the auth token, so rotating it signs the user out
+everywhere. Callers that want to keep the current session should save the
+new token in it.
+*/
+func (s UserService) UpdatePassword(userID int, password string) (string, error) {
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	return updatePassword(ctx, s.DB, userID, password)
+}
+
+func updatePassword(ctx context.Context, q services.Querier, userID int, password string) (string, error) {
+	var (
+		err           error
+		passwordBytes []byte
+		result        pgconn.CommandTag
+	)
+
+	if passwordBytes, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+
+	query := `
+UPDATE users SET
+	password=$1
+	, auth_token=$2
+WHERE id=$3
+	`
+
+	authToken := random.String(20)
+
+	args := []any{
+		string(passwordBytes),
+		authToken,
+		userID,
+	}
+
+	if result, err = q.Exec(ctx, query, args...); err != nil {
+		return "", fmt.Errorf("error updating password: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return "", ErrUserNotFound
+	}
+
+	return authToken, nil
+}
@@ -0,0 +1,206 @@
+package imports
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+const (
+	NotMapped int = -1
+)
+
+/*
+CSVColumnMapping holds the zero-based column index for each show field.
+Fields that don't appear in the file are set to NotMapped.
+*/
+type CSVColumnMapping struct {
+	ShowName      int
+	Platform      int
+	Status        int
+	CurrentSeason int
+	TotalSeasons  int
+	Watchers      int
+}
+
+var (
+	showNameHeaders      = []string{"show", "show name", "name", "title", "series", "tv show"}
+	platformHeaders      = []string{"platform", "service", "streaming service", "network", "where"}
+	statusHeaders        = []string{"status", "watch status", "state"}
+	currentSeasonHeaders = []string{"current season", "season", "on season", "last season"}
+	totalSeasonsHeaders  = []string{"total seasons", "seasons", "num seasons", "number of seasons"}
+	watchersHeaders      = []string{"watchers", "watcher", "who", "people", "watched by"}
+)
+
+/*
+ReadCSV reads every record from a CSV file. Rows may have differing
+numbers of columns, and a leading byte order mark is ignored.
+*/
+func ReadCSV(r io.Reader) ([][]string, error) {
+	var (
+		err     error
+		records [][]string
+	)
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	if records, err = reader.ReadAll(); err != nil {
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+
+	return records, nil
+}
+
+/*
+GuessCSVColumnMapping matches header names to show fields. Columns
+that can't be matched are set to NotMapped.
+*/
+func GuessCSVColumnMapping(headers []string) CSVColumnMapping {
+	result := CSVColumnMapping{
+		ShowName:      NotMapped,
+		Platform:      NotMapped,
+		Status:        NotMapped,
+		CurrentSeason: NotMapped,
+		TotalSeasons:  NotMapped,
+		Watchers:      NotMapped,
+	}
+
+	for index, header := range headers {
+		normalized := normalizeHeader(header)
+
+		switch {
+		case result.ShowName == NotMapped && slices.Contains(showNameHeaders, normalized):
+			result.ShowName = index
+
+		case result.Platform == NotMapped && slices.Contains(platformHeaders, normalized):
+			result.Platform = index
+
+		case result.Status == NotMapped && slices.Contains(statusHeaders, normalized):
+			result.Status = index
+
+		case result.CurrentSeason == NotMapped && slices.Contains(currentSeasonHeaders, normalized):
+			result.CurrentSeason = index
+
+		case result.TotalSeasons == NotMapped && slices.Contains(totalSeasonsHeaders, normalized):
+			result.TotalSeasons = index
+
+		case result.Watchers == NotMapped && slices.Contains(watchersHeaders, normalized):
+			result.Watchers = index
+		}
+	}
+
+	return result
+}
+
+/*
+RowsFromCSV converts CSV records into import rows using the provided
+column mapping. When hasHeader is true the first record is skipped.
+Blank lines are ignored. Row numbers match the line in the file.
+*/
+func RowsFromCSV(records [][]string, mapping CSVColumnMapping, hasHeader bool) []models.ImportRow {
+	result := []models.ImportRow{}
+
+	for index, record := range records {
+		if hasHeader && index == 0 {
+			continue
+		}
+
+		if isBlankRecord(record) {
+			continue
+		}
+
+		row := models.ImportRow{
+			RowNumber:    index + 1,
+			ShowName:     cell(record, mapping.ShowName),
+			PlatformName: cell(record, mapping.Platform),
+			Status:       cell(record, mapping.Status),
+			WatcherNames: SplitWatcherNames(cell(record, mapping.Watchers)),
+			Problems:     []string{},
+		}
+
+		row.CurrentSeason = numericCell(&row, record, mapping.CurrentSeason, "current season")
+		row.TotalSeasons = numericCell(&row, record, mapping.TotalSeasons, "total seasons")
+
+		result = append(result, row)
+	}
+
+	return result
+}
+
+/*
+SplitWatcherNames splits a list of watcher names separated by commas,
+semicolons, or pipes.
+*/
+func SplitWatcherNames(value string) []string {
+	result := []string{}
+
+	names := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|'
+	})
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+func cell(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[index])
+}
+
+func numericCell(row *models.ImportRow, record []string, index int, fieldName string) int {
+	var (
+		err   error
+		value int
+	)
+
+	raw := cell(record, index)
+
+	if raw == "" {
+		return 0
+	}
+
+	if value, err = strconv.Atoi(raw); err != nil || value < 0 {
+		row.Problems = append(row.Problems, fmt.Sprintf("'%s' is not a valid %s", raw, fieldName))
+		return 0
+	}
+
+	return value
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func normalizeHeader(header string) string {
+	result := strings.ToLower(strings.TrimSpace(header))
+	result = strings.ReplaceAll(result, "_", " ")
+	result = strings.ReplaceAll(result, "-", " ")
+	return strings.Join(strings.Fields(result), " ")
+}
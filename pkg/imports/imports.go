@@ -0,0 +1,634 @@
+package imports
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/querymodels"
+	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/shows"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
+	"github.com/alitto/pond/v2"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+var (
+	ErrNothingToImport = fmt.Errorf("there is nothing to import")
+	ErrPlanHasErrors   = fmt.Errorf("the import has rows with errors")
+)
+
+var (
+	watchStatusNames = map[int]string{
+		models.WantToWatch:      "Want To Watch",
+		models.Watching:         "Watching",
+		models.FinishedWatching: "Finished Watching",
+	}
+
+	watchStatusAliases = map[string]int{
+		"want to watch":      models.WantToWatch,
+		"want":               models.WantToWatch,
+		"to watch":           models.WantToWatch,
+		"plan to watch":      models.WantToWatch,
+		"planned":            models.WantToWatch,
+		"watchlist":          models.WantToWatch,
+		"watching":           models.Watching,
+		"currently watching": models.Watching,
+		"in progress":        models.Watching,
+		"started":            models.Watching,
+		"finished":           models.FinishedWatching,
+		"finished watching":  models.FinishedWatching,
+		"completed":          models.FinishedWatching,
+		"complete":           models.FinishedWatching,
+		"done":               models.FinishedWatching,
+		"watched":            models.FinishedWatching,
+	}
+)
+
+type ImportServicer interface {
+	/*
+		PlanImport resolves platforms, watchers, and existing shows for a set of
+		import rows and describes what applying the import would do. Nothing
+		is written to the database.
+	*/
+	PlanImport(accountID int, rows []models.ImportRow, options ...PlanOption) (models.ImportPlan, error)
+
+	/*
+		ApplyImport creates any new watchers and creates or updates every show
+		in the plan inside a single transaction. If anything fails, nothing is
+		imported.
+	*/
+	ApplyImport(accountID int, plan models.ImportPlan) (models.ImportResult, error)
+
+	/*
+		MatchWatchHistory finds each show from another service's export on
+		TVMaze and turns it into an import row with its watch status and
+		current season. Shows that can't be found are returned separately
+		so they can be added by hand.
+	*/
+	MatchWatchHistory(history []models.WatchHistoryShow) ([]models.ImportRow, []models.UnmatchedImportItem, error)
+}
+
+type ImportServiceConfig struct {
+	services.DbServiceBaseConfig
+	ShowService    shows.ShowServicer
+	WatcherService watchers.WatcherServicer
+}
+
+type ImportService struct {
+	services.DbServiceBase
+	showService    shows.ShowServicer
+	watcherService watchers.WatcherServicer
+}
+
+func NewImportService(config ImportServiceConfig) ImportService {
+	return ImportService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+			PageSize:     config.PageSize,
+		},
+		showService:    config.ShowService,
+		watcherService: config.WatcherService,
+	}
+}
+
+func (s ImportService) PlanImport(accountID int, rows []models.ImportRow, options ...PlanOption) (models.ImportPlan, error) {
+	var (
+		err             error
+		platformNames   []querymodels.ImportPlatformName
+		existingShows   []querymodels.ImportExistingShow
+		accountWatchers []*models.Watcher
+	)
+
+	result := models.ImportPlan{
+		Items:       []models.ImportPlanItem{},
+		NewWatchers: []string{},
+	}
+
+	opts := &PlanOptions{}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	if platformNames, err = s.getPlatformNames(); err != nil {
+		return result, err
+	}
+
+	if existingShows, err = s.getExistingShows(accountID); err != nil {
+		return result, err
+	}
+
+	if accountWatchers, err = s.watcherService.GetWatchers(accountID); err != nil {
+		return result, fmt.Errorf("error getting watchers for import: %w", err)
+	}
+
+	platformsByName := map[string]querymodels.ImportPlatformName{}
+	platformsByID := map[int]querymodels.ImportPlatformName{}
+
+	for _, p := range platformNames {
+		platformsByName[p.Name] = p
+		platformsByID[p.PlatformID] = p
+	}
+
+	showsByName := map[string]querymodels.ImportExistingShow{}
+	showsByTVMazeID := map[int]querymodels.ImportExistingShow{}
+
+	for _, show := range existingShows {
+		showsByName[strings.ToLower(show.ShowName)] = show
+
+		if show.TVMazeID > 0 {
+			showsByTVMazeID[show.TVMazeID] = show
+		}
+	}
+
+	watchersByName := map[string]string{}
+	watchersByID := map[int]string{}
+
+	for _, watcher := range accountWatchers {
+		watchersByName[strings.ToLower(watcher.Name)] = watcher.Name
+		watchersByID[watcher.ID.ID] = watcher.Name
+	}
+
+	defaultWatcherNames := []string{}
+
+	for _, watcherID := range opts.DefaultWatcherIDs {
+		if name, ok := watchersByID[watcherID]; ok {
+			defaultWatcherNames = append(defaultWatcherNames, name)
+		}
+	}
+
+	seenShows := map[string]int{}
+	newWatchers := map[string]string{}
+
+	for _, row := range rows {
+		item := models.ImportPlanItem{
+			Row:          row,
+			Action:       models.ImportActionCreate,
+			WatcherNames: []string{},
+			Changes:      []string{},
+			Problems:     slices.Clone(row.Problems),
+		}
+
+		if item.Problems == nil {
+			item.Problems = []string{}
+		}
+
+		showKey := strings.ToLower(strings.TrimSpace(row.ShowName))
+
+		if showKey == "" {
+			item.Problems = append(item.Problems, "show name is missing")
+		} else if firstRow, ok := seenShows[showKey]; ok {
+			item.Problems = append(item.Problems, fmt.Sprintf("duplicate of row %d", firstRow))
+		} else {
+			seenShows[showKey] = row.RowNumber
+		}
+
+		/*
+		 * Resolve the platform
+		 */
+		platformID := row.PlatformID
+
+		if opts.ForcePlatformID > 0 {
+			platformID = opts.ForcePlatformID
+			row.PlatformName = ""
+		}
+
+		if platformID == 0 && row.PlatformName != "" {
+			if p, ok := platformsByName[strings.ToLower(strings.TrimSpace(row.PlatformName))]; ok {
+				platformID = p.PlatformID
+			} else {
+				item.Problems = append(item.Problems, fmt.Sprintf("unknown platform '%s'", row.PlatformName))
+			}
+		}
+
+		if platformID == 0 && row.PlatformName == "" {
+			platformID = opts.DefaultPlatformID
+		}
+
+		if p, ok := platformsByID[platformID]; ok {
+			item.PlatformID = p.PlatformID
+			item.PlatformName = p.PlatformName
+		}
+
+		/*
+		 * Resolve the status and seasons
+		 */
+		item.CurrentSeason = row.CurrentSeason
+		item.TotalSeasons = max(row.TotalSeasons, row.CurrentSeason)
+
+		if item.WatchStatusID, err = parseWatchStatus(row.Status, row.CurrentSeason); err != nil {
+			item.Problems = append(item.Problems, err.Error())
+			err = nil
+		}
+
+		if item.WatchStatusID == models.FinishedWatching && item.TotalSeasons > 0 {
+			item.CurrentSeason = item.TotalSeasons
+		}
+
+		if item.WatchStatusID == models.Watching && item.CurrentSeason == 0 {
+			item.CurrentSeason = 1
+			item.TotalSeasons = max(item.TotalSeasons, 1)
+		}
+
+		item.WatchStatus = watchStatusNames[item.WatchStatusID]
+
+		/*
+		 * Resolve watchers. Names that don't match an existing watcher
+		 * will be created as manual watchers.
+		 */
+		watcherNames := row.WatcherNames
+
+		if len(watcherNames) == 0 {
+			watcherNames = defaultWatcherNames
+		}
+
+		for _, name := range watcherNames {
+			key := strings.ToLower(name)
+
+			if existingName, ok := watchersByName[key]; ok {
+				name = existingName
+			} else if newName, ok := newWatchers[key]; ok {
+				name = newName
+			} else {
+				newWatchers[key] = name
+				result.NewWatchers = append(result.NewWatchers, name)
+			}
+
+			if !slices.Contains(item.WatcherNames, name) {
+				item.WatcherNames = append(item.WatcherNames, name)
+			}
+		}
+
+		/*
+		 * Decide what to do with the row. A platform is only required
+		 * when the show doesn't exist yet.
+		 */
+		existing, showExists := showsByTVMazeID[row.TVMazeID]
+
+		if !showExists {
+			existing, showExists = showsByName[showKey]
+		}
+
+		if !showExists && item.PlatformID == 0 && row.PlatformName == "" {
+			item.Problems = append(item.Problems, "platform is missing")
+		}
+
+		if len(item.Problems) > 0 {
+			item.Action = models.ImportActionError
+			result.NumErrors++
+			result.Items = append(result.Items, item)
+			continue
+		}
+
+		if showExists {
+			item.ExistingShowID = existing.ShowID
+			item.Changes = describeChanges(existing, item)
+
+			if len(item.Changes) == 0 {
+				item.Action = models.ImportActionSkip
+				result.NumSkip++
+			} else {
+				item.Action = models.ImportActionUpdate
+				result.NumUpdate++
+			}
+		} else {
+			result.NumCreate++
+		}
+
+		result.Items = append(result.Items, item)
+	}
+
+	/*
+	 * Only create watchers that are actually used by a row we will import
+	 */
+	usedWatchers := []string{}
+
+	for _, name := range result.NewWatchers {
+		for _, item := range result.Items {
+			if (item.Action == models.ImportActionCreate || item.Action == models.ImportActionUpdate) && slices.Contains(item.WatcherNames, name) {
+				usedWatchers = append(usedWatchers, name)
+				break
+			}
+		}
+	}
+
+	result.NewWatchers = usedWatchers
+	return result, nil
+}
+
+func (s ImportService) ApplyImport(accountID int, plan models.ImportPlan) (models.ImportResult, error) {
+	var (
+		err             error
+		result          models.ImportResult
+		accountWatchers []*models.Watcher
+		newWatcher      *models.Watcher
+	)
+
+	if plan.NumErrors > 0 {
+		return result, ErrPlanHasErrors
+	}
+
+	if plan.NumCreate+plan.NumUpdate == 0 {
+		return result, ErrNothingToImport
+	}
+
+	if accountWatchers, err = s.watcherService.GetWatchers(accountID); err != nil {
+		return result, fmt.Errorf("error getting watchers for import: %w", err)
+	}
+
+	watcherIDs := map[string]int{}
+
+	for _, watcher := range accountWatchers {
+		watcherIDs[strings.ToLower(watcher.Name)] = watcher.ID.ID
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("error beginning import transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	for _, name := range plan.NewWatchers {
+		if _, ok := watcherIDs[strings.ToLower(name)]; ok {
+			continue
+		}
+
+		if newWatcher, err = s.watcherService.CreateWatcherManual(accountID, name, services.WithTx(tx)); err != nil {
+			return result, fmt.Errorf("error creating watcher '%s' during import: %w", name, err)
+		}
+
+		watcherIDs[strings.ToLower(name)] = newWatcher.ID.ID
+		result.WatchersCreated++
+	}
+
+	for _, item := range plan.Items {
+		ids := []int{}
+
+		for _, name := range item.WatcherNames {
+			if id, ok := watcherIDs[strings.ToLower(name)]; ok {
+				ids = append(ids, id)
+			}
+		}
+
+		switch item.Action {
+		case models.ImportActionCreate:
+			req := requesttypes.AddShowRequest{
+				Name:          strings.TrimSpace(item.Row.ShowName),
+				TotalSeasons:  item.TotalSeasons,
+				PlatformID:    item.PlatformID,
+				WatcherIDs:    ids,
+				PosterImage:   item.Row.PosterImage,
+				WatchStatusID: item.WatchStatusID,
+				CurrentSeason: item.CurrentSeason,
+				TVMazeID:      item.Row.TVMazeID,
+			}
+
+			if _, err = s.showService.AddShow(accountID, req, services.WithTx(tx)); err != nil {
+				return result, fmt.Errorf("error importing row %d (%s): %w", item.Row.RowNumber, item.Row.ShowName, err)
+			}
+
+			result.ShowsCreated++
+
+		case models.ImportActionUpdate:
+			req := requesttypes.UpdateShowProgressRequest{
+				ShowID:        item.ExistingShowID,
+				WatchStatusID: item.WatchStatusID,
+				CurrentSeason: item.CurrentSeason,
+				NumSeasons:    item.TotalSeasons,
+				WatcherIDs:    ids,
+				TVMazeID:      item.Row.TVMazeID,
+			}
+
+			if err = s.showService.UpdateShowProgress(accountID, req, services.WithTx(tx)); err != nil {
+				return result, fmt.Errorf("error importing row %d (%s): %w", item.Row.RowNumber, item.Row.ShowName, err)
+			}
+
+			result.ShowsUpdated++
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return result, fmt.Errorf("error committing import transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s ImportService) MatchWatchHistory(history []models.WatchHistoryShow) ([]models.ImportRow, []models.UnmatchedImportItem, error) {
+	var (
+		err error
+	)
+
+	type matchResult struct {
+		match *models.OnlineShowMatch
+		err   error
+	}
+
+	matches := make([]matchResult, len(history))
+	pool := pond.NewPool(3)
+
+	for index, show := range history {
+		pool.Submit(func() {
+			match, matchErr := s.showService.MatchOnlineShow(show.Title, show.Year, show.IMDBID, show.TVDBID)
+			matches[index] = matchResult{match: match, err: matchErr}
+		})
+	}
+
+	pool.StopAndWait()
+
+	rows := []models.ImportRow{}
+	unmatched := []models.UnmatchedImportItem{}
+
+	for index, show := range history {
+		result := matches[index]
+
+		if result.err != nil {
+			if !errors.Is(result.err, shows.ErrOnlineShowNotFound) {
+				slog.Error("error matching imported show", "title", show.Title, "error", result.err)
+			}
+
+			reason := "No matching show was found on TVMaze"
+
+			if !errors.Is(result.err, shows.ErrOnlineShowNotFound) {
+				reason = "TVMaze could not be reached"
+				err = result.err
+			}
+
+			unmatched = append(unmatched, models.UnmatchedImportItem{
+				Title:  show.Title,
+				Year:   show.Year,
+				Reason: reason,
+			})
+
+			continue
+		}
+
+		watchStatusID, currentSeason := ProgressFromWatchHistory(show, *result.match)
+
+		row := models.ImportRow{
+			RowNumber:     len(rows) + 1,
+			ShowName:      result.match.Name,
+			Status:        watchStatusNames[watchStatusID],
+			CurrentSeason: currentSeason,
+			TotalSeasons:  max(result.match.NumSeasons, currentSeason),
+			WatcherNames:  []string{},
+			PosterImage:   result.match.PosterImage,
+			TVMazeID:      result.match.TVMazeID,
+			LastWatchedAt: show.LastWatchedAt,
+			Problems:      []string{},
+		}
+
+		if len(result.match.Platforms) > 0 {
+			row.PlatformID = result.match.Platforms[0].ID.ID
+			row.PlatformName = result.match.Platforms[0].Name
+		}
+
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 && err != nil {
+		return rows, unmatched, fmt.Errorf("error matching watch history: %w", err)
+	}
+
+	return rows, unmatched, nil
+}
+
+/*
+getPlatformNames returns every name a platform can be referred to by, which
+is its own name plus any aliases. All names are lower case.
+*/
+func (s ImportService) getPlatformNames() ([]querymodels.ImportPlatformName, error) {
+	var (
+		err    error
+		result []querymodels.ImportPlatformName
+	)
+
+	query := `
+SELECT DISTINCT
+	p.id AS platform_id
+	, p.name AS platform_name
+	, LOWER(p.name) AS name
+FROM platforms AS p
+
+UNION
+
+SELECT DISTINCT
+	p.id AS platform_id
+	, p.name AS platform_name
+	, LOWER(pa.external_name) AS name
+FROM platform_aliases AS pa
+	INNER JOIN platforms AS p ON p.id = pa.platform_id
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &result, query); err != nil {
+		return result, fmt.Errorf("error querying platform names for import: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s ImportService) getExistingShows(accountID int) ([]querymodels.ImportExistingShow, error) {
+	var (
+		err    error
+		result []querymodels.ImportExistingShow
+	)
+
+	query := `
+SELECT
+	s.id AS show_id
+	, s.name AS show_name
+	, coalesce(s.tvmaze_id, 0) AS tvmaze_id
+	, s.num_seasons
+	, ss.watch_status_id
+	, ss.current_season
+	, s.cancelled
+	, coalesce(array_agg(w.name) FILTER (WHERE w.name IS NOT NULL), '{}') AS watcher_names
+FROM shows AS s
+	INNER JOIN show_status AS ss ON ss.show_id = s.id AND ss.account_id = s.account_id
+	LEFT JOIN watchers_to_show_statuses AS wtss ON wtss.show_status_id = ss.id
+	LEFT JOIN watchers AS w ON w.id = wtss.watcher_id
+WHERE 1=1
+	AND s.account_id = $1
+GROUP BY s.id, s.name, s.tvmaze_id, s.num_seasons, ss.watch_status_id, ss.current_season, s.cancelled
+	`
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = pgxscan.Select(ctx, s.DB, &result, query, accountID); err != nil {
+		return result, fmt.Errorf("error querying existing shows for import: %w", err)
+	}
+
+	return result, nil
+}
+
+/*
+parseWatchStatus converts the status text from an import row to a watch
+status ID. When no status is given a show with a current season is
+considered "Watching", otherwise "Want To Watch".
+*/
+func parseWatchStatus(status string, currentSeason int) (int, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(status))), " ")
+
+	if normalized == "" {
+		if currentSeason > 0 {
+			return models.Watching, nil
+		}
+
+		return models.WantToWatch, nil
+	}
+
+	if watchStatusID, ok := watchStatusAliases[normalized]; ok {
+		return watchStatusID, nil
+	}
+
+	return models.WantToWatch, fmt.Errorf("unknown status '%s'", status)
+}
+
+/*
+describeChanges lists the differences between an existing show and what
+the import would set. Imports never move a show backwards to a lower
+season or remove watchers.
+*/
+func describeChanges(existing querymodels.ImportExistingShow, item models.ImportPlanItem) []string {
+	result := []string{}
+
+	if existing.WatchStatusID != item.WatchStatusID {
+		result = append(result, fmt.Sprintf("status: %s → %s", watchStatusNames[existing.WatchStatusID], item.WatchStatus))
+	}
+
+	if existing.CurrentSeason != item.CurrentSeason {
+		result = append(result, fmt.Sprintf("current season: %d → %d", existing.CurrentSeason, item.CurrentSeason))
+	}
+
+	if item.TotalSeasons > existing.NumSeasons {
+		result = append(result, fmt.Sprintf("total seasons: %d → %d", existing.NumSeasons, item.TotalSeasons))
+	}
+
+	existingWatchers := map[string]struct{}{}
+
+	for _, name := range existing.WatcherNames {
+		existingWatchers[strings.ToLower(name)] = struct{}{}
+	}
+
+	for _, name := range item.WatcherNames {
+		if _, ok := existingWatchers[strings.ToLower(name)]; !ok {
+			result = append(result, fmt.Sprintf("add watcher: %s", name))
+		}
+	}
+
+	return result
+}
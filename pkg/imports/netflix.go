@@ -0,0 +1,191 @@
+package imports
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	netflixSeasonPattern        = regexp.MustCompile(`(?i)^(season|part|volume|vol\.|series|book|collection|chapter)\s+(\d+)$`)
+	netflixLimitedSeriesPattern = regexp.MustCompile(`(?i)^(limited series|miniseries|mini-series)$`)
+)
+
+/*
+AddNetflixViewingHistory reads NetflixViewingHistory.csv into the watch
+history. Netflix titles look like "Show: Season 2: Episode Title". Netflix
+doesn't include episode numbers, so each different episode title in a
+season is counted as one watched episode. Titles without a season, which
+are usually movies, are skipped and counted in the returned total.
+*/
+func (h *WatchHistory) AddNetflixViewingHistory(r io.Reader) (int, error) {
+	var (
+		err     error
+		records [][]string
+		skipped int
+	)
+
+	if records, err = ReadCSV(r); err != nil {
+		return 0, fmt.Errorf("error reading Netflix viewing history: %w", err)
+	}
+
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	titleColumn := findColumn(records[0], []string{"title"})
+	dateColumn := findColumn(records[0], []string{"date"})
+
+	if titleColumn == NotMapped {
+		return 0, fmt.Errorf("error reading Netflix viewing history: no Title column found")
+	}
+
+	dates := make([]string, 0, len(records)-1)
+
+	for _, record := range records[1:] {
+		dates = append(dates, cell(record, dateColumn))
+	}
+
+	dayFirst := netflixDatesAreDayFirst(dates)
+	episodeTitles := map[string]map[int][]string{}
+
+	for index, record := range records[1:] {
+		showName, season, episodeTitle, ok := parseNetflixTitle(cell(record, titleColumn))
+
+		if !ok {
+			skipped++
+			continue
+		}
+
+		show := h.addShow(showName, 0, "", 0)
+		key := strings.ToLower(showName)
+
+		if episodeTitles[key] == nil {
+			episodeTitles[key] = map[int][]string{}
+		}
+
+		episodeNumber := slices.Index(episodeTitles[key][season], episodeTitle) + 1
+
+		if episodeNumber == 0 {
+			episodeTitles[key][season] = append(episodeTitles[key][season], episodeTitle)
+			episodeNumber = len(episodeTitles[key][season])
+		}
+
+		addWatchedEpisode(show, season, episodeNumber, parseNetflixDate(dates[index], dayFirst))
+	}
+
+	return skipped, nil
+}
+
+/*
+parseNetflixTitle splits a Netflix title into the show name, season number,
+and episode title. Besides "Season N", Netflix uses "Part N", "Volume N",
+"Limited Series", and sometimes the show name followed by a number (for
+example "Stranger Things: Stranger Things 2: Chapter One").
+*/
+func parseNetflixTitle(title string) (string, int, string, bool) {
+	parts := strings.Split(title, ": ")
+
+	if len(parts) < 3 {
+		return "", 0, "", false
+	}
+
+	for index := 1; index < len(parts)-1; index++ {
+		segment := strings.TrimSpace(parts[index])
+		showName := strings.TrimSpace(strings.Join(parts[:index], ": "))
+		episodeTitle := strings.TrimSpace(strings.Join(parts[index+1:], ": "))
+
+		if matches := netflixSeasonPattern.FindStringSubmatch(segment); matches != nil {
+			season, _ := strconv.Atoi(matches[2])
+			return showName, season, episodeTitle, true
+		}
+
+		if netflixLimitedSeriesPattern.MatchString(segment) {
+			return showName, 1, episodeTitle, true
+		}
+
+		if suffix, ok := strings.CutPrefix(strings.ToLower(segment), strings.ToLower(showName)+" "); ok {
+			if season, err := strconv.Atoi(suffix); err == nil {
+				return showName, season, episodeTitle, true
+			}
+		}
+	}
+
+	return "", 0, "", false
+}
+
+/*
+netflixDatesAreDayFirst works out whether dates are written day first
+(such as 31/12/2024) or month first (such as 12/31/2024). Netflix uses the
+account's locale, so if any date has a first number over 12 the whole
+file is day first. Otherwise month first is assumed.
+*/
+func netflixDatesAreDayFirst(dates []string) bool {
+	for _, date := range dates {
+		parts := splitNetflixDate(date)
+
+		if len(parts) != 3 || len(parts[0]) == 4 {
+			continue
+		}
+
+		if first, err := strconv.Atoi(parts[0]); err == nil && first > 12 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseNetflixDate(date string, dayFirst bool) *time.Time {
+	var (
+		err                     error
+		year, month, day        int
+		first, second, yearText string
+	)
+
+	parts := splitNetflixDate(date)
+
+	if len(parts) != 3 {
+		return nil
+	}
+
+	if len(parts[0]) == 4 {
+		yearText, first, second = parts[0], parts[1], parts[2]
+		dayFirst = false
+	} else {
+		first, second, yearText = parts[0], parts[1], parts[2]
+	}
+
+	if year, err = strconv.Atoi(yearText); err != nil {
+		return nil
+	}
+
+	if year < 100 {
+		year += 2000
+	}
+
+	if dayFirst {
+		first, second = second, first
+	}
+
+	if month, err = strconv.Atoi(first); err != nil || month < 1 || month > 12 {
+		return nil
+	}
+
+	if day, err = strconv.Atoi(second); err != nil || day < 1 || day > 31 {
+		return nil
+	}
+
+	result := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return &result
+}
+
+func splitNetflixDate(date string) []string {
+	return strings.FieldsFunc(strings.TrimSpace(date), func(r rune) bool {
+		return r == '/' || r == '-' || r == '.'
+	})
+}
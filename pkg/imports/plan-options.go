@@ -0,0 +1,37 @@
+package imports
+
+type PlanOption func(p *PlanOptions)
+
+type PlanOptions struct {
+	DefaultPlatformID int
+	DefaultWatcherIDs []int
+	ForcePlatformID   int
+}
+
+/*
+WithDefaultPlatformID sets the platform used for rows that don't name one.
+*/
+func WithDefaultPlatformID(platformID int) PlanOption {
+	return func(p *PlanOptions) {
+		p.DefaultPlatformID = platformID
+	}
+}
+
+/*
+WithDefaultWatcherIDs sets the watchers assigned to rows that don't name any.
+*/
+func WithDefaultWatcherIDs(watcherIDs []int) PlanOption {
+	return func(p *PlanOptions) {
+		p.DefaultWatcherIDs = watcherIDs
+	}
+}
+
+/*
+WithForcePlatformID assigns every row to a single platform, ignoring any
+platform named in the row.
+*/
+func WithForcePlatformID(platformID int) PlanOption {
+	return func(p *PlanOptions) {
+		p.ForcePlatformID = platformID
+	}
+}
@@ -0,0 +1,91 @@
+package imports
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+type traktShow struct {
+	Title string `json:"title"`
+	Year  int    `json:"year"`
+	IDs   struct {
+		TVDB int    `json:"tvdb"`
+		IMDB string `json:"imdb"`
+	} `json:"ids"`
+}
+
+type traktEpisode struct {
+	Season        int        `json:"season"`
+	Number        int        `json:"number"`
+	LastWatchedAt *time.Time `json:"last_watched_at"`
+}
+
+type traktSeason struct {
+	Number   int            `json:"number"`
+	Episodes []traktEpisode `json:"episodes"`
+}
+
+/*
+traktItem covers the entries found in the different Trakt export files:
+
+  - watched-shows.json has a show with its watched seasons and episodes
+  - history.json has one entry of type "episode" per play
+  - watchlist.json has entries of type "show" (movies are ignored)
+*/
+type traktItem struct {
+	Type          string        `json:"type"`
+	Show          *traktShow    `json:"show"`
+	Seasons       []traktSeason `json:"seasons"`
+	Episode       *traktEpisode `json:"episode"`
+	WatchedAt     *time.Time    `json:"watched_at"`
+	LastWatchedAt *time.Time    `json:"last_watched_at"`
+}
+
+/*
+AddTraktExport reads a Trakt JSON export file (watched shows, history,
+or watchlist) into the watch history.
+*/
+func (h *WatchHistory) AddTraktExport(r io.Reader) error {
+	var (
+		err   error
+		items []traktItem
+	)
+
+	if err = json.NewDecoder(r).Decode(&items); err != nil {
+		return fmt.Errorf("error reading Trakt export: %w", err)
+	}
+
+	for _, item := range items {
+		if item.Show == nil {
+			continue
+		}
+
+		switch {
+		case len(item.Seasons) > 0:
+			show := h.addShow(item.Show.Title, item.Show.Year, item.Show.IDs.IMDB, item.Show.IDs.TVDB)
+
+			for _, season := range item.Seasons {
+				for _, episode := range season.Episodes {
+					watchedAt := episode.LastWatchedAt
+
+					if watchedAt == nil {
+						watchedAt = item.LastWatchedAt
+					}
+
+					addWatchedEpisode(show, season.Number, episode.Number, watchedAt)
+				}
+			}
+
+		case item.Type == "episode" && item.Episode != nil:
+			show := h.addShow(item.Show.Title, item.Show.Year, item.Show.IDs.IMDB, item.Show.IDs.TVDB)
+			addWatchedEpisode(show, item.Episode.Season, item.Episode.Number, item.WatchedAt)
+
+		case item.Type == "show" || item.Type == "":
+			h.addShow(item.Show.Title, item.Show.Year, item.Show.IDs.IMDB, item.Show.IDs.TVDB)
+		}
+	}
+
+	return nil
+}
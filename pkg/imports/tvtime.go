@@ -0,0 +1,105 @@
+package imports
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	tvTimeShowNameHeaders = []string{"tv show name", "series name", "show name", "tv show", "show"}
+	tvTimeTVDBIDHeaders   = []string{"tv show id", "series id", "tvdb id", "show id"}
+	tvTimeSeasonHeaders   = []string{"episode season number", "season number", "season"}
+	tvTimeEpisodeHeaders  = []string{"episode number", "number", "episode"}
+	tvTimeDateHeaders     = []string{"created at", "watched at", "updated at", "date"}
+
+	tvTimeDateLayouts = []string{
+		time.RFC3339,
+		time.DateTime,
+		time.DateOnly,
+	}
+)
+
+/*
+AddTVTimeExport reads a CSV file from a TV Time data export into the watch
+history. Files with season and episode columns (such as seen_episode.csv)
+are read as watched episodes. Files with only show columns (such as
+followed_tv_show.csv) are read as a watchlist.
+*/
+func (h *WatchHistory) AddTVTimeExport(r io.Reader) error {
+	var (
+		err     error
+		records [][]string
+	)
+
+	if records, err = ReadCSV(r); err != nil {
+		return fmt.Errorf("error reading TV Time export: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	showNameColumn := findColumn(records[0], tvTimeShowNameHeaders)
+	tvdbIDColumn := findColumn(records[0], tvTimeTVDBIDHeaders)
+	seasonColumn := findColumn(records[0], tvTimeSeasonHeaders)
+	episodeColumn := findColumn(records[0], tvTimeEpisodeHeaders)
+	dateColumn := findColumn(records[0], tvTimeDateHeaders)
+
+	if showNameColumn == NotMapped {
+		return fmt.Errorf("error reading TV Time export: no show name column found")
+	}
+
+	hasEpisodes := seasonColumn != NotMapped && episodeColumn != NotMapped
+
+	for _, record := range records[1:] {
+		title := cell(record, showNameColumn)
+
+		if title == "" {
+			continue
+		}
+
+		tvdbID, _ := strconv.Atoi(cell(record, tvdbIDColumn))
+		show := h.addShow(title, 0, "", tvdbID)
+
+		if !hasEpisodes {
+			continue
+		}
+
+		season, seasonErr := strconv.Atoi(cell(record, seasonColumn))
+		episode, episodeErr := strconv.Atoi(cell(record, episodeColumn))
+
+		if seasonErr != nil || episodeErr != nil {
+			continue
+		}
+
+		addWatchedEpisode(show, season, episode, parseTVTimeDate(cell(record, dateColumn)))
+	}
+
+	return nil
+}
+
+func findColumn(headers []string, names []string) int {
+	for index, header := range headers {
+		if slices.Contains(names, normalizeHeader(header)) {
+			return index
+		}
+	}
+
+	return NotMapped
+}
+
+func parseTVTimeDate(value string) *time.Time {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range tvTimeDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package imports
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+/*
+WatchHistory collects shows from one or more export files from other
+tracking services. The same show appearing in several files, such as a
+watchlist and a watched history, is merged into a single entry.
+*/
+type WatchHistory struct {
+	shows map[string]*models.WatchHistoryShow
+	order []string
+}
+
+func NewWatchHistory() *WatchHistory {
+	return &WatchHistory{
+		shows: map[string]*models.WatchHistoryShow{},
+		order: []string{},
+	}
+}
+
+/*
+Shows returns every show in the history in the order they were first seen.
+*/
+func (h *WatchHistory) Shows() []models.WatchHistoryShow {
+	result := make([]models.WatchHistoryShow, 0, len(h.order))
+
+	for _, key := range h.order {
+		result = append(result, *h.shows[key])
+	}
+
+	return result
+}
+
+/*
+addShow returns the existing entry for a show, or creates one. Shows are
+identified by IMDB ID, then TheTVDB ID, then title and year.
+*/
+func (h *WatchHistory) addShow(title string, year int, imdbID string, tvdbID int) *models.WatchHistoryShow {
+	title = strings.TrimSpace(title)
+	imdbID = strings.TrimSpace(imdbID)
+
+	keys := []string{}
+
+	if imdbID != "" {
+		keys = append(keys, "imdb:"+imdbID)
+	}
+
+	if tvdbID > 0 {
+		keys = append(keys, fmt.Sprintf("tvdb:%d", tvdbID))
+	}
+
+	keys = append(keys, fmt.Sprintf("title:%s:%d", strings.ToLower(title), year))
+
+	for _, key := range keys {
+		if show, ok := h.shows[key]; ok {
+			h.linkKeys(show, keys)
+
+			if show.IMDBID == "" {
+				show.IMDBID = imdbID
+			}
+
+			if show.TVDBID == 0 {
+				show.TVDBID = tvdbID
+			}
+
+			return show
+		}
+	}
+
+	show := &models.WatchHistoryShow{
+		Title:           title,
+		Year:            year,
+		IMDBID:          imdbID,
+		TVDBID:          tvdbID,
+		WatchedEpisodes: map[int][]int{},
+	}
+
+	h.order = append(h.order, keys[0])
+	h.linkKeys(show, keys)
+	return show
+}
+
+func (h *WatchHistory) linkKeys(show *models.WatchHistoryShow, keys []string) {
+	for _, key := range keys {
+		if _, ok := h.shows[key]; !ok {
+			h.shows[key] = show
+		}
+	}
+}
+
+func addWatchedEpisode(show *models.WatchHistoryShow, season, episode int, watchedAt *time.Time) {
+	if !slices.Contains(show.WatchedEpisodes[season], episode) {
+		show.WatchedEpisodes[season] = append(show.WatchedEpisodes[season], episode)
+	}
+
+	updateLastWatched(show, watchedAt)
+}
+
+func updateLastWatched(show *models.WatchHistoryShow, watchedAt *time.Time) {
+	if watchedAt == nil {
+		return
+	}
+
+	if show.LastWatchedAt == nil || watchedAt.After(*show.LastWatchedAt) {
+		t := *watchedAt
+		show.LastWatchedAt = &t
+	}
+}
+
+/*
+ProgressFromWatchHistory works out a show's watch status and current season
+from the episodes someone has watched. Specials (season 0) are ignored.
+
+  - Nothing watched, such as a show only on a watchlist, means "Want To
+    Watch".
+  - A partly watched season means "Watching" that season.
+  - A fully watched season means "Watching" the next one, or "Finished
+    Watching" when it was the last season to air.
+*/
+func ProgressFromWatchHistory(show models.WatchHistoryShow, match models.OnlineShowMatch) (watchStatusID int, currentSeason int) {
+	lastSeason := 0
+
+	for season, episodes := range show.WatchedEpisodes {
+		if season > lastSeason && len(episodes) > 0 {
+			lastSeason = season
+		}
+	}
+
+	if lastSeason == 0 {
+		return models.WantToWatch, 0
+	}
+
+	episodesInSeason := match.EpisodesPerSeason[lastSeason]
+	seasonComplete := episodesInSeason > 0 && (len(show.WatchedEpisodes[lastSeason]) >= episodesInSeason || slices.Max(show.WatchedEpisodes[lastSeason]) >= episodesInSeason)
+
+	if !seasonComplete {
+		return models.Watching, lastSeason
+	}
+
+	if lastSeason >= match.NumSeasons {
+		return models.FinishedWatching, max(lastSeason, match.NumSeasons)
+	}
+
+	return models.Watching, lastSeason + 1
+}
+
+/*
+RowFromUnmatchedWatchHistory builds an import row for a show that couldn't
+be found on TVMaze, using only what the export file says. The show is
+marked as "Watching" the furthest season watched.
+*/
+func RowFromUnmatchedWatchHistory(show models.WatchHistoryShow) models.ImportRow {
+	furthestSeason := 0
+
+	for season, episodes := range show.WatchedEpisodes {
+		if season > furthestSeason && len(episodes) > 0 {
+			furthestSeason = season
+		}
+	}
+
+	watchStatusID := models.Watching
+
+	if furthestSeason == 0 {
+		watchStatusID = models.WantToWatch
+	}
+
+	return models.ImportRow{
+		ShowName:      show.Title,
+		Status:        watchStatusNames[watchStatusID],
+		CurrentSeason: furthestSeason,
+		TotalSeasons:  furthestSeason,
+		WatcherNames:  []string{},
+		LastWatchedAt: show.LastWatchedAt,
+		Problems:      []string{},
+	}
+}
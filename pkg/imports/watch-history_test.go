@@ -0,0 +1,99 @@
+package imports_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adampresley/streaming-tracker/pkg/imports"
+	"github.com/adampresley/streaming-tracker/pkg/models"
+)
+
+func TestProgressFromWatchHistory(t *testing.T) {
+	match := models.OnlineShowMatch{
+		NumSeasons:        3,
+		EpisodesPerSeason: map[int]int{1: 8, 2: 8, 3: 10},
+	}
+
+	tests := []struct {
+		name              string
+		watchedEpisodes   map[int][]int
+		wantWatchStatusID int
+		wantCurrentSeason int
+	}{
+		{name: "nothing watched", watchedEpisodes: map[int][]int{}, wantWatchStatusID: models.WantToWatch, wantCurrentSeason: 0},
+		{name: "only specials watched", watchedEpisodes: map[int][]int{0: {1, 2}}, wantWatchStatusID: models.WantToWatch, wantCurrentSeason: 0},
+		{name: "part of a season", watchedEpisodes: map[int][]int{1: {1, 2, 3}}, wantWatchStatusID: models.Watching, wantCurrentSeason: 1},
+		{name: "a whole season", watchedEpisodes: map[int][]int{1: {1, 2, 3, 4, 5, 6, 7, 8}}, wantWatchStatusID: models.Watching, wantCurrentSeason: 2},
+		{name: "last episode of a season", watchedEpisodes: map[int][]int{1: {1, 2, 3, 4, 5, 6, 7, 8}, 2: {8}}, wantWatchStatusID: models.Watching, wantCurrentSeason: 3},
+		{name: "the last season", watchedEpisodes: map[int][]int{3: {10}}, wantWatchStatusID: models.FinishedWatching, wantCurrentSeason: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watchStatusID, currentSeason := imports.ProgressFromWatchHistory(models.WatchHistoryShow{WatchedEpisodes: tt.watchedEpisodes}, match)
+
+			if watchStatusID != tt.wantWatchStatusID || currentSeason != tt.wantCurrentSeason {
+				t.Errorf("expected status %d at season %d, got status %d at season %d", tt.wantWatchStatusID, tt.wantCurrentSeason, watchStatusID, currentSeason)
+			}
+		})
+	}
+}
+
+func TestWatchlistShowsAreWantToWatch(t *testing.T) {
+	match := models.OnlineShowMatch{NumSeasons: 2, EpisodesPerSeason: map[int]int{1: 9, 2: 10}}
+
+	tests := []struct {
+		name string
+		add  func(h *imports.WatchHistory) error
+	}{
+		{
+			name: "Trakt watchlist",
+			add: func(h *imports.WatchHistory) error {
+				return h.AddTraktExport(strings.NewReader(`[{"type": "show", "show": {"title": "Andor", "year": 2022, "ids": {"imdb": "tt9253284"}}}]`))
+			},
+		},
+		{
+			name: "TV Time followed shows",
+			add: func(h *imports.WatchHistory) error {
+				return h.AddTVTimeExport(strings.NewReader("tv_show_name,tv_show_id\nAndor,393189\n"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := imports.NewWatchHistory()
+
+			if err := tt.add(history); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			shows := history.Shows()
+
+			if len(shows) != 1 || shows[0].Title != "Andor" {
+				t.Fatalf("expected Andor, got %+v", shows)
+			}
+
+			if watchStatusID, currentSeason := imports.ProgressFromWatchHistory(shows[0], match); watchStatusID != models.WantToWatch || currentSeason != 0 {
+				t.Errorf("expected want to watch at season 0, got status %d at season %d", watchStatusID, currentSeason)
+			}
+
+			if row := imports.RowFromUnmatchedWatchHistory(shows[0]); row.Status != "Want To Watch" || row.CurrentSeason != 0 {
+				t.Errorf("expected an unmatched row to be want to watch at season 0, got %q at season %d", row.Status, row.CurrentSeason)
+			}
+		})
+	}
+
+	/*
+	 * A show on the watchlist that has been watched too goes by what was
+	 * watched.
+	 */
+	history := imports.NewWatchHistory()
+
+	_ = history.AddTraktExport(strings.NewReader(`[{"type": "show", "show": {"title": "Andor", "year": 2022, "ids": {"imdb": "tt9253284"}}}]`))
+	_ = history.AddTraktExport(strings.NewReader(`[{"type": "episode", "show": {"title": "Andor", "year": 2022, "ids": {"imdb": "tt9253284"}}, "episode": {"season": 1, "number": 3}}]`))
+
+	if watchStatusID, currentSeason := imports.ProgressFromWatchHistory(history.Shows()[0], match); watchStatusID != models.Watching || currentSeason != 1 {
+		t.Errorf("expected watching season 1, got status %d at season %d", watchStatusID, currentSeason)
+	}
+}
@@ -0,0 +1,619 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	/*
+	   LegacyBaselineVersion is the newest migration every database created
+	   before schema_migrations existed is known to have. Migrations 1 and 2
+	   insert seed data and can't run twice. Later migrations check before
+	   changing anything, so they are safe to run against those databases.
+	*/
+	LegacyBaselineVersion = 2
+
+	/*
+	   advisoryLockID is the key passed to pg_advisory_lock so only one
+	   replica migrates the database at a time. It is arbitrary, but must
+	   never change.
+	*/
+	advisoryLockID int64 = 0x73747261636b6572
+)
+
+var (
+	ErrChecksumMismatch     = errors.New("migration has changed since it was applied")
+	ErrDuplicateMigration   = errors.New("more than one migration file has the same version")
+	ErrMissingMigration     = errors.New("an applied migration is missing from the migration files")
+	ErrMissingUpMigration   = errors.New("down migration has no matching up migration")
+	ErrNoDownMigration      = errors.New("migration has no down script")
+	ErrInvalidNumberOfSteps = errors.New("number of migrations to roll back must be at least 1")
+
+	/*
+	   Migration files are named commitNNNNN.sql. The optional down script
+	   that undoes a migration is named commitNNNNN.down.sql.
+	*/
+	fileNamePattern = regexp.MustCompile(`^commit(\d+)(\.down)?\.sql$`)
+)
+
+type MigrationServicer interface {
+	/*
+	   Down rolls back the most recently applied migrations, newest first,
+	   and returns the migrations that were rolled back.
+	*/
+	Down(steps int) ([]Migration, error)
+
+	/*
+	   Status returns every migration file and whether it has been applied,
+	   plus any applied migrations whose file is missing.
+	*/
+	Status() ([]MigrationStatus, error)
+
+	/*
+	   Up applies every migration that hasn't been applied yet, in order,
+	   and returns the migrations that were applied.
+	*/
+	Up() ([]Migration, error)
+}
+
+type MigrationServiceConfig struct {
+	services.DbServiceBaseConfig
+
+	/*
+	   Source holds the migration files in its root directory.
+	*/
+	Source fs.FS
+
+	/*
+	   LegacyBaselineVersion is the newest migration that databases created
+	   before schema_migrations existed are known to have. When one of those
+	   databases is first migrated, migrations up to and including this
+	   version are recorded as applied without running them.
+	*/
+	LegacyBaselineVersion int
+}
+
+type MigrationService struct {
+	services.DbServiceBase
+
+	source                fs.FS
+	legacyBaselineVersion int
+}
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Migration
+
+	Applied          bool
+	AppliedAt        *time.Time
+	Baseline         bool
+	ChecksumMismatch bool
+	Missing          bool
+}
+
+type appliedMigration struct {
+	Version   int       `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+	Baseline  bool      `db:"baseline"`
+}
+
+func NewMigrationService(config MigrationServiceConfig) MigrationService {
+	return MigrationService{
+		DbServiceBase: services.DbServiceBase{
+			QueryTimeout: config.QueryTimeout,
+			DB:           config.DB,
+		},
+		source:                config.Source,
+		legacyBaselineVersion: config.LegacyBaselineVersion,
+	}
+}
+
+/*
+Down rolls back the most recently applied migrations, newest first. Each
+one runs its down script and removes its schema_migrations row in a single
+transaction. Nothing is rolled back unless every migration asked for has a
+down script.
+*/
+func (s MigrationService) Down(steps int) ([]Migration, error) {
+	var (
+		err        error
+		migrations []Migration
+		applied    []appliedMigration
+		conn       *pgxpool.Conn
+		unlock     func()
+	)
+
+	result := []Migration{}
+
+	if steps < 1 {
+		return result, ErrInvalidNumberOfSteps
+	}
+
+	if migrations, err = s.load(); err != nil {
+		return result, err
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if conn, unlock, err = s.lock(ctx); err != nil {
+		return result, err
+	}
+
+	defer unlock()
+
+	if err = s.createTable(ctx, conn); err != nil {
+		return result, err
+	}
+
+	if applied, err = s.getApplied(ctx, conn); err != nil {
+		return result, err
+	}
+
+	if err = verify(migrations, applied); err != nil {
+		return result, err
+	}
+
+	slices.Reverse(applied)
+	toRollBack := []Migration{}
+
+	for _, a := range applied[:min(steps, len(applied))] {
+		migration := findMigration(migrations, a.Version)
+
+		if migration.Down == "" {
+			return result, fmt.Errorf("%w: %s", ErrNoDownMigration, migration.Name)
+		}
+
+		toRollBack = append(toRollBack, migration)
+	}
+
+	for _, migration := range toRollBack {
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, migration.Down); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			return err
+		})
+
+		if err != nil {
+			return result, fmt.Errorf("error rolling back migration %s: %w", migration.Name, err)
+		}
+
+		result = append(result, migration)
+	}
+
+	return result, nil
+}
+
+/*
+Status returns every migration file and whether it has been applied.
+Applied migrations whose file no longer exists are included and marked
+Missing. It doesn't change the database, so a database that has never been
+migrated simply shows everything as pending.
+*/
+func (s MigrationService) Status() ([]MigrationStatus, error) {
+	var (
+		err        error
+		migrations []Migration
+		applied    []appliedMigration
+		hasTable   bool
+	)
+
+	result := []MigrationStatus{}
+
+	if migrations, err = s.load(); err != nil {
+		return result, err
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if err = s.DB.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&hasTable); err != nil {
+		return result, fmt.Errorf("error checking for schema_migrations table: %w", err)
+	}
+
+	if hasTable {
+		if applied, err = s.getApplied(ctx, s.DB); err != nil {
+			return result, err
+		}
+	}
+
+	for _, migration := range migrations {
+		status := MigrationStatus{
+			Migration: migration,
+		}
+
+		for _, a := range applied {
+			if a.Version == migration.Version {
+				status.Applied = true
+				status.AppliedAt = &a.AppliedAt
+				status.Baseline = a.Baseline
+				status.ChecksumMismatch = a.Checksum != migration.Checksum
+			}
+		}
+
+		result = append(result, status)
+	}
+
+	for _, a := range applied {
+		if findMigration(migrations, a.Version).Name != "" {
+			continue
+		}
+
+		result = append(result, MigrationStatus{
+			Migration: Migration{
+				Version:  a.Version,
+				Name:     a.Name,
+				Checksum: a.Checksum,
+			},
+			Applied:   true,
+			AppliedAt: &a.AppliedAt,
+			Baseline:  a.Baseline,
+			Missing:   true,
+		})
+	}
+
+	slices.SortFunc(result, func(a, b MigrationStatus) int {
+		return a.Version - b.Version
+	})
+
+	return result, nil
+}
+
+/*
+Up applies every migration that hasn't been applied yet, in order. Each
+migration and its schema_migrations row are written in one transaction, so
+a failed migration leaves nothing behind. Replicas starting at the same time
+wait on an advisory lock, then find there is nothing left to do.
+
+Up refuses to run when an applied migration file has been edited or
+removed, since the database may no longer match the files.
+*/
+func (s MigrationService) Up() ([]Migration, error) {
+	var (
+		err        error
+		migrations []Migration
+		applied    []appliedMigration
+		conn       *pgxpool.Conn
+		unlock     func()
+	)
+
+	result := []Migration{}
+
+	if migrations, err = s.load(); err != nil {
+		return result, err
+	}
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	if conn, unlock, err = s.lock(ctx); err != nil {
+		return result, err
+	}
+
+	defer unlock()
+
+	if err = s.createTable(ctx, conn); err != nil {
+		return result, err
+	}
+
+	if applied, err = s.getApplied(ctx, conn); err != nil {
+		return result, err
+	}
+
+	if len(applied) == 0 {
+		if applied, err = s.baselineLegacyDatabase(ctx, conn, migrations); err != nil {
+			return result, err
+		}
+	}
+
+	if err = verify(migrations, applied); err != nil {
+		return result, err
+	}
+
+	for _, migration := range migrations {
+		if slices.ContainsFunc(applied, func(a appliedMigration) bool { return a.Version == migration.Version }) {
+			continue
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, migration.Up); err != nil {
+				return err
+			}
+
+			return insertApplied(ctx, tx, migration, false)
+		})
+
+		if err != nil {
+			return result, fmt.Errorf("error applying migration %s: %w", migration.Name, err)
+		}
+
+		result = append(result, migration)
+	}
+
+	return result, nil
+}
+
+/*
+baselineLegacyDatabase records the migrations up to the legacy baseline as
+applied when the database was created before schema_migrations existed.
+Those databases already have the early migrations, and some of them insert
+seed data that can't be inserted twice.
+*/
+func (s MigrationService) baselineLegacyDatabase(ctx context.Context, conn *pgxpool.Conn, migrations []Migration) ([]appliedMigration, error) {
+	var (
+		err      error
+		isLegacy bool
+	)
+
+	if s.legacyBaselineVersion < 1 {
+		return nil, nil
+	}
+
+	if err = conn.QueryRow(ctx, `SELECT to_regclass('users') IS NOT NULL`).Scan(&isLegacy); err != nil {
+		return nil, fmt.Errorf("error checking for a legacy database: %w", err)
+	}
+
+	if !isLegacy {
+		return nil, nil
+	}
+
+	slog.Info("recording existing migrations for a database created before schema_migrations", "baselineVersion", s.legacyBaselineVersion)
+
+	err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		for _, migration := range migrations {
+			if migration.Version > s.legacyBaselineVersion {
+				break
+			}
+
+			if err := insertApplied(ctx, tx, migration, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error recording baseline migrations: %w", err)
+	}
+
+	return s.getApplied(ctx, conn)
+}
+
+/*
+lock takes a connection from the pool and holds the migration advisory lock
+on it. Call the returned function to release both.
+*/
+func (s MigrationService) lock(ctx context.Context) (*pgxpool.Conn, func(), error) {
+	var (
+		err  error
+		conn *pgxpool.Conn
+	)
+
+	if conn, err = s.DB.Acquire(ctx); err != nil {
+		return nil, nil, fmt.Errorf("error acquiring connection for migrations: %w", err)
+	}
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID); err != nil {
+		conn.Release()
+		return nil, nil, fmt.Errorf("error acquiring migration lock: %w", err)
+	}
+
+	unlock := func() {
+		/*
+		 * Use a fresh context. The caller's may have expired, and the lock
+		 * must not stay held on a connection returned to the pool.
+		 */
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, advisoryLockID); err != nil {
+			slog.Error("error releasing migration lock", "error", err)
+			_ = conn.Conn().Close(ctx)
+		}
+
+		conn.Release()
+	}
+
+	return conn, unlock, nil
+}
+
+func (s MigrationService) createTable(ctx context.Context, conn *pgxpool.Conn) error {
+	query := `
+CREATE TABLE IF NOT EXISTS "schema_migrations" (
+   version integer PRIMARY KEY,
+   name text NOT NULL,
+   checksum text NOT NULL,
+   applied_at timestamp NOT NULL,
+   baseline boolean NOT NULL DEFAULT false
+)
+	`
+
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func (s MigrationService) getApplied(ctx context.Context, db pgxscan.Querier) ([]appliedMigration, error) {
+	var (
+		err     error
+		results = []appliedMigration{}
+	)
+
+	query := `
+SELECT
+	version
+	, name
+	, checksum
+	, applied_at
+	, baseline
+FROM schema_migrations
+ORDER BY version
+	`
+
+	if err = pgxscan.Select(ctx, db, &results, query); err != nil {
+		return results, fmt.Errorf("error fetching applied migrations: %w", err)
+	}
+
+	return results, nil
+}
+
+/*
+load reads the migration files from the source, sorted by version.
+*/
+func (s MigrationService) load() ([]Migration, error) {
+	var (
+		err     error
+		entries []fs.DirEntry
+		b       []byte
+	)
+
+	byVersion := map[int]*Migration{}
+	downScripts := map[int]string{}
+
+	if entries, err = fs.ReadDir(s.source, "."); err != nil {
+		return nil, fmt.Errorf("error reading migration files: %w", err)
+	}
+
+	for _, entry := range entries {
+		matches := fileNamePattern.FindStringSubmatch(entry.Name())
+
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+
+		if b, err = fs.ReadFile(s.source, entry.Name()); err != nil {
+			return nil, fmt.Errorf("error reading migration file %s: %w", entry.Name(), err)
+		}
+
+		if matches[2] != "" {
+			downScripts[version] = string(b)
+			continue
+		}
+
+		if existing, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("%w: %s and %s", ErrDuplicateMigration, existing.Name, entry.Name())
+		}
+
+		checksum := sha256.Sum256(b)
+
+		byVersion[version] = &Migration{
+			Version:  version,
+			Name:     entry.Name(),
+			Up:       string(b),
+			Checksum: hex.EncodeToString(checksum[:]),
+		}
+	}
+
+	for version, down := range downScripts {
+		migration, ok := byVersion[version]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: version %d", ErrMissingUpMigration, version)
+		}
+
+		migration.Down = down
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		result = append(result, *migration)
+	}
+
+	slices.SortFunc(result, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	return result, nil
+}
+
+func insertApplied(ctx context.Context, tx pgx.Tx, migration Migration, baseline bool) error {
+	query := `
+INSERT INTO schema_migrations (
+	version
+	, name
+	, checksum
+	, applied_at
+	, baseline
+) VALUES (
+	$1
+	, $2
+	, $3
+	, $4
+	, $5
+)
+	`
+
+	args := []any{
+		migration.Version,
+		migration.Name,
+		migration.Checksum,
+		time.Now().UTC(),
+		baseline,
+	}
+
+	_, err := tx.Exec(ctx, query, args...)
+	return err
+}
+
+/*
+verify makes sure every applied migration still exists and hasn't been
+edited since it was applied.
+*/
+func verify(migrations []Migration, applied []appliedMigration) error {
+	for _, a := range applied {
+		migration := findMigration(migrations, a.Version)
+
+		if migration.Name == "" {
+			return fmt.Errorf("%w: %s", ErrMissingMigration, a.Name)
+		}
+
+		if migration.Checksum != a.Checksum {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+func findMigration(migrations []Migration, version int) Migration {
+	for _, migration := range migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+
+	return Migration{}
+}
@@ -0,0 +1,134 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/migrations"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/testdb"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestShowStatusAccountMigrationReportsMismatchedRows(t *testing.T) {
+	var (
+		err            error
+		first          int
+		second         int
+		showID         int
+		showStatusID   int
+		accountMatches bool
+	)
+
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	/*
+	 * Migrate to just before show_status.account_id had to match the
+	 * show's, then tie one household's show to another's status.
+	 */
+	if _, err = newMigrationService(db, migrationFiles(t, 18)).Up(); err != nil {
+		t.Fatalf("error migrating: %v", err)
+	}
+
+	first = insertAccount(t, db, "first@example.com")
+	second = insertAccount(t, db, "second@example.com")
+
+	if err = db.QueryRow(ctx, "INSERT INTO shows (name, num_seasons, platform_id, account_id, created_at, updated_at) VALUES ('Severance', 2, 1, $1, now(), now()) RETURNING id", first).Scan(&showID); err != nil {
+		t.Fatalf("error inserting show: %v", err)
+	}
+
+	if err = db.QueryRow(ctx, "INSERT INTO show_status (show_id, account_id, watch_status_id) VALUES ($1, $2, 1) RETURNING id", showID, second).Scan(&showStatusID); err != nil {
+		t.Fatalf("error inserting show status: %v", err)
+	}
+
+	_, err = newMigrationService(db, migrationFiles(t, 19)).Up()
+
+	if err == nil {
+		t.Fatalf("expected the migration to fail")
+	}
+
+	if !strings.Contains(err.Error(), fmt.Sprintf("show_status %d (account %d) for show %d (account %d)", showStatusID, second, showID, first)) {
+		t.Errorf("expected the mismatched row to be reported, got %v", err)
+	}
+
+	if err = db.QueryRow(ctx, "SELECT ss.account_id = s.account_id FROM show_status AS ss INNER JOIN shows AS s ON s.id = ss.show_id WHERE ss.id = $1", showStatusID).Scan(&accountMatches); err != nil {
+		t.Fatalf("error getting show status: %v", err)
+	}
+
+	if accountMatches {
+		t.Errorf("expected the show status to be left as it was")
+	}
+}
+
+/*
+insertAccount makes a user with their own household, and returns the
+household's ID.
+*/
+func insertAccount(t *testing.T, db *pgxpool.Pool, email string) int {
+	t.Helper()
+
+	var (
+		err       error
+		userID    int
+		accountID int
+	)
+
+	ctx := context.Background()
+
+	if err = db.QueryRow(ctx, "INSERT INTO users (created_at, active, email, password, auth_token) VALUES (now(), true, $1, '', $1) RETURNING id", email).Scan(&userID); err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+
+	if err = db.QueryRow(ctx, "INSERT INTO accounts (owner, join_token) VALUES ($1, $2) RETURNING id", userID, "join-"+email).Scan(&accountID); err != nil {
+		t.Fatalf("error inserting account: %v", err)
+	}
+
+	return accountID
+}
+
+func newMigrationService(db *pgxpool.Pool, source fs.FS) migrations.MigrationService {
+	return migrations.NewMigrationService(migrations.MigrationServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			DB:           db,
+			QueryTimeout: time.Minute,
+		},
+		Source: source,
+	})
+}
+
+/*
+migrationFiles returns the application's migrations up to and including
+version.
+*/
+func migrationFiles(t *testing.T, version int) fs.FS {
+	t.Helper()
+
+	source := os.DirFS(testdb.MigrationsDir())
+	result := fstest.MapFS{}
+
+	for v := 1; v <= version; v++ {
+		for _, name := range []string{fmt.Sprintf("commit%05d.sql", v), fmt.Sprintf("commit%05d.down.sql", v)} {
+			b, err := fs.ReadFile(source, name)
+
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			if err != nil {
+				t.Fatalf("error reading %s: %v", name, err)
+			}
+
+			result[name] = &fstest.MapFile{Data: b}
+		}
+	}
+
+	return result
+}
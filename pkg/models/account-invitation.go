@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type AccountInvitation struct {
+	ID             int        `json:"id" db:"id"`
+	AccountID      int        `json:"accountID" db:"account_id"`
+	Email          string     `json:"email" db:"email"`
+	InvitedBy      *int       `json:"invitedBy" db:"invited_by"`
+	InvitedByEmail string     `json:"invitedByEmail" db:"invited_by_email"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	ExpiresAt      time.Time  `json:"expiresAt" db:"expires_at"`
+	UsedAt         *time.Time `json:"usedAt" db:"used_at"`
+	RevokedAt      *time.Time `json:"revokedAt" db:"revoked_at"`
+}
+
+type CreateAccountInvitationRequest struct {
+	AccountID int
+	Email     string
+	InvitedBy int
+	Lifetime  time.Duration
+}
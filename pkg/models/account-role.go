@@ -0,0 +1,43 @@
+package models
+
+/*
+AccountRole is what a member may do in a household. The account's owner is
+always AccountRoleOwner.
+*/
+type AccountRole string
+
+const (
+	AccountRoleOwner  AccountRole = "owner"
+	AccountRoleMember AccountRole = "member"
+	AccountRoleViewer AccountRole = "viewer"
+)
+
+/*
+IsAssignable reports whether the owner can give this role to a member.
+Ownership is transferred, not assigned.
+*/
+func (r AccountRole) IsAssignable() bool {
+	return r == AccountRoleMember || r == AccountRoleViewer
+}
+
+/*
+CanEditShows reports whether the role can add and edit shows, and track
+what has been watched.
+*/
+func (r AccountRole) CanEditShows() bool {
+	return r == AccountRoleOwner || r == AccountRoleMember
+}
+
+/*
+CanDeleteShows reports whether the role can delete shows.
+*/
+func (r AccountRole) CanDeleteShows() bool {
+	return r == AccountRoleOwner
+}
+
+/*
+CanAddWatchers reports whether the role can add watchers to the household.
+*/
+func (r AccountRole) CanAddWatchers() bool {
+	return r == AccountRoleOwner || r == AccountRoleMember
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Account struct {
 	ID        `db:"account_id"`
 	Owner     int    `json:"owner" db:"account_owner"`
@@ -9,3 +11,41 @@ type Account struct {
 type CreateAccountRequest struct {
 	UserID int `json:"userID"`
 }
+
+type AccountSummary struct {
+	ID          int    `json:"id" db:"id"`
+	Owner       int    `json:"owner" db:"owner"`
+	OwnerEmail  string `json:"ownerEmail" db:"owner_email"`
+	JoinToken   string `json:"joinToken" db:"join_token"`
+	NumMembers  int    `json:"numMembers" db:"num_members"`
+	NumWatchers int    `json:"numWatchers" db:"num_watchers"`
+	NumShows    int    `json:"numShows" db:"num_shows"`
+}
+
+type AccountMember struct {
+	UserID      int         `json:"userID" db:"user_id"`
+	Email       string      `json:"email" db:"email"`
+	Active      bool        `json:"active" db:"active"`
+	IsOwner     bool        `json:"isOwner" db:"is_owner"`
+	Role        AccountRole `json:"role" db:"role"`
+	WatcherName string      `json:"watcherName" db:"watcher_name"`
+}
+
+/*
+DetachedMember is where a user ends up after leaving or being removed from
+an account. AccountID is the account they are using now.
+*/
+type DetachedMember struct {
+	AccountID int
+}
+
+/*
+AccountMembership is one of the households a user belongs to.
+*/
+type AccountMembership struct {
+	AccountID  int       `json:"accountID" db:"account_id"`
+	OwnerEmail string    `json:"ownerEmail" db:"owner_email"`
+	IsOwner    bool      `json:"isOwner" db:"is_owner"`
+	NumMembers int       `json:"numMembers" db:"num_members"`
+	JoinedAt   time.Time `json:"joinedAt" db:"joined_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	ApiTokenScopeRead  string = "read"
+	ApiTokenScopeWrite string = "write"
+)
+
+type ApiToken struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"userID" db:"user_id"`
+	UserEmail   string     `json:"userEmail" db:"user_email"`
+	AccountID   int        `json:"accountID" db:"account_id"`
+	Name        string     `json:"name" db:"name"`
+	TokenPrefix string     `json:"tokenPrefix" db:"token_prefix"`
+	Scope       string     `json:"scope" db:"scope"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	LastUsedAt  *time.Time `json:"lastUsedAt" db:"last_used_at"`
+	RevokedAt   *time.Time `json:"revokedAt" db:"revoked_at"`
+}
@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+/*
+AuditEventType is the kind of security event that happened.
+*/
+type AuditEventType string
+
+const (
+	AuditEventAccountVerified          AuditEventType = "account_verified"
+	AuditEventEmailChanged             AuditEventType = "email_changed"
+	AuditEventHouseholdJoined          AuditEventType = "household_joined"
+	AuditEventHouseholdLeft            AuditEventType = "household_left"
+	AuditEventHouseholdMemberRemoved   AuditEventType = "household_member_removed"
+	AuditEventHouseholdOwnerChanged    AuditEventType = "household_owner_changed"
+	AuditEventIdentityUnlinked         AuditEventType = "identity_unlinked"
+	AuditEventLogin                    AuditEventType = "login"
+	AuditEventLoginFailed              AuditEventType = "login_failed"
+	AuditEventLoginLocked              AuditEventType = "login_locked"
+	AuditEventLogout                   AuditEventType = "logout"
+	AuditEventPasskeyAdded             AuditEventType = "passkey_added"
+	AuditEventPasskeyRemoved           AuditEventType = "passkey_removed"
+	AuditEventPasswordChanged          AuditEventType = "password_changed"
+	AuditEventPasswordReset            AuditEventType = "password_reset"
+	AuditEventRecoveryCodesRegenerated AuditEventType = "recovery_codes_regenerated"
+	AuditEventSessionsLoggedOut        AuditEventType = "sessions_logged_out"
+	AuditEventTwoFactorDisabled        AuditEventType = "two_factor_disabled"
+	AuditEventTwoFactorEnabled         AuditEventType = "two_factor_enabled"
+)
+
+/*
+Description returns the event type in words, for showing to people.
+*/
+func (t AuditEventType) Description() string {
+	switch t {
+	case AuditEventAccountVerified:
+		return "Verified their account"
+	case AuditEventEmailChanged:
+		return "Changed their email address"
+	case AuditEventHouseholdJoined:
+		return "Joined the household"
+	case AuditEventHouseholdLeft:
+		return "Left the household"
+	case AuditEventHouseholdMemberRemoved:
+		return "Was removed from the household"
+	case AuditEventHouseholdOwnerChanged:
+		return "Became the household's owner"
+	case AuditEventIdentityUnlinked:
+		return "Unlinked a single sign-on account"
+	case AuditEventLogin:
+		return "Logged in"
+	case AuditEventLoginFailed:
+		return "Failed to log in"
+	case AuditEventLoginLocked:
+		return "Log ins locked after too many failures"
+	case AuditEventLogout:
+		return "Logged out"
+	case AuditEventPasskeyAdded:
+		return "Added a passkey"
+	case AuditEventPasskeyRemoved:
+		return "Removed a passkey"
+	case AuditEventPasswordChanged:
+		return "Changed their password"
+	case AuditEventPasswordReset:
+		return "Reset their password"
+	case AuditEventRecoveryCodesRegenerated:
+		return "Made new recovery codes"
+	case AuditEventSessionsLoggedOut:
+		return "Logged out other devices"
+	case AuditEventTwoFactorDisabled:
+		return "Turned off two-factor authentication"
+	case AuditEventTwoFactorEnabled:
+		return "Turned on two-factor authentication"
+	}
+
+	return string(t)
+}
+
+/*
+AuditEvent is a security event, such as a log in or password change.
+UserID is who it happened to. AccountID is the household it happened in.
+It is only empty for events recorded before that was kept.
+*/
+type AuditEvent struct {
+	ID        int            `json:"id" db:"id"`
+	UserID    int            `json:"userID" db:"user_id"`
+	UserEmail string         `json:"userEmail" db:"user_email"`
+	AccountID *int           `json:"accountID" db:"account_id"`
+	EventType AuditEventType `json:"eventType" db:"event_type"`
+	Details   string         `json:"details" db:"details"`
+	IPAddress string         `json:"ipAddress" db:"ip_address"`
+	UserAgent string         `json:"userAgent" db:"user_agent"`
+	CreatedAt time.Time      `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+const (
+	ImportActionCreate string = "create"
+	ImportActionUpdate string = "update"
+	ImportActionSkip   string = "skip"
+	ImportActionError  string = "error"
+)
+
+/*
+ImportRow is a single show read from an import source, before any
+platforms, watchers, or existing shows have been resolved.
+*/
+type ImportRow struct {
+	RowNumber     int        `json:"rowNumber"`
+	ShowName      string     `json:"showName"`
+	PlatformName  string     `json:"platformName"`
+	PlatformID    int        `json:"platformID"`
+	Status        string     `json:"status"`
+	CurrentSeason int        `json:"currentSeason"`
+	TotalSeasons  int        `json:"totalSeasons"`
+	WatcherNames  []string   `json:"watcherNames"`
+	PosterImage   string     `json:"posterImage"`
+	TVMazeID      int        `json:"tvmazeID"`
+	LastWatchedAt *time.Time `json:"lastWatchedAt"`
+	Problems      []string   `json:"problems"`
+}
+
+/*
+ImportPlanItem describes what an import will do with a single row.
+*/
+type ImportPlanItem struct {
+	Row            ImportRow `json:"row"`
+	Action         string    `json:"action"`
+	ExistingShowID int       `json:"existingShowID"`
+	PlatformID     int       `json:"platformID"`
+	PlatformName   string    `json:"platformName"`
+	WatchStatusID  int       `json:"watchStatusID"`
+	WatchStatus    string    `json:"watchStatus"`
+	CurrentSeason  int       `json:"currentSeason"`
+	TotalSeasons   int       `json:"totalSeasons"`
+	WatcherNames   []string  `json:"watcherNames"`
+	Changes        []string  `json:"changes"`
+	Problems       []string  `json:"problems"`
+}
+
+/*
+ImportPlan is the dry-run result of an import. Nothing is written
+until the plan is applied.
+*/
+type ImportPlan struct {
+	Items       []ImportPlanItem `json:"items"`
+	NewWatchers []string         `json:"newWatchers"`
+	NumCreate   int              `json:"numCreate"`
+	NumUpdate   int              `json:"numUpdate"`
+	NumSkip     int              `json:"numSkip"`
+	NumErrors   int              `json:"numErrors"`
+}
+
+type ImportResult struct {
+	ShowsCreated    int `json:"showsCreated"`
+	ShowsUpdated    int `json:"showsUpdated"`
+	WatchersCreated int `json:"watchersCreated"`
+}
+
+/*
+WatchHistoryShow is a show read from another tracking service's export.
+WatchedEpisodes maps a season number to the episode numbers watched in
+that season. It is empty for a show that is only on a watchlist.
+*/
+type WatchHistoryShow struct {
+	Title           string        `json:"title"`
+	Year            int           `json:"year"`
+	IMDBID          string        `json:"imdbID"`
+	TVDBID          int           `json:"tvdbID"`
+	WatchedEpisodes map[int][]int `json:"watchedEpisodes"`
+	LastWatchedAt   *time.Time    `json:"lastWatchedAt"`
+}
+
+/*
+UnmatchedImportItem is a show from an import that could not be found on
+TVMaze and needs to be added by hand.
+*/
+type UnmatchedImportItem struct {
+	Title  string `json:"title"`
+	Year   int    `json:"year"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+/*
+LoginSession is a device a user is logged in on.
+*/
+type LoginSession struct {
+	ID         int       `json:"id" db:"id"`
+	UserID     int       `json:"userID" db:"user_id"`
+	UserAgent  string    `json:"userAgent" db:"user_agent"`
+	IPAddress  string    `json:"ipAddress" db:"ip_address"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	LastSeenAt time.Time `json:"lastSeenAt" db:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expiresAt" db:"expires_at"`
+}
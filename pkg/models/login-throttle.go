@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+/*
+LoginThrottle counts failed log ins for an email address or IP address.
+LockedUntil is set once there have been too many.
+*/
+type LoginThrottle struct {
+	Key            string     `json:"key" db:"key"`
+	FailedAttempts int        `json:"failedAttempts" db:"failed_attempts"`
+	LockedUntil    *time.Time `json:"lockedUntil" db:"locked_until"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+/*
+IsLocked returns true when log ins are refused at the given time.
+*/
+func (t LoginThrottle) IsLocked(now time.Time) bool {
+	return t.LockedUntil != nil && t.LockedUntil.After(now)
+}
@@ -15,3 +15,16 @@ type OnlineShowSearchResult struct {
 	RawPlatformNames []string   `json:"rawPlatformNames"`
 	Weight           int        `json:"weight"`
 }
+
+/*
+OnlineShowMatch is a show found on TVMaze for an imported title, along
+with what is needed to work out how far through the show someone is.
+*/
+type OnlineShowMatch struct {
+	TVMazeID          int         `json:"tvmazeID"`
+	Name              string      `json:"name"`
+	NumSeasons        int         `json:"numSeasons"`
+	EpisodesPerSeason map[int]int `json:"episodesPerSeason"`
+	PosterImage       string      `json:"posterImage"`
+	Platforms         []Platform  `json:"platforms"`
+}
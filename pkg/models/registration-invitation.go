@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type RegistrationInvitation struct {
+	ID             int        `json:"id" db:"id"`
+	Email          string     `json:"email" db:"email"`
+	InvitedBy      *int       `json:"invitedBy" db:"invited_by"`
+	InvitedByEmail string     `json:"invitedByEmail" db:"invited_by_email"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	ExpiresAt      time.Time  `json:"expiresAt" db:"expires_at"`
+	UsedAt         *time.Time `json:"usedAt" db:"used_at"`
+}
+
+type CreateRegistrationInvitationRequest struct {
+	Email string
+
+	/*
+	   InvitedBy is the ID of the user sending the invitation. Zero means it
+	   came from an administrator.
+	*/
+	InvitedBy int
+	Lifetime  time.Duration
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+/*
+UserIdentity is an account at an OpenID Connect provider that a user can
+sign in with. Issuer and Subject identify it at the provider.
+*/
+type UserIdentity struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"userID" db:"user_id"`
+	Issuer    string    `json:"issuer" db:"issuer"`
+	Subject   string    `json:"subject" db:"subject"`
+	Email     string    `json:"email" db:"email"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type LinkUserIdentityRequest struct {
+	UserID  int
+	Issuer  string
+	Subject string
+	Email   string
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+/*
+UserPasskey is a passkey a user can log in with. CredentialID is base64url
+encoded and PublicKey is COSE encoded, as the authenticator sent them.
+*/
+type UserPasskey struct {
+	ID           int        `json:"id" db:"id"`
+	UserID       int        `json:"userID" db:"user_id"`
+	UserEmail    string     `json:"userEmail" db:"user_email"`
+	CredentialID string     `json:"credentialID" db:"credential_id"`
+	PublicKey    []byte     `json:"-" db:"public_key"`
+	SignCount    int64      `json:"-" db:"sign_count"`
+	Name         string     `json:"name" db:"name"`
+	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
+	LastUsedAt   *time.Time `json:"lastUsedAt" db:"last_used_at"`
+}
+
+type CreatePasskeyRequest struct {
+	UserID       int
+	CredentialID string
+	PublicKey    []byte
+	SignCount    int64
+	Name         string
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	UserTokenPurposeEmailLogin     = "email_login"
+	UserTokenPurposePasskeyLogin   = "passkey_login"
+	UserTokenPurposePasswordReset  = "password_reset"
+	UserTokenPurposeTwoFactorLogin = "two_factor_login"
+)
+
+type UserToken struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"userID" db:"user_id"`
+	UserEmail string     `json:"userEmail" db:"user_email"`
+	Purpose   string     `json:"purpose" db:"purpose"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	ExpiresAt time.Time  `json:"expiresAt" db:"expires_at"`
+	UsedAt    *time.Time `json:"usedAt" db:"used_at"`
+}
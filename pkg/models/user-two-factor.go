@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+/*
+UserTwoFactor is a user's authenticator app. EnabledAt is nil until the
+user confirms it with a code.
+*/
+type UserTwoFactor struct {
+	UserID                 int        `json:"userID" db:"user_id"`
+	Secret                 string     `json:"-" db:"secret"`
+	LastUsedStep           int64      `json:"-" db:"last_used_step"`
+	CreatedAt              time.Time  `json:"createdAt" db:"created_at"`
+	EnabledAt              *time.Time `json:"enabledAt" db:"enabled_at"`
+	RemainingRecoveryCodes int        `json:"remainingRecoveryCodes" db:"remaining_recovery_codes"`
+}
+
+func (t UserTwoFactor) IsEnabled() bool {
+	return t.EnabledAt != nil
+}
@@ -11,11 +11,24 @@ type User struct {
 	AuthToken      string   `json:"authToken"`
 	Account        *Account `json:"account,omitempty"`
 	ActivationCode string   `json:"activationCode,omitempty"`
+	PendingEmail   string   `json:"pendingEmail,omitempty"`
 }
 
 type CreateUserRequest struct {
 	Email    string
 	Password string
+
+	/*
+	   InvitationCode is used up when the user is created. Leave it empty
+	   when registration is open.
+	*/
+	InvitationCode string
+
+	/*
+	   AccountInvitationCode is used up when the user is created, and the
+	   user joins the account it is for.
+	*/
+	AccountInvitationCode string
 }
 
 type UserQueryResult struct {
@@ -29,6 +42,7 @@ type UserQueryResult struct {
 	AccountOwner     *int      `db:"account_owner"`
 	AccountJoinToken *string   `db:"join_token"`
 	ActivationCode   string    `db:"activation_code"`
+	PendingEmail     *string   `db:"pending_email"`
 }
 
 type AuthenticationResponse struct {
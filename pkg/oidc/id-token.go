@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	clockSkew = time.Minute
+)
+
+/*
+parseIDToken splits a signed ID token and decodes its header and claims. The
+signature is not checked.
+*/
+func parseIDToken(idToken string) (tokenHeader, Claims, []byte, []byte, error) {
+	var (
+		err       error
+		header    tokenHeader
+		claims    Claims
+		b         []byte
+		signature []byte
+	)
+
+	parts := strings.Split(idToken, ".")
+
+	if len(parts) != 3 {
+		return header, claims, nil, nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	if b, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return header, claims, nil, nil, fmt.Errorf("%w: error decoding header: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	if err = json.Unmarshal(b, &header); err != nil {
+		return header, claims, nil, nil, fmt.Errorf("%w: error parsing header: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	if b, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return header, claims, nil, nil, fmt.Errorf("%w: error decoding claims: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	if err = json.Unmarshal(b, &claims); err != nil {
+		return header, claims, nil, nil, fmt.Errorf("%w: error parsing claims: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	if signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return header, claims, nil, nil, fmt.Errorf("%w: error decoding signature: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	return header, claims, []byte(parts[0] + "." + parts[1]), signature, nil
+}
+
+/*
+verifySignature checks a token's signature with one public key. Only the
+asymmetric algorithms providers sign ID tokens with are allowed, so a token
+can't pick "none" or an HMAC keyed with something public.
+*/
+func verifySignature(alg string, key crypto.PublicKey, signingInput, signature []byte) error {
+	var (
+		hash crypto.Hash
+	)
+
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported signing algorithm %q", ErrInvalidIDToken, alg)
+	}
+
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+		}
+
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(k, hash, digest, signature, nil)
+		}
+
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			break
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		if len(signature) != size*2 {
+			return fmt.Errorf("%w: bad signature length", ErrInvalidIDToken)
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		if ecdsa.Verify(k, digest, r, s) {
+			return nil
+		}
+
+		return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	return fmt.Errorf("%w: key doesn't match signing algorithm %q", ErrInvalidIDToken, alg)
+}
+
+/*
+validateClaims checks that a token was issued by the provider, for this
+client, for this sign in, and hasn't expired.
+*/
+func validateClaims(claims Claims, issuer, clientID, nonce string, now time.Time) error {
+	if claims.Issuer != issuer {
+		return fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.Issuer)
+	}
+
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	if !claims.Audience.contains(clientID) {
+		return fmt.Errorf("%w: issued for another client", ErrInvalidIDToken)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != clientID {
+		return fmt.Errorf("%w: authorized party is not this client", ErrInvalidIDToken)
+	}
+
+	if claims.ExpiresAt == 0 || now.Add(-clockSkew).After(time.Unix(claims.ExpiresAt, 0)) {
+		return fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+
+	if claims.Nonce != nonce {
+		return fmt.Errorf("%w: nonce doesn't match", ErrInvalidIDToken)
+	}
+
+	return nil
+}
+
+/*
+publicKey turns a JSON web key into a public key. Keys that aren't for
+signatures, or of a type we don't support, return nil.
+*/
+func publicKey(jwk jsonWebKey) (crypto.PublicKey, error) {
+	var (
+		err error
+		n   []byte
+		e   []byte
+		x   []byte
+		y   []byte
+	)
+
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return nil, nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		if n, err = base64.RawURLEncoding.DecodeString(jwk.N); err != nil {
+			return nil, fmt.Errorf("error decoding RSA modulus: %w", err)
+		}
+
+		if e, err = base64.RawURLEncoding.DecodeString(jwk.E); err != nil {
+			return nil, fmt.Errorf("error decoding RSA exponent: %w", err)
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, fmt.Errorf("unsupported RSA exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+
+		if x, err = base64.RawURLEncoding.DecodeString(jwk.X); err != nil {
+			return nil, fmt.Errorf("error decoding EC x coordinate: %w", err)
+		}
+
+		if y, err = base64.RawURLEncoding.DecodeString(jwk.Y); err != nil {
+			return nil, fmt.Errorf("error decoding EC y coordinate: %w", err)
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+
+		if _, err = key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+
+		return key, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,135 @@
+package oidc
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+/*
+Claims are the parts of a verified ID token that Streaming Tracker uses.
+*/
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+/*
+VerifiedEmail returns the email address when the provider says it has
+verified it. Otherwise it returns "", since an unverified address could be
+anyone's, and must not be used to find a user.
+*/
+func (c Claims) VerifiedEmail() string {
+	if !c.EmailVerified {
+		return ""
+	}
+
+	return strings.TrimSpace(c.Email)
+}
+
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+/*
+audience is the aud claim, which may be a single string or a list.
+*/
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var (
+		err    error
+		single string
+		many   []string
+	)
+
+	if err = json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	if err = json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+
+	*a = audience(many)
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+flexBool is a boolean claim that some providers send as a string, such as
+email_verified.
+*/
+type flexBool bool
+
+func (f *flexBool) UnmarshalJSON(b []byte) error {
+	var (
+		err   error
+		value bool
+		str   string
+	)
+
+	if err = json.Unmarshal(b, &value); err == nil {
+		*f = flexBool(value)
+		return nil
+	}
+
+	if err = json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+
+	value, _ = strconv.ParseBool(str)
+	*f = flexBool(value)
+	return nil
+}
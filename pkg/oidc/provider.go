@@ -0,0 +1,398 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxResponseSize int64 = 1 << 20
+
+	/*
+	   keyRefreshInterval is the least time between fetching the provider's
+	   keys because a token was signed with one we don't know.
+	*/
+	keyRefreshInterval = time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+type ProviderServicer interface {
+	/*
+	   AuthCodeURL returns the address to send someone to so they can sign in
+	   with the provider. state, nonce, and codeVerifier must be new for
+	   every sign in, and kept until the provider sends them back.
+	*/
+	AuthCodeURL(state, nonce, codeVerifier string) (string, error)
+
+	/*
+	   Exchange trades the code the provider sent back for the claims in a
+	   verified ID token. Returns ErrInvalidIDToken when the token can't be
+	   trusted, including when it wasn't issued for this nonce.
+	*/
+	Exchange(code, codeVerifier, nonce string) (*Claims, error)
+}
+
+type ProviderServiceConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	HttpClient   *http.Client
+	Timeout      time.Duration
+}
+
+/*
+ProviderService signs people in with an OpenID Connect provider using the
+authorization code flow with PKCE. The provider's configuration and keys
+are discovered from its issuer the first time they are needed.
+*/
+type ProviderService struct {
+	config     ProviderServiceConfig
+	httpClient *http.Client
+
+	lock          *sync.Mutex
+	discovery     *discoveryDocument
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+func NewProviderService(config ProviderServiceConfig) *ProviderService {
+	httpClient := config.HttpClient
+
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = time.Second * 10
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	if !slices.Contains(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+
+	return &ProviderService{
+		config:     config,
+		httpClient: httpClient,
+		lock:       &sync.Mutex{},
+		keys:       map[string]crypto.PublicKey{},
+	}
+}
+
+/*
+NewSecret returns a random value for a sign in's state, nonce, or PKCE code
+verifier.
+*/
+func NewSecret() (string, error) {
+	var (
+		err error
+	)
+
+	b := make([]byte, 32)
+
+	if _, err = rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating secret: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+AuthCodeURL returns the address to send someone to so they can sign in with
+the provider.
+*/
+func (s *ProviderService) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	var (
+		err       error
+		discovery *discoveryDocument
+		u         *url.URL
+	)
+
+	if discovery, err = s.getDiscovery(); err != nil {
+		return "", err
+	}
+
+	if u, err = url.Parse(discovery.AuthorizationEndpoint); err != nil {
+		return "", fmt.Errorf("error parsing authorization endpoint: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", s.config.ClientID)
+	query.Set("redirect_uri", s.config.RedirectURL)
+	query.Set("scope", strings.Join(s.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+/*
+Exchange trades the code the provider sent back for the claims in a
+verified ID token.
+*/
+func (s *ProviderService) Exchange(code, codeVerifier, nonce string) (*Claims, error) {
+	var (
+		err       error
+		discovery *discoveryDocument
+		req       *http.Request
+		response  tokenResponse
+	)
+
+	if discovery, err = s.getDiscovery(); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	/*
+	 * Client secret basic is the default when a provider doesn't say what
+	 * it supports. Public clients have no secret to send.
+	 */
+	useBasicAuth := s.config.ClientSecret != "" &&
+		(len(discovery.TokenEndpointAuthMethodsSupported) == 0 || slices.Contains(discovery.TokenEndpointAuthMethodsSupported, "client_secret_basic"))
+
+	if !useBasicAuth {
+		form.Set("client_id", s.config.ClientID)
+
+		if s.config.ClientSecret != "" {
+			form.Set("client_secret", s.config.ClientSecret)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode())); err != nil {
+		return nil, fmt.Errorf("error creating token request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if useBasicAuth {
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	if err = s.doJSON(req, &response); err != nil {
+		if response.Error != "" {
+			return nil, fmt.Errorf("error exchanging code: %s %s", response.Error, response.ErrorDescription)
+		}
+
+		return nil, fmt.Errorf("error exchanging code: %w", err)
+	}
+
+	if response.IDToken == "" {
+		return nil, fmt.Errorf("%w: the provider didn't return one", ErrInvalidIDToken)
+	}
+
+	return s.verifyIDToken(response.IDToken, discovery, nonce)
+}
+
+func (s *ProviderService) verifyIDToken(idToken string, discovery *discoveryDocument, nonce string) (*Claims, error) {
+	var (
+		err          error
+		header       tokenHeader
+		claims       Claims
+		signingInput []byte
+		signature    []byte
+		keys         []crypto.PublicKey
+	)
+
+	if header, claims, signingInput, signature, err = parseIDToken(idToken); err != nil {
+		return nil, err
+	}
+
+	if keys, err = s.getKeys(discovery, header.Kid); err != nil {
+		return nil, err
+	}
+
+	verified := false
+
+	for _, key := range keys {
+		if err = verifySignature(header.Alg, key, signingInput, signature); err == nil {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, fmt.Errorf("%w: signature doesn't match any of the provider's keys", ErrInvalidIDToken)
+	}
+
+	if err = validateClaims(claims, discovery.Issuer, s.config.ClientID, nonce, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+/*
+getDiscovery fetches the provider's configuration, once.
+*/
+func (s *ProviderService) getDiscovery() (*discoveryDocument, error) {
+	var (
+		err       error
+		req       *http.Request
+		discovery discoveryDocument
+	)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(s.config.Issuer, "/")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil); err != nil {
+		return nil, fmt.Errorf("error creating discovery request: %w", err)
+	}
+
+	if err = s.doJSON(req, &discovery); err != nil {
+		return nil, fmt.Errorf("error fetching provider configuration: %w", err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("provider configuration is for issuer %q, not %q", discovery.Issuer, s.config.Issuer)
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("provider configuration is missing endpoints")
+	}
+
+	s.discovery = &discovery
+	return s.discovery, nil
+}
+
+/*
+getKeys returns the provider's signing keys that could have signed a token
+with the given key ID. The keys are fetched again when the ID is one we
+haven't seen, since providers rotate them.
+*/
+func (s *ProviderService) getKeys(discovery *discoveryDocument, kid string) ([]crypto.PublicKey, error) {
+	var (
+		err    error
+		req    *http.Request
+		keySet jsonWebKeySet
+		key    crypto.PublicKey
+	)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, known := s.keys[kid]
+	stale := time.Since(s.keysFetchedAt) > keyRefreshInterval
+
+	if (len(s.keys) == 0 || (kid != "" && !known)) && stale {
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+		defer cancel()
+
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, discovery.JwksURI, nil); err != nil {
+			return nil, fmt.Errorf("error creating keys request: %w", err)
+		}
+
+		if err = s.doJSON(req, &keySet); err != nil {
+			return nil, fmt.Errorf("error fetching provider keys: %w", err)
+		}
+
+		keys := map[string]crypto.PublicKey{}
+
+		for _, jwk := range keySet.Keys {
+			if key, err = publicKey(jwk); err != nil {
+				return nil, fmt.Errorf("error reading provider key %q: %w", jwk.Kid, err)
+			}
+
+			if key != nil {
+				keys[jwk.Kid] = key
+			}
+		}
+
+		s.keys = keys
+		s.keysFetchedAt = time.Now()
+	}
+
+	if kid != "" {
+		if key, known = s.keys[kid]; !known {
+			return nil, fmt.Errorf("%w: signed with unknown key %q", ErrInvalidIDToken, kid)
+		}
+
+		return []crypto.PublicKey{key}, nil
+	}
+
+	result := make([]crypto.PublicKey, 0, len(s.keys))
+
+	for _, key = range s.keys {
+		result = append(result, key)
+	}
+
+	return result, nil
+}
+
+/*
+doJSON sends a request and decodes the JSON response into dest. Error
+responses are decoded too, because token errors are described in the body.
+*/
+func (s *ProviderService) doJSON(req *http.Request, dest any) error {
+	var (
+		err      error
+		response *http.Response
+		body     []byte
+	)
+
+	if response, err = s.httpClient.Do(req); err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if body, err = io.ReadAll(io.LimitReader(response.Body, maxResponseSize)); err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	_ = json.Unmarshal(body, dest)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+
+	if err = json.Unmarshal(body, dest); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return nil
+}
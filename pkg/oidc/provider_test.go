@@ -0,0 +1,595 @@
+package oidc_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/oidc"
+)
+
+const (
+	testClientID     = "streaming-tracker"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://tracker.example.com/login/oidc/callback"
+)
+
+/*
+standInProvider is a small OpenID Connect provider. It serves discovery and
+keys, and hands out the ID token a test asks for in exchange for a code,
+once the PKCE code verifier matches the challenge it was given.
+*/
+type standInProvider struct {
+	server *httptest.Server
+
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	codes    map[string]pendingCode
+	numCodes int
+}
+
+type pendingCode struct {
+	challenge string
+	idToken   string
+}
+
+func newStandInProvider(t *testing.T) *standInProvider {
+	t.Helper()
+
+	var (
+		err error
+	)
+
+	p := &standInProvider{codes: map[string]pendingCode{}}
+
+	if p.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatalf("error generating RSA key: %v", err)
+	}
+
+	if p.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatalf("error generating EC key: %v", err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                p.issuer(),
+			"authorization_endpoint":                p.issuer() + "/authorize",
+			"token_endpoint":                        p.issuer() + "/token",
+			"jwks_uri":                              p.issuer() + "/jwks",
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+		})
+	})
+
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		size := (p.ecKey.Curve.Params().BitSize + 7) / 8
+
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa-1",
+					"use": "sig",
+					"n":   b64(p.rsaKey.N.Bytes()),
+					"e":   b64(big.NewInt(int64(p.rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC",
+					"kid": "ec-1",
+					"use": "sig",
+					"crv": "P-256",
+					"x":   b64(p.ecKey.X.FillBytes(make([]byte, size))),
+					"y":   b64(p.ecKey.Y.FillBytes(make([]byte, size))),
+				},
+				{
+					"kty": "RSA",
+					"kid": "enc-1",
+					"use": "enc",
+					"n":   b64(p.rsaKey.N.Bytes()),
+					"e":   b64(big.NewInt(int64(p.rsaKey.E)).Bytes()),
+				},
+			},
+		})
+	})
+
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+
+		if !ok || clientID != testClientID || clientSecret != testClientSecret {
+			writeTestJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != testRedirectURL {
+			writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		p.mu.Lock()
+		pending, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code"))
+		p.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+		if !ok || b64(verifier[:]) != pending.challenge {
+			writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code or verifier is wrong"})
+			return
+		}
+
+		writeTestJSON(w, http.StatusOK, map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     pending.idToken,
+		})
+	})
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *standInProvider) issuer() string {
+	return p.server.URL
+}
+
+/*
+authorize plays the part of the user signing in at the provider. It takes
+the PKCE challenge from the sign in address and returns a code that can be
+exchanged for idToken.
+*/
+func (p *standInProvider) authorize(t *testing.T, authURL, idToken string) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+
+	if err != nil {
+		t.Fatalf("error parsing sign in address: %v", err)
+	}
+
+	if method := u.Query().Get("code_challenge_method"); method != "S256" {
+		t.Fatalf("expected an S256 code challenge, got %q", method)
+	}
+
+	p.mu.Lock()
+	p.numCodes++
+	code := fmt.Sprintf("code-%d", p.numCodes)
+	p.codes[code] = pendingCode{challenge: u.Query().Get("code_challenge"), idToken: idToken}
+	p.mu.Unlock()
+
+	return code
+}
+
+func (p *standInProvider) claims(nonce string) map[string]any {
+	now := time.Now()
+
+	return map[string]any{
+		"iss":            p.issuer(),
+		"sub":            "user-123",
+		"aud":            testClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "adam@example.com",
+		"email_verified": true,
+	}
+}
+
+func (p *standInProvider) signRS256(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+
+	signingInput := encodeSigningInput(t, map[string]string{"alg": "RS256", "kid": kid}, claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:])
+
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	return signingInput + "." + b64(signature)
+}
+
+func (p *standInProvider) signES256(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+
+	signingInput := encodeSigningInput(t, map[string]string{"alg": "ES256", "kid": kid}, claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, s, err := ecdsa.Sign(rand.Reader, p.ecKey, digest[:])
+
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signingInput + "." + b64(signature)
+}
+
+func newTestProviderService(p *standInProvider) *oidc.ProviderService {
+	return oidc.NewProviderService(oidc.ProviderServiceConfig{
+		Issuer:       p.issuer(),
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		HttpClient:   p.server.Client(),
+	})
+}
+
+/*
+signIn runs a whole sign in. The provider hands back idToken, made by
+makeToken from the nonce the service sent. exchangeNonce is the nonce the
+service expects back, which is normally the same one.
+*/
+func signIn(t *testing.T, p *standInProvider, service *oidc.ProviderService, makeToken func(nonce string) string, exchangeNonce string) (*oidc.Claims, error) {
+	t.Helper()
+
+	nonce := "nonce-" + t.Name()
+	verifier := "verifier-" + t.Name()
+
+	authURL, err := service.AuthCodeURL("state", nonce, verifier)
+
+	if err != nil {
+		t.Fatalf("error building sign in address: %v", err)
+	}
+
+	if exchangeNonce == "" {
+		exchangeNonce = nonce
+	}
+
+	code := p.authorize(t, authURL, makeToken(nonce))
+	return service.Exchange(code, verifier, exchangeNonce)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p := newStandInProvider(t)
+
+	authURL, err := newTestProviderService(p).AuthCodeURL("the-state", "the-nonce", "the-verifier")
+
+	if err != nil {
+		t.Fatalf("error building sign in address: %v", err)
+	}
+
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	challenge := sha256.Sum256([]byte("the-verifier"))
+
+	expected := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        b64(challenge[:]),
+		"code_challenge_method": "S256",
+		"scope":                 "openid email profile",
+	}
+
+	if !strings.HasPrefix(authURL, p.issuer()+"/authorize?") {
+		t.Errorf("expected the provider's authorization endpoint, got %s", authURL)
+	}
+
+	for key, value := range expected {
+		if query.Get(key) != value {
+			t.Errorf("expected %s to be %q, got %q", key, value, query.Get(key))
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	p := newStandInProvider(t)
+
+	service := oidc.NewProviderService(oidc.ProviderServiceConfig{
+		Issuer:     p.issuer() + "/other",
+		ClientID:   testClientID,
+		HttpClient: p.server.Client(),
+	})
+
+	if _, err := service.AuthCodeURL("state", "nonce", "verifier"); err == nil {
+		t.Errorf("expected an error when discovery is for another issuer")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	p := newStandInProvider(t)
+
+	tests := []struct {
+		name          string
+		makeToken     func(t *testing.T, nonce string) string
+		exchangeNonce string
+		wantErr       bool
+	}{
+		{
+			name: "RS256 token",
+			makeToken: func(t *testing.T, nonce string) string {
+				return p.signRS256(t, "rsa-1", p.claims(nonce))
+			},
+		},
+		{
+			name: "ES256 token",
+			makeToken: func(t *testing.T, nonce string) string {
+				return p.signES256(t, "ec-1", p.claims(nonce))
+			},
+		},
+		{
+			name: "token without a key ID",
+			makeToken: func(t *testing.T, nonce string) string {
+				return p.signRS256(t, "", p.claims(nonce))
+			},
+		},
+		{
+			name: "bad signature",
+			makeToken: func(t *testing.T, nonce string) string {
+				token := p.signRS256(t, "rsa-1", p.claims(nonce))
+				parts := strings.Split(token, ".")
+				tampered := p.claims(nonce)
+				tampered["sub"] = "someone-else"
+
+				return encodeSigningInput(t, map[string]string{"alg": "RS256", "kid": "rsa-1"}, tampered) + "." + parts[2]
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed with another key",
+			makeToken: func(t *testing.T, nonce string) string {
+				other, _ := rsa.GenerateKey(rand.Reader, 2048)
+				signingInput := encodeSigningInput(t, map[string]string{"alg": "RS256", "kid": "rsa-1"}, p.claims(nonce))
+				digest := sha256.Sum256([]byte(signingInput))
+				signature, _ := rsa.SignPKCS1v15(rand.Reader, other, crypto.SHA256, digest[:])
+
+				return signingInput + "." + b64(signature)
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed with an encryption key",
+			makeToken: func(t *testing.T, nonce string) string {
+				return p.signRS256(t, "enc-1", p.claims(nonce))
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned token",
+			makeToken: func(t *testing.T, nonce string) string {
+				return encodeSigningInput(t, map[string]string{"alg": "none"}, p.claims(nonce)) + "."
+			},
+			wantErr: true,
+		},
+		{
+			name: "RSA key used with an EC algorithm",
+			makeToken: func(t *testing.T, nonce string) string {
+				token := p.signRS256(t, "rsa-1", p.claims(nonce))
+				parts := strings.Split(token, ".")
+
+				return encodeSigningInput(t, map[string]string{"alg": "ES256", "kid": "rsa-1"}, p.claims(nonce)) + "." + parts[2]
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				claims["iss"] = "https://evil.example.com"
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "issued for another client",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				claims["aud"] = "another-client"
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "several audiences with this client as the authorized party",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				claims["aud"] = []string{testClientID, "another-client"}
+				claims["azp"] = testClientID
+				return p.signRS256(t, "rsa-1", claims)
+			},
+		},
+		{
+			name: "several audiences with another authorized party",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				claims["aud"] = []string{testClientID, "another-client"}
+				claims["azp"] = "another-client"
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "several audiences without an authorized party",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				claims["aud"] = []string{testClientID, "another-client"}
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "no expiry",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				delete(claims, "exp")
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "issued in the future",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				claims["iat"] = time.Now().Add(time.Hour).Unix()
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "no subject",
+			makeToken: func(t *testing.T, nonce string) string {
+				claims := p.claims(nonce)
+				delete(claims, "sub")
+				return p.signRS256(t, "rsa-1", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "nonce from another sign in",
+			makeToken: func(t *testing.T, nonce string) string {
+				return p.signRS256(t, "rsa-1", p.claims(nonce))
+			},
+			exchangeNonce: "a-different-nonce",
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestProviderService(p)
+
+			claims, err := signIn(t, p, service, func(nonce string) string { return tt.makeToken(t, nonce) }, tt.exchangeNonce)
+
+			if tt.wantErr {
+				if !errors.Is(err, oidc.ErrInvalidIDToken) {
+					t.Fatalf("expected ErrInvalidIDToken, got claims %+v and error %v", claims, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if claims.Issuer != p.issuer() || claims.Subject != "user-123" || claims.Email != "adam@example.com" {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestExchangePKCE(t *testing.T) {
+	p := newStandInProvider(t)
+	service := newTestProviderService(p)
+
+	authURL, err := service.AuthCodeURL("state", "nonce", "the-real-verifier")
+
+	if err != nil {
+		t.Fatalf("error building sign in address: %v", err)
+	}
+
+	code := p.authorize(t, authURL, p.signRS256(t, "rsa-1", p.claims("nonce")))
+
+	if _, err = service.Exchange(code, "a-stolen-code-without-its-verifier", "nonce"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("expected the provider to refuse the wrong code verifier, got %v", err)
+	}
+
+	code = p.authorize(t, authURL, p.signRS256(t, "rsa-1", p.claims("nonce")))
+
+	if _, err = service.Exchange(code, "the-real-verifier", "nonce"); err != nil {
+		t.Fatalf("expected the right code verifier to work, got %v", err)
+	}
+}
+
+func TestVerifiedEmail(t *testing.T) {
+	p := newStandInProvider(t)
+
+	tests := []struct {
+		name          string
+		emailVerified any
+		want          string
+	}{
+		{name: "verified", emailVerified: true, want: "adam@example.com"},
+		{name: "verified as a string", emailVerified: "true", want: "adam@example.com"},
+		{name: "not verified", emailVerified: false, want: ""},
+		{name: "not verified as a string", emailVerified: "false", want: ""},
+		{name: "not sent", emailVerified: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestProviderService(p)
+
+			claims, err := signIn(t, p, service, func(nonce string) string {
+				claims := p.claims(nonce)
+
+				if tt.emailVerified == nil {
+					delete(claims, "email_verified")
+				} else {
+					claims["email_verified"] = tt.emailVerified
+				}
+
+				return p.signRS256(t, "rsa-1", claims)
+			}, "")
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if got := claims.VerifiedEmail(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func encodeSigningInput(t *testing.T, header map[string]string, claims map[string]any) string {
+	t.Helper()
+
+	h, err := json.Marshal(header)
+
+	if err != nil {
+		t.Fatalf("error encoding header: %v", err)
+	}
+
+	c, err := json.Marshal(claims)
+
+	if err != nil {
+		t.Fatalf("error encoding claims: %v", err)
+	}
+
+	return b64(h) + "." + b64(c)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,606 @@
+/*
+Package qrcode draws QR codes for short text, such as the otpauth:// links
+authenticator apps scan. It only does what that needs: byte mode, medium
+error correction, and versions 1 through 20, which hold up to 666 bytes.
+*/
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxVersion = 20
+	quietZone  = 4
+)
+
+var (
+	ErrTooLong = errors.New("text is too long for a QR code")
+)
+
+/*
+blockLayout is how a version's codewords are split into error correction
+blocks at level M. The first group's blocks are one data codeword shorter
+than the second's.
+*/
+type blockLayout struct {
+	ecPerBlock   int
+	group1Blocks int
+	group1Data   int
+	group2Blocks int
+	group2Data   int
+}
+
+var layouts = [maxVersion + 1]blockLayout{
+	{},
+	{10, 1, 16, 0, 0},
+	{16, 1, 28, 0, 0},
+	{26, 1, 44, 0, 0},
+	{18, 2, 32, 0, 0},
+	{24, 2, 43, 0, 0},
+	{16, 4, 27, 0, 0},
+	{18, 4, 31, 0, 0},
+	{22, 2, 38, 2, 39},
+	{22, 3, 36, 2, 37},
+	{26, 4, 43, 1, 44},
+	{30, 1, 50, 4, 51},
+	{22, 6, 36, 2, 37},
+	{22, 8, 37, 1, 38},
+	{24, 4, 40, 5, 41},
+	{24, 5, 41, 5, 42},
+	{28, 7, 45, 3, 46},
+	{28, 10, 46, 1, 47},
+	{26, 9, 43, 4, 44},
+	{26, 3, 44, 11, 45},
+	{26, 3, 41, 13, 42},
+}
+
+func (l blockLayout) dataCodewords() int {
+	return l.group1Blocks*l.group1Data + l.group2Blocks*l.group2Data
+}
+
+/*
+Code is an encoded QR code. Modules are indexed [y][x], and true is dark.
+*/
+type Code struct {
+	Size    int
+	Modules [][]bool
+
+	isFunction [][]bool
+}
+
+/*
+Encode makes the smallest QR code that holds text.
+*/
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	version := 0
+
+	for v := 1; v <= maxVersion; v++ {
+		if len(data) <= maxBytes(v) {
+			version = v
+			break
+		}
+	}
+
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLong, len(data))
+	}
+
+	size := version*4 + 17
+
+	c := &Code{
+		Size:       size,
+		Modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+
+	for y := range size {
+		c.Modules[y] = make([]bool, size)
+		c.isFunction[y] = make([]bool, size)
+	}
+
+	c.drawFunctionPatterns(version)
+	c.drawCodewords(addErrorCorrection(version, encodeData(version, data)))
+
+	bestMask := 0
+	bestPenalty := -1
+
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask = mask
+			bestPenalty = penalty
+		}
+
+		c.applyMask(mask)
+	}
+
+	c.applyMask(bestMask)
+	c.drawFormatBits(bestMask)
+
+	return c, nil
+}
+
+/*
+SVG draws the code as an SVG image with a quiet zone around it. moduleSize
+is the width of each module in pixels.
+*/
+func (c *Code) SVG(moduleSize int) string {
+	var b strings.Builder
+
+	width := (c.Size + quietZone*2) * moduleSize
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, c.Size+quietZone*2, c.Size+quietZone*2, width, width)
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+
+	for y := range c.Size {
+		for x := range c.Size {
+			if c.Modules[y][x] {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}
+
+/*
+maxBytes is how much text a version holds in byte mode.
+*/
+func maxBytes(version int) int {
+	bits := layouts[version].dataCodewords()*8 - 4 - countBits(version)
+	return bits / 8
+}
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+
+	return 16
+}
+
+/*
+encodeData turns text into a version's data codewords: the byte mode
+header, the text, a terminator, and padding.
+*/
+func encodeData(version int, data []byte) []byte {
+	capacity := layouts[version].dataCodewords() * 8
+	bits := &bitBuffer{}
+
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits(version))
+
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	bits.append(0, min(4, capacity-bits.length))
+	bits.append(0, (8-bits.length%8)%8)
+
+	for pad := 0xEC; bits.length < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	return bits.bytes
+}
+
+/*
+addErrorCorrection splits data codewords into blocks, adds Reed-Solomon
+error correction to each, and interleaves them in the order they are
+drawn.
+*/
+func addErrorCorrection(version int, data []byte) []byte {
+	layout := layouts[version]
+	divisor := reedSolomonDivisor(layout.ecPerBlock)
+
+	dataBlocks := [][]byte{}
+	ecBlocks := [][]byte{}
+	offset := 0
+
+	for i := range layout.group1Blocks + layout.group2Blocks {
+		length := layout.group1Data
+
+		if i >= layout.group1Blocks {
+			length = layout.group2Data
+		}
+
+		block := data[offset : offset+length]
+		offset += length
+
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	result := make([]byte, 0, len(data)+len(ecBlocks)*layout.ecPerBlock)
+
+	for i := range max(layout.group1Data, layout.group2Data) {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	for i := range layout.ecPerBlock {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.Modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+/*
+drawFunctionPatterns draws everything that isn't data: the finder, timing,
+and alignment patterns, and the version information. The format bits are
+reserved here and drawn once the mask is chosen.
+*/
+func (c *Code) drawFunctionPatterns(version int) {
+	for i := range c.Size {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions(version)
+	last := len(positions) - 1
+
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	c.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+
+		for range 12 {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+
+		bits := version<<12 | rem
+
+		for i := range 18 {
+			dark := (bits>>i)&1 != 0
+			a := c.Size - 11 + i%3
+			b := i / 3
+
+			c.setFunction(a, b, dark)
+			c.setFunction(b, a, dark)
+		}
+	}
+}
+
+/*
+drawFinder draws a finder pattern and its separator centered on x, y.
+*/
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+
+			distance := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, distance != 2 && distance != 4)
+		}
+	}
+}
+
+/*
+drawFormatBits draws both copies of the error correction level and mask.
+*/
+func (c *Code) drawFormatBits(mask int) {
+	const levelM = 0
+
+	data := levelM<<3 | mask
+	rem := data
+
+	for range 10 {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool {
+		return (bits>>i)&1 != 0
+	}
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+
+	c.setFunction(8, c.Size-8, true)
+}
+
+/*
+drawCodewords fills the data area in the zigzag order, two columns at a
+time from the bottom right, skipping the vertical timing pattern.
+*/
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		upward := (right+1)&2 == 0
+
+		for vert := range c.Size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+
+				if upward {
+					y = c.Size - 1 - vert
+				}
+
+				if c.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+
+				c.Modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+/*
+applyMask flips the data modules a mask pattern selects. Applying the same
+mask twice undoes it.
+*/
+func (c *Code) applyMask(mask int) {
+	for y := range c.Size {
+		for x := range c.Size {
+			if c.isFunction[y][x] {
+				continue
+			}
+
+			var flip bool
+
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+
+			if flip {
+				c.Modules[y][x] = !c.Modules[y][x]
+			}
+		}
+	}
+}
+
+/*
+penalty scores how hard the code would be to scan, by the four rules in
+ISO/IEC 18004. Lower is better. Past the edge of the code counts as light,
+since the quiet zone is there.
+*/
+func (c *Code) penalty() int {
+	result := 0
+	dark := 0
+
+	for i := range c.Size {
+		row := make([]bool, c.Size)
+		column := make([]bool, c.Size)
+
+		for j := range c.Size {
+			row[j] = c.Modules[i][j]
+			column[j] = c.Modules[j][i]
+
+			if row[j] {
+				dark++
+			}
+		}
+
+		result += linePenalty(row) + linePenalty(column)
+	}
+
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			color := c.Modules[y][x]
+
+			if color == c.Modules[y][x+1] && color == c.Modules[y+1][x] && color == c.Modules[y+1][x+1] {
+				result += 3
+			}
+		}
+	}
+
+	/*
+	 * 10 points for every full 5% the dark modules are away from half.
+	 */
+	total := c.Size * c.Size
+	result += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+
+	return result
+}
+
+/*
+linePenalty scores a row or column for runs of five or more modules of
+the same color, and for patterns that look like a finder: dark, light,
+three dark, light, dark, at any module width, with four widths of light on
+one side.
+*/
+func linePenalty(line []bool) int {
+	result := 0
+
+	/*
+	 * runs holds the lengths of the last seven runs, newest first. The
+	 * first run is light, and includes the quiet zone before the line.
+	 */
+	runs := make([]int, 7)
+
+	addRun := func(length int) {
+		if runs[0] == 0 {
+			length += len(line)
+		}
+
+		copy(runs[1:], runs)
+		runs[0] = length
+	}
+
+	finderLike := func() int {
+		width := runs[1]
+
+		if width == 0 || runs[2] != width || runs[3] != width*3 || runs[4] != width || runs[5] != width {
+			return 0
+		}
+
+		count := 0
+
+		if runs[0] >= width*4 && runs[6] >= width {
+			count++
+		}
+
+		if runs[6] >= width*4 && runs[0] >= width {
+			count++
+		}
+
+		return count * 40
+	}
+
+	color := false
+	run := 0
+
+	for _, dark := range line {
+		if dark == color {
+			run++
+
+			if run == 5 {
+				result += 3
+			} else if run > 5 {
+				result++
+			}
+
+			continue
+		}
+
+		addRun(run)
+
+		/*
+		 * Only a light run can finish a finder-like pattern.
+		 */
+		if !color {
+			result += finderLike()
+		}
+
+		color = dark
+		run = 1
+	}
+
+	/*
+	 * The quiet zone after the line is light too.
+	 */
+	if color {
+		addRun(run)
+		run = 0
+	}
+
+	addRun(run + len(line))
+	return result + finderLike()
+}
+
+/*
+alignmentPositions returns the centers of a version's alignment patterns
+along each axis.
+*/
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	count := version/7 + 2
+	step := (version*4 + count*2 + 1) / (count*2 - 2) * 2
+	result := make([]int, count)
+	result[0] = 6
+
+	for i, position := count-1, version*4+10; i > 0; i, position = i-1, position-step {
+		result[i] = position
+	}
+
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+type bitBuffer struct {
+	bytes  []byte
+	length int
+}
+
+func (b *bitBuffer) append(value, count int) {
+	for i := count - 1; i >= 0; i-- {
+		if b.length%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+
+		if (value>>i)&1 != 0 {
+			b.bytes[b.length/8] |= 0x80 >> (b.length % 8)
+		}
+
+		b.length++
+	}
+}
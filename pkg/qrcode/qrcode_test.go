@@ -0,0 +1,213 @@
+package qrcode_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/streaming-tracker/pkg/qrcode"
+)
+
+const (
+	levelM = 0
+)
+
+func TestEncode(t *testing.T) {
+	/*
+	 * Where go-qrcode also uses byte mode, the codes were checked against
+	 * it drawn with the same mask. The masks were checked against the
+	 * penalty scoring in Nayuki's QR code generator.
+	 */
+	tests := []struct {
+		name        string
+		text        string
+		wantVersion int
+		wantMask    int
+	}{
+		{name: "short text", text: "hello, world", wantVersion: 1, wantMask: 0},
+		{name: "most a version 1 code holds", text: strings.Repeat("a", 14), wantVersion: 1, wantMask: 2},
+		{name: "one byte more than version 1 holds", text: strings.Repeat("a", 15), wantVersion: 2, wantMask: 2},
+		{name: "email address", text: "adam@example.com", wantVersion: 2, wantMask: 2},
+		{name: "link", text: "https://example.com/a/much/longer/path/that/needs/a/bigger/version?with=query&and=more", wantVersion: 6, wantMask: 2},
+		{
+			name:        "authenticator key",
+			text:        "otpauth://totp/Streaming%20Tracker:adam%40example.com?algorithm=SHA1&digits=6&issuer=Streaming%20Tracker&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+			wantVersion: 9,
+			wantMask:    6,
+		},
+		{name: "version 10, with a longer length", text: strings.Repeat("a", 200), wantVersion: 10, wantMask: 1},
+		{name: "most the largest version holds", text: strings.Repeat("x", 666), wantVersion: 20, wantMask: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := qrcode.Encode(tt.text)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if code.Size != tt.wantVersion*4+17 {
+				t.Fatalf("expected version %d, %d modules wide, got %d", tt.wantVersion, tt.wantVersion*4+17, code.Size)
+			}
+
+			level, mask := formatBits(t, code)
+
+			if level != levelM || mask != tt.wantMask {
+				t.Errorf("expected level M and mask %d, got level %d and mask %d", tt.wantMask, level, mask)
+			}
+
+			if tt.wantVersion >= 7 {
+				if got := versionBits(code); got != tt.wantVersion {
+					t.Errorf("expected version information for %d, got %d", tt.wantVersion, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeModules(t *testing.T) {
+	/*
+	 * "hello, world" at level M with mask 0, as go-qrcode draws it.
+	 */
+	want := []string{
+		"#######..#.##.#######",
+		"#.....#.##..#.#.....#",
+		"#.###.#..#..#.#.###.#",
+		"#.###.#...##..#.###.#",
+		"#.###.#.#..##.#.###.#",
+		"#.....#....#..#.....#",
+		"#######.#.#.#.#######",
+		"..........#..........",
+		"#.#.#.#..#..#...#..#.",
+		"#.##...###.#....#..##",
+		".#..####.###.#.######",
+		"####.#.######..#...#.",
+		".######.#.##....#....",
+		"........##.#..###.###",
+		"#######..#..##..#.###",
+		"#.....#....#...#...#.",
+		"#.###.#.##.###.#...#.",
+		"#.###.#..#.###.##.##.",
+		"#.###.#.#..##...#.#.#",
+		"#.....#..#.#....#..#.",
+		"#######.####...#...##",
+	}
+
+	code, err := qrcode.Encode("hello, world")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if code.Size != len(want) {
+		t.Fatalf("expected %d modules wide, got %d", len(want), code.Size)
+	}
+
+	for y, row := range code.Modules {
+		var got strings.Builder
+
+		for _, dark := range row {
+			if dark {
+				got.WriteByte('#')
+			} else {
+				got.WriteByte('.')
+			}
+		}
+
+		if got.String() != want[y] {
+			t.Errorf("row %d: expected %s, got %s", y, want[y], got.String())
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := qrcode.Encode(strings.Repeat("x", 667)); !errors.Is(err, qrcode.ErrTooLong) {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	code, err := qrcode.Encode("hello, world")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	svg := code.SVG(4)
+
+	/*
+	 * 21 modules and a quiet zone of 4 on each side, at 4 pixels each.
+	 */
+	if !strings.Contains(svg, `viewBox="0 0 29 29" width="116" height="116"`) {
+		t.Errorf("expected a 29 module image 116 pixels wide, got %s", svg)
+	}
+
+	if !strings.Contains(svg, "M4 4h1v1h-1z") {
+		t.Errorf("expected the top left module inside the quiet zone, got %s", svg)
+	}
+}
+
+/*
+formatBits reads the error correction level and mask from both copies of
+the format information, and fails if they disagree.
+*/
+func formatBits(t *testing.T, code *qrcode.Code) (int, int) {
+	t.Helper()
+
+	first := 0
+	second := 0
+
+	bit := func(x, y int) int {
+		if code.Modules[y][x] {
+			return 1
+		}
+
+		return 0
+	}
+
+	for i := 0; i <= 5; i++ {
+		first |= bit(8, i) << i
+	}
+
+	first |= bit(8, 7)<<6 | bit(8, 8)<<7 | bit(7, 8)<<8
+
+	for i := 9; i < 15; i++ {
+		first |= bit(14-i, 8) << i
+	}
+
+	for i := range 8 {
+		second |= bit(code.Size-1-i, 8) << i
+	}
+
+	for i := 8; i < 15; i++ {
+		second |= bit(8, code.Size-15+i) << i
+	}
+
+	if first != second {
+		t.Fatalf("expected both copies of the format information to match, got %015b and %015b", first, second)
+	}
+
+	if bit(8, code.Size-8) != 1 {
+		t.Errorf("expected the dark module to be dark")
+	}
+
+	data := (first ^ 0x5412) >> 10
+	return data >> 3, data & 7
+}
+
+/*
+versionBits reads the version from the version information above the
+bottom left finder.
+*/
+func versionBits(code *qrcode.Code) int {
+	bits := 0
+
+	for i := range 18 {
+		if code.Modules[code.Size-11+i%3][i/3] {
+			bits |= 1 << i
+		}
+	}
+
+	return bits >> 12
+}
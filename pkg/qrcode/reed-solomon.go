@@ -0,0 +1,59 @@
+package qrcode
+
+/*
+reedSolomonDivisor returns the generator polynomial for degree error
+correction codewords, highest power first with the leading 1 left off.
+*/
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+
+	for range degree {
+		for j := range degree {
+			result[j] = gfMultiply(result[j], root)
+
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+/*
+reedSolomonRemainder returns the error correction codewords for a block of
+data.
+*/
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+
+	return result
+}
+
+/*
+gfMultiply multiplies in GF(2^8) with the QR code polynomial 0x11D.
+*/
+func gfMultiply(x, y byte) byte {
+	z := 0
+
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+
+	return byte(z)
+}
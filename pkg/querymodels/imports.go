@@ -0,0 +1,18 @@
+package querymodels
+
+type ImportPlatformName struct {
+	PlatformID   int    `db:"platform_id"`
+	PlatformName string `db:"platform_name"`
+	Name         string `db:"name"`
+}
+
+type ImportExistingShow struct {
+	ShowID        int      `db:"show_id"`
+	ShowName      string   `db:"show_name"`
+	TVMazeID      int      `db:"tvmaze_id"`
+	NumSeasons    int      `db:"num_seasons"`
+	WatchStatusID int      `db:"watch_status_id"`
+	CurrentSeason int      `db:"current_season"`
+	Cancelled     bool     `db:"cancelled"`
+	WatcherNames  []string `db:"watcher_names"`
+}
@@ -5,11 +5,14 @@ type SearchShowsRequest struct {
 }
 
 type AddShowRequest struct {
-	Name         string `json:"name"`
-	TotalSeasons int    `json:"totalSeasons"`
-	PlatformID   int    `json:"platformID"`
-	WatcherIDs   []int  `json:"watcherIDs"`
-	PosterImage  string `json:"posterImage"`
+	Name          string `json:"name"`
+	TotalSeasons  int    `json:"totalSeasons"`
+	PlatformID    int    `json:"platformID"`
+	WatcherIDs    []int  `json:"watcherIDs"`
+	PosterImage   string `json:"posterImage"`
+	WatchStatusID int    `json:"watchStatusID"`
+	CurrentSeason int    `json:"currentSeason"`
+	TVMazeID      int    `json:"tvmazeID"`
 }
 
 type EditShowRequest struct {
@@ -20,3 +23,12 @@ type EditShowRequest struct {
 	WatcherIDs   []int  `json:"watcherIDs"`
 	PosterImage  string `json:"posterImage"`
 }
+
+type UpdateShowProgressRequest struct {
+	ShowID        int   `json:"showID"`
+	WatchStatusID int   `json:"watchStatusID"`
+	CurrentSeason int   `json:"currentSeason"`
+	NumSeasons    int   `json:"numSeasons"`
+	WatcherIDs    []int `json:"watcherIDs"`
+	TVMazeID      int   `json:"tvmazeID"`
+}
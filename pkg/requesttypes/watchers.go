@@ -0,0 +1,5 @@
+package requesttypes
+
+type WatcherNameRequest struct {
+	Name string `json:"name"`
+}
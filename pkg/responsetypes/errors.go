@@ -0,0 +1,30 @@
+package responsetypes
+
+/*
+Error codes returned in the "code" field of an API error response. Clients
+should check the code rather than the message, which is meant for people.
+*/
+const (
+	ErrorCodeBadRequest            = "bad_request"
+	ErrorCodeValidationFailed      = "validation_failed"
+	ErrorCodeUnauthorized          = "unauthorized"
+	ErrorCodeInvalidToken          = "invalid_token"
+	ErrorCodeInsufficientScope     = "insufficient_scope"
+	ErrorCodeForbidden             = "forbidden"
+	ErrorCodeNotFound              = "not_found"
+	ErrorCodeShowNotFound          = "show_not_found"
+	ErrorCodeShowHasWatchedSeasons = "show_has_watched_seasons"
+	ErrorCodeOnlineShowNotFound    = "online_show_not_found"
+	ErrorCodeWatcherNotFound       = "watcher_not_found"
+	ErrorCodeInternalError         = "internal_error"
+)
+
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
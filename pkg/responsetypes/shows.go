@@ -26,10 +26,20 @@ type Show struct {
 	CurrentSeason int    `json:"currentSeason"`
 	FinishedAt    string `json:"finishedAt"`
 	WatcherName   string `json:"watcherName"`
+	PosterImage   string `json:"posterImage"`
 }
 
 type PagedShows struct {
-	Shows    []Show `json:"shows"`
-	Page     int    `json:"page"`
-	NumPages int    `json:"numPages"`
+	Shows      []Show `json:"shows"`
+	Page       int    `json:"page"`
+	NumPages   int    `json:"numPages"`
+	TotalCount int    `json:"totalCount"`
+}
+
+type CreatedShow struct {
+	ID int `json:"id"`
+}
+
+type ShowImage struct {
+	ImageURL string `json:"imageUrl"`
 }
@@ -0,0 +1,9 @@
+package responsetypes
+
+type Watcher struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	UserID    int    `json:"userID"`
+	UserEmail string `json:"userEmail"`
+	IsOwner   bool   `json:"isOwner"`
+}
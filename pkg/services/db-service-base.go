@@ -5,9 +5,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+/*
+Querier is satisfied by both the connection pool and a transaction.
+*/
+type Querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type DbServiceBaseConfig struct {
 	QueryTimeout time.Duration
 	DB           *pgxpool.Pool
@@ -25,6 +37,24 @@ func (s DbServiceBase) GetContext() (context.Context, context.CancelFunc) {
 	return ctx, cancel
 }
 
+/*
+GetQuerier returns the caller's transaction when one is provided through
+WithTx, otherwise the connection pool.
+*/
+func (s DbServiceBase) GetQuerier(options ...TxOption) Querier {
+	opts := &TxOptions{}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	if opts.Tx != nil {
+		return opts.Tx
+	}
+
+	return s.DB
+}
+
 func (s DbServiceBase) IsDuplicateRecordError(err error) bool {
 	return strings.Contains(err.Error(), "duplicate key value violates unique constraint")
 }
@@ -0,0 +1,19 @@
+package services
+
+import "github.com/jackc/pgx/v5"
+
+type TxOption func(to *TxOptions)
+
+type TxOptions struct {
+	Tx pgx.Tx
+}
+
+/*
+WithTx runs a service method inside a transaction owned by the caller.
+The caller is responsible for committing or rolling back the transaction.
+*/
+func WithTx(tx pgx.Tx) TxOption {
+	return func(to *TxOptions) {
+		to.Tx = tx
+	}
+}
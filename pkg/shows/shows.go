@@ -1,14 +1,18 @@
 package shows
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/adampresley/adamgokit/rest"
 	"github.com/adampresley/adamgokit/rest/calloptions"
@@ -18,6 +22,7 @@ import (
 	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
 	"github.com/adampresley/streaming-tracker/pkg/services"
 	"github.com/adampresley/streaming-tracker/pkg/tvmaze"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
 	"github.com/alitto/pond/v2"
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -27,11 +32,12 @@ import (
 var (
 	ErrShowNotFound          = fmt.Errorf("show not found")
 	ErrShowHasWatchedSeasons = fmt.Errorf("show has watched seasons and cannot be deleted")
+	ErrOnlineShowNotFound    = fmt.Errorf("show not found on TVMaze")
 )
 
 type ShowServicer interface {
 	AddSeason(accountID, showID int) error
-	AddShow(accountID int, req requesttypes.AddShowRequest) (int, error)
+	AddShow(accountID int, req requesttypes.AddShowRequest, options ...services.TxOption) (int, error)
 	BackToWantToWatch(accountID, showID int) error
 	CancelShow(accountID, showID int) error
 	DeleteShow(accountID, showID int) error
@@ -41,10 +47,12 @@ type ShowServicer interface {
 	GetActiveShowsGroupedByWatchersAndStatus(accountID int) (*orderedmap.OrderedMap[string, *orderedmap.OrderedMap[string, []models.ShowGroupedByStatusAndWatchers]], error)
 	GetFinishedShows(accountID int) ([]querymodels.Shows, error)
 	GetShowByID(accountID, showID int) (*models.ShowForEdit, error)
+	MatchOnlineShow(title string, year int, imdbID string, tvdbID int) (*models.OnlineShowMatch, error)
 	OnlineSearch(searchTerm, country string) ([]models.OnlineShowSearchResult, error)
 	SearchShows(accountID int, options ...SearchShowsOption) ([]querymodels.Shows, int, error)
 	StartWatching(accountID, showID int) error
 	UpdateShow(accountID int, req requesttypes.EditShowRequest) error
+	UpdateShowProgress(accountID int, req requesttypes.UpdateShowProgressRequest, options ...services.TxOption) error
 }
 
 type ShowServiceConfig struct {
@@ -68,7 +76,7 @@ func NewShowService(config ShowServiceConfig) ShowService {
 	}
 }
 
-func (s ShowService) AddShow(accountID int, req requesttypes.AddShowRequest) (int, error) {
+func (s ShowService) AddShow(accountID int, req requesttypes.AddShowRequest, options ...services.TxOption) (int, error) {
 	var (
 		err    error
 		showID int
@@ -77,8 +85,14 @@ func (s ShowService) AddShow(accountID int, req requesttypes.AddShowRequest) (in
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	// Begin transaction
-	tx, err := s.DB.Begin(ctx)
+	watchStatusID := req.WatchStatusID
+
+	if watchStatusID == 0 {
+		watchStatusID = models.WantToWatch
+	}
+
+	// Begin transaction. When the caller provides one this becomes a savepoint.
+	tx, err := s.GetQuerier(options...).Begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("error beginning transaction: %w", err)
 	}
@@ -87,26 +101,30 @@ func (s ShowService) AddShow(accountID int, req requesttypes.AddShowRequest) (in
 
 	// Insert the show
 	insertShowQuery := `
-INSERT INTO shows (name, num_seasons, platform_id, account_id, poster_image, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, NOW() AT TIME ZONE 'UTC', NOW() AT TIME ZONE 'UTC')
+INSERT INTO shows (name, num_seasons, platform_id, account_id, poster_image, tvmaze_id, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NOW() AT TIME ZONE 'UTC', NOW() AT TIME ZONE 'UTC')
 RETURNING id
 	`
 
-	if err = tx.QueryRow(ctx, insertShowQuery, req.Name, req.TotalSeasons, req.PlatformID, accountID, req.PosterImage).Scan(&showID); err != nil {
+	if err = tx.QueryRow(ctx, insertShowQuery, req.Name, req.TotalSeasons, req.PlatformID, accountID, req.PosterImage, req.TVMazeID).Scan(&showID); err != nil {
 		return 0, fmt.Errorf("error inserting show: %w", err)
 	}
 
-	// Create show_status record with "Want to Watch" status (watch_status_id = 1)
+	// Create show_status record. New shows default to "Want to Watch" (watch_status_id = 1)
 	insertShowStatusQuery := `
-INSERT INTO show_status (show_id, account_id, watch_status_id, current_season)
-VALUES ($1, $2, 1, 0)
+INSERT INTO show_status (show_id, account_id, watch_status_id, current_season, finished_at)
+VALUES ($1, $2, $3, $4, CASE WHEN $3 = 3 THEN NOW() AT TIME ZONE 'UTC' ELSE NULL END)
 	`
 
-	if _, err = tx.Exec(ctx, insertShowStatusQuery, showID, accountID); err != nil {
+	if _, err = tx.Exec(ctx, insertShowStatusQuery, showID, accountID, watchStatusID, req.CurrentSeason); err != nil {
 		return 0, fmt.Errorf("error inserting show status: %w", err)
 	}
 
 	// Link watchers to the show status
+	if err = checkWatchersInAccount(ctx, tx, accountID, req.WatcherIDs); err != nil {
+		return 0, err
+	}
+
 	for _, watcherID := range req.WatcherIDs {
 		insertWatcherLinkQuery := `
 INSERT INTO watchers_to_show_statuses (watcher_id, show_status_id)
@@ -197,10 +215,10 @@ func (s ShowService) BackToWantToWatch(accountID, showID int) error {
 	updateQuery := `
 UPDATE show_status
 SET watch_status_id = 1
-WHERE show_id = $1
+WHERE show_id = $1 AND account_id = $2
 	`
 
-	if result, err = s.DB.Exec(ctx, updateQuery, showID); err != nil {
+	if result, err = s.DB.Exec(ctx, updateQuery, showID, accountID); err != nil {
 		return fmt.Errorf("error updating show to want to watch status: %w", err)
 	}
 
@@ -266,6 +284,7 @@ FROM shows s
 WHERE ss.show_id = $1 
 	AND ss.show_id = s.id
 	AND ss.account_id = $2
+	AND s.account_id = ss.account_id
 	`
 
 	if result, err = s.DB.Exec(ctx, updateQuery, showID, accountID); err != nil {
@@ -303,10 +322,10 @@ SELECT
 	, s.poster_image
 FROM watch_status AS ws
 	INNER JOIN show_status AS ss ON ss.watch_status_id=ws.id
-	LEFT JOIN shows AS s ON s.id=ss.show_id
+	LEFT JOIN shows AS s ON s.id=ss.show_id AND s.account_id=ss.account_id
 	LEFT JOIN platforms AS p ON  p.id=s.platform_id
 	INNER JOIN watchers_to_show_statuses AS wtss ON wtss.show_status_id=ss.id
-	INNER JOIN watchers AS w ON w.id=wtss.watcher_id
+	INNER JOIN watchers AS w ON w.id=wtss.watcher_id AND w.account_id=ss.account_id
 WHERE 1=1
 	AND ss.account_id=$1
 	AND ss.watch_status_id IN (1, 2)
@@ -398,10 +417,10 @@ SELECT
 	, string_agg(w.name, ', ' ORDER BY w.name) AS watcher_name
 FROM watch_status AS ws
 	INNER JOIN show_status AS ss ON ss.watch_status_id=ws.id
-	LEFT JOIN shows AS s ON s.id=ss.show_id
+	LEFT JOIN shows AS s ON s.id=ss.show_id AND s.account_id=ss.account_id
 	LEFT JOIN platforms AS p ON  p.id=s.platform_id
 	INNER JOIN watchers_to_show_statuses AS wtss ON wtss.show_status_id=ss.id
-	INNER JOIN watchers AS w ON w.id=wtss.watcher_id
+	INNER JOIN watchers AS w ON w.id=wtss.watcher_id AND w.account_id=ss.account_id
 WHERE 1=1
 	AND ss.account_id=$1
 	AND ss.watch_status_id IN (1, 2)
@@ -491,10 +510,10 @@ SELECT
 	, string_agg(w.name, ', ' ORDER BY w.name) AS watcher_name
 FROM watch_status AS ws
 	INNER JOIN show_status AS ss ON ss.watch_status_id=ws.id
-	LEFT JOIN shows AS s ON s.id=ss.show_id
+	LEFT JOIN shows AS s ON s.id=ss.show_id AND s.account_id=ss.account_id
 	LEFT JOIN platforms AS p ON  p.id=s.platform_id
 	INNER JOIN watchers_to_show_statuses AS wtss ON wtss.show_status_id=ss.id
-	INNER JOIN watchers AS w ON w.id=wtss.watcher_id
+	INNER JOIN watchers AS w ON w.id=wtss.watcher_id AND w.account_id=ss.account_id
 WHERE 1=1
 	AND ss.account_id = $1
 	AND ss.watch_status_id IN (3)
@@ -540,7 +559,7 @@ SELECT
 	, s.date_cancelled
 	, coalesce(s.poster_image, '') as poster_image
 FROM shows s
-	INNER JOIN show_status ss ON ss.show_id = s.id
+	INNER JOIN show_status ss ON ss.show_id = s.id AND ss.account_id = s.account_id
 	INNER JOIN watchers_to_show_statuses wtss ON wtss.show_status_id = ss.id
 WHERE s.account_id = $1
 	AND s.id = $2
@@ -689,6 +708,229 @@ func (s ShowService) FindShowImageByName(showName string) (string, error) {
 	return "", nil
 }
 
+/*
+MatchOnlineShow finds the TVMaze entry for a show from another service.
+The IMDB and TheTVDB IDs are tried first as they are exact. After that the
+title is searched, and only a result with the same name (and premiere year,
+when one is given) is accepted. Returns ErrOnlineShowNotFound when there is
+no confident match.
+*/
+func (s ShowService) MatchOnlineShow(title string, year int, imdbID string, tvdbID int) (*models.OnlineShowMatch, error) {
+	var (
+		err            error
+		show           *tvmaze.Show
+		seasons        tvmaze.Seasons
+		seasonsResult  rest.HttpResult
+		lookupAttempts []map[string]string
+	)
+
+	if imdbID != "" {
+		lookupAttempts = append(lookupAttempts, map[string]string{"imdb": imdbID})
+	}
+
+	if tvdbID > 0 {
+		lookupAttempts = append(lookupAttempts, map[string]string{"thetvdb": strconv.Itoa(tvdbID)})
+	}
+
+	for _, queryParams := range lookupAttempts {
+		if show, err = s.lookupOnlineShow(queryParams); err != nil {
+			return nil, err
+		}
+
+		if show != nil {
+			break
+		}
+	}
+
+	if show == nil && strings.TrimSpace(title) != "" {
+		if show, err = s.searchOnlineShowByTitle(title, year); err != nil {
+			return nil, err
+		}
+	}
+
+	if show == nil {
+		return nil, ErrOnlineShowNotFound
+	}
+
+	err = withTvmazeRateLimitRetry(func() error {
+		seasons, seasonsResult, err = rest.Get[tvmaze.Seasons](
+			s.restClientOptions,
+			"/shows/"+strconv.Itoa(show.ID)+"/seasons",
+		)
+
+		return err
+	}, &seasonsResult)
+
+	if err != nil {
+		slog.Error("error fetching seasons", "showID", show.ID, "statusCode", seasonsResult.StatusCode, "error", err)
+		return nil, fmt.Errorf("error fetching seasons for TVMaze show %d: %w", show.ID, err)
+	}
+
+	result := &models.OnlineShowMatch{
+		TVMazeID:          show.ID,
+		Name:              show.Name,
+		EpisodesPerSeason: map[int]int{},
+		Platforms:         []models.Platform{},
+	}
+
+	/*
+	 * Only count seasons that have started airing. Announced seasons
+	 * would otherwise stop anyone from being "finished" with a show.
+	 */
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	for _, season := range seasons {
+		if season.PremiereDate == nil || *season.PremiereDate > today {
+			continue
+		}
+
+		result.NumSeasons++
+		result.EpisodesPerSeason[season.Number] = season.EpisodeOrder
+	}
+
+	if show.Image != nil {
+		result.PosterImage = show.Image.Medium
+	}
+
+	externalNames := []string{}
+
+	if show.WebChannel != nil {
+		externalNames = append(externalNames, strings.ToLower(show.WebChannel.Name))
+	}
+
+	if show.Network != nil {
+		externalNames = append(externalNames, strings.ToLower(show.Network.Name))
+	}
+
+	if result.Platforms, err = s.lookupPlatformsByExternalNames(externalNames, "tvmaze"); err != nil {
+		slog.Error("error looking up platforms", "error", err, "externalNames", externalNames)
+		result.Platforms = []models.Platform{}
+	}
+
+	return result, nil
+}
+
+func (s ShowService) lookupOnlineShow(queryParams map[string]string) (*tvmaze.Show, error) {
+	var (
+		err        error
+		response   tvmaze.Show
+		httpResult rest.HttpResult
+	)
+
+	err = withTvmazeRateLimitRetry(func() error {
+		response, httpResult, err = rest.Get[tvmaze.Show](
+			s.restClientOptions,
+			"/lookup/shows",
+			calloptions.WithQueryParams(queryParams),
+		)
+
+		return err
+	}, &httpResult)
+
+	if httpResult.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		slog.Error("error looking up show on TVMaze", "statusCode", httpResult.StatusCode, "body", httpResult.Body, "query", queryParams)
+		return nil, fmt.Errorf("error looking up show: %w", err)
+	}
+
+	return &response, nil
+}
+
+func (s ShowService) searchOnlineShowByTitle(title string, year int) (*tvmaze.Show, error) {
+	var (
+		err           error
+		response      tvmaze.SearchResults
+		httpResult    rest.HttpResult
+		unmarshallErr *json.UnmarshalTypeError
+		nameMatch     *tvmaze.Show
+	)
+
+	err = withTvmazeRateLimitRetry(func() error {
+		response, httpResult, err = rest.Get[tvmaze.SearchResults](
+			s.restClientOptions,
+			"/search/shows",
+			calloptions.WithQueryParams(map[string]string{
+				"q": title,
+			}),
+		)
+
+		return err
+	}, &httpResult)
+
+	if err != nil {
+		if errors.As(err, &unmarshallErr) {
+			return nil, nil
+		}
+
+		slog.Error("error searching TVMaze by title", "statusCode", httpResult.StatusCode, "body", httpResult.Body, "title", title)
+		return nil, fmt.Errorf("error searching for show: %w", err)
+	}
+
+	normalizedTitle := normalizeShowTitle(title)
+
+	for _, searchResult := range response {
+		if normalizeShowTitle(searchResult.Show.Name) != normalizedTitle {
+			continue
+		}
+
+		if year == 0 {
+			return &searchResult.Show, nil
+		}
+
+		if searchResult.Show.Premiered != nil && strings.HasPrefix(*searchResult.Show.Premiered, strconv.Itoa(year)) {
+			return &searchResult.Show, nil
+		}
+
+		if nameMatch == nil {
+			nameMatch = &searchResult.Show
+		}
+	}
+
+	return nameMatch, nil
+}
+
+/*
+withTvmazeRateLimitRetry retries a TVMaze call when the API says we are
+making too many requests. TVMaze allows roughly 20 calls every 10 seconds,
+which a large import can easily exceed.
+*/
+func withTvmazeRateLimitRetry(fn func() error, httpResult *rest.HttpResult) error {
+	var (
+		err error
+	)
+
+	for attempt := 1; attempt <= 4; attempt++ {
+		if err = fn(); err == nil || httpResult.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+
+		time.Sleep(time.Duration(attempt) * 2 * time.Second)
+	}
+
+	return err
+}
+
+/*
+normalizeShowTitle lower cases a title and strips punctuation so that
+names like "Marvel's Daredevil" and "marvels daredevil" compare equal.
+*/
+func normalizeShowTitle(title string) string {
+	result := strings.Builder{}
+
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			result.WriteRune(r)
+		} else if unicode.IsSpace(r) {
+			result.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(result.String()), " ")
+}
+
 func (s ShowService) lookupPlatformsByExternalNames(externalNames []string, source string) ([]models.Platform, error) {
 	var (
 		err       error
@@ -753,6 +995,10 @@ WHERE id = $5 AND account_id = $6
 	}
 
 	if len(req.WatcherIDs) > 0 {
+		if err = checkWatchersInAccount(ctx, tx, accountID, req.WatcherIDs); err != nil {
+			return err
+		}
+
 		// Delete existing watcher links
 		deleteWatchersQuery := `
 DELETE FROM watchers_to_show_statuses 
@@ -784,6 +1030,95 @@ VALUES ($1, (SELECT id FROM show_status WHERE show_id = $2 AND account_id = $3))
 	return nil
 }
 
+/*
+UpdateShowProgress sets the watch status and current season of a show, raises
+the number of seasons if needed, and links any watchers not already watching.
+Pass services.WithTx to perform the update inside an existing transaction.
+*/
+func (s ShowService) UpdateShowProgress(accountID int, req requesttypes.UpdateShowProgressRequest, options ...services.TxOption) error {
+	var (
+		err    error
+		result pgconn.CommandTag
+	)
+
+	ctx, cancel := s.GetContext()
+	defer cancel()
+
+	// Begin transaction. When the caller provides one this becomes a savepoint.
+	tx, err := s.GetQuerier(options...).Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	updateShowQuery := `
+UPDATE shows
+SET
+	num_seasons = GREATEST(num_seasons, $1),
+	tvmaze_id = coalesce(tvmaze_id, NULLIF($2, 0)),
+	updated_at = NOW() AT TIME ZONE 'UTC'
+WHERE id = $3 AND account_id = $4
+	`
+
+	if result, err = tx.Exec(ctx, updateShowQuery, req.NumSeasons, req.TVMazeID, req.ShowID, accountID); err != nil {
+		return fmt.Errorf("error updating number of seasons: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrShowNotFound
+	}
+
+	updateStatusQuery := `
+UPDATE show_status
+SET
+	watch_status_id = $1,
+	current_season = $2,
+	finished_at = CASE
+		WHEN $1 = 3 THEN coalesce(finished_at, NOW() AT TIME ZONE 'UTC')
+		ELSE NULL
+	END
+WHERE show_id = $3 AND account_id = $4
+	`
+
+	if result, err = tx.Exec(ctx, updateStatusQuery, req.WatchStatusID, req.CurrentSeason, req.ShowID, accountID); err != nil {
+		return fmt.Errorf("error updating show progress: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrShowNotFound
+	}
+
+	// Link watchers that aren't already linked to the show
+	if err = checkWatchersInAccount(ctx, tx, accountID, req.WatcherIDs); err != nil {
+		return err
+	}
+
+	for _, watcherID := range req.WatcherIDs {
+		insertWatcherLinkQuery := `
+INSERT INTO watchers_to_show_statuses (watcher_id, show_status_id)
+SELECT $1, ss.id
+FROM show_status ss
+WHERE ss.show_id = $2
+	AND ss.account_id = $3
+	AND NOT EXISTS (
+		SELECT 1 FROM watchers_to_show_statuses wtss
+		WHERE wtss.watcher_id = $1 AND wtss.show_status_id = ss.id
+	)
+		`
+
+		if _, err = tx.Exec(ctx, insertWatcherLinkQuery, watcherID, req.ShowID, accountID); err != nil {
+			return fmt.Errorf("error linking watcher to show: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
 func (s ShowService) SearchShows(accountID int, options ...SearchShowsOption) ([]querymodels.Shows, int, error) {
 	var (
 		err    error
@@ -836,10 +1171,10 @@ WITH matches AS (
 		, coalesce(s.poster_image, '') AS poster_image
 	FROM watch_status AS ws
 		INNER JOIN show_status AS ss ON ss.watch_status_id=ws.id
-		LEFT JOIN shows AS s ON s.id=ss.show_id
+		LEFT JOIN shows AS s ON s.id=ss.show_id AND s.account_id=ss.account_id
 		LEFT JOIN platforms AS p ON  p.id=s.platform_id
 		INNER JOIN watchers_to_show_statuses AS wtss ON wtss.show_status_id=ss.id
-		INNER JOIN watchers AS w ON w.id=wtss.watcher_id
+		INNER JOIN watchers AS w ON w.id=wtss.watcher_id AND w.account_id=ss.account_id
 	WHERE 1=1
 		AND ss.account_id = $1
 	`
@@ -917,47 +1252,30 @@ FROM matches
 
 func (s ShowService) StartWatching(accountID, showID int) error {
 	var (
-		err           error
-		currentSeason int
+		err    error
+		result pgconn.CommandTag
 	)
 
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	// Check if show exists and get current season
-	checkQuery := `
-SELECT ss.current_season
-FROM show_status ss
-INNER JOIN shows s ON s.id = ss.show_id
-WHERE ss.show_id = $1
-	`
-
-	if err = pgxscan.Get(ctx, s.DB, &currentSeason, checkQuery, showID); err != nil {
-		if pgxscan.NotFound(err) {
-			return ErrShowNotFound
-		}
-		return fmt.Errorf("error checking show status: %w", err)
-	}
-
-	// Determine the season to set based on current season
-	var newSeason int
-	if currentSeason == 0 {
-		newSeason = 1
-	} else {
-		newSeason = currentSeason
-	}
-
-	// Update the show status to "Watching" (watch_status_id = 2) and set appropriate season
+	// Update the show status to "Watching" (watch_status_id = 2). Shows that haven't been started begin at season 1
 	updateQuery := `
-UPDATE show_status 
-SET watch_status_id = 2, current_season = $2
-WHERE show_id = $1
+UPDATE show_status
+SET
+	watch_status_id = 2,
+	current_season = CASE WHEN current_season = 0 THEN 1 ELSE current_season END
+WHERE show_id = $1 AND account_id = $2
 	`
 
-	if _, err = s.DB.Exec(ctx, updateQuery, showID, newSeason); err != nil {
+	if result, err = s.DB.Exec(ctx, updateQuery, showID, accountID); err != nil {
 		return fmt.Errorf("error updating show to watching status: %w", err)
 	}
 
+	if result.RowsAffected() == 0 {
+		return ErrShowNotFound
+	}
+
 	return nil
 }
 
@@ -974,7 +1292,7 @@ func (s ShowService) DeleteShow(accountID, showID int) error {
 	checkQuery := `
 SELECT ss.current_season
 FROM show_status ss
-INNER JOIN shows s ON s.id = ss.show_id
+INNER JOIN shows s ON s.id = ss.show_id AND s.account_id = ss.account_id
 WHERE ss.show_id = $1 AND ss.account_id = $2
 	`
 
@@ -1040,3 +1358,37 @@ WHERE id = $1 AND account_id = $2
 
 	return nil
 }
+
+/*
+checkWatchersInAccount returns watchers.ErrWatcherNotFound when any of the
+watchers belongs to another account, so a show can't be linked to another
+household's watcher.
+*/
+func checkWatchersInAccount(ctx context.Context, q services.Querier, accountID int, watcherIDs []int) error {
+	var (
+		err     error
+		missing int
+	)
+
+	if len(watcherIDs) == 0 {
+		return nil
+	}
+
+	query := `
+SELECT COUNT(*)
+FROM unnest($2::integer[]) AS requested(id)
+WHERE NOT EXISTS (
+	SELECT 1 FROM watchers AS w WHERE w.id = requested.id AND w.account_id = $1
+)
+	`
+
+	if err = q.QueryRow(ctx, query, accountID, watcherIDs).Scan(&missing); err != nil {
+		return fmt.Errorf("error checking watchers: %w", err)
+	}
+
+	if missing > 0 {
+		return watchers.ErrWatcherNotFound
+	}
+
+	return nil
+}
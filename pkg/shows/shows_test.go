@@ -0,0 +1,220 @@
+package shows_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/models"
+	"github.com/adampresley/streaming-tracker/pkg/requesttypes"
+	"github.com/adampresley/streaming-tracker/pkg/services"
+	"github.com/adampresley/streaming-tracker/pkg/shows"
+	"github.com/adampresley/streaming-tracker/pkg/testdb"
+	"github.com/adampresley/streaming-tracker/pkg/watchers"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	netflix = 1
+)
+
+func TestShowsOfAnotherAccountAreNotFound(t *testing.T) {
+	db := testdb.New(t)
+
+	service := shows.NewShowService(shows.ShowServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			DB:           db,
+			QueryTimeout: testdb.QueryTimeout,
+			PageSize:     20,
+		},
+	})
+
+	ownerAccount, ownerWatcher := insertAccount(t, db, "owner@example.com")
+	otherAccount, otherWatcher := insertAccount(t, db, "other@example.com")
+
+	showID, err := service.AddShow(ownerAccount, requesttypes.AddShowRequest{
+		Name:          "Severance",
+		TotalSeasons:  2,
+		PlatformID:    netflix,
+		WatcherIDs:    []int{ownerWatcher},
+		WatchStatusID: models.WantToWatch,
+	})
+
+	if err != nil {
+		t.Fatalf("error adding show: %v", err)
+	}
+
+	want, err := service.GetShowByID(ownerAccount, showID)
+
+	if err != nil {
+		t.Fatalf("error getting show: %v", err)
+	}
+
+	mutations := []struct {
+		name   string
+		mutate func() error
+	}{
+		{name: "AddSeason", mutate: func() error { return service.AddSeason(otherAccount, showID) }},
+		{name: "BackToWantToWatch", mutate: func() error { return service.BackToWantToWatch(otherAccount, showID) }},
+		{name: "CancelShow", mutate: func() error { return service.CancelShow(otherAccount, showID) }},
+		{name: "DeleteShow", mutate: func() error { return service.DeleteShow(otherAccount, showID) }},
+		{name: "FinishSeason", mutate: func() error { return service.FinishSeason(otherAccount, showID) }},
+		{name: "StartWatching", mutate: func() error { return service.StartWatching(otherAccount, showID) }},
+		{
+			name: "UpdateShow",
+			mutate: func() error {
+				return service.UpdateShow(otherAccount, requesttypes.EditShowRequest{ID: showID, Name: "Renamed", TotalSeasons: 9, PlatformID: netflix, WatcherIDs: []int{otherWatcher}})
+			},
+		},
+		{
+			name: "UpdateShowProgress",
+			mutate: func() error {
+				return service.UpdateShowProgress(otherAccount, requesttypes.UpdateShowProgressRequest{ShowID: showID, WatchStatusID: models.FinishedWatching, CurrentSeason: 9, NumSeasons: 9, WatcherIDs: []int{otherWatcher}})
+			},
+		},
+		{
+			name: "GetShowByID",
+			mutate: func() error {
+				_, err := service.GetShowByID(otherAccount, showID)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range mutations {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mutate(); !errors.Is(err, shows.ErrShowNotFound) {
+				t.Errorf("expected ErrShowNotFound, got %v", err)
+			}
+		})
+	}
+
+	t.Run("lists", func(t *testing.T) {
+		byStatus, err := service.GetActiveShowsGroupedByStatusAndWatchers(otherAccount)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if byStatus.Len() != 0 {
+			t.Errorf("expected no active shows by status, got %d", byStatus.Len())
+		}
+
+		byWatcher, err := service.GetActiveShowsGroupedByWatchersAndStatus(otherAccount)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if byWatcher.Len() != 0 {
+			t.Errorf("expected no active shows by watcher, got %d", byWatcher.Len())
+		}
+
+		finished, err := service.GetFinishedShows(otherAccount)
+
+		if err != nil || len(finished) != 0 {
+			t.Errorf("expected no finished shows, got %+v (%v)", finished, err)
+		}
+
+		found, total, err := service.SearchShows(otherAccount, shows.WithShowName("Severance"))
+
+		if err != nil || len(found) != 0 || total != 0 {
+			t.Errorf("expected no shows found, got %+v and %d (%v)", found, total, err)
+		}
+	})
+
+	t.Run("show is unchanged", func(t *testing.T) {
+		got, err := service.GetShowByID(ownerAccount, showID)
+
+		if err != nil {
+			t.Fatalf("error getting show: %v", err)
+		}
+
+		if got.Name != want.Name || got.NumSeasons != want.NumSeasons || got.Cancelled != want.Cancelled || len(got.WatcherIds) != 1 || got.WatcherIds[0] != ownerWatcher {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+
+		var (
+			watchStatusID int
+			currentSeason int
+		)
+
+		if err = db.QueryRow(context.Background(), "SELECT watch_status_id, current_season FROM show_status WHERE show_id=$1", showID).Scan(&watchStatusID, &currentSeason); err != nil {
+			t.Fatalf("error getting show status: %v", err)
+		}
+
+		if watchStatusID != models.WantToWatch || currentSeason != 0 {
+			t.Errorf("expected the show to still be want to watch at season 0, got status %d at season %d", watchStatusID, currentSeason)
+		}
+	})
+}
+
+func TestShowsCanNotBeLinkedToAnotherAccountsWatcher(t *testing.T) {
+	db := testdb.New(t)
+
+	service := shows.NewShowService(shows.ShowServiceConfig{
+		DbServiceBaseConfig: services.DbServiceBaseConfig{
+			DB:           db,
+			QueryTimeout: testdb.QueryTimeout,
+			PageSize:     20,
+		},
+	})
+
+	ownerAccount, ownerWatcher := insertAccount(t, db, "owner@example.com")
+	_, otherWatcher := insertAccount(t, db, "other@example.com")
+
+	if _, err := service.AddShow(ownerAccount, requesttypes.AddShowRequest{Name: "Andor", TotalSeasons: 2, PlatformID: netflix, WatcherIDs: []int{otherWatcher}}); !errors.Is(err, watchers.ErrWatcherNotFound) {
+		t.Errorf("AddShow: expected ErrWatcherNotFound, got %v", err)
+	}
+
+	showID, err := service.AddShow(ownerAccount, requesttypes.AddShowRequest{Name: "Andor", TotalSeasons: 2, PlatformID: netflix, WatcherIDs: []int{ownerWatcher}})
+
+	if err != nil {
+		t.Fatalf("error adding show: %v", err)
+	}
+
+	if err = service.UpdateShow(ownerAccount, requesttypes.EditShowRequest{ID: showID, Name: "Andor", TotalSeasons: 2, PlatformID: netflix, WatcherIDs: []int{otherWatcher}}); !errors.Is(err, watchers.ErrWatcherNotFound) {
+		t.Errorf("UpdateShow: expected ErrWatcherNotFound, got %v", err)
+	}
+
+	if err = service.UpdateShowProgress(ownerAccount, requesttypes.UpdateShowProgressRequest{ShowID: showID, WatchStatusID: models.Watching, CurrentSeason: 1, NumSeasons: 2, WatcherIDs: []int{otherWatcher}}); !errors.Is(err, watchers.ErrWatcherNotFound) {
+		t.Errorf("UpdateShowProgress: expected ErrWatcherNotFound, got %v", err)
+	}
+}
+
+/*
+insertAccount makes a user with their own household and a watcher in it,
+and returns the household's and watcher's IDs.
+*/
+func insertAccount(t *testing.T, db *pgxpool.Pool, email string) (int, int) {
+	t.Helper()
+
+	var (
+		err       error
+		userID    int
+		accountID int
+		watcherID int
+	)
+
+	ctx := context.Background()
+
+	if err = db.QueryRow(ctx, "INSERT INTO users (created_at, active, email, password, auth_token) VALUES ($1, true, $2, '', $2) RETURNING id", time.Now().UTC(), email).Scan(&userID); err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+
+	if err = db.QueryRow(ctx, "INSERT INTO accounts (owner, join_token) VALUES ($1, $2) RETURNING id", userID, "join-"+strconv.Itoa(userID)).Scan(&accountID); err != nil {
+		t.Fatalf("error inserting account: %v", err)
+	}
+
+	if _, err = db.Exec(ctx, "UPDATE users SET account_id=$1 WHERE id=$2", accountID, userID); err != nil {
+		t.Fatalf("error setting account: %v", err)
+	}
+
+	if err = db.QueryRow(ctx, "INSERT INTO watchers (user_id, name, account_id) VALUES ($1, $2, $3) RETURNING id", userID, email, accountID).Scan(&watcherID); err != nil {
+		t.Fatalf("error inserting watcher: %v", err)
+	}
+
+	return accountID, watcherID
+}
@@ -0,0 +1,137 @@
+/*
+Package totp makes and checks time-based one-time passwords (RFC 6238) with
+the settings every authenticator app supports: SHA-1, six digits, and a
+thirty second period.
+*/
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	modulus = 1000000
+
+	secretNumBytes = 20
+
+	/*
+	   skewSteps is how many periods either side of now a code is accepted
+	   for, to allow for clocks that are a little off.
+	*/
+	skewSteps = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+/*
+NewSecret returns a random base32 secret to share with an authenticator
+app.
+*/
+func NewSecret() (string, error) {
+	b := make([]byte, secretNumBytes)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating secret: %w", err)
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+/*
+KeyURI returns the otpauth:// link an authenticator app scans to add an
+account. issuer is shown as the name of the service and accountName as
+whose account it is.
+*/
+func KeyURI(issuer, accountName, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", Digits))
+	query.Set("period", fmt.Sprintf("%d", int(Period.Seconds())))
+
+	/*
+	 * Some apps show a + in the issuer literally, so spaces are escaped
+	 * the way paths escape them.
+	 */
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+/*
+Step returns the time step t falls in.
+*/
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+/*
+Code returns the code for a time step.
+*/
+func Code(secret string, step int64) (string, error) {
+	var (
+		err error
+		key []byte
+	)
+
+	if key, err = encoding.DecodeString(strings.ToUpper(secret)); err != nil {
+		return "", fmt.Errorf("error decoding secret: %w", err)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%modulus), nil
+}
+
+/*
+Validate checks a code against the steps around now. It returns the step
+the code matched, so the caller can refuse that step, and any before it,
+the next time. Steps at or before lastUsedStep never match.
+*/
+func Validate(secret, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(now)
+
+	for step := current - skewSteps; step <= current+skewSteps; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+
+		expected, err := Code(secret, step)
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
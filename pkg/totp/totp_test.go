@@ -0,0 +1,152 @@
+package totp_test
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/adampresley/streaming-tracker/pkg/totp"
+)
+
+const (
+	/*
+	   rfcSecret is the SHA-1 secret from RFC 6238, "12345678901234567890",
+	   in base32.
+	*/
+	rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+)
+
+func TestCode(t *testing.T) {
+	/*
+	 * The SHA-1 test vectors from RFC 6238 Appendix B. The RFC gives eight
+	 * digits, and six digit codes are the last six of them.
+	 */
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d", tt.unix), func(t *testing.T) {
+			got, err := totp.Code(rfcSecret, totp.Step(time.Unix(tt.unix, 0)))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	got, err := totp.Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got != "287082" {
+		t.Errorf("expected 287082, got %s", got)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := totp.Code("not base32!", 1); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totp.Step(now)
+
+	code := func(offset int64) string {
+		c, err := totp.Code(rfcSecret, step+offset)
+
+		if err != nil {
+			t.Fatalf("error making code: %v", err)
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name         string
+		code         string
+		lastUsedStep int64
+		wantStep     int64
+		wantOK       bool
+	}{
+		{name: "current step", code: code(0), wantStep: step, wantOK: true},
+		{name: "one step behind", code: code(-1), wantStep: step - 1, wantOK: true},
+		{name: "one step ahead", code: code(1), wantStep: step + 1, wantOK: true},
+		{name: "two steps behind", code: code(-2)},
+		{name: "two steps ahead", code: code(2)},
+		{name: "spaces", code: " " + code(0)[:3] + " " + code(0)[3:] + " ", wantStep: step, wantOK: true},
+		{name: "wrong code", code: "000000"},
+		{name: "too short", code: code(0)[:5]},
+		{name: "too long", code: code(0) + "0"},
+		{name: "step already used", code: code(0), lastUsedStep: step},
+		{name: "before the step already used", code: code(-1), lastUsedStep: step - 1},
+		{name: "after the step already used", code: code(1), lastUsedStep: step, wantStep: step + 1, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := totp.Validate(rfcSecret, tt.code, now, tt.lastUsedStep)
+
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("expected step %d and %v, got step %d and %v", tt.wantStep, tt.wantOK, gotStep, gotOK)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := totp.NewSecret()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(secret) != 32 {
+		t.Errorf("expected 20 bytes in 32 base32 characters, got %q", secret)
+	}
+
+	if _, err = totp.Code(secret, 1); err != nil {
+		t.Errorf("expected the secret to make codes, got %v", err)
+	}
+
+	other, _ := totp.NewSecret()
+
+	if other == secret {
+		t.Errorf("expected a different secret each time")
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	got, err := url.Parse(totp.KeyURI("Streaming Tracker", "adam+tv@example.com", rfcSecret))
+
+	if err != nil {
+		t.Fatalf("error parsing %q: %v", got, err)
+	}
+
+	if got.Scheme != "otpauth" || got.Host != "totp" || got.Path != "/Streaming Tracker:adam+tv@example.com" {
+		t.Errorf("expected a totp link labeled with the issuer and account, got %s", got)
+	}
+
+	if got.RawQuery != "algorithm=SHA1&digits=6&issuer=Streaming%20Tracker&period=30&secret="+rfcSecret {
+		t.Errorf("expected the settings and secret, with spaces as %%20, got %s", got.RawQuery)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Package useragent describes a browser's user agent in a few words, such as
+"Firefox on Windows", so people can recognize their devices.
+*/
+package useragent
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type match struct {
+	token string
+	name  string
+}
+
+/*
+Browsers and systems are checked in order, since user agents name the
+browsers they are compatible with too. Edge says it is Chrome, and Chrome
+says it is Safari.
+*/
+var (
+	browsers = []match{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+
+	systems = []match{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+/*
+Describe returns the browser and operating system in a user agent. Parts
+it doesn't recognize are left out.
+*/
+func Describe(userAgent string) string {
+	browser := find(userAgent, browsers)
+	system := find(userAgent, systems)
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	return "Unknown device"
+}
+
+/*
+Truncate shortens a user agent to at most maxLength characters so it fits
+in a column, dropping any invalid UTF-8 the database would refuse.
+*/
+func Truncate(userAgent string, maxLength int) string {
+	userAgent = strings.ToValidUTF8(userAgent, "")
+
+	if utf8.RuneCountInString(userAgent) <= maxLength {
+		return userAgent
+	}
+
+	return string([]rune(userAgent)[:maxLength])
+}
+
+func find(userAgent string, matches []match) string {
+	for _, m := range matches {
+		if strings.Contains(userAgent, m.token) {
+			return m.name
+		}
+	}
+
+	return ""
+}
@@ -8,6 +8,11 @@ import (
 	"github.com/georgysavva/scany/v2/pgxscan"
 )
 
+var (
+	ErrWatcherNotFound  = fmt.Errorf("watcher not found")
+	ErrPermissionDenied = fmt.Errorf("permission denied: cannot edit this watcher's name")
+)
+
 type WatcherServicer interface {
 	/*
 	   CreateWatcher creates a new watcher record for a user.
@@ -16,8 +21,9 @@ type WatcherServicer interface {
 
 	/*
 		CreateWatcherManual creates a new watcher record without a user association.
+		Pass services.WithTx to create the watcher inside an existing transaction.
 	*/
-	CreateWatcherManual(accountID int, name string) (*models.Watcher, error)
+	CreateWatcherManual(accountID int, name string, options ...services.TxOption) (*models.Watcher, error)
 
 	/*
 		GetWatchers retrieves all watchers for a given account.
@@ -143,8 +149,9 @@ ORDER BY w.name ASC
 
 /*
 CreateWatcherManual creates a new watcher record without a user association.
+Pass services.WithTx to create the watcher inside an existing transaction.
 */
-func (s WatcherService) CreateWatcherManual(accountID int, name string) (*models.Watcher, error) {
+func (s WatcherService) CreateWatcherManual(accountID int, name string, options ...services.TxOption) (*models.Watcher, error) {
 	var (
 		err          error
 		newWatcherID int64
@@ -171,7 +178,7 @@ RETURNING id
 	ctx, cancel := s.GetContext()
 	defer cancel()
 
-	if err = pgxscan.Get(ctx, s.DB, &newWatcherID, query, args...); err != nil {
+	if err = pgxscan.Get(ctx, s.GetQuerier(options...), &newWatcherID, query, args...); err != nil {
 		return nil, fmt.Errorf("error creating manual watcher: %w", err)
 	}
 
@@ -256,6 +263,10 @@ WHERE w.id = $1 AND w.account_id = $2
 	defer cancel()
 
 	if err = pgxscan.Get(ctx, s.DB, &targetWatcher, checkQuery, checkArgs...); err != nil {
+		if pgxscan.NotFound(err) {
+			return ErrWatcherNotFound
+		}
+
 		return fmt.Errorf("error fetching watcher for permission check: %w", err)
 	}
 
@@ -280,7 +291,7 @@ WHERE w.id = $1 AND w.account_id = $2
 	}
 
 	if !canEdit {
-		return fmt.Errorf("permission denied: cannot edit this watcher's name")
+		return ErrPermissionDenied
 	}
 
 	// Perform the update
@@ -0,0 +1,162 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	maxCBORDepth = 16
+)
+
+var (
+	errCBORTruncated = errors.New("cbor data is truncated")
+)
+
+/*
+decodeCBOR decodes the subset of CBOR that authenticators use: integers,
+byte and text strings, arrays, maps, booleans, and null. Integers decode to
+int64, maps to map[any]any. It returns the bytes after the first item,
+because a credential's public key is followed by more data.
+*/
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	var (
+		err      error
+		argument uint64
+	)
+
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("cbor data is nested too deeply")
+	}
+
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22, 23:
+			return nil, data[1:], nil
+		default:
+			return nil, nil, fmt.Errorf("unsupported cbor simple value %d", info)
+		}
+	}
+
+	if argument, data, err = readCBORArgument(info, data[1:]); err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, nil, fmt.Errorf("cbor integer is too large")
+		}
+
+		return int64(argument), data, nil
+
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, nil, fmt.Errorf("cbor integer is too large")
+		}
+
+		return -1 - int64(argument), data, nil
+
+	case 2, 3:
+		if argument > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+
+		value := data[:argument]
+
+		if major == 3 {
+			return string(value), data[argument:], nil
+		}
+
+		return append([]byte{}, value...), data[argument:], nil
+
+	case 4:
+		if argument > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+
+		result := make([]any, 0, argument)
+
+		for range argument {
+			var item any
+
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+
+			result = append(result, item)
+		}
+
+		return result, data, nil
+
+	case 5:
+		if argument > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+
+		result := make(map[any]any, argument)
+
+		for range argument {
+			var key, value any
+
+			if key, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("unsupported cbor map key type %T", key)
+			}
+
+			if value, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+
+			result[key] = value
+		}
+
+		return result, data, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported cbor major type %d", major)
+}
+
+/*
+readCBORArgument reads the number that follows an item's initial byte.
+Indefinite lengths aren't supported, since authenticators don't use them.
+*/
+func readCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	case info > 27:
+		return 0, nil, fmt.Errorf("unsupported cbor length %d", info)
+	}
+
+	return 0, nil, errCBORTruncated
+}
@@ -0,0 +1,207 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     any
+		wantRest string
+	}{
+		{name: "small integer", data: "17", want: int64(23)},
+		{name: "one byte integer", data: "1818", want: int64(24)},
+		{name: "two byte integer", data: "1903e8", want: int64(1000)},
+		{name: "four byte integer", data: "1a000f4240", want: int64(1000000)},
+		{name: "eight byte integer", data: "1b000000e8d4a51000", want: int64(1000000000000)},
+		{name: "negative integer", data: "20", want: int64(-1)},
+		{name: "one byte negative integer", data: "3863", want: int64(-100)},
+		{name: "two byte negative integer", data: "390100", want: int64(-257)},
+		{name: "byte string", data: "4401020304", want: []byte{1, 2, 3, 4}},
+		{name: "empty byte string", data: "40", want: []byte{}},
+		{name: "text string", data: "6449455446", want: "IETF"},
+		{name: "array", data: "83010203", want: []any{int64(1), int64(2), int64(3)}},
+		{name: "nested array", data: "8201820203", want: []any{int64(1), []any{int64(2), int64(3)}}},
+		{name: "map with integer keys", data: "a201020304", want: map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{name: "map with text keys", data: "a26161016162820203", want: map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{name: "false", data: "f4", want: false},
+		{name: "true", data: "f5", want: true},
+		{name: "null", data: "f6", want: nil},
+		{name: "trailing data is returned", data: "0102", want: int64(1), wantRest: "02"},
+		{name: "trailing data after a map", data: "a10102ff", want: map[any]any{int64(1): int64(2)}, wantRest: "ff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := decodeCBOR(mustHex(t, tt.data))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+
+			if hex.EncodeToString(rest) != tt.wantRest {
+				t.Errorf("expected rest %q, got %x", tt.wantRest, rest)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantError string
+	}{
+		{name: "empty", data: "", wantError: "truncated"},
+		{name: "truncated argument", data: "1903", wantError: "truncated"},
+		{name: "truncated byte string", data: "4401", wantError: "truncated"},
+		{name: "truncated text string", data: "6449", wantError: "truncated"},
+		{name: "array missing items", data: "830102", wantError: "truncated"},
+		{name: "array claiming more items than bytes", data: "9affffffff", wantError: "truncated"},
+		{name: "map claiming more pairs than bytes", data: "baffffffff", wantError: "truncated"},
+		{name: "map missing a value", data: "a101", wantError: "truncated"},
+		{name: "integer too large", data: "1bffffffffffffffff", wantError: "too large"},
+		{name: "negative integer too large", data: "3bffffffffffffffff", wantError: "too large"},
+		{name: "indefinite length", data: "9f01ff", wantError: "unsupported cbor length"},
+		{name: "reserved length", data: "1c", wantError: "unsupported cbor length"},
+		{name: "byte string map key", data: "a14101f5", wantError: "unsupported cbor map key"},
+		{name: "array map key", data: "a18001f5", wantError: "unsupported cbor map key"},
+		{name: "tag", data: "c001", wantError: "unsupported cbor major type 6"},
+		{name: "float", data: "f93c00", wantError: "unsupported cbor simple value"},
+		{name: "undefined simple value", data: "f0", wantError: "unsupported cbor simple value"},
+		{name: "nested too deeply", data: strings.Repeat("81", maxCBORDepth+2) + "00", wantError: "nested too deeply"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := decodeCBOR(mustHex(t, tt.data))
+
+			if err == nil {
+				t.Fatalf("expected an error, got %#v", got)
+			}
+
+			if !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func mustHex(t *testing.T, value string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(value)
+
+	if err != nil {
+		t.Fatalf("bad test data %q: %v", value, err)
+	}
+
+	return b
+}
+
+/*
+encodeCBOR encodes test data with the same subset of CBOR decodeCBOR
+reads. Maps are cborMap so their keys stay in order.
+*/
+func encodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+
+		return cborHead(0, uint64(v))
+
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+
+	case []any:
+		result := cborHead(4, uint64(len(v)))
+
+		for _, item := range v {
+			result = append(result, encodeCBOR(item)...)
+		}
+
+		return result
+
+	case cborMap:
+		result := cborHead(5, uint64(len(v)))
+
+		for _, pair := range v {
+			result = append(result, encodeCBOR(pair.key)...)
+			result = append(result, encodeCBOR(pair.value)...)
+		}
+
+		return result
+
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+
+		return []byte{0xf4}
+
+	case nil:
+		return []byte{0xf6}
+	}
+
+	panic("encodeCBOR: unsupported type")
+}
+
+type cborPair struct {
+	key   any
+	value any
+}
+
+type cborMap []cborPair
+
+func cborHead(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument <= 0xffff:
+		return []byte{major<<5 | 25, byte(argument >> 8), byte(argument)}
+	}
+
+	return []byte{major<<5 | 26, byte(argument >> 24), byte(argument >> 16), byte(argument >> 8), byte(argument)}
+}
+
+func TestEncodeCBORRoundTrip(t *testing.T) {
+	value := cborMap{
+		{key: 1, value: 2},
+		{key: -1, value: []byte{1, 2, 3}},
+		{key: "fmt", value: "none"},
+		{key: "list", value: []any{300, -300, true, nil}},
+	}
+
+	got, rest, err := decodeCBOR(encodeCBOR(value))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[any]any{
+		int64(1):  int64(2),
+		int64(-1): []byte{1, 2, 3},
+		"fmt":     "none",
+		"list":    []any{int64(300), int64(-300), true, nil},
+	}
+
+	if !reflect.DeepEqual(got, want) || len(rest) != 0 {
+		t.Errorf("expected %#v with no rest, got %#v and %x", want, got, rest)
+	}
+}
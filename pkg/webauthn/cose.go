@@ -0,0 +1,156 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+/*
+COSE algorithm identifiers for the keys we accept. Together they cover
+platform authenticators and security keys.
+*/
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+const (
+	coseKeyType      = 1
+	coseKeyAlgorithm = 3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+/*
+coseKey is a credential public key and the algorithm it signs with.
+*/
+type coseKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+/*
+parseCOSEKey reads a COSE encoded public key, as stored when a passkey is
+registered.
+*/
+func parseCOSEKey(data []byte) (*coseKey, error) {
+	var (
+		err     error
+		decoded any
+		rest    []byte
+	)
+
+	if decoded, rest, err = decodeCBOR(data); err != nil {
+		return nil, fmt.Errorf("error decoding public key: %w", err)
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("public key has trailing data")
+	}
+
+	fields, ok := decoded.(map[any]any)
+
+	if !ok {
+		return nil, fmt.Errorf("public key is not a map")
+	}
+
+	keyType, _ := fields[int64(coseKeyType)].(int64)
+	algorithm, _ := fields[int64(coseKeyAlgorithm)].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == AlgES256:
+		curve, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+		y, _ := fields[int64(-3)].([]byte)
+
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("unsupported EC2 public key")
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+
+		if _, err = key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC2 public key: %w", err)
+		}
+
+		return &coseKey{algorithm: algorithm, key: key}, nil
+
+	case keyType == coseKeyTypeRSA && algorithm == AlgRS256:
+		n, _ := fields[int64(-1)].([]byte)
+		e, _ := fields[int64(-2)].([]byte)
+
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("unsupported RSA public key")
+		}
+
+		return &coseKey{
+			algorithm: algorithm,
+			key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			},
+		}, nil
+
+	case keyType == coseKeyTypeOKP && algorithm == AlgEdDSA:
+		curve, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported OKP public key")
+		}
+
+		return &coseKey{algorithm: algorithm, key: ed25519.PublicKey(x)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", keyType, algorithm)
+}
+
+/*
+verify checks a signature made by the key's authenticator.
+*/
+func (k *coseKey) verify(data, signature []byte) error {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+
+		return nil
+
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, signature) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	return ErrInvalidSignature
+}
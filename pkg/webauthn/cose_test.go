@@ -0,0 +1,298 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParseCOSEKey(t *testing.T) {
+	ecKey := newES256Key(t)
+	edKey := newEdDSAKey(t)
+	rsaKey := newRS256Key(t)
+
+	tests := []struct {
+		name          string
+		data          []byte
+		wantAlgorithm int64
+	}{
+		{name: "ES256", data: ecKey.cose(), wantAlgorithm: AlgES256},
+		{name: "EdDSA", data: edKey.cose(), wantAlgorithm: AlgEdDSA},
+		{name: "RS256", data: rsaKey.cose(), wantAlgorithm: AlgRS256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseCOSEKey(tt.data)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if key.algorithm != tt.wantAlgorithm {
+				t.Errorf("expected algorithm %d, got %d", tt.wantAlgorithm, key.algorithm)
+			}
+		})
+	}
+}
+
+func TestParseCOSEKeyErrors(t *testing.T) {
+	ecKey := newES256Key(t)
+	x, y := ecKey.coordinates()
+
+	offCurve := append([]byte{}, y...)
+	offCurve[31] ^= 0x01
+
+	edKey := newEdDSAKey(t)
+
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+
+	if err != nil {
+		t.Fatalf("error generating RSA key: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantError string
+	}{
+		{
+			name:      "not CBOR",
+			data:      []byte{0xff},
+			wantError: "error decoding public key",
+		},
+		{
+			name:      "trailing data",
+			data:      append(ecKey.cose(), 0x00),
+			wantError: "trailing data",
+		},
+		{
+			name:      "not a map",
+			data:      encodeCBOR([]any{2, AlgES256}),
+			wantError: "not a map",
+		},
+		{
+			name:      "unsupported algorithm",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, -35}, {-1, coseCurveP256}, {-2, x}, {-3, y}}),
+			wantError: "unsupported public key type 2 with algorithm -35",
+		},
+		{
+			name:      "algorithm for another key type",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeOKP}, {3, AlgES256}, {-1, coseCurveEd25519}, {-2, []byte(edKey.public)}}),
+			wantError: "unsupported public key type 1",
+		},
+		{
+			name:      "EC2 on another curve",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, AlgES256}, {-1, 2}, {-2, x}, {-3, y}}),
+			wantError: "unsupported EC2 public key",
+		},
+		{
+			name:      "EC2 with a short coordinate",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, AlgES256}, {-1, coseCurveP256}, {-2, x[1:]}, {-3, y}}),
+			wantError: "unsupported EC2 public key",
+		},
+		{
+			name:      "EC2 missing a coordinate",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, AlgES256}, {-1, coseCurveP256}, {-2, x}}),
+			wantError: "unsupported EC2 public key",
+		},
+		{
+			name:      "EC2 point not on the curve",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, AlgES256}, {-1, coseCurveP256}, {-2, x}, {-3, offCurve}}),
+			wantError: "invalid EC2 public key",
+		},
+		{
+			name:      "EC2 coordinate as text",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, AlgES256}, {-1, coseCurveP256}, {-2, string(x)}, {-3, y}}),
+			wantError: "unsupported EC2 public key",
+		},
+		{
+			name:      "OKP on another curve",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeOKP}, {3, AlgEdDSA}, {-1, 7}, {-2, []byte(edKey.public)}}),
+			wantError: "unsupported OKP public key",
+		},
+		{
+			name:      "OKP with a short key",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeOKP}, {3, AlgEdDSA}, {-1, coseCurveEd25519}, {-2, []byte(edKey.public[1:])}}),
+			wantError: "unsupported OKP public key",
+		},
+		{
+			name:      "RSA key too small",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeRSA}, {3, AlgRS256}, {-1, smallRSA.N.Bytes()}, {-2, big.NewInt(int64(smallRSA.E)).Bytes()}}),
+			wantError: "unsupported RSA public key",
+		},
+		{
+			name:      "RSA exponent too long",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeRSA}, {3, AlgRS256}, {-1, newRS256Key(t).private.N.Bytes()}, {-2, []byte{1, 0, 0, 0, 1}}}),
+			wantError: "unsupported RSA public key",
+		},
+		{
+			name:      "RSA missing exponent",
+			data:      encodeCBOR(cborMap{{1, coseKeyTypeRSA}, {3, AlgRS256}, {-1, newRS256Key(t).private.N.Bytes()}}),
+			wantError: "unsupported RSA public key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseCOSEKey(tt.data)
+
+			if err == nil {
+				t.Fatalf("expected an error, got %+v", key)
+			}
+
+			if !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestCOSEKeyVerify(t *testing.T) {
+	keys := []testKey{newES256Key(t), newEdDSAKey(t), newRS256Key(t)}
+	data := []byte("signed data")
+
+	for i, signer := range keys {
+		key, err := parseCOSEKey(signer.cose())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err = key.verify(data, signer.sign(t, data)); err != nil {
+			t.Errorf("%T: expected the signature to verify, got %v", signer, err)
+		}
+
+		if err = key.verify([]byte("other data"), signer.sign(t, data)); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%T: expected ErrInvalidSignature for other data, got %v", signer, err)
+		}
+
+		for j, other := range keys {
+			if i == j {
+				continue
+			}
+
+			if err = key.verify(data, other.sign(t, data)); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%T: expected ErrInvalidSignature for a %T signature, got %v", signer, other, err)
+			}
+		}
+	}
+}
+
+/*
+Test keys stand in for an authenticator. Each can sign and give its public
+key COSE encoded, as an authenticator would.
+*/
+
+type testKey interface {
+	cose() []byte
+	sign(t *testing.T, data []byte) []byte
+}
+
+type es256Key struct {
+	private *ecdsa.PrivateKey
+}
+
+func newES256Key(t *testing.T) es256Key {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("error generating EC key: %v", err)
+	}
+
+	return es256Key{private: key}
+}
+
+func (k es256Key) coordinates() ([]byte, []byte) {
+	return k.private.X.FillBytes(make([]byte, 32)), k.private.Y.FillBytes(make([]byte, 32))
+}
+
+func (k es256Key) cose() []byte {
+	x, y := k.coordinates()
+	return encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, AlgES256}, {-1, coseCurveP256}, {-2, x}, {-3, y}})
+}
+
+func (k es256Key) sign(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	digest := sha256Sum(data)
+	signature, err := ecdsa.SignASN1(rand.Reader, k.private, digest)
+
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+
+	return signature
+}
+
+type eddsaKey struct {
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+func newEdDSAKey(t *testing.T) eddsaKey {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatalf("error generating Ed25519 key: %v", err)
+	}
+
+	return eddsaKey{public: public, private: private}
+}
+
+func (k eddsaKey) cose() []byte {
+	return encodeCBOR(cborMap{{1, coseKeyTypeOKP}, {3, AlgEdDSA}, {-1, coseCurveEd25519}, {-2, []byte(k.public)}})
+}
+
+func (k eddsaKey) sign(t *testing.T, data []byte) []byte {
+	return ed25519.Sign(k.private, data)
+}
+
+type rs256Key struct {
+	private *rsa.PrivateKey
+}
+
+func newRS256Key(t *testing.T) rs256Key {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatalf("error generating RSA key: %v", err)
+	}
+
+	return rs256Key{private: key}
+}
+
+func (k rs256Key) cose() []byte {
+	return encodeCBOR(cborMap{{1, coseKeyTypeRSA}, {3, AlgRS256}, {-1, k.private.N.Bytes()}, {-2, big.NewInt(int64(k.private.E)).Bytes()}})
+}
+
+func (k rs256Key) sign(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, sha256Sum(data))
+
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+
+	return signature
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,394 @@
+/*
+Package webauthn registers passkeys and checks passkey sign ins. Only what
+a small site needs is supported: attestation isn't verified, so any
+authenticator is accepted, and keys must use ES256, EdDSA, or RS256.
+*/
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	challengeNumBytes = 32
+
+	/*
+	   Timeout is how long the browser waits for the user to use their
+	   authenticator.
+	*/
+	Timeout = time.Minute * 5
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+
+	authDataMinLength = 37
+)
+
+var (
+	ErrInvalidResponse  = errors.New("invalid webauthn response")
+	ErrInvalidSignature = errors.New("invalid webauthn signature")
+	ErrSignCount        = errors.New("webauthn sign count went backwards")
+)
+
+/*
+RelyingParty is this site, as authenticators see it. Passkeys only work on
+the site they were made for, so ID and Origin must not change once people
+have registered them.
+*/
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+/*
+NewRelyingParty makes a relying party for the site at siteURL, such as
+"https://example.com". The ID is its host name.
+*/
+func NewRelyingParty(name, siteURL string) (RelyingParty, error) {
+	var (
+		err error
+		u   *url.URL
+	)
+
+	if u, err = url.Parse(siteURL); err != nil {
+		return RelyingParty{}, fmt.Errorf("error parsing site address: %w", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return RelyingParty{}, fmt.Errorf("site address %q must include a scheme and host", siteURL)
+	}
+
+	return RelyingParty{
+		ID:     u.Hostname(),
+		Name:   name,
+		Origin: u.Scheme + "://" + u.Host,
+	}, nil
+}
+
+/*
+Credential is what is kept about a registered passkey. PublicKey is COSE
+encoded, as the authenticator sent it.
+*/
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+/*
+User is who a passkey is being made for. ID is the user handle the
+authenticator stores. It shouldn't contain personal information.
+*/
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+/*
+NewChallenge returns a random challenge for one registration or sign in,
+base64url encoded as it appears in the client data.
+*/
+func NewChallenge() (string, error) {
+	b := make([]byte, challengeNumBytes)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating challenge: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+CreationOptions returns the options for navigator.credentials.create.
+Existing credentials are excluded, so the same authenticator isn't
+registered twice.
+*/
+func (rp RelyingParty) CreationOptions(challenge string, user User, existing [][]byte) CreationOptions {
+	exclude := make([]CredentialDescriptor, 0, len(existing))
+
+	for _, id := range existing {
+		exclude = append(exclude, CredentialDescriptor{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(id)})
+	}
+
+	return CreationOptions{
+		Challenge: challenge,
+		RP: RelyingPartyEntity{
+			ID:   rp.ID,
+			Name: rp.Name,
+		},
+		User: UserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(user.ID),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+}
+
+/*
+RequestOptions returns the options for navigator.credentials.get. No
+credentials are listed, so the browser offers whichever passkeys the user
+has for this site.
+*/
+func (rp RelyingParty) RequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}
+}
+
+/*
+VerifyRegistration checks the response to CreationOptions and returns the
+new credential.
+*/
+func (rp RelyingParty) VerifyRegistration(challenge string, response RegistrationResponse) (*Credential, error) {
+	var (
+		err               error
+		clientDataJSON    []byte
+		attestationObject []byte
+		rawID             []byte
+		decoded           any
+		authData          authenticatorData
+	)
+
+	if clientDataJSON, err = decodeBase64URL(response.Response.ClientDataJSON); err == nil {
+		if attestationObject, err = decodeBase64URL(response.Response.AttestationObject); err == nil {
+			rawID, err = decodeBase64URL(response.RawID)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, err.Error())
+	}
+
+	if err = rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	if decoded, _, err = decodeCBOR(attestationObject); err != nil {
+		return nil, fmt.Errorf("%w: error decoding attestation: %s", ErrInvalidResponse, err.Error())
+	}
+
+	attestation, ok := decoded.(map[any]any)
+
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation is not a map", ErrInvalidResponse)
+	}
+
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	if authData, err = rp.parseAuthenticatorData(rawAuthData); err != nil {
+		return nil, err
+	}
+
+	if authData.flags&flagAttestedData == 0 || len(authData.credentialID) == 0 {
+		return nil, fmt.Errorf("%w: no credential in authenticator data", ErrInvalidResponse)
+	}
+
+	if !bytes.Equal(authData.credentialID, rawID) {
+		return nil, fmt.Errorf("%w: credential ID doesn't match", ErrInvalidResponse)
+	}
+
+	if _, err = parseCOSEKey(authData.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, err.Error())
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+/*
+VerifyAssertion checks the response to RequestOptions against the stored
+credential it names, and returns the credential's new sign count. The
+challenge must not have been used before.
+*/
+func (rp RelyingParty) VerifyAssertion(challenge string, credential Credential, response AssertionResponse) (uint32, error) {
+	var (
+		err            error
+		clientDataJSON []byte
+		rawAuthData    []byte
+		signature      []byte
+		authData       authenticatorData
+		key            *coseKey
+	)
+
+	if clientDataJSON, err = decodeBase64URL(response.Response.ClientDataJSON); err == nil {
+		if rawAuthData, err = decodeBase64URL(response.Response.AuthenticatorData); err == nil {
+			signature, err = decodeBase64URL(response.Response.Signature)
+		}
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidResponse, err.Error())
+	}
+
+	if err = rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	if authData, err = rp.parseAuthenticatorData(rawAuthData); err != nil {
+		return 0, err
+	}
+
+	if key, err = parseCOSEKey(credential.PublicKey); err != nil {
+		return 0, fmt.Errorf("error reading stored public key: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+
+	if err = key.verify(signed, signature); err != nil {
+		return 0, err
+	}
+
+	/*
+	 * Authenticators that count signatures always count up. One that
+	 * doesn't may have been cloned. Many passkeys always send 0, so
+	 * nothing is learned from them. Callers must make each challenge
+	 * single use, since that is what stops a response being replayed.
+	 */
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.signCount, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp RelyingParty) verifyClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var (
+		err  error
+		data clientData
+	)
+
+	if err = json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("%w: error parsing client data: %s", ErrInvalidResponse, err.Error())
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: client data is for %q", ErrInvalidResponse, data.Type)
+	}
+
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge doesn't match", ErrInvalidResponse)
+	}
+
+	if data.Origin != rp.Origin || data.CrossOrigin {
+		return fmt.Errorf("%w: unexpected origin %q", ErrInvalidResponse, data.Origin)
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+/*
+parseAuthenticatorData reads authenticator data and checks it is for this
+site, and that the user was present and verified.
+*/
+func (rp RelyingParty) parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	var (
+		err    error
+		result authenticatorData
+		rest   []byte
+	)
+
+	if len(data) < authDataMinLength {
+		return result, fmt.Errorf("%w: authenticator data is too short", ErrInvalidResponse)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+
+	if subtle.ConstantTimeCompare(data[:32], rpIDHash[:]) != 1 {
+		return result, fmt.Errorf("%w: authenticator data is for another site", ErrInvalidResponse)
+	}
+
+	result.flags = data[32]
+	result.signCount = binary.BigEndian.Uint32(data[33:37])
+
+	if result.flags&flagUserPresent == 0 || result.flags&flagUserVerified == 0 {
+		return result, fmt.Errorf("%w: user wasn't verified", ErrInvalidResponse)
+	}
+
+	if result.flags&flagAttestedData == 0 {
+		return result, nil
+	}
+
+	/*
+	 * The AAGUID (16 bytes) and credential ID length come next, then the
+	 * credential ID and its COSE public key.
+	 */
+	attested := data[authDataMinLength:]
+
+	if len(attested) < 18 {
+		return result, fmt.Errorf("%w: attested credential data is too short", ErrInvalidResponse)
+	}
+
+	idLength := int(binary.BigEndian.Uint16(attested[16:18]))
+	attested = attested[18:]
+
+	if len(attested) < idLength {
+		return result, fmt.Errorf("%w: credential ID is truncated", ErrInvalidResponse)
+	}
+
+	result.credentialID = append([]byte{}, attested[:idLength]...)
+	attested = attested[idLength:]
+
+	if _, rest, err = decodeCBOR(attested); err != nil {
+		return result, fmt.Errorf("%w: error decoding public key: %s", ErrInvalidResponse, err.Error())
+	}
+
+	result.publicKey = append([]byte{}, attested[:len(attested)-len(rest)]...)
+	return result, nil
+}
+
+/*
+decodeBase64URL decodes base64url with or without padding, since browsers
+and libraries differ.
+*/
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
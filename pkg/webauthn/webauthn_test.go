@@ -0,0 +1,459 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const (
+	testRPID      = "tracker.example.com"
+	testOrigin    = "https://tracker.example.com"
+	testChallenge = "the-challenge"
+)
+
+var (
+	testRP = RelyingParty{ID: testRPID, Name: "Streaming Tracker", Origin: testOrigin}
+)
+
+func TestNewRelyingParty(t *testing.T) {
+	rp, err := NewRelyingParty("Streaming Tracker", "https://tracker.example.com:8443/some/path")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rp.ID != "tracker.example.com" || rp.Origin != "https://tracker.example.com:8443" {
+		t.Errorf("unexpected relying party %+v", rp)
+	}
+
+	if _, err = NewRelyingParty("Streaming Tracker", "tracker.example.com"); err == nil {
+		t.Errorf("expected an error for an address without a scheme")
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	key := newES256Key(t)
+	credentialID := []byte("credential-1")
+
+	tests := []struct {
+		name      string
+		change    func(r *registration)
+		wantError error
+	}{
+		{
+			name: "valid registration",
+		},
+		{
+			name:      "wrong challenge",
+			change:    func(r *registration) { r.client.Challenge = "another-challenge" },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "client data for signing in",
+			change:    func(r *registration) { r.client.Type = "webauthn.get" },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "another origin",
+			change:    func(r *registration) { r.client.Origin = "https://evil.example.com" },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "another site's authenticator data",
+			change:    func(r *registration) { r.rpID = "evil.example.com" },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "user not verified",
+			change:    func(r *registration) { r.flags = flagUserPresent | flagAttestedData },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "no attested credential",
+			change:    func(r *registration) { r.flags = flagUserPresent | flagUserVerified },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "raw ID doesn't match the credential",
+			change:    func(r *registration) { r.rawID = []byte("credential-2") },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "truncated credential ID",
+			change:    func(r *registration) { r.credentialIDLength = 200 },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "unsupported public key",
+			change:    func(r *registration) { r.publicKey = encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, -35}}) },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "attestation is not a map",
+			change:    func(r *registration) { r.attestationObject = encodeCBOR([]any{"none"}) },
+			wantError: ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRegistration(credentialID, key.cose())
+
+			if tt.change != nil {
+				tt.change(&r)
+			}
+
+			credential, err := testRP.VerifyRegistration(testChallenge, r.response(t))
+
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Fatalf("expected %v, got %v", tt.wantError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !bytes.Equal(credential.ID, credentialID) || !bytes.Equal(credential.PublicKey, key.cose()) || credential.SignCount != 7 {
+				t.Errorf("unexpected credential %+v", credential)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	keys := map[string]testKey{
+		"ES256": newES256Key(t),
+		"EdDSA": newEdDSAKey(t),
+		"RS256": newRS256Key(t),
+	}
+
+	for keyName, key := range keys {
+		t.Run(keyName, func(t *testing.T) {
+			a := newAssertion(5)
+			signCount, err := testRP.VerifyAssertion(testChallenge, Credential{PublicKey: key.cose(), SignCount: 4}, a.response(t, key))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if signCount != 5 {
+				t.Errorf("expected sign count 5, got %d", signCount)
+			}
+		})
+	}
+
+	key := newES256Key(t)
+	otherKey := newES256Key(t)
+
+	tests := []struct {
+		name          string
+		storedCount   uint32
+		change        func(a *assertion)
+		challenge     string
+		noChallenge   bool
+		wantError     error
+		wantSignCount uint32
+	}{
+		{
+			name:          "sign count goes up",
+			storedCount:   4,
+			wantSignCount: 5,
+		},
+		{
+			name:          "authenticator without a counter",
+			change:        func(a *assertion) { a.signCount = 0 },
+			wantSignCount: 0,
+		},
+		{
+			name:        "sign count stays the same",
+			storedCount: 5,
+			wantError:   ErrSignCount,
+		},
+		{
+			name:        "sign count goes back to 0",
+			storedCount: 5,
+			change:      func(a *assertion) { a.signCount = 0 },
+			wantError:   ErrSignCount,
+		},
+		{
+			name:      "wrong challenge",
+			challenge: "another-challenge",
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:        "no challenge",
+			noChallenge: true,
+			change:      func(a *assertion) { a.client.Challenge = "" },
+			wantError:   ErrInvalidResponse,
+		},
+		{
+			name:      "client data for registering",
+			change:    func(a *assertion) { a.client.Type = "webauthn.create" },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "another origin",
+			change:    func(a *assertion) { a.client.Origin = "https://evil.example.com" },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "cross origin",
+			change:    func(a *assertion) { a.client.CrossOrigin = true },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "another site's authenticator data",
+			change:    func(a *assertion) { a.rpID = "evil.example.com" },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "user not present",
+			change:    func(a *assertion) { a.flags = flagUserVerified },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "user not verified",
+			change:    func(a *assertion) { a.flags = flagUserPresent },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "authenticator data too short",
+			change:    func(a *assertion) { a.truncate = true },
+			wantError: ErrInvalidResponse,
+		},
+		{
+			name:      "signed by another key",
+			change:    func(a *assertion) { a.signer = otherKey },
+			wantError: ErrInvalidSignature,
+		},
+		{
+			name:      "authenticator data changed after signing",
+			change:    func(a *assertion) { a.tamper = func(authData []byte) { authData[36]++ } },
+			wantError: ErrInvalidSignature,
+		},
+		{
+			name:      "client data changed after signing",
+			change:    func(a *assertion) { a.changeClientAfterSigning = true },
+			wantError: ErrInvalidSignature,
+		},
+		{
+			name:      "signature isn't base64url",
+			change:    func(a *assertion) { a.badSignatureEncoding = true },
+			wantError: ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAssertion(5)
+
+			if tt.change != nil {
+				tt.change(&a)
+			}
+
+			challenge := testChallenge
+
+			if tt.challenge != "" || tt.noChallenge {
+				challenge = tt.challenge
+			}
+
+			signCount, err := testRP.VerifyAssertion(challenge, Credential{PublicKey: key.cose(), SignCount: tt.storedCount}, a.response(t, key))
+
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Fatalf("expected %v, got %v", tt.wantError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if signCount != tt.wantSignCount {
+				t.Errorf("expected sign count %d, got %d", tt.wantSignCount, signCount)
+			}
+		})
+	}
+}
+
+func TestRegisterThenSignIn(t *testing.T) {
+	key := newEdDSAKey(t)
+	r := newRegistration([]byte("credential-1"), key.cose())
+
+	credential, err := testRP.VerifyRegistration(testChallenge, r.response(t))
+
+	if err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+
+	a := newAssertion(8)
+	response := a.response(t, key)
+
+	if id, _ := response.CredentialID(); !bytes.Equal(id, credential.ID) {
+		t.Fatalf("expected the assertion to name credential %q, got %q", credential.ID, id)
+	}
+
+	if _, err = testRP.VerifyAssertion(testChallenge, *credential, response); err != nil {
+		t.Errorf("unexpected error signing in: %v", err)
+	}
+}
+
+/*
+registration builds a registration response the way an authenticator
+would. Tests change its fields before calling response.
+*/
+type registration struct {
+	client             clientData
+	rpID               string
+	flags              byte
+	credentialID       []byte
+	credentialIDLength int
+	publicKey          []byte
+	rawID              []byte
+	attestationObject  []byte
+}
+
+func newRegistration(credentialID, publicKey []byte) registration {
+	return registration{
+		client:             clientData{Type: "webauthn.create", Challenge: testChallenge, Origin: testOrigin},
+		rpID:               testRPID,
+		flags:              flagUserPresent | flagUserVerified | flagAttestedData,
+		credentialID:       credentialID,
+		credentialIDLength: len(credentialID),
+		publicKey:          publicKey,
+		rawID:              credentialID,
+	}
+}
+
+func (r registration) response(t *testing.T) RegistrationResponse {
+	t.Helper()
+
+	attested := make([]byte, 18)
+	binary.BigEndian.PutUint16(attested[16:], uint16(r.credentialIDLength))
+	attested = append(attested, r.credentialID...)
+	attested = append(attested, r.publicKey...)
+
+	authData := append(newAuthData(r.rpID, r.flags, 7), attested...)
+
+	attestationObject := r.attestationObject
+
+	if attestationObject == nil {
+		attestationObject = encodeCBOR(cborMap{
+			{"fmt", "none"},
+			{"attStmt", cborMap{}},
+			{"authData", authData},
+		})
+	}
+
+	var response RegistrationResponse
+
+	response.ID = base64.RawURLEncoding.EncodeToString(r.rawID)
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(mustJSON(t, r.client))
+	response.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(attestationObject)
+
+	return response
+}
+
+/*
+assertion builds a sign in response the way an authenticator would. Tests
+change its fields before calling response.
+*/
+type assertion struct {
+	client                   clientData
+	rpID                     string
+	flags                    byte
+	signCount                uint32
+	signer                   testKey
+	truncate                 bool
+	tamper                   func(authData []byte)
+	changeClientAfterSigning bool
+	badSignatureEncoding     bool
+}
+
+func newAssertion(signCount uint32) assertion {
+	return assertion{
+		client:    clientData{Type: "webauthn.get", Challenge: testChallenge, Origin: testOrigin},
+		rpID:      testRPID,
+		flags:     flagUserPresent | flagUserVerified,
+		signCount: signCount,
+	}
+}
+
+func (a assertion) response(t *testing.T, key testKey) AssertionResponse {
+	t.Helper()
+
+	signer := key
+
+	if a.signer != nil {
+		signer = a.signer
+	}
+
+	clientDataJSON := mustJSON(t, a.client)
+	authData := newAuthData(a.rpID, a.flags, a.signCount)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signature := signer.sign(t, append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	if a.tamper != nil {
+		a.tamper(authData)
+	}
+
+	if a.truncate {
+		authData = authData[:authDataMinLength-1]
+	}
+
+	/*
+	 * Trailing space still parses the same, but changes the hash that was
+	 * signed.
+	 */
+	if a.changeClientAfterSigning {
+		clientDataJSON = append(clientDataJSON, ' ')
+	}
+
+	var response AssertionResponse
+
+	response.ID = base64.RawURLEncoding.EncodeToString([]byte("credential-1"))
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(clientDataJSON)
+	response.Response.AuthenticatorData = base64.RawURLEncoding.EncodeToString(authData)
+	response.Response.Signature = base64.RawURLEncoding.EncodeToString(signature)
+
+	if a.badSignatureEncoding {
+		response.Response.Signature = "not base64url!"
+	}
+
+	return response
+}
+
+func newAuthData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, flags)
+
+	return binary.BigEndian.AppendUint32(authData, signCount)
+}
+
+func mustJSON(t *testing.T, value any) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(value)
+
+	if err != nil {
+		t.Fatalf("error encoding JSON: %v", err)
+	}
+
+	return b
+}